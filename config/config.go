@@ -27,6 +27,38 @@ type RedisConfig struct {
 	DB       int
 }
 
+// UploadPolicyConfig 上传策略默认值，管理员可在运行时通过/admin/upload_policy修改
+type UploadPolicyConfig struct {
+	AllowExts        []string
+	DenyExts         []string
+	AllowMimes       []string
+	DenyMimes        []string
+	UserMaxFileSize  int64 // 普通用户单个文件大小上限 (MB)
+	VIPMaxFileSize   int64 // VIP用户单个文件大小上限 (MB)
+	AdminMaxFileSize int64 // 管理员单个文件大小上限 (MB)
+	MaxFileCount     int64 // 每个用户最多文件数
+	DailyUploadLimit int64 // 每个用户每天上传总量 (MB)
+}
+
+// ShareConfig 分享访问相关配置
+type ShareConfig struct {
+	AccessTokenTTL      int    // 分享访问令牌有效期 (分钟)
+	AnonLimitedSpeed    int64  // 未登录用户下载分享文件的速度限额 (MB)
+	AnonRateLimit       int64  // 未登录用户每个IP每分钟最多下载分享文件次数
+	StatsFlushInterval  int    // 分享统计写回数据库的间隔 (秒)
+	PasswordMaxAttempts int64  // 每个IP连续输错分享密码多少次后锁定
+	LockoutBase         int    // 首次锁定时长 (秒)，之后每次失败翻倍
+	EnumMaxMisses       int64  // 每个IP访问不存在的分享多少次后锁定
+	PublicBaseURL       string // 分享链接、短链接与二维码使用的公开地址，如https://pan.example.com，为空时使用请求的地址
+}
+
+// SecurityConfig 账号安全相关配置
+type SecurityConfig struct {
+	RequireAdmin2FA          bool // 管理员是否必须开启两步验证，管理员可在运行时通过/admin/security_policy修改
+	SessionTTL               int  // 登录会话有效期 (小时)，每次刷新令牌顺延，期间没有刷新过的会话需要重新登录
+	RequireEmailVerification bool // 注册时是否必须提交邮箱验证凭证，开启后不能通过/user/update直接修改邮箱
+}
+
 type MinIOConfig struct {
 	MinIORootName   string
 	MinIOPassword   string
@@ -49,9 +81,23 @@ type Config struct {
 	CloudFileDir         string
 	AvatarDIR            string
 	DefaultAvatarPath    string
-	MaxFileSize          int64 // 单个文件大小限制 (GB)
-	NormalUserMaxStorage int64 // 非VIP用户存储空间限制 (GB)
-	LimitedSpeed         int64 // 非VIP用户下载速度限额 (MB) - 0 为不限速
+	MaxFileSize          int64  // 单个文件大小限制 (GB)
+	NormalUserMaxStorage int64  // 非VIP用户存储空间限制 (GB)
+	LimitedSpeed         int64  // 非VIP用户下载速度限额 (MB) - 0 为不限速
+	PreviewMaxSize       int64  // 文本类文件在线预览大小上限 (MB)
+	TusExpireHours       int    // tus上传会话过期时间 (小时)
+	ScannerAddr          string // 上传内容扫描服务(clamd)地址，为空时不扫描
+	ScannerTimeout       int    // 单个文件扫描超时 (秒)
+	MimeMismatchPolicy   string // 文件内容与扩展名不一致时的处理策略 reject/rename/flag
+	UploadPolicy         UploadPolicyConfig
+	OfflineWorkers       int // 离线下载并发数
+	OfflineTimeout       int // 单个离线下载任务超时 (分钟)
+
+	// Share
+	Share ShareConfig
+
+	// Security
+	Security SecurityConfig
 
 	// mysql
 	DSN string
@@ -66,8 +112,9 @@ type Config struct {
 	Email EmailConfig
 
 	//http
-	Host string
-	Port int
+	Host           string
+	Port           int
+	TrustedProxies []string // 可信反向代理的IP或CIDR，仅来自这些地址的请求才读取X-Forwarded-For/X-Real-IP，为空时不信任任何代理
 }
 
 func InitConfigByViper() *Config {
@@ -111,6 +158,13 @@ func InitConfigByViper() *Config {
 		MaxFileSize:          viper.GetInt64("app.file.max_file_size"),           // 25 GB
 		NormalUserMaxStorage: viper.GetInt64("app.file.normal_user_max_storage"), //100 GB
 		LimitedSpeed:         viper.GetInt64("app.file.limited_speed"),           // 10 MB/s
+		PreviewMaxSize:       viper.GetInt64("app.file.preview_max_size"),        // 2 MB
+		TusExpireHours:       viper.GetInt("app.file.tus_expire_hours"),          // 24 h
+		ScannerAddr:          viper.GetString("app.file.scanner_addr"),
+		ScannerTimeout:       viper.GetInt("app.file.scanner_timeout"),         // 60 s
+		MimeMismatchPolicy:   viper.GetString("app.file.mime_mismatch_policy"), // flag
+		OfflineWorkers:       viper.GetInt("app.file.offline_workers"),         // 3
+		OfflineTimeout:       viper.GetInt("app.file.offline_timeout"),         // 60 min
 		DSN:                  viper.GetString("database.mysql.dsn"),
 		Redis: RedisConfig{
 			Addr:     viper.GetString("database.redis.addr"),
@@ -123,6 +177,32 @@ func InitConfigByViper() *Config {
 			MinIOEndpoint:   viper.GetString("minio.endpoint"),
 			MinIOBucketName: viper.GetString("minio.bucket_name"),
 		},
+		UploadPolicy: UploadPolicyConfig{
+			AllowExts:        splitList(viper.GetString("app.file.upload_policy.allow_exts")),
+			DenyExts:         splitList(viper.GetString("app.file.upload_policy.deny_exts")),
+			AllowMimes:       splitList(viper.GetString("app.file.upload_policy.allow_mimes")),
+			DenyMimes:        splitList(viper.GetString("app.file.upload_policy.deny_mimes")),
+			UserMaxFileSize:  viper.GetInt64("app.file.upload_policy.user_max_file_size"),
+			VIPMaxFileSize:   viper.GetInt64("app.file.upload_policy.vip_max_file_size"),
+			AdminMaxFileSize: viper.GetInt64("app.file.upload_policy.admin_max_file_size"),
+			MaxFileCount:     viper.GetInt64("app.file.upload_policy.max_file_count"),
+			DailyUploadLimit: viper.GetInt64("app.file.upload_policy.daily_upload_limit"),
+		},
+		Share: ShareConfig{
+			AccessTokenTTL:      viper.GetInt("app.share.access_token_ttl"),        // 30 min
+			AnonLimitedSpeed:    viper.GetInt64("app.share.anon_limited_speed"),    // 2 MB/s
+			AnonRateLimit:       viper.GetInt64("app.share.anon_rate_limit"),       // 10 次/分钟
+			StatsFlushInterval:  viper.GetInt("app.share.stats_flush_interval"),    // 60 s
+			PasswordMaxAttempts: viper.GetInt64("app.share.password_max_attempts"), // 5 次
+			LockoutBase:         viper.GetInt("app.share.lockout_base"),            // 60 s
+			EnumMaxMisses:       viper.GetInt64("app.share.enum_max_misses"),       // 20 次
+			PublicBaseURL:       viper.GetString("app.share.public_base_url"),
+		},
+		Security: SecurityConfig{
+			RequireAdmin2FA:          viper.GetBool("app.security.require_admin_2fa"),          // false
+			SessionTTL:               viper.GetInt("app.security.session_ttl"),                 // 168 h
+			RequireEmailVerification: viper.GetBool("app.security.require_email_verification"), // false
+		},
 		Email: EmailConfig{
 			SMTPHost:  viper.GetString("email.SMTP_host"),
 			SMTPPort:  viper.GetInt("email.SMTP_port"),
@@ -131,9 +211,21 @@ func InitConfigByViper() *Config {
 			FromName:  viper.GetString("email.from_name"),
 			FromEmail: viper.GetString("email.from_email"),
 		},
-		Host: viper.GetString("app.http.host"),
-		Port: viper.GetInt("app.http.port"),
+		Host:           viper.GetString("app.http.host"),
+		Port:           viper.GetInt("app.http.port"),
+		TrustedProxies: splitList(viper.GetString("app.http.trusted_proxies")),
+	}
+}
+
+// splitList 解析逗号分隔的列表，如 "jpg, png" -> ["jpg", "png"]
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
+	return list
 }
 
 func WatchConfig() {
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 每日上传总量
+// upload:daily:<userID>:<yyyymmdd>  HASH  field=预留ID value=字节数
+// 按预留ID记录，上传失败或取消时可以准确退回；成功的上传保留到当天结束
+
+// dailyReserveScript 当天已用 + 本次 <= 上限时写入，同一预留ID重复写入时覆盖
+var dailyReserveScript = redis.NewScript(`
+local used = 0
+for _, v in ipairs(redis.call('HVALS', KEYS[1])) do
+	used = used + tonumber(v)
+end
+local old = redis.call('HGET', KEYS[1], ARGV[1])
+if old then
+	used = used - tonumber(old)
+end
+if used + tonumber(ARGV[2]) > tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+var dailyUsedScript = redis.NewScript(`
+local used = 0
+for _, v in ipairs(redis.call('HVALS', KEYS[1])) do
+	used = used + tonumber(v)
+end
+return used
+`)
+
+// 保留两天，跨天完成的上传仍能退回
+const dailyUploadTTL = 48 * time.Hour
+
+type dailyUploadCache struct {
+	cache *RedisClient
+}
+
+func NewDailyUploadCache(cache *RedisClient) DailyUploadCache {
+	return &dailyUploadCache{
+		cache: cache,
+	}
+}
+
+func dailyUploadKey(userID int, day time.Time) string {
+	return fmt.Sprintf("upload:daily:%d:%s", userID, day.Format("20060102"))
+}
+
+func (c *dailyUploadCache) Reserve(ctx context.Context, userID int, reservationID string, size, limit int64) (bool, error) {
+	ok, err := dailyReserveScript.Run(ctx, c.cache.client, []string{dailyUploadKey(userID, time.Now())},
+		reservationID, size, limit, dailyUploadTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("记录每日上传量失败: %v", err)
+	}
+	return ok == 1, nil
+}
+
+// Release 会话最长跨越一天，同时从当天与前一天的记录中删除
+func (c *dailyUploadCache) Release(ctx context.Context, userID int, reservationID string) error {
+	now := time.Now()
+	pipe := c.cache.client.TxPipeline()
+	pipe.HDel(ctx, dailyUploadKey(userID, now), reservationID)
+	pipe.HDel(ctx, dailyUploadKey(userID, now.AddDate(0, 0, -1)), reservationID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *dailyUploadCache) Used(ctx context.Context, userID int) (int64, error) {
+	return dailyUsedScript.Run(ctx, c.cache.client, []string{dailyUploadKey(userID, time.Now())}).Int64()
+}
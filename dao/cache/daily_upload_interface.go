@@ -0,0 +1,13 @@
+package cache
+
+import (
+	"context"
+)
+
+type DailyUploadCache interface {
+	// Reserve 当天上传总量 + size 不超过limit时记入当天用量
+	Reserve(ctx context.Context, userID int, reservationID string, size, limit int64) (bool, error)
+	// Release 上传失败或取消时退回用量
+	Release(ctx context.Context, userID int, reservationID string) error
+	Used(ctx context.Context, userID int) (int64, error)
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 邮箱验证
+// email:proof:<token_hash>   STRING  验证码校验通过后签发的邮箱验证凭证对应的邮箱
+// email:change:<user_id>     STRING  申请修改、尚未确认的新邮箱
+
+type emailCache struct {
+	cache *RedisClient
+}
+
+func NewEmailCache(cache *RedisClient) EmailCache {
+	return &emailCache{
+		cache: cache,
+	}
+}
+
+func emailProofKey(tokenHash string) string {
+	return fmt.Sprintf("email:proof:%s", tokenHash)
+}
+
+func emailChangeKey(userID int) string {
+	return fmt.Sprintf("email:change:%d", userID)
+}
+
+func (c *emailCache) SaveProof(ctx context.Context, tokenHash, email string, ttl time.Duration) error {
+	if err := c.cache.client.Set(ctx, emailProofKey(tokenHash), email, ttl).Err(); err != nil {
+		return fmt.Errorf("保存邮箱验证凭证失败: %v", err)
+	}
+	return nil
+}
+
+func (c *emailCache) GetProof(ctx context.Context, tokenHash string) (string, error) {
+	email, err := c.cache.client.Get(ctx, emailProofKey(tokenHash)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return "", fmt.Errorf("获取邮箱验证凭证失败: %v", err)
+	}
+	return email, nil
+}
+
+func (c *emailCache) DeleteProof(ctx context.Context, tokenHash string) error {
+	if err := c.cache.client.Del(ctx, emailProofKey(tokenHash)).Err(); err != nil {
+		return fmt.Errorf("删除邮箱验证凭证失败: %v", err)
+	}
+	return nil
+}
+
+func (c *emailCache) SavePendingChange(ctx context.Context, userID int, email string, ttl time.Duration) error {
+	if err := c.cache.client.Set(ctx, emailChangeKey(userID), email, ttl).Err(); err != nil {
+		return fmt.Errorf("保存待确认邮箱失败: %v", err)
+	}
+	return nil
+}
+
+func (c *emailCache) GetPendingChange(ctx context.Context, userID int) (string, error) {
+	email, err := c.cache.client.Get(ctx, emailChangeKey(userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return "", fmt.Errorf("获取待确认邮箱失败: %v", err)
+	}
+	return email, nil
+}
+
+func (c *emailCache) DeletePendingChange(ctx context.Context, userID int) error {
+	if err := c.cache.client.Del(ctx, emailChangeKey(userID)).Err(); err != nil {
+		return fmt.Errorf("删除待确认邮箱失败: %v", err)
+	}
+	return nil
+}
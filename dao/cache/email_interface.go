@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type EmailCache interface {
+	// SaveProof 保存邮箱验证凭证(SHA-256摘要)对应的邮箱，验证码校验通过后签发，注册时提交
+	SaveProof(ctx context.Context, tokenHash, email string, ttl time.Duration) error
+	// GetProof 返回凭证对应的邮箱，不存在或已过期时返回空字符串
+	GetProof(ctx context.Context, tokenHash string) (string, error)
+	DeleteProof(ctx context.Context, tokenHash string) error
+	// SavePendingChange 保存用户申请修改的新邮箱，确认前不写入数据库
+	SavePendingChange(ctx context.Context, userID int, email string, ttl time.Duration) error
+	// GetPendingChange 返回尚未确认的新邮箱，不存在或已过期时返回空字符串
+	GetPendingChange(ctx context.Context, userID int) (string, error)
+	DeletePendingChange(ctx context.Context, userID int) error
+}
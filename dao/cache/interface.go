@@ -15,4 +15,5 @@ type Cache interface {
 	Unlock(key string) error
 	Clean(keys ...string) error
 	Exists(key string) bool
+	SetMax(key string, value int64, expiration time.Duration) error
 }
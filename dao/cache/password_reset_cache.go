@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 找回密码
+// password_reset:<token_hash>   STRING  验证码校验通过后签发的重置令牌对应的用户ID
+
+var consumeResetTokenScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value then
+	redis.call('DEL', KEYS[1])
+end
+return value
+`)
+
+type passwordResetCache struct {
+	cache *RedisClient
+}
+
+func NewPasswordResetCache(cache *RedisClient) PasswordResetCache {
+	return &passwordResetCache{
+		cache: cache,
+	}
+}
+
+func resetTokenKey(tokenHash string) string {
+	return fmt.Sprintf("password_reset:%s", tokenHash)
+}
+
+func (c *passwordResetCache) SaveResetToken(ctx context.Context, tokenHash string, userID int, ttl time.Duration) error {
+	if err := c.cache.client.Set(ctx, resetTokenKey(tokenHash), userID, ttl).Err(); err != nil {
+		return fmt.Errorf("保存重置令牌失败: %v", err)
+	}
+	return nil
+}
+
+func (c *passwordResetCache) ConsumeResetToken(ctx context.Context, tokenHash string) (int, bool, error) {
+	value, err := consumeResetTokenScript.Run(ctx, c.cache.client, []string{resetTokenKey(tokenHash)}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("获取重置令牌失败: %v", err)
+	}
+	userID, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("重置令牌数据无效: %v", err)
+	}
+	return userID, true, nil
+}
@@ -0,0 +1,13 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type PasswordResetCache interface {
+	// SaveResetToken 保存重置令牌(SHA-256摘要)对应的用户
+	SaveResetToken(ctx context.Context, tokenHash string, userID int, ttl time.Duration) error
+	// ConsumeResetToken 取出并删除重置令牌，每个令牌只能使用一次，不存在或已使用时返回false
+	ConsumeResetToken(ctx context.Context, tokenHash string) (userID int, ok bool, err error)
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 存储空间预留
+// quota:reservations:<userID>      ZSET  member=预留ID score=过期时间(毫秒)
+// quota:reservation_size:<userID>  HASH  field=预留ID  value=预留字节数
+
+// reserveScript 清理过期预留后检查 已用 + 已预留 + 本次 <= 上限，通过则写入预留
+// limit < 0 表示不限额；同一预留ID重复预留时覆盖原大小
+var reserveScript = redis.NewScript(`
+local now = tonumber(ARGV[5])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)
+for _, id in ipairs(expired) do
+	redis.call('HDEL', KEYS[2], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+local limit = tonumber(ARGV[4])
+if limit >= 0 then
+	local reserved = 0
+	for _, v in ipairs(redis.call('HVALS', KEYS[2])) do
+		reserved = reserved + tonumber(v)
+	end
+	local old = redis.call('HGET', KEYS[2], ARGV[1])
+	if old then
+		reserved = reserved - tonumber(old)
+	end
+	if tonumber(ARGV[3]) + reserved + tonumber(ARGV[2]) > limit then
+		return 0
+	end
+end
+
+redis.call('ZADD', KEYS[1], ARGV[6], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+return 1
+`)
+
+// reservedScript 清理过期预留后返回预留总量
+var reservedScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)
+for _, id in ipairs(expired) do
+	redis.call('HDEL', KEYS[2], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+local reserved = 0
+for _, v in ipairs(redis.call('HVALS', KEYS[2])) do
+	reserved = reserved + tonumber(v)
+end
+return reserved
+`)
+
+type quotaCache struct {
+	cache *RedisClient
+}
+
+func NewQuotaCache(cache *RedisClient) QuotaCache {
+	return &quotaCache{
+		cache: cache,
+	}
+}
+
+func quotaKeys(userID int) []string {
+	return []string{
+		fmt.Sprintf("quota:reservations:%d", userID),
+		fmt.Sprintf("quota:reservation_size:%d", userID),
+	}
+}
+
+func (c *quotaCache) Reserve(ctx context.Context, userID int, reservationID string, size, used, limit int64, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	ok, err := reserveScript.Run(ctx, c.cache.client, quotaKeys(userID),
+		reservationID, size, used, limit, now.UnixMilli(), now.Add(ttl).UnixMilli()).Int()
+	if err != nil {
+		return false, fmt.Errorf("预留存储空间失败: %v", err)
+	}
+	return ok == 1, nil
+}
+
+// Extend 延长预留有效期，预留不存在时不做处理
+func (c *quotaCache) Extend(ctx context.Context, userID int, reservationID string, ttl time.Duration) error {
+	keys := quotaKeys(userID)
+	return c.cache.client.ZAddXX(ctx, keys[0], redis.Z{
+		Score:  float64(time.Now().Add(ttl).UnixMilli()),
+		Member: reservationID,
+	}).Err()
+}
+
+func (c *quotaCache) Release(ctx context.Context, userID int, reservationID string) error {
+	keys := quotaKeys(userID)
+	pipe := c.cache.client.TxPipeline()
+	pipe.ZRem(ctx, keys[0], reservationID)
+	pipe.HDel(ctx, keys[1], reservationID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *quotaCache) Reserved(ctx context.Context, userID int) (int64, error) {
+	return reservedScript.Run(ctx, c.cache.client, quotaKeys(userID), time.Now().UnixMilli()).Int64()
+}
+
+// Lock 读取已用空间与写入预留之间、提交与释放之间需要互斥
+func (c *quotaCache) Lock(ctx context.Context, userID int) (bool, error) {
+	return c.cache.Lock(fmt.Sprintf("quota:%d", userID), 10*time.Second)
+}
+
+func (c *quotaCache) Unlock(ctx context.Context, userID int) error {
+	return c.cache.Unlock(fmt.Sprintf("quota:%d", userID))
+}
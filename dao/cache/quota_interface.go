@@ -0,0 +1,15 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type QuotaCache interface {
+	Reserve(ctx context.Context, userID int, reservationID string, size, used, limit int64, ttl time.Duration) (bool, error)
+	Extend(ctx context.Context, userID int, reservationID string, ttl time.Duration) error
+	Release(ctx context.Context, userID int, reservationID string) error
+	Reserved(ctx context.Context, userID int) (int64, error)
+	Lock(ctx context.Context, userID int) (bool, error)
+	Unlock(ctx context.Context, userID int) error
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 固定窗口计数
+// ratelimit:<key>  STRING  窗口内的次数，第一次计数时设置过期时间为窗口长度
+// 多实例部署时共享计数，不同于中间件中按进程保存的令牌桶
+
+var rateLimitScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+type rateLimitCache struct {
+	cache *RedisClient
+}
+
+func NewRateLimitCache(cache *RedisClient) RateLimitCache {
+	return &rateLimitCache{
+		cache: cache,
+	}
+}
+
+func (c *rateLimitCache) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	count, err := rateLimitScript.Run(ctx, c.cache.client, []string{"ratelimit:" + key}, window.Milliseconds()).Int64()
+	if err != nil {
+		return false, fmt.Errorf("记录访问次数失败: %v", err)
+	}
+	return count <= limit, nil
+}
@@ -0,0 +1,11 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type RateLimitCache interface {
+	// Allow key在window内的次数未超过limit时记一次并返回true
+	Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error)
+}
@@ -100,6 +100,22 @@ func (rc *RedisClient) Clean(keys ...string) error {
 	return rc.client.Del(rc.ctx, keys...).Err()
 }
 
+// setMaxScript 缓存中没有值或值更小时才写入
+var setMaxScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+local n = cur and tonumber(cur)
+if n and n >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// SetMax 写入只增不减的整数（如令牌版本），并发写入时较旧的值不会覆盖较新的值
+func (rc *RedisClient) SetMax(key string, value int64, expiration time.Duration) error {
+	return setMaxScript.Run(rc.ctx, rc.client, []string{key}, value, expiration.Milliseconds()).Err()
+}
+
 func (rc *RedisClient) Exists(key string) bool {
 	return rc.client.Exists(rc.ctx, key).Val() > 0
 }
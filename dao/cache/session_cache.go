@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 登录会话
+// session:revoked:<session_id>   STRING  已撤销的会话，携带该会话访问令牌的请求直接拒绝
+
+type sessionCache struct {
+	cache *RedisClient
+}
+
+func NewSessionCache(cache *RedisClient) SessionCache {
+	return &sessionCache{
+		cache: cache,
+	}
+}
+
+func revokedSessionKey(sessionID string) string {
+	return fmt.Sprintf("session:revoked:%s", sessionID)
+}
+
+func (c *sessionCache) MarkRevoked(ctx context.Context, sessionIDs []string, ttl time.Duration) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	pipe := c.cache.client.TxPipeline()
+	for _, sessionID := range sessionIDs {
+		pipe.Set(ctx, revokedSessionKey(sessionID), 1, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("标记会话撤销失败: %v", err)
+	}
+	return nil
+}
+
+func (c *sessionCache) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := c.cache.client.Exists(ctx, revokedSessionKey(sessionID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("查询会话状态失败: %v", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,13 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type SessionCache interface {
+	// MarkRevoked 标记会话已撤销，ttl应不短于访问令牌的有效期，过期后访问令牌本身也已失效
+	MarkRevoked(ctx context.Context, sessionIDs []string, ttl time.Duration) error
+	// IsRevoked 会话是否已被撤销
+	IsRevoked(ctx context.Context, sessionID string) (bool, error)
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 分享密码与分享ID的失败计数和锁定
+// share:fail:<key>  STRING  window内的失败次数，第一次失败时设置过期时间为window
+// share:lock:<key>  STRING  锁定标记，过期时间即锁定时长
+// key形如 share:<unique_id>、ip:<ip>、enum:<ip>
+
+var shareFailScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+local threshold = tonumber(ARGV[2])
+if count < threshold then
+	return {count, 0}
+end
+local lock = tonumber(ARGV[3])
+local cap = tonumber(ARGV[4])
+local n = count - threshold
+while n > 0 and lock < cap do
+	lock = lock * 2
+	n = n - 1
+end
+if lock > cap then
+	lock = cap
+end
+redis.call('SET', KEYS[2], count, 'PX', lock)
+return {count, lock}
+`)
+
+type shareGuardCache struct {
+	cache *RedisClient
+}
+
+func NewShareGuardCache(cache *RedisClient) ShareGuardCache {
+	return &shareGuardCache{
+		cache: cache,
+	}
+}
+
+func shareFailKey(key string) string {
+	return "share:fail:" + key
+}
+
+func shareLockKey(key string) string {
+	return "share:lock:" + key
+}
+
+func (c *shareGuardCache) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.cache.client.PTTL(ctx, shareLockKey(key)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("获取锁定状态失败: %v", err)
+	}
+	if ttl <= 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (c *shareGuardCache) Fail(ctx context.Context, key string, threshold int64, window, base, max time.Duration) (int64, time.Duration, error) {
+	res, err := shareFailScript.Run(ctx, c.cache.client, []string{shareFailKey(key), shareLockKey(key)},
+		window.Milliseconds(), threshold, base.Milliseconds(), max.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("记录失败次数失败: %v", err)
+	}
+	return res[0], time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (c *shareGuardCache) Reset(ctx context.Context, key string) error {
+	if err := c.cache.client.Del(ctx, shareFailKey(key), shareLockKey(key)).Err(); err != nil {
+		return fmt.Errorf("清除失败次数失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type ShareGuardCache interface {
+	// LockedFor 返回key剩余的锁定时长，未锁定时为0
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Fail 记一次失败，window内失败次数达到threshold后锁定，锁定时长从base开始每次失败翻倍，不超过max
+	// 返回失败次数与本次设置的锁定时长，未锁定时为0
+	Fail(ctx context.Context, key string, threshold int64, window, base, max time.Duration) (int64, time.Duration, error)
+	// Reset 清除失败次数与锁定
+	Reset(ctx context.Context, key string) error
+}
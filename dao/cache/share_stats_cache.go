@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 分享统计
+// share:stats:pending:<shareID>    HASH   views/downloads 未写回数据库的增量
+// share:stats:downloads:<shareID>  STRING 总下载次数，第一次下载时用数据库中的次数初始化，用于原子地检查下载上限
+// share:stats:visitors:<shareID>   HLL    独立访客
+// share:stats:dirty                SET    有未写回增量的分享ID
+// share:stats:logs                 LIST   未写回的访问记录(JSON)
+
+const (
+	shareStatsDirtyKey = "share:stats:dirty"
+	shareStatsLogsKey  = "share:stats:logs"
+	// 总下载次数的过期时间，期间未写回的增量早已写回，过期后重新用数据库中的次数初始化
+	shareDownloadsTTL = 24 * time.Hour
+)
+
+// shareDownloadScript 总下载次数 < 上限时记一次
+var shareDownloadScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[3])
+local total = tonumber(redis.call('GET', KEYS[1]))
+local limit = tonumber(ARGV[2])
+if limit > 0 and total >= limit then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('HINCRBY', KEYS[2], 'downloads', 1)
+redis.call('SADD', KEYS[3], ARGV[4])
+redis.call('PFADD', KEYS[4], ARGV[5])
+return 1
+`)
+
+// shareDrainScript 取出并删除未写回的增量
+var shareDrainScript = redis.NewScript(`
+local views = tonumber(redis.call('HGET', KEYS[1], 'views') or '0')
+local downloads = tonumber(redis.call('HGET', KEYS[1], 'downloads') or '0')
+redis.call('DEL', KEYS[1])
+return {views, downloads}
+`)
+
+// sharePopLogsScript 取出并删除最早的n条访问记录
+var sharePopLogsScript = redis.NewScript(`
+local logs = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+redis.call('LTRIM', KEYS[1], #logs, -1)
+return logs
+`)
+
+type shareStatsCache struct {
+	cache *RedisClient
+}
+
+func NewShareStatsCache(cache *RedisClient) ShareStatsCache {
+	return &shareStatsCache{
+		cache: cache,
+	}
+}
+
+func sharePendingKey(shareID uint) string {
+	return fmt.Sprintf("share:stats:pending:%d", shareID)
+}
+
+func shareDownloadsKey(shareID uint) string {
+	return fmt.Sprintf("share:stats:downloads:%d", shareID)
+}
+
+func shareVisitorsKey(shareID uint) string {
+	return fmt.Sprintf("share:stats:visitors:%d", shareID)
+}
+
+func (c *shareStatsCache) View(ctx context.Context, shareID uint, visitor string) error {
+	pipe := c.cache.client.TxPipeline()
+	pipe.HIncrBy(ctx, sharePendingKey(shareID), "views", 1)
+	pipe.SAdd(ctx, shareStatsDirtyKey, shareID)
+	pipe.PFAdd(ctx, shareVisitorsKey(shareID), visitor)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("记录分享查看次数失败: %v", err)
+	}
+	return nil
+}
+
+func (c *shareStatsCache) Download(ctx context.Context, shareID uint, base, limit int64, visitor string) (bool, error) {
+	ok, err := shareDownloadScript.Run(ctx, c.cache.client,
+		[]string{shareDownloadsKey(shareID), sharePendingKey(shareID), shareStatsDirtyKey, shareVisitorsKey(shareID)},
+		base, limit, shareDownloadsTTL.Milliseconds(), shareID, visitor).Int()
+	if err != nil {
+		return false, fmt.Errorf("记录分享下载次数失败: %v", err)
+	}
+	return ok == 1, nil
+}
+
+func (c *shareStatsCache) Downloads(ctx context.Context, shareID uint, base int64) (int64, error) {
+	total, err := c.cache.client.Get(ctx, shareDownloadsKey(shareID)).Int64()
+	if err == redis.Nil {
+		return base, nil
+	}
+	return total, err
+}
+
+func (c *shareStatsCache) Pending(ctx context.Context, shareID uint) (int64, int64, error) {
+	values, err := c.cache.client.HMGet(ctx, sharePendingKey(shareID), "views", "downloads").Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	var counts [2]int64
+	for i, v := range values {
+		if str, ok := v.(string); ok {
+			counts[i], _ = strconv.ParseInt(str, 10, 64)
+		}
+	}
+	return counts[0], counts[1], nil
+}
+
+func (c *shareStatsCache) Visitors(ctx context.Context, shareID uint) (int64, error) {
+	return c.cache.client.PFCount(ctx, shareVisitorsKey(shareID)).Result()
+}
+
+func (c *shareStatsCache) Drain(ctx context.Context) (map[uint][2]int64, error) {
+	members, err := c.cache.client.SMembers(ctx, shareStatsDirtyKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make(map[uint][2]int64, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 64)
+		if err != nil {
+			c.cache.client.SRem(ctx, shareStatsDirtyKey, member)
+			continue
+		}
+		shareID := uint(id)
+
+		// 先移出再取增量，期间新的计数会重新加入集合，下次写回
+		if err := c.cache.client.SRem(ctx, shareStatsDirtyKey, member).Err(); err != nil {
+			return deltas, err
+		}
+		counts, err := shareDrainScript.Run(ctx, c.cache.client, []string{sharePendingKey(shareID)}).Int64Slice()
+		if err != nil {
+			return deltas, err
+		}
+		deltas[shareID] = [2]int64{counts[0], counts[1]}
+	}
+	return deltas, nil
+}
+
+func (c *shareStatsCache) Restore(ctx context.Context, shareID uint, views, downloads int64) error {
+	pipe := c.cache.client.TxPipeline()
+	pipe.HIncrBy(ctx, sharePendingKey(shareID), "views", views)
+	pipe.HIncrBy(ctx, sharePendingKey(shareID), "downloads", downloads)
+	pipe.SAdd(ctx, shareStatsDirtyKey, shareID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *shareStatsCache) PushLog(ctx context.Context, log *model.ShareAccessLog) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+	return c.cache.client.RPush(ctx, shareStatsLogsKey, data).Err()
+}
+
+func (c *shareStatsCache) PopLogs(ctx context.Context, n int64) ([]*model.ShareAccessLog, error) {
+	items, err := sharePopLogsScript.Run(ctx, c.cache.client, []string{shareStatsLogsKey}, n).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*model.ShareAccessLog, 0, len(items))
+	for _, item := range items {
+		var log model.ShareAccessLog
+		if err := json.Unmarshal([]byte(item), &log); err != nil {
+			continue
+		}
+		logs = append(logs, &log)
+	}
+	return logs, nil
+}
+
+func (c *shareStatsCache) Clear(ctx context.Context, shareID uint) error {
+	pipe := c.cache.client.TxPipeline()
+	pipe.Del(ctx, sharePendingKey(shareID), shareDownloadsKey(shareID), shareVisitorsKey(shareID))
+	pipe.SRem(ctx, shareStatsDirtyKey, shareID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
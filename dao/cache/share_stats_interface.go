@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type ShareStatsCache interface {
+	// View 记一次查看
+	View(ctx context.Context, shareID uint, visitor string) error
+	// Download 下载次数未达到limit时记一次，base为数据库中已写回的次数；limit为0时不限制
+	Download(ctx context.Context, shareID uint, base, limit int64, visitor string) (bool, error)
+	// Downloads 当前的总下载次数（已写回 + 未写回）
+	Downloads(ctx context.Context, shareID uint, base int64) (int64, error)
+	// Pending 尚未写回数据库的查看、下载次数
+	Pending(ctx context.Context, shareID uint) (int64, int64, error)
+	// Visitors 独立访客数（HyperLogLog估算）
+	Visitors(ctx context.Context, shareID uint) (int64, error)
+	// Drain 取出并清空所有有变化的分享的未写回计数，写回失败时用Restore退回
+	Drain(ctx context.Context) (map[uint][2]int64, error)
+	Restore(ctx context.Context, shareID uint, views, downloads int64) error
+	PushLog(ctx context.Context, log *model.ShareAccessLog) error
+	// PopLogs 取出最多n条访问记录
+	PopLogs(ctx context.Context, n int64) ([]*model.ShareAccessLog, error)
+	// Clear 删除分享时清理统计数据
+	Clear(ctx context.Context, shareID uint) error
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type tusUploadCache struct {
+	cache *RedisClient
+}
+
+func NewTusUploadCache(cache *RedisClient) TusUploadCache {
+	return &tusUploadCache{
+		cache: cache,
+	}
+}
+
+func (c *tusUploadCache) SaveUpload(ctx context.Context, upload *model.TusUpload, expiration time.Duration) error {
+	key := fmt.Sprintf("tus:upload:%s", upload.ID)
+	return c.cache.Set(key, upload, expiration)
+}
+
+func (c *tusUploadCache) GetUpload(ctx context.Context, uploadID string) (*model.TusUpload, error) {
+	key := fmt.Sprintf("tus:upload:%s", uploadID)
+	var upload model.TusUpload
+	if err := c.cache.Get(key, &upload); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (c *tusUploadCache) DeleteUpload(ctx context.Context, uploadID string) error {
+	key := fmt.Sprintf("tus:upload:%s", uploadID)
+	return c.cache.Delete(key)
+}
+
+// UploadExists 会话是否仍然有效；redis异常时返回error
+func (c *tusUploadCache) UploadExists(ctx context.Context, uploadID string) (bool, error) {
+	_, err := c.GetUpload(ctx, uploadID)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return false, err
+}
+
+// LockUpload 同一个上传同时只允许一个PATCH写入
+func (c *tusUploadCache) LockUpload(ctx context.Context, uploadID string) (bool, error) {
+	return c.cache.Lock(fmt.Sprintf("tus:upload:%s", uploadID), 10*time.Minute)
+}
+
+func (c *tusUploadCache) UnlockUpload(ctx context.Context, uploadID string) error {
+	return c.cache.Unlock(fmt.Sprintf("tus:upload:%s", uploadID))
+}
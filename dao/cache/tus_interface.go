@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+	"time"
+)
+
+type TusUploadCache interface {
+	SaveUpload(ctx context.Context, upload *model.TusUpload, expiration time.Duration) error
+	GetUpload(ctx context.Context, uploadID string) (*model.TusUpload, error)
+	DeleteUpload(ctx context.Context, uploadID string) error
+	UploadExists(ctx context.Context, uploadID string) (bool, error)
+	LockUpload(ctx context.Context, uploadID string) (bool, error)
+	UnlockUpload(ctx context.Context, uploadID string) error
+}
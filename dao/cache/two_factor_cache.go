@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 两步验证
+// 2fa:pending:<user_id>          STRING  开启两步验证时生成、尚未确认的密钥
+// 2fa:used:<user_id>:<code>      STRING  已使用的动态码，防止同一个动态码在有效期内被重放
+// 2fa:attempt:<challenge_id>     STRING  登录挑战的尝试次数
+// 2fa:challenge:<challenge_id>   STRING  已使用的登录挑战，每个挑战只能换取一次令牌
+// 2fa:fail:<user_id>             STRING  用户两步验证的失败次数，跨登录挑战累计，达到上限后锁定到键过期
+
+var challengeAttemptScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return -1
+end
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// 达到上限时重新设置过期时间，锁定从最后一次失败开始计算
+var userFailureScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 or count >= tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+type twoFactorCache struct {
+	cache *RedisClient
+}
+
+func NewTwoFactorCache(cache *RedisClient) TwoFactorCache {
+	return &twoFactorCache{
+		cache: cache,
+	}
+}
+
+func pendingSecretKey(userID int) string {
+	return fmt.Sprintf("2fa:pending:%d", userID)
+}
+
+func (c *twoFactorCache) SavePendingSecret(ctx context.Context, userID int, secret string, ttl time.Duration) error {
+	if err := c.cache.client.Set(ctx, pendingSecretKey(userID), secret, ttl).Err(); err != nil {
+		return fmt.Errorf("保存两步验证密钥失败: %v", err)
+	}
+	return nil
+}
+
+func (c *twoFactorCache) GetPendingSecret(ctx context.Context, userID int) (string, error) {
+	secret, err := c.cache.client.Get(ctx, pendingSecretKey(userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return "", fmt.Errorf("获取两步验证密钥失败: %v", err)
+	}
+	return secret, nil
+}
+
+func (c *twoFactorCache) DeletePendingSecret(ctx context.Context, userID int) error {
+	if err := c.cache.client.Del(ctx, pendingSecretKey(userID)).Err(); err != nil {
+		return fmt.Errorf("删除两步验证密钥失败: %v", err)
+	}
+	return nil
+}
+
+func (c *twoFactorCache) MarkCodeUsed(ctx context.Context, userID int, code string, ttl time.Duration) (bool, error) {
+	ok, err := c.cache.client.SetNX(ctx, fmt.Sprintf("2fa:used:%d:%s", userID, code), 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("记录动态码失败: %v", err)
+	}
+	return ok, nil
+}
+
+func (c *twoFactorCache) Attempt(ctx context.Context, challengeID string, ttl time.Duration) (int64, bool, error) {
+	keys := []string{"2fa:attempt:" + challengeID, "2fa:challenge:" + challengeID}
+	count, err := challengeAttemptScript.Run(ctx, c.cache.client, keys, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, fmt.Errorf("记录尝试次数失败: %v", err)
+	}
+	if count < 0 {
+		return 0, true, nil
+	}
+	return count, false, nil
+}
+
+func (c *twoFactorCache) ConsumeChallenge(ctx context.Context, challengeID string, ttl time.Duration) (bool, error) {
+	ok, err := c.cache.client.SetNX(ctx, "2fa:challenge:"+challengeID, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("记录登录挑战失败: %v", err)
+	}
+	return ok, nil
+}
+
+func userFailureKey(userID int) string {
+	return fmt.Sprintf("2fa:fail:%d", userID)
+}
+
+func (c *twoFactorCache) RecordFailure(ctx context.Context, userID int, maxFailures int64, ttl time.Duration) (int64, error) {
+	count, err := userFailureScript.Run(ctx, c.cache.client, []string{userFailureKey(userID)}, ttl.Milliseconds(), maxFailures).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("记录两步验证失败次数失败: %v", err)
+	}
+	return count, nil
+}
+
+func (c *twoFactorCache) Failures(ctx context.Context, userID int) (int64, error) {
+	count, err := c.cache.client.Get(ctx, userFailureKey(userID)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("获取两步验证失败次数失败: %v", err)
+	}
+	return count, nil
+}
+
+func (c *twoFactorCache) ClearFailures(ctx context.Context, userID int) error {
+	if err := c.cache.client.Del(ctx, userFailureKey(userID)).Err(); err != nil {
+		return fmt.Errorf("清除两步验证失败次数失败: %v", err)
+	}
+	return nil
+}
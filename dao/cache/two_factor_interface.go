@@ -0,0 +1,26 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type TwoFactorCache interface {
+	// SavePendingSecret 保存尚未确认的两步验证密钥，确认前不写入数据库
+	SavePendingSecret(ctx context.Context, userID int, secret string, ttl time.Duration) error
+	// GetPendingSecret 返回尚未确认的密钥，不存在或已过期时返回空字符串
+	GetPendingSecret(ctx context.Context, userID int) (string, error)
+	DeletePendingSecret(ctx context.Context, userID int) error
+	// MarkCodeUsed 记录已使用的动态码，ttl内同一个动态码再次使用时返回false
+	MarkCodeUsed(ctx context.Context, userID int, code string, ttl time.Duration) (bool, error)
+	// Attempt 记一次登录挑战的尝试，返回ttl内的尝试次数；挑战已被使用过时不计数，返回consumed为true
+	Attempt(ctx context.Context, challengeID string, ttl time.Duration) (attempts int64, consumed bool, err error)
+	// ConsumeChallenge 将登录挑战标记为已使用，已使用过时返回false
+	ConsumeChallenge(ctx context.Context, challengeID string, ttl time.Duration) (bool, error)
+	// RecordFailure 记一次用户的两步验证失败，返回累计次数；达到maxFailures时从本次起锁定ttl
+	RecordFailure(ctx context.Context, userID int, maxFailures int64, ttl time.Duration) (int64, error)
+	// Failures 返回用户当前累计的失败次数，锁定过期后为0
+	Failures(ctx context.Context, userID int) (int64, error)
+	// ClearFailures 登录成功后清除失败次数
+	ClearFailures(ctx context.Context, userID int) error
+}
@@ -4,8 +4,26 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
+// 邮箱验证码
+// verification:<purpose>:<email>           STRING  验证码
+// verification:attempt:<purpose>:<email>   STRING  当前验证码输错的次数
+// ratelimit:<email>                        STRING  发送频率锁，所有用途共用
+
+// verificationCodeTTL 验证码有效期
+const verificationCodeTTL = 5 * time.Minute
+
+var verificationAttemptScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
 type verificationCodeCache struct {
 	cache *RedisClient
 }
@@ -16,21 +34,38 @@ func NewVerificationCodeCache(cache *RedisClient) VerificationCodeCache {
 	}
 }
 
-func (c *verificationCodeCache) SaveVerificationCode(ctx context.Context, email, code string) error {
-	key := fmt.Sprintf("verification:%s", email)
-	return c.cache.Set(key, code, c.cache.RandExp(5*time.Minute))
+func verificationCodeKey(purpose, email string) string {
+	return fmt.Sprintf("verification:%s:%s", purpose, email)
+}
+
+func verificationAttemptKey(purpose, email string) string {
+	return fmt.Sprintf("verification:attempt:%s:%s", purpose, email)
 }
 
-func (c *verificationCodeCache) GetVerificationCode(ctx context.Context, email string) (string, error) {
-	key := fmt.Sprintf("verification:%s", email)
+func (c *verificationCodeCache) SaveVerificationCode(ctx context.Context, purpose, email, code string) error {
+	if err := c.cache.Delete(verificationAttemptKey(purpose, email)); err != nil {
+		return err
+	}
+	return c.cache.Set(verificationCodeKey(purpose, email), code, c.cache.RandExp(verificationCodeTTL))
+}
+
+func (c *verificationCodeCache) GetVerificationCode(ctx context.Context, purpose, email string) (string, error) {
 	var code string
-	err := c.cache.Get(key, &code)
+	err := c.cache.Get(verificationCodeKey(purpose, email), &code)
 	return code, err
 }
 
-func (c *verificationCodeCache) DeleteVerificationCode(ctx context.Context, email string) error {
-	key := fmt.Sprintf("verification:%s", email)
-	return c.cache.Delete(key)
+func (c *verificationCodeCache) DeleteVerificationCode(ctx context.Context, purpose, email string) error {
+	return c.cache.Delete(verificationCodeKey(purpose, email))
+}
+
+func (c *verificationCodeCache) IncrAttempts(ctx context.Context, purpose, email string) (int64, error) {
+	keys := []string{verificationAttemptKey(purpose, email)}
+	count, err := verificationAttemptScript.Run(ctx, c.cache.client, keys, (verificationCodeTTL * 2).Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("记录验证码尝试次数失败: %v", err)
+	}
+	return count, nil
 }
 
 func (c *verificationCodeCache) SetRateLimit(ctx context.Context, email string) error {
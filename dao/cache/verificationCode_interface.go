@@ -2,10 +2,13 @@ package cache
 
 import "context"
 
+// VerificationCodeCache 验证码按用途(purpose)区分，不同用途的验证码互不通用
 type VerificationCodeCache interface {
-	SaveVerificationCode(ctx context.Context, email, code string) error
-	GetVerificationCode(ctx context.Context, email string) (string, error)
-	DeleteVerificationCode(ctx context.Context, email string) error
+	SaveVerificationCode(ctx context.Context, purpose, email, code string) error
+	GetVerificationCode(ctx context.Context, purpose, email string) (string, error)
+	DeleteVerificationCode(ctx context.Context, purpose, email string) error
+	// IncrAttempts 记一次输错验证码，返回当前验证码已输错的次数，保存新验证码时清零
+	IncrAttempts(ctx context.Context, purpose, email string) (int64, error)
 	SetRateLimit(ctx context.Context, email string) error
 	CheckRateLimit(ctx context.Context, email string) (bool, error)
 }
@@ -0,0 +1,20 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type AlbumRepository interface {
+	CreateAlbum(ctx context.Context, album *model.Album) error
+	GetAlbumByID(ctx context.Context, albumID uint) (*model.Album, error)
+	GetUserAlbums(ctx context.Context, userID uint) ([]*model.Album, int64, error)
+	UpdateAlbum(ctx context.Context, album *model.Album) error
+	DeleteAlbum(ctx context.Context, albumID uint) error
+
+	//相册文件
+	AddFiles(ctx context.Context, albumID uint, fileIDs []uint) error
+	RemoveFiles(ctx context.Context, albumID uint, fileIDs []uint) error
+	GetAlbumFiles(ctx context.Context, albumID uint) ([]*model.File, error)
+	CountAlbumFiles(ctx context.Context, albumID uint) (int64, error)
+}
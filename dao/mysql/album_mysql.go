@@ -0,0 +1,213 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type mysqlAlbumRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlAlbumRepo(db *gorm.DB, cache *cache.RedisClient) AlbumRepository {
+	if err := db.AutoMigrate(&model.Album{}, &model.AlbumFile{}); err != nil {
+		panic("Failed to migrate album tables: " + err.Error())
+	}
+	return &mysqlAlbumRepo{db, cache}
+}
+
+func (repo *mysqlAlbumRepo) CreateAlbum(ctx context.Context, album *model.Album) error {
+	if err := repo.db.WithContext(ctx).Create(album).Error; err != nil {
+		return errors.New("create album failed")
+	}
+
+	//写后删除
+	return repo.cleanCache(album.ID, album.UserID)
+}
+
+func (repo *mysqlAlbumRepo) GetAlbumByID(ctx context.Context, albumID uint) (*model.Album, error) {
+	//cache
+	cacheKey := fmt.Sprintf("album:%d", albumID)
+	if repo.cache != nil {
+		var album model.Album
+		if err := repo.cache.Get(cacheKey, &album); err == nil && album.ID != 0 {
+			return &album, nil
+		}
+	}
+
+	//mysql
+	var album model.Album
+	if err := repo.db.WithContext(ctx).First(&album, albumID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("album not found")
+		}
+		return nil, err
+	}
+
+	//cache
+	if repo.cache != nil {
+		lockKey := fmt.Sprintf("lock:album:%d", albumID)
+		if success, _ := repo.cache.Lock(lockKey, 10*time.Second); success {
+			defer repo.cache.Unlock(lockKey)
+
+			if err := repo.cache.Set(cacheKey, &album, repo.cache.RandExp(5*time.Minute)); err != nil {
+				return nil, errors.New("set cache failed")
+			}
+		}
+	}
+
+	return &album, nil
+}
+
+func (repo *mysqlAlbumRepo) GetUserAlbums(ctx context.Context, userID uint) ([]*model.Album, int64, error) {
+	//cache
+	cacheKey := fmt.Sprintf("user_albums:%d", userID)
+	if repo.cache != nil {
+		var albums []*model.Album
+		if err := repo.cache.Get(cacheKey, &albums); err == nil {
+			return albums, int64(len(albums)), nil
+		}
+	}
+
+	//mysql
+	var albums []*model.Album
+	err := repo.db.WithContext(ctx).Where("user_id = ?", userID).Order("updated_at DESC").Find(&albums).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	//cache
+	if repo.cache != nil {
+		lockKey := fmt.Sprintf("lock:user_albums:%d", userID)
+		if success, _ := repo.cache.Lock(lockKey, 10*time.Second); success {
+			defer repo.cache.Unlock(lockKey)
+
+			if err := repo.cache.Set(cacheKey, albums, repo.cache.RandExp(5*time.Minute)); err != nil {
+				return nil, 0, errors.New("set cache failed")
+			}
+		}
+	}
+
+	return albums, int64(len(albums)), nil
+}
+
+func (repo *mysqlAlbumRepo) UpdateAlbum(ctx context.Context, album *model.Album) error {
+	if err := repo.db.WithContext(ctx).Save(album).Error; err != nil {
+		return errors.New("update album failed")
+	}
+
+	//写后删除
+	return repo.cleanCache(album.ID, album.UserID)
+}
+
+func (repo *mysqlAlbumRepo) DeleteAlbum(ctx context.Context, albumID uint) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var album model.Album
+		if err := tx.First(&album, albumID).Error; err != nil {
+			return errors.New("check album failed")
+		}
+
+		// 只删除关联记录，文件本身保留
+		if err := tx.Where("album_id = ?", albumID).Delete(&model.AlbumFile{}).Error; err != nil {
+			return errors.New("delete album failed")
+		}
+		if err := tx.Delete(&model.Album{}, albumID).Error; err != nil {
+			return errors.New("delete album failed")
+		}
+
+		return repo.cleanCache(album.ID, album.UserID)
+	})
+}
+
+func (repo *mysqlAlbumRepo) AddFiles(ctx context.Context, albumID uint, fileIDs []uint) error {
+	albumFiles := make([]model.AlbumFile, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		albumFiles = append(albumFiles, model.AlbumFile{AlbumID: albumID, FileID: id})
+	}
+
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 已在相册中的文件直接忽略
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&albumFiles).Error; err != nil {
+			return errors.New("add album files failed")
+		}
+		// 刷新相册更新时间
+		if err := tx.Model(&model.Album{}).Where("id = ?", albumID).Update("updated_at", time.Now()).Error; err != nil {
+			return errors.New("update album failed")
+		}
+
+		return repo.cleanAlbumCache(tx, albumID)
+	})
+}
+
+func (repo *mysqlAlbumRepo) RemoveFiles(ctx context.Context, albumID uint, fileIDs []uint) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("album_id = ? AND file_id IN ?", albumID, fileIDs).Delete(&model.AlbumFile{}).Error; err != nil {
+			return errors.New("remove album files failed")
+		}
+		if err := tx.Model(&model.Album{}).Where("id = ?", albumID).Update("updated_at", time.Now()).Error; err != nil {
+			return errors.New("update album failed")
+		}
+
+		return repo.cleanAlbumCache(tx, albumID)
+	})
+}
+
+func (repo *mysqlAlbumRepo) GetAlbumFiles(ctx context.Context, albumID uint) ([]*model.File, error) {
+	// 只返回仍然存在且不在回收站中的文件
+	var files []*model.File
+	err := repo.db.WithContext(ctx).
+		Joins("JOIN album_files ON album_files.file_id = files.id").
+		Where("album_files.album_id = ? AND files.is_deleted = ?", albumID, false).
+		Order("album_files.created_at DESC").
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (repo *mysqlAlbumRepo) CountAlbumFiles(ctx context.Context, albumID uint) (int64, error) {
+	var count int64
+	err := repo.db.WithContext(ctx).Model(&model.AlbumFile{}).
+		Joins("JOIN files ON files.id = album_files.file_id").
+		Where("album_files.album_id = ? AND files.is_deleted = ?", albumID, false).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// cleanAlbumCache 查询相册所属用户后清理缓存
+func (repo *mysqlAlbumRepo) cleanAlbumCache(tx *gorm.DB, albumID uint) error {
+	if repo.cache == nil {
+		return nil
+	}
+	var album model.Album
+	if err := tx.Select("id", "user_id").First(&album, albumID).Error; err != nil {
+		return errors.New("check album failed")
+	}
+	return repo.cleanCache(album.ID, album.UserID)
+}
+
+func (repo *mysqlAlbumRepo) cleanCache(albumID, userID uint) error {
+	if repo.cache == nil {
+		return nil
+	}
+	err := repo.cache.Clean(
+		fmt.Sprintf("album:%d", albumID),
+		fmt.Sprintf("user_albums:%d", userID),
+	)
+	if err != nil {
+		return errors.New("delete cache failed")
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type AuditRepository interface {
+	CreateAuditLog(ctx context.Context, log *model.AuditLog) error
+	// GetAuditLogs 按时间倒序分页，logType为空时返回全部类型
+	GetAuditLogs(ctx context.Context, logType string, page, pageSize int) ([]*model.AuditLog, int64, error)
+}
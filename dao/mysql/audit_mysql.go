@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type mysqlAuditRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlAuditRepo(db *gorm.DB, cache *cache.RedisClient) AuditRepository {
+	if err := db.AutoMigrate(&model.AuditLog{}); err != nil {
+		panic("Failed to migrate audit log table: " + err.Error())
+	}
+	return &mysqlAuditRepo{db, cache}
+}
+
+func (repo *mysqlAuditRepo) CreateAuditLog(ctx context.Context, log *model.AuditLog) error {
+	if err := repo.db.WithContext(ctx).Create(log).Error; err != nil {
+		return errors.New("create audit log failed")
+	}
+	return nil
+}
+
+func (repo *mysqlAuditRepo) GetAuditLogs(ctx context.Context, logType string, page, pageSize int) ([]*model.AuditLog, int64, error) {
+	var logs []*model.AuditLog
+	var total int64
+
+	query := repo.db.WithContext(ctx).Model(&model.AuditLog{})
+	if logType != "" {
+		query = query.Where("type = ?", logType)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
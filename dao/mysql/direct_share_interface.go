@@ -0,0 +1,20 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type DirectShareRepository interface {
+	// SaveDirectShare 同一文件已分享给该接收者时更新权限
+	SaveDirectShare(ctx context.Context, share *model.DirectShare) error
+	GetDirectShareByID(ctx context.Context, id uint) (*model.DirectShare, error)
+	DeleteDirectShare(ctx context.Context, id uint) error
+	DeleteByFileID(ctx context.Context, fileID uint) error
+
+	// GetByOwner fileID为0时返回分享者的全部定向分享
+	GetByOwner(ctx context.Context, ownerID uint, fileID uint) ([]*model.DirectShare, error)
+	GetByRecipient(ctx context.Context, recipientID uint) ([]*model.DirectShare, error)
+	// GetRecipientGrants 接收者在这些文件上的定向分享，用于沿文件夹向上查找权限
+	GetRecipientGrants(ctx context.Context, recipientID uint, fileIDs []uint) ([]*model.DirectShare, error)
+}
@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 权限检查需要实时生效（撤销后立即失去访问权限），直接读写mysql，不经过缓存
+type mysqlDirectShareRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlDirectShareRepo(db *gorm.DB, cache *cache.RedisClient) DirectShareRepository {
+	if err := db.AutoMigrate(&model.DirectShare{}); err != nil {
+		panic("Failed to migrate direct share table: " + err.Error())
+	}
+	return &mysqlDirectShareRepo{db, cache}
+}
+
+func (repo *mysqlDirectShareRepo) SaveDirectShare(ctx context.Context, share *model.DirectShare) error {
+	err := repo.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "recipient_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permission", "updated_at"}),
+	}).Create(share).Error
+	if err != nil {
+		return errors.New("save direct share failed")
+	}
+	return nil
+}
+
+func (repo *mysqlDirectShareRepo) GetDirectShareByID(ctx context.Context, id uint) (*model.DirectShare, error) {
+	var share model.DirectShare
+	if err := repo.db.WithContext(ctx).First(&share, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("direct share not found")
+		}
+		return nil, err
+	}
+	return &share, nil
+}
+
+func (repo *mysqlDirectShareRepo) DeleteDirectShare(ctx context.Context, id uint) error {
+	if err := repo.db.WithContext(ctx).Delete(&model.DirectShare{}, id).Error; err != nil {
+		return errors.New("delete direct share failed")
+	}
+	return nil
+}
+
+func (repo *mysqlDirectShareRepo) DeleteByFileID(ctx context.Context, fileID uint) error {
+	if err := repo.db.WithContext(ctx).Where("file_id = ?", fileID).Delete(&model.DirectShare{}).Error; err != nil {
+		return errors.New("delete direct share failed")
+	}
+	return nil
+}
+
+func (repo *mysqlDirectShareRepo) GetByOwner(ctx context.Context, ownerID uint, fileID uint) ([]*model.DirectShare, error) {
+	var shares []*model.DirectShare
+	query := repo.db.WithContext(ctx).Where("owner_id = ?", ownerID)
+	if fileID != 0 {
+		query = query.Where("file_id = ?", fileID)
+	}
+	if err := query.Preload("File").Preload("Recipient").Order("created_at DESC").Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (repo *mysqlDirectShareRepo) GetByRecipient(ctx context.Context, recipientID uint) ([]*model.DirectShare, error) {
+	var shares []*model.DirectShare
+	err := repo.db.WithContext(ctx).Where("recipient_id = ?", recipientID).
+		Preload("File").Preload("Owner").Order("created_at DESC").Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (repo *mysqlDirectShareRepo) GetRecipientGrants(ctx context.Context, recipientID uint, fileIDs []uint) ([]*model.DirectShare, error) {
+	var shares []*model.DirectShare
+	if len(fileIDs) == 0 {
+		return shares, nil
+	}
+	err := repo.db.WithContext(ctx).Where("recipient_id = ? AND file_id IN ?", recipientID, fileIDs).Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
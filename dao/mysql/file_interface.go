@@ -17,14 +17,21 @@ type FileRepository interface {
 	FindByUserID(ctx context.Context, userID uint) ([]*model.File, int64, error)
 	FindByParentID(ctx context.Context, parentID *uint, userID uint) ([]*model.File, int64, error)
 	CountByUserID(ctx context.Context, userID uint) (int64, error)
-	SearchFiles(userID int, keywords string) ([]*model.File, int, error)
+	SearchFiles(userID int, filter model.FileSearchFilter) ([]*model.File, int, error)
+	CountByPath(ctx context.Context, path string) (int64, error)
+	FindAllByHash(ctx context.Context, hash string) ([]*model.File, error)
+	FindQuarantined(ctx context.Context) ([]*model.File, int64, error)
+	FindChildren(ctx context.Context, userID uint, parentID *uint) ([]*model.File, error)
 
 	//分片上传相关
-	InitChunkUploadSession(fileHash string, chunkTotal int) error
-	CleanChunkUploadSession(fileHash string)
-	CheckChunkUploadSession(fileHash string) error
-	UpdateChunkUploadSession(fileHash string, chunkIndex int) error
-	IsChunkUploadFinished(fileHash string) (bool, error)
-	GetChunks(fileHash string) ([]int, error)
-	GetUploadedChunks(fileHash string) ([]int, error)
+	InitChunkUploadSession(session *model.ChunkUploadSession) error
+	GetChunkUploadSession(uploadID string) (*model.ChunkUploadSession, error)
+	ChunkUploadSessionExists(uploadID string) (bool, error)
+	CleanChunkUploadSession(uploadID string)
+	UpdateChunkUploadSession(uploadID string, chunkIndex int) error
+	IsChunkUploadFinished(uploadID string) (bool, error)
+	GetChunks(uploadID string) ([]int, error)
+	GetUploadedChunks(uploadID string) ([]int, error)
+	LockChunkMerge(uploadID string) (bool, error)
+	UnlockChunkMerge(uploadID string)
 }
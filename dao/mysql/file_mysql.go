@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -49,7 +50,7 @@ func (repo *mysqlFileRepo) Create(ctx context.Context, file *model.File) error {
 			}
 
 			// fileHash - file
-			fileHashCacheKey := fmt.Sprintf("fileHash:%d", file.Hash)
+			fileHashCacheKey := fmt.Sprintf("fileHash:%s", file.Hash)
 			err = repo.cache.Delete(fileHashCacheKey)
 			if err != nil {
 				return errors.New("set cache failed")
@@ -91,7 +92,7 @@ func (repo *mysqlFileRepo) Update(ctx context.Context, file *model.File) error {
 			}
 
 			// fileHash - file
-			fileHashCacheKey := fmt.Sprintf("fileHash:%d", file.Hash)
+			fileHashCacheKey := fmt.Sprintf("fileHash:%s", file.Hash)
 			err = repo.cache.Delete(fileHashCacheKey)
 			if err != nil {
 				return errors.New("set cache failed")
@@ -126,6 +127,15 @@ func (repo *mysqlFileRepo) Delete(ctx context.Context, id uint) error {
 		if err != nil {
 			return errors.New("failed to delete file")
 		}
+		//从所有分享与定向分享中移除
+		err = tx.WithContext(ctx).Where("file_id = ?", id).Delete(&model.ShareFile{}).Error
+		if err != nil {
+			return errors.New("failed to delete share files")
+		}
+		err = tx.WithContext(ctx).Where("file_id = ?", id).Delete(&model.DirectShare{}).Error
+		if err != nil {
+			return errors.New("failed to delete direct shares")
+		}
 
 		//写后删除
 		if repo.cache != nil {
@@ -611,10 +621,15 @@ func (repo *mysqlFileRepo) CountByUserID(ctx context.Context, userID uint) (int6
 	return count, err
 }
 
-func (repo *mysqlFileRepo) SearchFiles(userID int, keywords string) ([]*model.File, int, error) {
+func (repo *mysqlFileRepo) SearchFiles(userID int, filter model.FileSearchFilter) ([]*model.File, int, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, -1, err
+	}
+	cacheKey := fmt.Sprintf("search:userID:%d:filter:%s", userID, filterJSON)
+
 	//缓存
 	if repo.cache != nil {
-		cacheKey := fmt.Sprintf("search:userID:%d:keywords:%s", userID, keywords)
 		var jsonData string
 		err := repo.cache.Get(cacheKey, &jsonData)
 		if err == nil {
@@ -628,12 +643,25 @@ func (repo *mysqlFileRepo) SearchFiles(userID int, keywords string) ([]*model.Fi
 	}
 
 	//数据库
+	query := repo.db.Where("user_id = ?", userID)
+	if filter.Keywords != "" {
+		query = query.Where("name LIKE ?", "%"+filter.Keywords+"%")
+	}
+	if len(filter.Exts) > 0 {
+		query = query.Where("ext IN ?", filter.Exts)
+	}
+	if filter.TakenFrom != nil {
+		query = query.Where("meta_taken_at >= ?", *filter.TakenFrom)
+	}
+	if filter.TakenTo != nil {
+		query = query.Where("meta_taken_at < ?", *filter.TakenTo)
+	}
+
 	var files []*model.File
-	err := repo.db.Where("user_id = ? AND name LIKE ?", userID, "%"+keywords+"%").Find(&files).Error
+	err = query.Find(&files).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			if repo.cache != nil {
-				cacheKey := fmt.Sprintf("search:userID:%d:keywords:%s", userID, keywords)
 				var file = model.File{}
 				err := repo.cache.Set(cacheKey, file, 1*time.Minute)
 				if err != nil {
@@ -656,7 +684,6 @@ func (repo *mysqlFileRepo) SearchFiles(userID int, keywords string) ([]*model.Fi
 		if suc {
 			defer repo.cache.Unlock(lockKey)
 
-			cacheKey := fmt.Sprintf("search:userID:%d:keywords:%s", userID, keywords)
 			err := repo.cache.Set(cacheKey, jsonData, repo.cache.RandExp(5*time.Minute))
 			if err != nil {
 				return nil, -1, errors.New("set cache failed")
@@ -667,37 +694,88 @@ func (repo *mysqlFileRepo) SearchFiles(userID int, keywords string) ([]*model.Fi
 	return files, len(files), nil
 }
 
-func (repo *mysqlFileRepo) InitChunkUploadSession(fileHash string, chunkTotal int) error {
-	//分布式锁
-	lockKey := fmt.Sprintf("lock:chunkupload:%s", fileHash)
-	suc, _ := repo.cache.Lock(lockKey, 10*time.Second)
-	if !suc {
-		return fmt.Errorf("上传会话正在初始化，请稍候重试")
+func (repo *mysqlFileRepo) CountByPath(ctx context.Context, path string) (int64, error) {
+	var count int64
+	err := repo.db.WithContext(ctx).Model(&model.File{}).Where("path = ?", path).Count(&count).Error
+	if err != nil {
+		return 0, err
 	}
-	defer repo.cache.Unlock(lockKey)
+	return count, nil
+}
 
-	//设置chunkTotal
-	totalKey := fmt.Sprintf("chunkupload:total:%s", fileHash)
-	err := repo.cache.Set(totalKey, chunkTotal, repo.cache.RandExp(24*time.Hour))
+// FindAllByHash 查找内容相同的全部文件记录（秒传会让多条记录共用一个对象）
+func (repo *mysqlFileRepo) FindAllByHash(ctx context.Context, hash string) ([]*model.File, error) {
+	var files []*model.File
+	err := repo.db.WithContext(ctx).Where("hash = ?", hash).Find(&files).Error
 	if err != nil {
-		return fmt.Errorf("设置chunkTotal失败")
+		return nil, errors.New("failed to get file")
 	}
+	return files, nil
+}
 
-	//初始化分片
-	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", fileHash)
-	err = repo.cache.Expire(chunkKey, repo.cache.RandExp(24*time.Hour))
+// FindQuarantined 查找被隔离的文件，供管理员复核
+func (repo *mysqlFileRepo) FindQuarantined(ctx context.Context) ([]*model.File, int64, error) {
+	var files []*model.File
+	err := repo.db.WithContext(ctx).Where("quarantined = ?", true).Order("created_at DESC").Find(&files).Error
 	if err != nil {
-		fmt.Printf("设置分片过期时间失败: %v\n", err)
+		return nil, -1, errors.New("failed to get file")
+	}
+	return files, int64(len(files)), nil
+}
+
+// FindChildren 查找文件夹下未删除的文件，parentID为nil时查找根目录；文件夹在前
+// 目录内容随上传、移动实时变化，不经过缓存
+func (repo *mysqlFileRepo) FindChildren(ctx context.Context, userID uint, parentID *uint) ([]*model.File, error) {
+	query := repo.db.WithContext(ctx).Where("user_id = ? AND is_deleted = ?", userID, false)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var files []*model.File
+	if err := query.Order("is_dir DESC, name ASC").Find(&files).Error; err != nil {
+		return nil, errors.New("failed to get file")
+	}
+	return files, nil
+}
+
+func (repo *mysqlFileRepo) InitChunkUploadSession(session *model.ChunkUploadSession) error {
+	sessionKey := fmt.Sprintf("chunkupload:session:%s", session.UploadID)
+	err := repo.cache.Set(sessionKey, session, repo.cache.RandExp(24*time.Hour))
+	if err != nil {
+		return fmt.Errorf("保存上传会话失败: %v", err)
 	}
 
 	return nil
 }
 
-func (repo *mysqlFileRepo) CleanChunkUploadSession(fileHash string) {
+func (repo *mysqlFileRepo) GetChunkUploadSession(uploadID string) (*model.ChunkUploadSession, error) {
+	sessionKey := fmt.Sprintf("chunkupload:session:%s", uploadID)
+	var session model.ChunkUploadSession
+	if err := repo.cache.Get(sessionKey, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// ChunkUploadSessionExists 会话是否仍然有效；redis异常时返回error，调用方不应据此清理数据
+func (repo *mysqlFileRepo) ChunkUploadSessionExists(uploadID string) (bool, error) {
+	_, err := repo.GetChunkUploadSession(uploadID)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (repo *mysqlFileRepo) CleanChunkUploadSession(uploadID string) {
 	keys := []string{
-		fmt.Sprintf("chunkupload:chunk:%s", fileHash),
-		fmt.Sprintf("chunkupload:total:%s", fileHash),
-		fmt.Sprintf("lock:chunkupload:%s", fileHash),
+		fmt.Sprintf("chunkupload:session:%s", uploadID),
+		fmt.Sprintf("chunkupload:chunk:%s", uploadID),
 	}
 
 	for _, key := range keys {
@@ -708,71 +786,59 @@ func (repo *mysqlFileRepo) CleanChunkUploadSession(fileHash string) {
 	}
 }
 
-func (repo *mysqlFileRepo) CheckChunkUploadSession(fileHash string) error {
-	_, err := repo.cache.SMembers(fmt.Sprintf("chunkupload:chunk:%s", fileHash))
-	return err
-}
-
-func (repo *mysqlFileRepo) UpdateChunkUploadSession(fileHash string, chunkIndex int) error {
-	lockKey := fmt.Sprintf("lock:chunkupload:%s", fileHash)
+func (repo *mysqlFileRepo) UpdateChunkUploadSession(uploadID string, chunkIndex int) error {
+	lockKey := fmt.Sprintf("chunkupload:%s", uploadID)
 	suc, _ := repo.cache.Lock(lockKey, 10*time.Second)
 	if !suc {
 		return fmt.Errorf("分片正在上传中，请稍候重试")
 	}
 	defer repo.cache.Unlock(lockKey)
 
-	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", fileHash)
+	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", uploadID)
 
 	//检查分片是否上传成功
 	exist, err := repo.cache.SIsMember(chunkKey, chunkIndex)
 	if err != nil {
 		return fmt.Errorf("检查分片状态失败")
 	}
-	if exist { // 已上传
-		return nil
+	if !exist {
+		//更新缓存
+		err = repo.cache.SAdd(chunkKey, chunkIndex)
+		if err != nil {
+			return fmt.Errorf("记录分片失败: %v", err)
+		}
 	}
 
-	//更新缓存
-	err = repo.cache.SAdd(chunkKey, chunkIndex)
-	if err != nil {
-		return fmt.Errorf("记录分片失败: %v", err)
-	}
-	err = repo.cache.Expire(chunkKey, repo.cache.RandExp(24*time.Hour))
-	if err != nil {
+	//续期：会话与分片集合同时延长
+	expiration := repo.cache.RandExp(24 * time.Hour)
+	if err := repo.cache.Expire(chunkKey, expiration); err != nil {
 		fmt.Printf("设置分片过期时间失败: %v\n", err)
 	}
+	if err := repo.cache.Expire(fmt.Sprintf("chunkupload:session:%s", uploadID), expiration); err != nil {
+		fmt.Printf("设置会话过期时间失败: %v\n", err)
+	}
 
 	return nil
 }
 
-func (repo *mysqlFileRepo) IsChunkUploadFinished(fileHash string) (bool, error) {
+func (repo *mysqlFileRepo) IsChunkUploadFinished(uploadID string) (bool, error) {
 	// 获取分片总数
-	totalKey := fmt.Sprintf("chunkupload:total:%s", fileHash)
-
-	var total int
-	err := repo.cache.Get(totalKey, &total)
+	session, err := repo.GetChunkUploadSession(uploadID)
 	if err != nil {
 		return false, err
 	}
 
 	//获取已上传分片数量
-	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", fileHash)
-	chunks, err := repo.cache.SMembers(chunkKey)
+	uploaded, err := repo.GetUploadedChunks(uploadID)
 	if err != nil {
 		return false, err
 	}
-	uploaded := make([]int, 0, len(chunks))
-	for _, chunk := range chunks {
-		if idx, err := strconv.Atoi(chunk); err == nil {
-			uploaded = append(uploaded, idx)
-		}
-	}
 
-	return len(uploaded) >= total, nil
+	return len(uploaded) >= session.ChunkTotal, nil
 }
 
-func (repo *mysqlFileRepo) GetChunks(fileHash string) ([]int, error) {
-	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", fileHash)
+func (repo *mysqlFileRepo) GetChunks(uploadID string) ([]int, error) {
+	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", uploadID)
 	chunksStr, err := repo.cache.SMembers(chunkKey)
 	if err != nil {
 		return nil, err
@@ -789,13 +855,13 @@ func (repo *mysqlFileRepo) GetChunks(fileHash string) ([]int, error) {
 	return chunks, nil
 }
 
-func (repo *mysqlFileRepo) GetUploadedChunks(fileHash string) ([]int, error) {
-	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", fileHash)
+func (repo *mysqlFileRepo) GetUploadedChunks(uploadID string) ([]int, error) {
+	chunkKey := fmt.Sprintf("chunkupload:chunk:%s", uploadID)
 	chunksStr, err := repo.cache.SMembers(chunkKey)
 	if err != nil {
 		return nil, err
 	}
-	var chunks []int
+	chunks := make([]int, 0, len(chunksStr))
 	for _, chunkStr := range chunksStr {
 		chunk, err := strconv.Atoi(chunkStr)
 		if err != nil {
@@ -807,6 +873,15 @@ func (repo *mysqlFileRepo) GetUploadedChunks(fileHash string) ([]int, error) {
 	return chunks, nil
 }
 
+// LockChunkMerge 最后几个分片可能同时到达，保证只合并一次
+func (repo *mysqlFileRepo) LockChunkMerge(uploadID string) (bool, error) {
+	return repo.cache.Lock(fmt.Sprintf("chunkupload:merge:%s", uploadID), 10*time.Minute)
+}
+
+func (repo *mysqlFileRepo) UnlockChunkMerge(uploadID string) {
+	repo.cache.Unlock(fmt.Sprintf("chunkupload:merge:%s", uploadID))
+}
+
 /*
 //写入缓存
 	//栈思想存储用户和父文件夹旗下的文件
@@ -0,0 +1,25 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type FileRequestRepository interface {
+	CreateFileRequest(ctx context.Context, request *model.FileRequest) error
+	GetFileRequestByUniqueID(ctx context.Context, uniqueID string) (*model.FileRequest, error)
+	GetUserFileRequests(ctx context.Context, userID uint) ([]*model.FileRequest, int64, error)
+	// DeleteFileRequest 删除链接与提交记录，已上传的文件保留在文件夹中
+	DeleteFileRequest(ctx context.Context, requestID uint) error
+
+	// AddUsage 累计上传总量，超过上限时不修改并返回false
+	AddUsage(ctx context.Context, requestID uint, size int64) (bool, error)
+	ReleaseUsage(ctx context.Context, requestID uint, size int64) error
+
+	// 提交记录
+	CreateSubmission(ctx context.Context, submission *model.FileSubmission) error
+	UpdateSubmission(ctx context.Context, submission *model.FileSubmission) error
+	GetSubmissionByUploadID(ctx context.Context, uploadID string) (*model.FileSubmission, error)
+	// GetSubmissions 只返回已完成的提交
+	GetSubmissions(ctx context.Context, requestID uint, page, pageSize int) ([]*model.FileSubmission, int64, error)
+}
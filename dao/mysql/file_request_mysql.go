@@ -0,0 +1,121 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// 已上传总量需要原子地累计，直接读写mysql，不经过缓存
+type mysqlFileRequestRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlFileRequestRepo(db *gorm.DB, cache *cache.RedisClient) FileRequestRepository {
+	if err := db.AutoMigrate(&model.FileRequest{}, &model.FileSubmission{}); err != nil {
+		panic("Failed to migrate file request tables: " + err.Error())
+	}
+	return &mysqlFileRequestRepo{db, cache}
+}
+
+func (repo *mysqlFileRequestRepo) CreateFileRequest(ctx context.Context, request *model.FileRequest) error {
+	if err := repo.db.WithContext(ctx).Create(request).Error; err != nil {
+		return errors.New("create file request failed")
+	}
+	return nil
+}
+
+func (repo *mysqlFileRequestRepo) GetFileRequestByUniqueID(ctx context.Context, uniqueID string) (*model.FileRequest, error) {
+	var request model.FileRequest
+	if err := repo.db.WithContext(ctx).Where("unique_id = ?", uniqueID).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (repo *mysqlFileRequestRepo) GetUserFileRequests(ctx context.Context, userID uint) ([]*model.FileRequest, int64, error) {
+	var requests []*model.FileRequest
+	if err := repo.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, int64(len(requests)), nil
+}
+
+func (repo *mysqlFileRequestRepo) DeleteFileRequest(ctx context.Context, requestID uint) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("request_id = ?", requestID).Delete(&model.FileSubmission{}).Error; err != nil {
+			return errors.New("delete file request failed")
+		}
+		if err := tx.Delete(&model.FileRequest{}, requestID).Error; err != nil {
+			return errors.New("delete file request failed")
+		}
+		return nil
+	})
+}
+
+func (repo *mysqlFileRequestRepo) AddUsage(ctx context.Context, requestID uint, size int64) (bool, error) {
+	res := repo.db.WithContext(ctx).Model(&model.FileRequest{}).
+		Where("id = ? AND (max_total_size = 0 OR used_size + ? <= max_total_size * 1048576)", requestID, size).
+		Updates(map[string]interface{}{
+			"used_size":  gorm.Expr("used_size + ?", size),
+			"file_count": gorm.Expr("file_count + 1"),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (repo *mysqlFileRequestRepo) ReleaseUsage(ctx context.Context, requestID uint, size int64) error {
+	return repo.db.WithContext(ctx).Model(&model.FileRequest{}).Where("id = ?", requestID).Updates(map[string]interface{}{
+		"used_size":  gorm.Expr("GREATEST(used_size - ?, 0)", size),
+		"file_count": gorm.Expr("GREATEST(file_count - 1, 0)"),
+	}).Error
+}
+
+func (repo *mysqlFileRequestRepo) CreateSubmission(ctx context.Context, submission *model.FileSubmission) error {
+	if err := repo.db.WithContext(ctx).Create(submission).Error; err != nil {
+		return errors.New("create file submission failed")
+	}
+	return nil
+}
+
+func (repo *mysqlFileRequestRepo) UpdateSubmission(ctx context.Context, submission *model.FileSubmission) error {
+	if err := repo.db.WithContext(ctx).Omit("File").Save(submission).Error; err != nil {
+		return errors.New("update file submission failed")
+	}
+	return nil
+}
+
+func (repo *mysqlFileRequestRepo) GetSubmissionByUploadID(ctx context.Context, uploadID string) (*model.FileSubmission, error) {
+	var submission model.FileSubmission
+	if err := repo.db.WithContext(ctx).Where("upload_id = ?", uploadID).First(&submission).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("file submission not found")
+		}
+		return nil, err
+	}
+	return &submission, nil
+}
+
+func (repo *mysqlFileRequestRepo) GetSubmissions(ctx context.Context, requestID uint, page, pageSize int) ([]*model.FileSubmission, int64, error) {
+	var submissions []*model.FileSubmission
+	var total int64
+
+	query := repo.db.WithContext(ctx).Model(&model.FileSubmission{}).Where("request_id = ? AND file_id IS NOT NULL", requestID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Preload("File").Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&submissions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return submissions, total, nil
+}
@@ -0,0 +1,15 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type OfflineTaskRepository interface {
+	CreateTask(ctx context.Context, task *model.OfflineTask) error
+	GetTaskByID(ctx context.Context, taskID uint) (*model.OfflineTask, error)
+	GetUserTasks(ctx context.Context, userID uint) ([]*model.OfflineTask, int64, error)
+	UpdateTask(ctx context.Context, task *model.OfflineTask) error
+	// GetTasksByStatus 服务重启时恢复未完成的任务
+	GetTasksByStatus(ctx context.Context, statuses ...string) ([]*model.OfflineTask, error)
+}
@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// 任务进度变化频繁，直接读写mysql，不经过缓存
+type mysqlOfflineTaskRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlOfflineTaskRepo(db *gorm.DB, cache *cache.RedisClient) OfflineTaskRepository {
+	if err := db.AutoMigrate(&model.OfflineTask{}); err != nil {
+		panic("Failed to migrate offline task table: " + err.Error())
+	}
+	return &mysqlOfflineTaskRepo{db, cache}
+}
+
+func (repo *mysqlOfflineTaskRepo) CreateTask(ctx context.Context, task *model.OfflineTask) error {
+	if err := repo.db.WithContext(ctx).Create(task).Error; err != nil {
+		return errors.New("create offline task failed")
+	}
+	return nil
+}
+
+func (repo *mysqlOfflineTaskRepo) GetTaskByID(ctx context.Context, taskID uint) (*model.OfflineTask, error) {
+	var task model.OfflineTask
+	if err := repo.db.WithContext(ctx).First(&task, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("offline task not found")
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (repo *mysqlOfflineTaskRepo) GetUserTasks(ctx context.Context, userID uint) ([]*model.OfflineTask, int64, error) {
+	var tasks []*model.OfflineTask
+	if err := repo.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+	return tasks, int64(len(tasks)), nil
+}
+
+func (repo *mysqlOfflineTaskRepo) UpdateTask(ctx context.Context, task *model.OfflineTask) error {
+	if err := repo.db.WithContext(ctx).Save(task).Error; err != nil {
+		return errors.New("update offline task failed")
+	}
+	return nil
+}
+
+func (repo *mysqlOfflineTaskRepo) GetTasksByStatus(ctx context.Context, statuses ...string) ([]*model.OfflineTask, error) {
+	var tasks []*model.OfflineTask
+	if err := repo.db.WithContext(ctx).Where("status IN ?", statuses).Order("id ASC").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
@@ -0,0 +1,13 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type UploadPolicyRepository interface {
+	// GetUploadPolicy 管理员未修改过策略时返回gorm.ErrRecordNotFound
+	GetUploadPolicy(ctx context.Context) (*model.UploadPolicy, error)
+	SaveUploadPolicy(ctx context.Context, policy *model.UploadPolicy) error
+	DeleteUploadPolicy(ctx context.Context) error
+}
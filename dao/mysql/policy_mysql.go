@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 全局只有一条上传策略
+const (
+	uploadPolicyID       = 1
+	uploadPolicyCacheKey = "upload_policy"
+)
+
+type mysqlUploadPolicyRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlUploadPolicyRepo(db *gorm.DB, cache *cache.RedisClient) UploadPolicyRepository {
+	if err := db.AutoMigrate(&model.UploadPolicy{}); err != nil {
+		panic("Failed to migrate upload policy table: " + err.Error())
+	}
+	return &mysqlUploadPolicyRepo{db, cache}
+}
+
+func (repo *mysqlUploadPolicyRepo) GetUploadPolicy(ctx context.Context) (*model.UploadPolicy, error) {
+	//cache
+	if repo.cache != nil {
+		var policy model.UploadPolicy
+		if err := repo.cache.Get(uploadPolicyCacheKey, &policy); err == nil {
+			if policy.UpdatedAt.IsZero() {
+				// 空值缓存：未修改过策略
+				return nil, gorm.ErrRecordNotFound
+			}
+			policy.ID = uploadPolicyID
+			return &policy, nil
+		}
+	}
+
+	//mysql
+	var policy model.UploadPolicy
+	err := repo.db.WithContext(ctx).First(&policy, uploadPolicyID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	//cache，未修改过策略时同样缓存，避免每次上传都查库
+	if repo.cache != nil {
+		if errSet := repo.cache.Set(uploadPolicyCacheKey, &policy, repo.cache.RandExp(5*time.Minute)); errSet != nil {
+			return nil, errors.New("set cache failed")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func (repo *mysqlUploadPolicyRepo) SaveUploadPolicy(ctx context.Context, policy *model.UploadPolicy) error {
+	policy.ID = uploadPolicyID
+	if err := repo.db.WithContext(ctx).Save(policy).Error; err != nil {
+		return errors.New("save upload policy failed")
+	}
+
+	//写后删除
+	return repo.cleanCache()
+}
+
+func (repo *mysqlUploadPolicyRepo) DeleteUploadPolicy(ctx context.Context) error {
+	if err := repo.db.WithContext(ctx).Delete(&model.UploadPolicy{}, uploadPolicyID).Error; err != nil {
+		return errors.New("delete upload policy failed")
+	}
+
+	//写后删除
+	return repo.cleanCache()
+}
+
+func (repo *mysqlUploadPolicyRepo) cleanCache() error {
+	if repo.cache == nil {
+		return nil
+	}
+	if err := repo.cache.Delete(uploadPolicyCacheKey); err != nil {
+		return errors.New("delete cache failed")
+	}
+	return nil
+}
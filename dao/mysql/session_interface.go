@@ -0,0 +1,23 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+	"time"
+)
+
+type SessionRepository interface {
+	// CreateSession 创建会话并保存第一个刷新令牌
+	CreateSession(ctx context.Context, session *model.Session, tokenHash string) error
+	// GetRefreshToken 按摘要查询刷新令牌，不存在时返回gorm.ErrRecordNotFound
+	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	GetSession(ctx context.Context, sessionID string) (*model.Session, error)
+	// RotateRefreshToken 作废旧的刷新令牌、保存新的并顺延会话，旧令牌已被使用过时返回false
+	RotateRefreshToken(ctx context.Context, tokenID uint, sessionID, newTokenHash, clientIP string, expiresAt time.Time) (bool, error)
+	// ListActiveSessions 列出用户未撤销且未过期的会话，最近使用的在前
+	ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error)
+	// RevokeSession 撤销用户的一个会话，会话不存在或已撤销时返回false
+	RevokeSession(ctx context.Context, userID int, sessionID, reason string) (bool, error)
+	// RevokeUserSessions 撤销用户除exceptSessionID外的全部会话，返回被撤销的会话ID
+	RevokeUserSessions(ctx context.Context, userID int, exceptSessionID, reason string) ([]string, error)
+}
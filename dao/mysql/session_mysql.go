@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type mysqlSessionRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlSessionRepo(db *gorm.DB, cache *cache.RedisClient) SessionRepository {
+	if err := db.AutoMigrate(&model.Session{}, &model.RefreshToken{}); err != nil {
+		panic("Failed to migrate session tables: " + err.Error())
+	}
+	return &mysqlSessionRepo{db, cache}
+}
+
+func (repo *mysqlSessionRepo) CreateSession(ctx context.Context, session *model.Session, tokenHash string) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return errors.New("create session failed")
+		}
+		token := model.RefreshToken{SessionID: session.SessionID, TokenHash: tokenHash}
+		if err := tx.Create(&token).Error; err != nil {
+			return errors.New("create refresh token failed")
+		}
+		return nil
+	})
+}
+
+func (repo *mysqlSessionRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	if err := repo.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repo *mysqlSessionRepo) GetSession(ctx context.Context, sessionID string) (*model.Session, error) {
+	var session model.Session
+	if err := repo.db.WithContext(ctx).Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (repo *mysqlSessionRepo) RotateRefreshToken(ctx context.Context, tokenID uint, sessionID, newTokenHash, clientIP string, expiresAt time.Time) (bool, error) {
+	rotated := false
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		//条件更新，同一个刷新令牌并发刷新时只有一个能成功
+		res := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", tokenID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return errors.New("use refresh token failed")
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		token := model.RefreshToken{SessionID: sessionID, TokenHash: newTokenHash}
+		if err := tx.Create(&token).Error; err != nil {
+			return errors.New("create refresh token failed")
+		}
+		err := tx.Model(&model.Session{}).Where("session_id = ?", sessionID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_ip": clientIP, "expires_at": expiresAt}).Error
+		if err != nil {
+			return errors.New("update session failed")
+		}
+		rotated = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return rotated, nil
+}
+
+func (repo *mysqlSessionRepo) ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	var sessions []model.Session
+	err := repo.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, errors.New("select sessions failed")
+	}
+	return sessions, nil
+}
+
+func (repo *mysqlSessionRepo) RevokeSession(ctx context.Context, userID int, sessionID, reason string) (bool, error) {
+	res := repo.db.WithContext(ctx).Model(&model.Session{}).
+		Where("user_id = ? AND session_id = ? AND revoked_at IS NULL", userID, sessionID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason})
+	if res.Error != nil {
+		return false, errors.New("revoke session failed")
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (repo *mysqlSessionRepo) RevokeUserSessions(ctx context.Context, userID int, exceptSessionID, reason string) ([]string, error) {
+	var sessionIDs []string
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now())
+		if exceptSessionID != "" {
+			query = query.Where("session_id <> ?", exceptSessionID)
+		}
+		if err := query.Pluck("session_id", &sessionIDs).Error; err != nil {
+			return errors.New("select sessions failed")
+		}
+		if len(sessionIDs) == 0 {
+			return nil
+		}
+		err := tx.Model(&model.Session{}).
+			Where("session_id IN ? AND revoked_at IS NULL", sessionIDs).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+		if err != nil {
+			return errors.New("revoke sessions failed")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
+}
@@ -7,9 +7,24 @@ import (
 
 type ShareRepository interface {
 	CreateShare(ctx context.Context, share *model.Share, fileIDs []uint) error
+	// GetShareByUniqueID 分享不存在时返回gorm.ErrRecordNotFound
 	GetShareByUniqueID(ctx context.Context, UniqueID string) (*model.Share, error)
 	GetUserShares(ctx context.Context, userID uint) ([]*model.Share, int64, error)
 	DeleteShare(ctx context.Context, shareID uint) error
+	UpdateSharePassword(ctx context.Context, share *model.Share, hashedPassword string) error
+	// UpdateShare 保存有效期、密码、停用状态、下载上限与水印设置，fileIDs不为nil时替换分享的文件
+	UpdateShare(ctx context.Context, share *model.Share, fileIDs []uint) error
+	// GetShareByShortCode 按短码查找分享，不存在时返回gorm.ErrRecordNotFound
+	GetShareByShortCode(ctx context.Context, code string) (*model.Share, error)
+	// UpdateShortCode 保存分享的短码，为nil时删除短链接
+	UpdateShortCode(ctx context.Context, share *model.Share) error
+	// GetExpiredShares 用户已过期的分享
+	GetExpiredShares(ctx context.Context, userID uint) ([]*model.Share, int64, error)
 	IsExp(share *model.Share) bool
 	LoadFiles(ctx context.Context, share *model.Share) error
+
+	// 分享统计
+	AddShareStats(ctx context.Context, shareID uint, views, downloads, visitors int64) error
+	CreateAccessLogs(ctx context.Context, logs []*model.ShareAccessLog) error
+	GetAccessLogs(ctx context.Context, shareID uint, page, pageSize int) ([]*model.ShareAccessLog, int64, error)
 }
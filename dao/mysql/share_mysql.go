@@ -17,9 +17,22 @@ type mysqlShareRepo struct {
 }
 
 func NewMysqlShareRepo(db *gorm.DB, cache *cache.RedisClient) ShareRepository {
-	if err := db.AutoMigrate(&model.Share{}, &model.ShareFile{}); err != nil {
+	if err := db.AutoMigrate(&model.Share{}, &model.ShareFile{}, &model.ShareAccessLog{}); err != nil {
 		panic("Failed to migrate share tables: " + err.Error())
 	}
+	// 旧版本只保存了有效时长，换算为过期时间
+	err := db.Model(&model.Share{}).Where("exp > 0 AND expire_at IS NULL").
+		Update("expire_at", gorm.Expr("DATE_ADD(created_at, INTERVAL exp DIV 1000000000 SECOND)")).Error
+	if err != nil {
+		panic("Failed to migrate share expiry: " + err.Error())
+	}
+	// 旧版本中有效天数为0的分享创建后立即过期，现在0表示永久有效
+	// 旧记录没有updated_at，迁移为在创建时过期，避免这些分享重新可以访问
+	err = db.Model(&model.Share{}).Where("exp = 0 AND expire_at IS NULL AND updated_at IS NULL").
+		Update("expire_at", gorm.Expr("created_at")).Error
+	if err != nil {
+		panic("Failed to migrate share expiry: " + err.Error())
+	}
 	return &mysqlShareRepo{db, cache}
 }
 
@@ -88,7 +101,7 @@ func (repo *mysqlShareRepo) GetShareByUniqueID(ctx context.Context, uniqueID str
 					return nil, errors.New("set cache failed")
 				}
 			}
-			return nil, errors.New("set cache failed")
+			return nil, gorm.ErrRecordNotFound
 		}
 		return nil, errors.New("set cache failed")
 	}
@@ -183,6 +196,11 @@ func (repo *mysqlShareRepo) DeleteShare(ctx context.Context, shareID uint) error
 			return errors.New("delete share failed")
 		}
 
+		// 删除访问记录
+		if err := tx.Where("share_id = ?", shareID).Delete(&model.ShareAccessLog{}).Error; err != nil {
+			return errors.New("delete share failed")
+		}
+
 		// 删除分享记录
 		if err := tx.Delete(&model.Share{}, shareID).Error; err != nil {
 			return errors.New("delete share failed")
@@ -208,12 +226,93 @@ func (repo *mysqlShareRepo) DeleteShare(ctx context.Context, shareID uint) error
 		return nil
 	})
 }
-func (repo *mysqlShareRepo) IsExp(share *model.Share) bool {
-	expTime := share.CreatedAt.Add(time.Duration(share.Exp) * time.Hour * 24)
-	if expTime.After(time.Now()) {
-		return false
+func (repo *mysqlShareRepo) UpdateSharePassword(ctx context.Context, share *model.Share, hashedPassword string) error {
+	if err := repo.db.WithContext(ctx).Model(&model.Share{}).Where("id = ?", share.ID).Update("password", hashedPassword).Error; err != nil {
+		return errors.New("update share password failed")
+	}
+	share.Password = hashedPassword
+
+	// 清理缓存
+	if repo.cache != nil {
+		if err := repo.cache.Delete(fmt.Sprintf("share:unique_id:%s", share.UniqueID)); err != nil {
+			return errors.New("update share password failed")
+		}
+		if err := repo.cache.Delete(fmt.Sprintf("user_shares:%d", share.UserID)); err != nil {
+			return errors.New("update share password failed")
+		}
+	}
+	return nil
+}
+func (repo *mysqlShareRepo) UpdateShare(ctx context.Context, share *model.Share, fileIDs []uint) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(share).Select("expire_at", "password", "disabled", "max_downloads", "watermark", "updated_at").Updates(share).Error
+		if err != nil {
+			return errors.New("update share failed")
+		}
+
+		if fileIDs != nil {
+			if err := tx.Where("share_id = ?", share.ID).Delete(&model.ShareFile{}).Error; err != nil {
+				return errors.New("update share files failed")
+			}
+			for _, id := range fileIDs {
+				if err := tx.Create(&model.ShareFile{ShareID: share.ID, FileID: id}).Error; err != nil {
+					return errors.New("update share files failed")
+				}
+			}
+		}
+
+		return repo.clearShareCache(share)
+	})
+}
+
+func (repo *mysqlShareRepo) GetShareByShortCode(ctx context.Context, code string) (*model.Share, error) {
+	var share model.Share
+	err := repo.db.WithContext(ctx).Where("short_code = ?", code).First(&share).Error
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+func (repo *mysqlShareRepo) UpdateShortCode(ctx context.Context, share *model.Share) error {
+	err := repo.db.WithContext(ctx).Model(share).Update("short_code", share.ShortCode).Error
+	if err != nil {
+		return err
 	}
-	return true
+	return repo.clearShareCache(share)
+}
+
+func (repo *mysqlShareRepo) GetExpiredShares(ctx context.Context, userID uint) ([]*model.Share, int64, error) {
+	var shares []*model.Share
+	err := repo.db.WithContext(ctx).Where("user_id = ? AND expire_at IS NOT NULL AND expire_at <= ?", userID, time.Now()).
+		Order("expire_at DESC").Find(&shares).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, share := range shares {
+		if err := repo.LoadFiles(ctx, share); err != nil {
+			return nil, 0, err
+		}
+	}
+	return shares, int64(len(shares)), nil
+}
+
+func (repo *mysqlShareRepo) clearShareCache(share *model.Share) error {
+	if repo.cache == nil {
+		return nil
+	}
+	if err := repo.cache.Delete(fmt.Sprintf("share:unique_id:%s", share.UniqueID)); err != nil {
+		return errors.New("delete share cache failed")
+	}
+	if err := repo.cache.Delete(fmt.Sprintf("user_shares:%d", share.UserID)); err != nil {
+		return errors.New("delete share cache failed")
+	}
+	return nil
+}
+
+// IsExp 分享是否已过期，未设置过期时间的分享不过期
+func (repo *mysqlShareRepo) IsExp(share *model.Share) bool {
+	return share.ExpireAt != nil && !share.ExpireAt.After(time.Now())
 }
 func (repo *mysqlShareRepo) LoadFiles(ctx context.Context, share *model.Share) error {
 	var shareFiles []model.ShareFile
@@ -224,3 +323,34 @@ func (repo *mysqlShareRepo) LoadFiles(ctx context.Context, share *model.Share) e
 	share.ShareFiles = shareFiles
 	return nil
 }
+
+// AddShareStats 写回redis中累计的计数，visitors为HyperLogLog的估算值，直接覆盖
+func (repo *mysqlShareRepo) AddShareStats(ctx context.Context, shareID uint, views, downloads, visitors int64) error {
+	return repo.db.WithContext(ctx).Model(&model.Share{}).Where("id = ?", shareID).Updates(map[string]interface{}{
+		"view_count":     gorm.Expr("view_count + ?", views),
+		"download_count": gorm.Expr("download_count + ?", downloads),
+		"visitor_count":  gorm.Expr("GREATEST(visitor_count, ?)", visitors),
+	}).Error
+}
+
+func (repo *mysqlShareRepo) CreateAccessLogs(ctx context.Context, logs []*model.ShareAccessLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return repo.db.WithContext(ctx).CreateInBatches(logs, 200).Error
+}
+
+func (repo *mysqlShareRepo) GetAccessLogs(ctx context.Context, shareID uint, page, pageSize int) ([]*model.ShareAccessLog, int64, error) {
+	var logs []*model.ShareAccessLog
+	var total int64
+
+	query := repo.db.WithContext(ctx).Model(&model.ShareAccessLog{}).Where("share_id = ?", shareID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
@@ -0,0 +1,23 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/model"
+	"context"
+)
+
+type TwoFactorRepository interface {
+	// EnableTOTP 保存密钥并开启两步验证，同时替换用户的全部恢复码
+	EnableTOTP(ctx context.Context, userID int, secret string, codeHashes []string) error
+	// DisableTOTP 关闭两步验证，清除密钥与恢复码
+	DisableTOTP(ctx context.Context, userID int) error
+	// ReplaceRecoveryCodes 作废旧的恢复码并保存新的
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	// UseRecoveryCode 将未使用的恢复码标记为已使用，恢复码不存在或已使用时返回false
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	// CountRecoveryCodes 统计剩余可用的恢复码
+	CountRecoveryCodes(ctx context.Context, userID int) (int64, error)
+
+	// GetSecurityPolicy 管理员未修改过策略时返回gorm.ErrRecordNotFound
+	GetSecurityPolicy(ctx context.Context) (*model.SecurityPolicy, error)
+	SaveSecurityPolicy(ctx context.Context, policy *model.SecurityPolicy) error
+}
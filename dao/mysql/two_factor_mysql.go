@@ -0,0 +1,184 @@
+package mysql
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 全局只有一条安全策略
+const (
+	securityPolicyID       = 1
+	securityPolicyCacheKey = "security_policy"
+)
+
+type mysqlTwoFactorRepo struct {
+	db    *gorm.DB
+	cache *cache.RedisClient
+}
+
+func NewMysqlTwoFactorRepo(db *gorm.DB, cache *cache.RedisClient) TwoFactorRepository {
+	if err := db.AutoMigrate(&model.RecoveryCode{}, &model.SecurityPolicy{}); err != nil {
+		panic("Failed to migrate two factor tables: " + err.Error())
+	}
+	return &mysqlTwoFactorRepo{db, cache}
+}
+
+func (repo *mysqlTwoFactorRepo) EnableTOTP(ctx context.Context, userID int, secret string, codeHashes []string) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true}).Error
+		if err != nil {
+			return errors.New("enable totp failed")
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	if err != nil {
+		return err
+	}
+
+	//写后删除
+	return repo.cleanUserCache(ctx, userID)
+}
+
+func (repo *mysqlTwoFactorRepo) DisableTOTP(ctx context.Context, userID int) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false}).Error
+		if err != nil {
+			return errors.New("disable totp failed")
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return errors.New("delete recovery codes failed")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//写后删除
+	return repo.cleanUserCache(ctx, userID)
+}
+
+func (repo *mysqlTwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return errors.New("delete recovery codes failed")
+	}
+	codes := make([]model.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, model.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	if err := tx.Create(&codes).Error; err != nil {
+		return errors.New("create recovery codes failed")
+	}
+	return nil
+}
+
+func (repo *mysqlTwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	//条件更新，并发使用同一个恢复码时只有一个能成功
+	res := repo.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, errors.New("use recovery code failed")
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (repo *mysqlTwoFactorRepo) CountRecoveryCodes(ctx context.Context, userID int) (int64, error) {
+	var count int64
+	err := repo.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	if err != nil {
+		return 0, errors.New("count recovery codes failed")
+	}
+	return count, nil
+}
+
+func (repo *mysqlTwoFactorRepo) GetSecurityPolicy(ctx context.Context) (*model.SecurityPolicy, error) {
+	//cache
+	if repo.cache != nil {
+		var policy model.SecurityPolicy
+		if err := repo.cache.Get(securityPolicyCacheKey, &policy); err == nil {
+			if policy.UpdatedAt.IsZero() {
+				// 空值缓存：未修改过策略
+				return nil, gorm.ErrRecordNotFound
+			}
+			policy.ID = securityPolicyID
+			return &policy, nil
+		}
+	}
+
+	//mysql
+	var policy model.SecurityPolicy
+	err := repo.db.WithContext(ctx).First(&policy, securityPolicyID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	//cache，未修改过策略时同样缓存，避免每次访问后台都查库
+	if repo.cache != nil {
+		if errSet := repo.cache.Set(securityPolicyCacheKey, &policy, repo.cache.RandExp(5*time.Minute)); errSet != nil {
+			return nil, errors.New("set cache failed")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func (repo *mysqlTwoFactorRepo) SaveSecurityPolicy(ctx context.Context, policy *model.SecurityPolicy) error {
+	policy.ID = securityPolicyID
+	if err := repo.db.WithContext(ctx).Save(policy).Error; err != nil {
+		return errors.New("save security policy failed")
+	}
+
+	//写后删除
+	if repo.cache == nil {
+		return nil
+	}
+	if err := repo.cache.Delete(securityPolicyCacheKey); err != nil {
+		return errors.New("delete cache failed")
+	}
+	return nil
+}
+
+// cleanUserCache 用户的两步验证状态变化后删除用户缓存
+func (repo *mysqlTwoFactorRepo) cleanUserCache(ctx context.Context, userID int) error {
+	if repo.cache == nil {
+		return nil
+	}
+	var user model.User
+	if err := repo.db.WithContext(ctx).Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return errors.New("select user failed")
+	}
+	keys := []string{
+		fmt.Sprintf("user:id:%d", user.UserID),
+		fmt.Sprintf("user:username:%s", user.Username),
+		fmt.Sprintf("user:email:%s", user.Email),
+	}
+	for _, key := range keys {
+		if err := repo.cache.Delete(key); err != nil {
+			return errors.New("delete cache failed")
+		}
+	}
+	return nil
+}
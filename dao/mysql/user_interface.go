@@ -23,6 +23,8 @@ type UserRepository interface {
 	GetBannedUsers() ([]model.User, int64, error)
 	GetUsers() ([]model.User, int64, error)
 	GetAdmin() ([]model.User, int64, error)
+	// GetTokenVersion 用户当前的令牌版本，签发时写入令牌，封禁、修改角色或密码后版本加一，旧令牌全部失效
+	GetTokenVersion(userID int) (int, error)
 
 	// 更新
 	UpdateUsername(userID int, username string) error
@@ -30,6 +32,7 @@ type UserRepository interface {
 	UpdateEmail(userID int, email string) error
 	UpdateRole(userID int, role string) error
 	UpdateStorage(userID int, storage int64) error
+	IncrStorage(userID int, delta int64) error
 	UpdateUserRole(userID int, role string) error
 	AddInvitationCodeNum(userID int) error
 	BanUser(userID int) error
@@ -9,6 +9,7 @@ import (
 	"log"
 	"time"
 
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -443,52 +444,41 @@ func (repo *mysqlUserRepo) UpdateUsername(userID int, username string) error {
 }
 
 func (repo *mysqlUserRepo) UpdatePassword(userID int, password string) error {
-	return repo.db.Transaction(func(tx *gorm.DB) error {
-		var user model.User
-		err := repo.db.Model(&user).Where("user_id = ?", userID).Update("password", password).Error
+	var user model.User
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"password": password, "token_version": gorm.Expr("token_version + 1")}).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
 
 		//更新后数据
-		err = repo.db.Where("user_id = ?", userID).First(&user).Error
+		err = tx.Where("user_id = ?", userID).First(&user).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
-
-		//写后删除缓存
-		err = repo.cache.Delete(fmt.Sprintf("user:id:%d", user.UserID))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:username:%s", user.Username))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:email:%s", user.Email))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-
-		cacheKey1 := fmt.Sprintf("users")
-		cacheKey2 := fmt.Sprintf("admin_users")
-		err = repo.cache.Clean(cacheKey1)
-		if err != nil {
-			return errors.New("set cache failed")
-		}
-		err = repo.cache.Clean(cacheKey2)
-		if err != nil {
-			return errors.New("set cache failed")
-		}
-
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	//提交后再处理缓存
+	repo.refreshUserCache(&user, "users", "admin_users")
+	return nil
 }
 
 func (repo *mysqlUserRepo) UpdateEmail(userID int, email string) error {
 	return repo.db.Transaction(func(tx *gorm.DB) error {
+		//更新前数据，旧邮箱的缓存同样需要删除
+		var oldUser model.User
+		err := repo.db.Where("user_id = ?", userID).First(&oldUser).Error
+		if err != nil {
+			return errors.New("update user failed")
+		}
+
 		var user model.User
-		err := repo.db.Model(&user).Where("user_id = ?", userID).Update("email", email).Error
+		err = repo.db.Model(&user).Where("user_id = ?", userID).Update("email", email).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
@@ -512,6 +502,10 @@ func (repo *mysqlUserRepo) UpdateEmail(userID int, email string) error {
 		if err != nil {
 			return errors.New("delete user failed")
 		}
+		err = repo.cache.Delete(fmt.Sprintf("user:email:%s", oldUser.Email))
+		if err != nil {
+			return errors.New("delete user failed")
+		}
 
 		cacheKey1 := fmt.Sprintf("users")
 		cacheKey2 := fmt.Sprintf("admin_users")
@@ -529,46 +523,49 @@ func (repo *mysqlUserRepo) UpdateEmail(userID int, email string) error {
 }
 
 func (repo *mysqlUserRepo) UpdateRole(userID int, role string) error {
-	return repo.db.Transaction(func(tx *gorm.DB) error {
-		var user model.User
-		err := repo.db.Model(&user).Where("user_id = ?", userID).Update("role", role).Error
+	var user model.User
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"role": role, "token_version": gorm.Expr("token_version + 1")}).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
 
 		//更新后数据
-		err = repo.db.Where("user_id = ?", userID).First(&user).Error
+		err = tx.Where("user_id = ?", userID).First(&user).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		//写后删除缓存
-		err = repo.cache.Delete(fmt.Sprintf("user:id:%d", user.UserID))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:username:%s", user.Username))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:email:%s", user.Email))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
+	//提交后再处理缓存
+	repo.refreshUserCache(&user, "users", "admin_users")
+	return nil
+}
 
-		cacheKey1 := fmt.Sprintf("users")
-		cacheKey2 := fmt.Sprintf("admin_users")
-		err = repo.cache.Clean(cacheKey1)
-		if err != nil {
-			return errors.New("set cache failed")
-		}
-		err = repo.cache.Clean(cacheKey2)
-		if err != nil {
-			return errors.New("set cache failed")
-		}
+// IncrStorage 原子地增减已用存储空间，结果不小于0
+func (repo *mysqlUserRepo) IncrStorage(userID int, delta int64) error {
+	var user model.User
+	err := repo.db.Model(&user).Where("user_id = ?", userID).
+		Update("storage", gorm.Expr("GREATEST(storage + ?, 0)", delta)).Error
+	if err != nil {
+		return fmt.Errorf("更新存储空间失败: %v", err)
+	}
 
-		return nil
-	})
+	//写后删除缓存
+	if err := repo.db.Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	repo.cache.Delete(fmt.Sprintf("user:id:%d", user.UserID))
+	repo.cache.Delete(fmt.Sprintf("user:username:%s", user.Username))
+	repo.cache.Delete(fmt.Sprintf("user:email:%s", user.Email))
+	repo.cache.Clean("users", "admin_users")
+
+	return nil
 }
 
 func (repo *mysqlUserRepo) UpdateStorage(userID int, storage int64) error {
@@ -723,7 +720,7 @@ func (repo *mysqlUserRepo) CreateInvitationCode(invitationCode model.InvitationC
 		}
 
 		//邂逅删除
-		CacheKey := fmt.Sprintf("invitationCode:%s", invitationCode)
+		CacheKey := fmt.Sprintf("invitationCode:%s", invitationCode.Code)
 		err = repo.cache.Delete(CacheKey)
 		if err != nil {
 			return errors.New("set cache failed")
@@ -745,7 +742,7 @@ func (repo *mysqlUserRepo) UseInvitationCode(invitationCode string, userID int)
 		}
 
 		//邂逅删除
-		CacheKey := fmt.Sprintf("invitationCode:%s", invitationCode)
+		CacheKey := fmt.Sprintf("invitationCode:%s", invitationCode.Code)
 		err = repo.cache.Delete(CacheKey)
 		if err != nil {
 			return errors.New("set cache failed")
@@ -924,38 +921,28 @@ func (repo *mysqlUserRepo) GetAllUserRecourse() (int64, int64, error) {
 }
 
 func (repo *mysqlUserRepo) BanUser(userID int) error {
-	return repo.db.Transaction(func(tx *gorm.DB) error {
-		var user model.User
-		err := repo.db.Model(&user).Where("user_id = ?", userID).Update("is_banned", true).Error
+	var user model.User
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"is_banned": true, "token_version": gorm.Expr("token_version + 1")}).Error
 		if err != nil {
 			return errors.New("ban user failed")
 		}
 
 		//更新后数据
-		err = repo.db.Where("user_id = ?", userID).First(&user).Error
+		err = tx.Where("user_id = ?", userID).First(&user).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
-
-		//写后删除缓存
-		err = repo.cache.Delete(fmt.Sprintf("user:id:%d", user.UserID))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:username:%s", user.Username))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:email:%s", user.Email))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Clean("banned_users")
-		if err != nil {
-			return errors.New("delete user failed")
-		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	//提交后再处理缓存
+	repo.refreshUserCache(&user, "banned_users")
+	return nil
 }
 
 func (repo *mysqlUserRepo) RecoverUser(userID int) error {
@@ -1042,35 +1029,28 @@ func (repo *mysqlUserRepo) GetBannedUsers() ([]model.User, int64, error) {
 }
 
 func (repo *mysqlUserRepo) UpdateUserRole(userID int, role string) error {
-	return repo.db.Transaction(func(tx *gorm.DB) error {
-		var user model.User
-		err := repo.db.Model(&user).Where("user_id = ?", userID).Update("role", role).Error
+	var user model.User
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"role": role, "token_version": gorm.Expr("token_version + 1")}).Error
 		if err != nil {
-			return errors.New("recover banned user failed")
+			return errors.New("update user role failed")
 		}
 
 		//更新后数据
-		err = repo.db.Where("user_id = ?", userID).First(&user).Error
+		err = tx.Where("user_id = ?", userID).First(&user).Error
 		if err != nil {
 			return errors.New("update user failed")
 		}
-
-		//写后删除缓存
-		err = repo.cache.Delete(fmt.Sprintf("user:id:%d", user.UserID))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:username:%s", user.Username))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-		err = repo.cache.Delete(fmt.Sprintf("user:email:%s", user.Email))
-		if err != nil {
-			return errors.New("delete user failed")
-		}
-
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	//提交后再处理缓存
+	repo.refreshUserCache(&user)
+	return nil
 }
 
 func (repo *mysqlUserRepo) GetUsers() ([]model.User, int64, error) {
@@ -1166,3 +1146,66 @@ func (repo *mysqlUserRepo) GetAdmin() ([]model.User, int64, error) {
 
 	return users, int64(len(users)), nil
 }
+
+func tokenVersionCacheKey(userID int) string {
+	return fmt.Sprintf("user:token_version:%d", userID)
+}
+
+// refreshUserCache 令牌版本增加的写操作提交后调用：删除用户缓存，并把新的令牌版本写入缓存
+// 数据库已经提交，缓存失败不影响操作结果，只记录日志
+func (repo *mysqlUserRepo) refreshUserCache(user *model.User, cleanKeys ...string) {
+	if repo.cache == nil {
+		return
+	}
+	keys := []string{
+		fmt.Sprintf("user:id:%d", user.UserID),
+		fmt.Sprintf("user:username:%s", user.Username),
+		fmt.Sprintf("user:email:%s", user.Email),
+	}
+	for _, key := range append(keys, cleanKeys...) {
+		if err := repo.cache.Delete(key); err != nil {
+			zap.S().Errorf("删除缓存 %s 失败: %v", key, err)
+		}
+	}
+
+	//直接写入新版本而不是删除，并发的GetTokenVersion不能再把旧版本写回缓存
+	versionKey := tokenVersionCacheKey(user.UserID)
+	if err := repo.cache.SetMax(versionKey, int64(user.TokenVersion), repo.cache.RandExp(30*time.Minute)); err != nil {
+		zap.S().Errorf("写入令牌版本缓存失败: %v", err)
+		if err := repo.cache.Delete(versionKey); err != nil {
+			zap.S().Errorf("删除缓存 %s 失败: %v", versionKey, err)
+		}
+	}
+}
+
+// GetTokenVersion 每次认证都会调用，优先读缓存，封禁、修改角色或密码提交后写入新版本
+func (repo *mysqlUserRepo) GetTokenVersion(userID int) (int, error) {
+	//缓存
+	if repo.cache != nil {
+		var version int
+		if err := repo.cache.Get(tokenVersionCacheKey(userID), &version); err == nil {
+			return version, nil
+		}
+	}
+
+	//数据库
+	var user model.User
+	err := repo.db.Select("user_id", "token_version").Where("user_id = ?", userID).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return -1, errors.New("user not found")
+		}
+		return -1, errors.New("get token version failed")
+	}
+
+	//写入缓存
+	if repo.cache != nil {
+		//读数据库之后版本可能已经增加，SetMax不会用旧版本覆盖新版本
+		err := repo.cache.SetMax(tokenVersionCacheKey(userID), int64(user.TokenVersion), repo.cache.RandExp(30*time.Minute))
+		if err != nil {
+			return -1, errors.New("set cache failed")
+		}
+	}
+
+	return user.TokenVersion, nil
+}
@@ -4,6 +4,7 @@ import (
 	"ClaranCloudDisk/model"
 	services "ClaranCloudDisk/service"
 	"ClaranCloudDisk/util"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -342,3 +343,313 @@ func (h *AdminHandler) GetAdminList(c *gin.Context) {
 		"total": total,
 	}, "获取op用户列表成功")
 }
+
+// GetQuarantineList godoc
+// @Summary 获取隔离文件列表
+// @Description 管理员获取未通过上传内容扫描而被隔离的文件，scan_result为命中的病毒/策略名称
+// @Tags 后台管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/quarantine [get]
+func (h *AdminHandler) GetQuarantineList(c *gin.Context) {
+	zap.L().Info("获取隔离文件列表请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	files, total, err := h.adminService.GetQuarantineList(c.Request.Context())
+	if err != nil {
+		zap.S().Errorf("获取隔离文件列表失败: %v", err)
+		util.Error(c, 500, "获取隔离文件列表失败")
+		return
+	}
+
+	zap.L().Info("获取隔离文件列表请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"files": files,
+		"total": total,
+	}, "获取隔离文件列表成功")
+}
+
+// ReleaseQuarantine godoc
+// @Summary 解除文件隔离
+// @Description 管理员复核后解除文件隔离，内容相同（秒传共用同一对象）的文件一并解除
+// @Tags 后台管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "文件ID"
+// @Success 200 {object} map[string]interface{} "解除成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/quarantine/{id}/release [post]
+func (h *AdminHandler) ReleaseQuarantine(c *gin.Context) {
+	zap.L().Info("解除文件隔离请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	fileID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		zap.S().Errorf("无效的文件ID: %v", err)
+		util.Error(c, 400, "无效的文件ID")
+		return
+	}
+
+	released, err := h.adminService.ReleaseQuarantine(c.Request.Context(), fileID)
+	if err != nil {
+		zap.S().Errorf("解除文件隔离失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	zap.L().Info("解除文件隔离请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"file_id":  fileID,
+		"released": released,
+	}, "解除文件隔离成功")
+}
+
+// GetUploadPolicy godoc
+// @Summary 获取上传策略
+// @Description 管理员获取当前生效的上传策略，未修改过时为config.yaml中的默认值
+// @Tags 后台管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "LOGGetUploadPolicy成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/upload_policy [get]
+func (h *AdminHandler) GetUploadPolicy(c *gin.Context) {
+	zap.L().Info("LOGGetUploadPolicy请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	policy, err := h.adminService.GetUploadPolicy(c.Request.Context())
+	if err != nil {
+		zap.S().Errorf("LOGGetUploadPolicy失败: %v", err)
+		util.Error(c, 500, "LOGGetUploadPolicy失败")
+		return
+	}
+
+	zap.L().Info("LOGGetUploadPolicy请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"policy": policy,
+	}, "LOGGetUploadPolicy成功")
+}
+
+// UpdateUploadPolicy godoc
+// @Summary 修改上传策略
+// @Description 管理员在运行时修改上传策略，立即对之后的上传生效；未传的字段保持不变，传空数组清空名单
+// @Tags 后台管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.UpdateUploadPolicyRequest true "上传策略"
+// @Success 200 {object} map[string]interface{} "LOGUpdateUploadPolicy成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/upload_policy [put]
+func (h *AdminHandler) UpdateUploadPolicy(c *gin.Context) {
+	zap.L().Info("LOGUpdateUploadPolicy请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	var req model.UpdateUploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	policy, err := h.adminService.UpdateUploadPolicy(c.Request.Context(), &req)
+	if err != nil {
+		zap.S().Errorf("LOGUpdateUploadPolicy失败: %v", err)
+		util.Error(c, 500, "LOGUpdateUploadPolicy失败")
+		return
+	}
+
+	zap.L().Info("LOGUpdateUploadPolicy请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"policy": policy,
+	}, "LOGUpdateUploadPolicy成功")
+}
+
+// ResetUploadPolicy godoc
+// @Summary 重置上传策略
+// @Description 管理员删除运行时修改的上传策略，恢复为config.yaml中的默认值
+// @Tags 后台管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "LOGResetUploadPolicy成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/upload_policy [delete]
+func (h *AdminHandler) ResetUploadPolicy(c *gin.Context) {
+	zap.L().Info("LOGResetUploadPolicy请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	policy, err := h.adminService.ResetUploadPolicy(c.Request.Context())
+	if err != nil {
+		zap.S().Errorf("LOGResetUploadPolicy失败: %v", err)
+		util.Error(c, 500, "LOGResetUploadPolicy失败")
+		return
+	}
+
+	zap.L().Info("LOGResetUploadPolicy请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"policy": policy,
+	}, "LOGResetUploadPolicy成功")
+}
+
+// GetSecurityPolicy godoc
+// @Summary 获取账号安全策略
+// @Description 管理员获取当前生效的账号安全策略，未修改过时为config.yaml中的默认值
+// @Tags 后台管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取安全策略成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限或未按安全策略开启两步验证"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/security_policy [get]
+func (h *AdminHandler) GetSecurityPolicy(c *gin.Context) {
+	zap.L().Info("获取安全策略请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	policy, err := h.adminService.GetSecurityPolicy(c.Request.Context())
+	if err != nil {
+		zap.S().Errorf("获取安全策略失败: %v", err)
+		util.Error(c, 500, "获取安全策略失败")
+		return
+	}
+
+	zap.L().Info("获取安全策略请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"policy": policy,
+	}, "获取安全策略成功")
+}
+
+// UpdateSecurityPolicy godoc
+// @Summary 修改账号安全策略
+// @Description 管理员在运行时修改账号安全策略，如要求管理员开启两步验证；未传的字段保持不变
+// @Description 要求开启后，未开启两步验证的管理员不能访问后台接口，需要先在/user/2fa/setup开启
+// @Tags 后台管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.UpdateSecurityPolicyRequest true "安全策略"
+// @Success 200 {object} map[string]interface{} "修改安全策略成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限或未按安全策略开启两步验证"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/security_policy [put]
+func (h *AdminHandler) UpdateSecurityPolicy(c *gin.Context) {
+	zap.L().Info("修改安全策略请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	var req model.UpdateSecurityPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	policy, err := h.adminService.UpdateSecurityPolicy(c.Request.Context(), &req)
+	if err != nil {
+		zap.S().Errorf("修改安全策略失败: %v", err)
+		util.Error(c, 500, "修改安全策略失败")
+		return
+	}
+
+	zap.L().Info("修改安全策略请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"policy": policy,
+	}, "修改安全策略成功")
+}
+
+// GetAuditLogs godoc
+// @Summary 查看审计记录
+// @Description 管理员查看安全相关事件，如分享密码被暴力尝试、分享ID被枚举
+// @Tags 后台管理
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "事件类型（share_brute_force/share_enumeration/two_factor_failure），不传返回全部"
+// @Param page query int false "页码（从1开始）"
+// @Param page_size query int false "每页条数（默认20，最大100）"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无管理员权限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /admin/audit [get]
+func (h *AdminHandler) GetAuditLogs(c *gin.Context) {
+	zap.L().Info("获取审计记录请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	logs, total, err := h.adminService.GetAuditLogs(c.Request.Context(), c.Query("type"), page, pageSize)
+	if err != nil {
+		zap.S().Errorf("获取审计记录失败: %v", err)
+		util.Error(c, 500, "获取审计记录失败")
+		return
+	}
+
+	zap.L().Info("获取审计记录请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"logs":  logs,
+		"total": total,
+	}, "获取审计记录成功")
+}
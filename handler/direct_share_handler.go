@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type DirectShareHandler struct {
+	directShareService *services.DirectShareService
+}
+
+func NewDirectShareHandler(directShareService *services.DirectShareService) *DirectShareHandler {
+	return &DirectShareHandler{
+		directShareService: directShareService,
+	}
+}
+
+// ShareWithUsers godoc
+// @Summary 定向分享给指定用户
+// @Description 将文件或文件夹直接分享给平台内的用户（用户名或邮箱），权限为read只读或write读写
+// @Description 分享文件夹时对其中的所有文件生效；已分享过的接收者更新为新的权限
+// @Tags 分享管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.DirectShareRequest true "定向分享请求参数"
+// @Success 200 {object} map[string]interface{} "分享成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或用户不存在"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Router /share/direct [post]
+func (h *DirectShareHandler) ShareWithUsers(c *gin.Context) {
+	zap.L().Info("定向分享请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.DirectShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	shares, err := h.directShareService.ShareWithUsers(ctx, uint(userID), &req)
+	if err != nil {
+		zap.S().Errorf("定向分享失败: %v", err)
+		util.Error(c, 400, "定向分享失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("定向分享请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"shares": shares,
+	}, "定向分享成功")
+}
+
+// GetGranted godoc
+// @Summary 查看我的定向分享
+// @Description 分享者查看自己分享给指定用户的文件及接收者，可按文件筛选
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param file_id query int false "文件ID，不传时返回全部"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /share/direct [get]
+func (h *DirectShareHandler) GetGranted(c *gin.Context) {
+	zap.L().Info("查看定向分享请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	fileID, err := strconv.ParseUint(c.DefaultQuery("file_id", "0"), 10, 32)
+	if err != nil {
+		zap.S().Errorf("无效的文件ID: %v", err)
+		util.Error(c, 400, "无效的文件ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	shares, err := h.directShareService.GetGranted(ctx, uint(userID), uint(fileID))
+	if err != nil {
+		zap.S().Errorf("查看定向分享失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("查看定向分享请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"shares": shares,
+		"total":  len(shares),
+	}, "获取定向分享成功")
+}
+
+// SharedWithMe godoc
+// @Summary 分享给我的文件
+// @Description 查看其他用户定向分享给我的文件和文件夹及权限
+// @Description 之后通过文件接口访问：/file/{id}、/file/{id}/download、/file/folder?parent_id= 等
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /share/received [get]
+func (h *DirectShareHandler) SharedWithMe(c *gin.Context) {
+	zap.L().Info("查看分享给我的文件请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+
+	ctx := c.Request.Context()
+	shares, err := h.directShareService.SharedWithMe(ctx, uint(userID))
+	if err != nil {
+		zap.S().Errorf("查看分享给我的文件失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("查看分享给我的文件请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"shares": shares,
+		"total":  len(shares),
+	}, "获取分享给我的文件成功")
+}
+
+// Revoke godoc
+// @Summary 撤销定向分享
+// @Description 分享者撤销对某个接收者的定向分享，接收者也可以移除分享给自己的文件，撤销后立即失去访问权限
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "定向分享ID"
+// @Success 200 {object} map[string]interface{} "撤销成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权撤销"
+// @Router /share/direct/{id} [delete]
+func (h *DirectShareHandler) Revoke(c *gin.Context) {
+	zap.L().Info("撤销定向分享请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		zap.S().Errorf("无效的分享ID: %v", err)
+		util.Error(c, 400, "无效的分享ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.directShareService.Revoke(ctx, uint(userID), uint(id)); err != nil {
+		zap.S().Errorf("撤销定向分享失败: %v", err)
+		util.Error(c, 403, err.Error())
+		return
+	}
+
+	zap.L().Info("撤销定向分享请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"id": id,
+	}, "撤销定向分享成功")
+}
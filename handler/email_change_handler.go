@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type EmailChangeHandler struct {
+	emailChangeService *services.EmailChangeService
+}
+
+func NewEmailChangeHandler(emailChangeService *services.EmailChangeService) *EmailChangeHandler {
+	return &EmailChangeHandler{
+		emailChangeService: emailChangeService,
+	}
+}
+
+// RequestEmailChange godoc
+// @Summary 修改邮箱：申请
+// @Description 验证当前密码后向新邮箱发送验证码，10分钟内需调用/user/email/confirm确认，确认前邮箱不变
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.ChangeEmailRequest true "修改邮箱请求参数"
+// @Success 200 {object} map[string]interface{} "验证码已发送到新邮箱"
+// @Failure 400 {object} map[string]interface{} "请求参数错误、邮箱格式错误、邮箱未变化或已被使用"
+// @Failure 401 {object} map[string]interface{} "未授权或密码错误"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/email/change [post]
+func (h *EmailChangeHandler) RequestEmailChange(c *gin.Context) {
+	zap.L().Info("申请修改邮箱请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	if err := h.emailChangeService.Request(c.Request.Context(), userID, req.Password, req.NewEmail); err != nil {
+		zap.S().Errorf("申请修改邮箱失败: %v", err)
+		util.Error(c, emailChangeStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("申请修改邮箱请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"new_email": req.NewEmail,
+	}, "验证码已发送到新邮箱")
+}
+
+// ConfirmEmailChange godoc
+// @Summary 修改邮箱：确认
+// @Description 使用新邮箱收到的验证码确认修改，修改成功后向旧邮箱发送通知
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.ConfirmEmailChangeRequest true "确认修改邮箱请求参数"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误、验证码错误、没有待确认的修改或邮箱已被使用"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/email/confirm [post]
+func (h *EmailChangeHandler) ConfirmEmailChange(c *gin.Context) {
+	zap.L().Info("确认修改邮箱请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	email, err := h.emailChangeService.Confirm(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		zap.S().Errorf("确认修改邮箱失败: %v", err)
+		util.Error(c, emailChangeStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("确认修改邮箱请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"email": email,
+	}, "邮箱修改成功")
+}
+
+func emailChangeStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrEmailChangeFormat),
+		errors.Is(err, services.ErrEmailUnchanged),
+		errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrEmailChangeNotPending),
+		errors.Is(err, services.ErrEmailChangeCode):
+		return 400
+	case errors.Is(err, services.ErrEmailChangePassword):
+		return 401
+	}
+	return 500
+}
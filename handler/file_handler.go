@@ -4,7 +4,10 @@ import (
 	"ClaranCloudDisk/model"
 	"ClaranCloudDisk/service"
 	"ClaranCloudDisk/util"
+	"ClaranCloudDisk/util/filetype"
 	"ClaranCloudDisk/util/minIO"
+	"ClaranCloudDisk/util/preview"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -38,8 +41,10 @@ func NewFileHandler(fileService *services.FileService, minioClient *minIO.MinIOC
 // @Success 200 {object} map[string]interface{} "上传成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "文件数量已达上限"
 // @Failure 413 {object} map[string]interface{} "文件太大"
-// @Failure 415 {object} map[string]interface{} "不支持的文件类型"
+// @Failure 415 {object} map[string]interface{} "文件内容与扩展名不一致（reject策略）或上传策略不允许该类型"
+// @Failure 429 {object} map[string]interface{} "今日上传总量已达上限"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /file/upload [post]
 func (h *FileHandler) Upload(c *gin.Context) {
@@ -70,6 +75,18 @@ func (h *FileHandler) Upload(c *gin.Context) {
 	fileContent, err := h.fileService.Upload(ctx, userID, src, file)
 	if err != nil {
 		zap.S().Errorf("上传文件失败: %v", err)
+		if status, ok := policyStatus(err); ok {
+			util.Error(c, status, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrQuotaExceeded) || errors.Is(err, services.ErrFileTooLarge) {
+			util.Error(c, 413, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrMimeMismatch) {
+			util.Error(c, 415, err.Error())
+			return
+		}
 		util.Error(c, 500, "上传失败: "+err.Error())
 		return
 	}
@@ -81,31 +98,105 @@ func (h *FileHandler) Upload(c *gin.Context) {
 
 	//返回响应
 	util.Success(c, gin.H{"data": gin.H{
-		"id":         fileContent.ID,
-		"name":       fileContent.Name,
-		"size":       fileContent.Size,
-		"mime_type":  fileContent.MimeType,
-		"created_at": fileContent.CreatedAt,
+		"id":            fileContent.ID,
+		"name":          fileContent.Name,
+		"size":          fileContent.Size,
+		"mime_type":     fileContent.MimeType,
+		"detected_mime": fileContent.DetectedMime,
+		"mime_mismatch": fileContent.MimeMismatch,
+		"created_at":    fileContent.CreatedAt,
 	}}, "文件上传成功")
 }
 
+// InitChunkUpload godoc
+// @Summary 初始化分片上传
+// @Description 声明文件名、大小、SHA-256与分片数，检查存储空间后签发upload_id；会话按用户隔离
+// @Tags 文件管理
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file_name formData string true "文件名"
+// @Param file_hash formData string true "整个文件的SHA-256（十六进制），合并后校验"
+// @Param file_size formData int true "文件总字节数"
+// @Param chunk_total formData int true "总分片数"
+// @Param file_mime_type formData string false "客户端声明的MIME类型，仅作记录，真实类型由服务端根据文件头识别"
+// @Success 200 {object} map[string]interface{} "初始化成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "文件数量已达上限"
+// @Failure 413 {object} map[string]interface{} "文件太大或存储空间不足"
+// @Failure 415 {object} map[string]interface{} "上传策略不允许该扩展名"
+// @Failure 429 {object} map[string]interface{} "今日上传总量已达上限"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/chunk_upload/init [post]
+func (h *FileHandler) InitChunkUpload(c *gin.Context) {
+	zap.L().Info("初始化分片上传请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	fileName := c.PostForm("file_name")
+	fileHash := c.PostForm("file_hash")
+	fileMimeType := c.PostForm("file_mime_type")
+	fileSize, errSize := strconv.ParseInt(c.PostForm("file_size"), 10, 64)
+	chunkTotal, errTotal := strconv.Atoi(c.PostForm("chunk_total"))
+	if fileName == "" || fileHash == "" || errSize != nil || errTotal != nil || fileSize < 0 || chunkTotal < 1 {
+		zap.S().Errorf("分片上传元数据错误")
+		util.Error(c, 400, "请正确填写file_name、file_hash、file_size、chunk_total")
+		return
+	}
+
+	//服务层
+	session, err := h.fileService.InitChunkUpload(c.Request.Context(), userID, fileName, fileHash, fileSize, chunkTotal, fileMimeType)
+	if err != nil {
+		zap.S().Errorf("初始化上传失败: %v", err)
+		if status, ok := policyStatus(err); ok {
+			util.Error(c, status, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrQuotaExceeded) || errors.Is(err, services.ErrFileTooLarge) {
+			util.Error(c, 413, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrInvalidFileHash) || errors.Is(err, services.ErrTooManyChunks) {
+			util.Error(c, 400, err.Error())
+			return
+		}
+		util.Error(c, 500, "初始化上传失败")
+		return
+	}
+
+	zap.L().Info("初始化分片上传请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"upload_id":   session.UploadID,
+		"chunk_total": session.ChunkTotal,
+	}, "初始化上传成功")
+}
+
 // ChunkUpload godoc
 // @Summary 分片上传文件
-// @Description 分片上传大文件，支持断点续传
+// @Description 上传一个分片，分片可以乱序、并发上传；全部分片到达后自动合并，并校验整个文件的SHA-256
 // @Tags 文件管理
 // @Accept multipart/form-data
 // @Produce json
 // @Security BearerAuth
+// @Param upload_id formData string true "初始化时签发的上传ID"
 // @Param chunk formData file true "文件分片"
 // @Param chunk_index formData int true "分片索引（从0开始）"
-// @Param chunk_total formData int true "总分片数"
-// @Param file_hash formData string true "文件哈希值"
-// @Param file_name formData string true "文件名"
-// @Param file_mime_type formData string true "文件MIME类型"
+// @Param chunk_hash formData string true "分片的SHA-256（十六进制）"
 // @Success 200 {object} map[string]interface{} "分片上传成功"
 // @Success 200 {object} map[string]interface{} "文件上传完成"
-// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或分片校验失败"
 // @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在或已过期"
+// @Failure 409 {object} map[string]interface{} "文件正在合并"
+// @Failure 415 {object} map[string]interface{} "文件内容与扩展名不一致（reject策略）或上传策略不允许该类型"
+// @Failure 422 {object} map[string]interface{} "合并后的文件与声明的哈希不一致"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /file/chunk_upload [post]
 func (h *FileHandler) ChunkUpload(c *gin.Context) {
@@ -123,13 +214,11 @@ func (h *FileHandler) ChunkUpload(c *gin.Context) {
 		return
 	}
 	//获取分片状态数据
+	uploadID := c.PostForm("upload_id")
 	chunkIndexStr := c.PostForm("chunk_index") // Str
-	chunkTotalStr := c.PostForm("chunk_total") // Str
-	fileHash := c.PostForm("file_hash")
-	fileName := c.PostForm("file_name")
-	fileMimeType := c.PostForm("file_mime_type") // mimetype
-	if chunkIndexStr == "" || chunkTotalStr == "" || fileHash == "" || fileName == "" {
-		zap.S().Errorf("无分片元数据: %v", err)
+	chunkHash := c.PostForm("chunk_hash")
+	if uploadID == "" || chunkIndexStr == "" || chunkHash == "" {
+		zap.S().Errorf("无分片元数据")
 		util.Error(c, 400, "请上传元数据")
 		return
 	}
@@ -140,17 +229,6 @@ func (h *FileHandler) ChunkUpload(c *gin.Context) {
 		util.Error(c, 400, "chunkIndex应当是数字")
 		return
 	}
-	chunkTotal, err := strconv.Atoi(chunkTotalStr)
-	if err != nil {
-		zap.S().Errorf("不正确的chunkTotal格式: %v", err)
-		util.Error(c, 400, "chunkTotal应当是数字")
-		return
-	}
-
-	if chunkIndex < 0 || chunkTotal < 1 {
-		zap.S().Errorf("不正确的chunkIndex或chunkTotal: %v", err)
-		util.Error(c, 400, "chunkIndex或chunkTotal错误")
-	}
 
 	fileReader, err := file.Open()
 	if err != nil {
@@ -160,8 +238,7 @@ func (h *FileHandler) ChunkUpload(c *gin.Context) {
 	}
 	defer fileReader.Close()
 
-	chunkData := make([]byte, file.Size)
-	_, err = fileReader.Read(chunkData)
+	chunkData, err := io.ReadAll(fileReader)
 	if err != nil {
 		zap.S().Errorf("读取分片文件失败: %v", err)
 		util.Error(c, 500, "读取分片文件失败")
@@ -169,30 +246,48 @@ func (h *FileHandler) ChunkUpload(c *gin.Context) {
 	}
 
 	//服务层
-	//如果是第一个分片 -> 初始化分片上传
-	if chunkIndex == 0 {
-		err := h.fileService.InitChunkUpload(userID, fileName, fileHash, chunkTotal) // 初始化上传，创建临时文件夹
-		if err != nil {
-			zap.S().Errorf("初始化上传失败: %v", err)
-			util.Error(c, 500, "初始化上传失败")
-			return
-		}
-	}
-
 	//保存分片文件
-	err = h.fileService.SaveChunk(fileHash, userID, chunkIndex, chunkData)
+	session, err := h.fileService.SaveChunk(userID, uploadID, chunkIndex, chunkHash, chunkData)
 	if err != nil {
 		zap.S().Errorf("保存分片文件失败: %v", err)
-		util.Error(c, 500, err.Error())
+		switch {
+		case errors.Is(err, services.ErrChunkSessionNotFound):
+			util.Error(c, 404, err.Error())
+		case errors.Is(err, services.ErrChunkHashMismatch), errors.Is(err, services.ErrChunkIndexOutOfRange):
+			util.Error(c, 400, err.Error())
+		default:
+			util.Error(c, 500, err.Error())
+		}
 		return
 	}
 
-	//如果是最后一个分片 -> 合并所有分片文件 & 返回上传成功响应
-	if chunkIndex == chunkTotal-1 {
-		file, err := h.fileService.MergeAllChunks(userID, fileHash, fileName, fileMimeType)
+	//全部分片到达 -> 合并所有分片文件 & 返回上传成功响应
+	finished, err := h.fileService.IsChunkUploadFinished(uploadID)
+	if err != nil {
+		zap.S().Errorf("检查上传状态失败: %v", err)
+		util.Error(c, 500, "检查上传状态失败")
+		return
+	}
+	if finished {
+		file, err := h.fileService.MergeAllChunks(userID, uploadID)
 		if err != nil {
 			zap.S().Errorf("合并分片失败: %v", err)
-			util.Error(c, 500, "合并分片失败")
+			if status, ok := policyStatus(err); ok {
+				util.Error(c, status, err.Error())
+				return
+			}
+			switch {
+			case errors.Is(err, services.ErrChunkMerging):
+				util.Error(c, 409, err.Error())
+			case errors.Is(err, services.ErrFileHashMismatch):
+				util.Error(c, 422, err.Error())
+			case errors.Is(err, services.ErrMimeMismatch):
+				util.Error(c, 415, err.Error())
+			case errors.Is(err, services.ErrChunkSessionNotFound):
+				util.Error(c, 404, err.Error())
+			default:
+				util.Error(c, 500, "合并分片失败")
+			}
 			return
 		}
 
@@ -202,11 +297,14 @@ func (h *FileHandler) ChunkUpload(c *gin.Context) {
 			zap.String("client_ip", c.ClientIP()))
 
 		util.Success(c, gin.H{
-			"id":         file.ID,
-			"name":       file.Name,
-			"size":       file.Size,
-			"mime_type":  file.MimeType,
-			"created_at": file.CreatedAt,
+			"id":            file.ID,
+			"name":          file.Name,
+			"size":          file.Size,
+			"hash":          file.Hash,
+			"mime_type":     file.MimeType,
+			"detected_mime": file.DetectedMime,
+			"mime_mismatch": file.MimeMismatch,
+			"created_at":    file.CreatedAt,
 		}, "文件上传成功")
 		return
 	}
@@ -218,23 +316,24 @@ func (h *FileHandler) ChunkUpload(c *gin.Context) {
 
 	//返回响应
 	util.Success(c, gin.H{
+		"upload_id":   uploadID,
 		"chunk_index": chunkIndex,
-		"chunk_total": chunkTotal,
+		"chunk_total": session.ChunkTotal,
 		"status":      "uncompleted",
 	}, "分片上传成功")
 }
 
 // GetChunkStatus godoc
 // @Summary 获取分片上传状态
-// @Description 查询文件分片上传的进度状态，用于断点续传
+// @Description 查询已上传的分片，用于断点续传
 // @Tags 文件管理
-// @Accept multipart/form-data
 // @Produce json
 // @Security BearerAuth
-// @Param file_hash formData string true "文件哈希值"
+// @Param upload_id query string true "上传ID"
 // @Success 200 {object} map[string]interface{} "查询成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在或已过期"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /file/chunk_upload/status [get]
 func (h *FileHandler) GetChunkStatus(c *gin.Context) {
@@ -243,17 +342,22 @@ func (h *FileHandler) GetChunkStatus(c *gin.Context) {
 		zap.String("method", c.Request.Method),
 		zap.String("client_ip", c.ClientIP()))
 	//捕获数据
-	fileHash := c.PostForm("file_hash")
-	if fileHash == "" {
-		zap.S().Errorf("缺少filehash参数")
-		util.Error(c, 400, "缺少fileHash参数")
+	userID := c.GetInt("user_id")
+	uploadID := c.Query("upload_id")
+	if uploadID == "" {
+		zap.S().Errorf("缺少upload_id参数")
+		util.Error(c, 400, "缺少upload_id参数")
 		return
 	}
 
 	//服务层
-	uploadedChunks, err := h.fileService.GetUploadedChunks(fileHash)
+	session, uploadedChunks, err := h.fileService.GetUploadedChunks(userID, uploadID)
 	if err != nil {
 		zap.S().Errorf("获取分片状态失败: %v", err)
+		if errors.Is(err, services.ErrChunkSessionNotFound) {
+			util.Error(c, 404, err.Error())
+			return
+		}
 		util.Error(c, 500, err.Error())
 		return
 	}
@@ -265,12 +369,54 @@ func (h *FileHandler) GetChunkStatus(c *gin.Context) {
 
 	//成功响应
 	util.Success(c, gin.H{
-		"file_hash":       fileHash,
+		"upload_id":       uploadID,
+		"file_name":       session.FileName,
+		"chunk_total":     session.ChunkTotal,
 		"uploaded_chunks": uploadedChunks,
 		"uploaded_count":  len(uploadedChunks),
 	}, "获取上传状态成功")
 }
 
+// AbortChunkUpload godoc
+// @Summary 取消分片上传
+// @Description 删除上传会话与已上传的分片
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Param upload_id path string true "上传ID"
+// @Success 200 {object} map[string]interface{} "取消成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在或已过期"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/chunk_upload/{upload_id} [delete]
+func (h *FileHandler) AbortChunkUpload(c *gin.Context) {
+	zap.L().Info("取消分片上传请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	uploadID := c.Param("upload_id")
+
+	//服务层
+	if err := h.fileService.AbortChunkUpload(userID, uploadID); err != nil {
+		zap.S().Errorf("取消分片上传失败: %v", err)
+		if errors.Is(err, services.ErrChunkSessionNotFound) {
+			util.Error(c, 404, err.Error())
+			return
+		}
+		util.Error(c, 500, "取消上传失败")
+		return
+	}
+
+	zap.L().Info("取消分片上传请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{"upload_id": uploadID}, "已取消上传")
+}
+
 // Download /:id/download
 // Download godoc
 // @Summary 下载文件
@@ -282,7 +428,7 @@ func (h *FileHandler) GetChunkStatus(c *gin.Context) {
 // @Success 200 {file} binary "文件流"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
-// @Failure 403 {object} map[string]interface{} "无访问权限"
+// @Failure 403 {object} map[string]interface{} "无访问权限或文件已被隔离"
 // @Failure 404 {object} map[string]interface{} "文件不存在"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /file/{id}/download [get]
@@ -303,6 +449,11 @@ func (h *FileHandler) Download(c *gin.Context) {
 	//调用服务
 	ctx := c.Request.Context()
 	file, limitedSpeed, err := h.fileService.Download(ctx, userID, fileID)
+	if errors.Is(err, services.ErrFileQuarantined) {
+		zap.S().Errorf("文件已被隔离: %v", fileID)
+		util.Error(c, 403, err.Error())
+		return
+	}
 	if err != nil || limitedSpeed == -1 {
 		zap.S().Errorf("文件不存在或无权限访问: %v", err)
 		util.Error(c, 404, "文件不存在或无权访问: "+err.Error())
@@ -767,16 +918,169 @@ func (h *FileHandler) Rename(c *gin.Context) {
 	}, "重命名成功")
 }
 
+// CreateFolder godoc
+// @Summary 新建文件夹
+// @Description 在根目录或指定文件夹下新建文件夹，同一目录下不能重名
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.CreateFolderRequest true "新建文件夹请求参数"
+// @Success 200 {object} map[string]interface{} "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或文件夹名已存在"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Router /file/folder [post]
+func (h *FileHandler) CreateFolder(c *gin.Context) {
+	zap.L().Info("新建文件夹请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	var req model.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	//调用服务层
+	ctx := c.Request.Context()
+	folder, err := h.fileService.CreateFolder(ctx, userID, req.Name, req.ParentID)
+	if err != nil {
+		zap.S().Errorf("新建文件夹失败: %v", err)
+		util.Error(c, 400, "新建文件夹失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("新建文件夹请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	//返回响应
+	util.Success(c, gin.H{
+		"data": folder,
+	}, "新建文件夹成功")
+}
+
+// ListFolder godoc
+// @Summary 获取文件夹内容
+// @Description 列出根目录或指定文件夹下的文件与子文件夹，文件夹排在前面
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Param parent_id query int false "文件夹ID，不传时列出根目录"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或文件夹不存在"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Router /file/folder [get]
+func (h *FileHandler) ListFolder(c *gin.Context) {
+	zap.L().Info("获取文件夹内容请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	var parentID *uint
+	if raw := c.Query("parent_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			zap.S().Errorf("无效的文件夹ID: %v", err)
+			util.Error(c, 400, "无效的文件夹ID")
+			return
+		}
+		folderID := uint(id)
+		parentID = &folderID
+	}
+
+	//调用服务层
+	ctx := c.Request.Context()
+	files, err := h.fileService.ListFolder(ctx, userID, parentID)
+	if err != nil {
+		zap.S().Errorf("获取文件夹内容失败: %v", err)
+		util.Error(c, 400, "获取文件夹内容失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("获取文件夹内容请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	//返回响应
+	util.Success(c, gin.H{
+		"files": files,
+		"total": len(files),
+	}, "获取文件夹内容成功")
+}
+
+// MoveFile godoc
+// @Summary 移动文件
+// @Description 将文件或文件夹移动到指定文件夹，parent_id为空时移动到根目录
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "文件ID"
+// @Param request body model.MoveFileRequest true "移动文件请求参数"
+// @Success 200 {object} map[string]interface{} "移动成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或目标文件夹不合法"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Router /file/{id}/move [put]
+func (h *FileHandler) MoveFile(c *gin.Context) {
+	zap.L().Info("移动文件请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		zap.S().Errorf("无效的文件ID: %v", err)
+		util.Error(c, 400, "无效的文件ID")
+		return
+	}
+	var req model.MoveFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	//调用服务层
+	ctx := c.Request.Context()
+	file, err := h.fileService.MoveFile(ctx, userID, uint(fileID), req.ParentID)
+	if err != nil {
+		zap.S().Errorf("移动文件失败: %v", err)
+		util.Error(c, 400, "移动文件失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("移动文件请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	//返回响应
+	util.Success(c, gin.H{
+		"data": file,
+	}, "移动成功")
+}
+
 // Preview godoc
 // @Summary 预览文件
 // @Description 预览指定文件（支持图片、视频、音频、文档等多种格式）
+// @Description Markdown返回清洗后的HTML，CSV/TSV返回分页的表格JSON，源码返回内容及识别出的语言
 // @Tags 文件管理
 // @Security BearerAuth
 // @Param id path int true "文件ID"
+// @Param page query int false "表格预览页码（从1开始）"
+// @Param page_size query int false "表格预览每页行数（默认50，最大500）"
 // @Success 200 {file} binary "文件预览"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
-// @Failure 403 {object} map[string]interface{} "无访问权限"
+// @Failure 403 {object} map[string]interface{} "无访问权限或文件已被隔离"
 // @Failure 404 {object} map[string]interface{} "文件不存在"
 // @Failure 415 {object} map[string]interface{} "不支持的文件类型"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
@@ -803,7 +1107,34 @@ func (h *FileHandler) Preview(c *gin.Context) {
 		util.Error(c, 404, "文件不存在或无权访问: "+err.Error())
 		return
 	}
+	if file.Quarantined {
+		zap.S().Errorf("文件已被隔离: %v", fileID)
+		util.Error(c, 403, services.ErrFileQuarantined.Error())
+		return
+	}
 
+	h.servePreview(c, file)
+
+	zap.L().Info("预览文件请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+}
+
+// servePreview 按文件类型返回预览内容，文件预览与分享预览共用
+func (h *FileHandler) servePreview(c *gin.Context, file *model.File) {
+	//服务层获取文件类型（按文件头识别出的类型路由）
+	fileType, err := h.fileService.PreviewType(c.Request.Context(), file)
+	if err != nil {
+		zap.S().Errorf("获取文件类型失败: %v", err)
+		util.Error(c, 500, "获取文件类型失败: "+err.Error())
+		return
+	}
+	h.servePreviewType(c, file, fileType)
+}
+
+// servePreviewType 按预览类别返回文件，分享预览的类别由服务层确定
+func (h *FileHandler) servePreviewType(c *gin.Context, file *model.File, fileType string) {
 	exist, err := h.minioClient.Exists(c, file.Path)
 	if err != nil {
 		zap.S().Errorf("检查文件失败: %v", err)
@@ -823,13 +1154,6 @@ func (h *FileHandler) Preview(c *gin.Context) {
 	//}
 	//=============================================================================================================
 
-	//服务层获取文件类型
-	fileType, err := h.fileService.GetMimeType(ctx, file)
-	if err != nil {
-		zap.S().Errorf("获取文件类型失败: %v", err)
-		util.Error(c, 500, "获取文件类型失败: "+err.Error())
-		return
-	}
 	switch fileType {
 	case "image":
 		h.PreImage(c, file)
@@ -841,17 +1165,32 @@ func (h *FileHandler) Preview(c *gin.Context) {
 		h.PreDoc(c, file)
 	case "text":
 		h.PreText(c, file)
+	case "markdown":
+		h.PreMarkdown(c, file)
+	case "table":
+		h.PreTable(c, file)
+	case "code":
+		h.PreCode(c, file)
 	case "other":
-		h.PreText(c, file) // // 其他类型尝试作为文本预览
+		h.PreOther(c, file) // 其他类型先判断是否为二进制，文本内容按源码预览
 	default:
 		zap.S().Errorf("未解析的文件类型: %s", fileType)
 		util.Error(c, 400, "未解析的文件类型")
-		return
 	}
-	zap.L().Info("预览文件请求结束",
-		zap.String("url", c.Request.RequestURI),
-		zap.String("method", c.Request.Method),
-		zap.String("client_ip", c.ClientIP()))
+}
+
+// detectedOr 优先使用上传时识别出的类型，未识别过的历史文件使用按扩展名推断的类型
+func detectedOr(file *model.File, fallback string) string {
+	if file.DetectedMime != "" {
+		return file.DetectedMime
+	}
+	return fallback
+}
+
+// setSandboxHeaders 活动内容（svg/html）内联返回时禁止执行脚本、加载外部资源
+func setSandboxHeaders(c *gin.Context) {
+	c.Header("Content-Security-Policy", "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+	c.Header("X-Content-Type-Options", "nosniff")
 }
 
 func (h *FileHandler) PreImage(c *gin.Context, file *model.File) {
@@ -860,9 +1199,15 @@ func (h *FileHandler) PreImage(c *gin.Context, file *model.File) {
 	if ext == "svg" {
 		ext = "svg+xml"
 	}
-	MineType := "image/" + ext
+	MineType := detectedOr(file, "image/"+ext)
 	c.Header("Content-Type", MineType)
-	c.Header("Cache-Control", "public, max-age=31536000") // 缓存1年
+	if c.Writer.Header().Get("Cache-Control") == "" {
+		c.Header("Cache-Control", "private, max-age=31536000") // 缓存1年，分享预览已设置为不缓存
+	}
+	if filetype.IsActive(MineType) {
+		//svg可以携带脚本，只在沙箱中内联展示
+		setSandboxHeaders(c)
+	}
 
 	//从minIO获取文件流
 	stream, err := h.minioClient.GetStream(c, file.Path)
@@ -888,7 +1233,7 @@ func (h *FileHandler) PreVideo(c *gin.Context, file *model.File) {
 	if ext == "mkv" {
 		ext = "x-matroska"
 	}
-	MineType := "video/" + ext
+	MineType := detectedOr(file, "video/"+ext)
 	c.Header("Content-Type", MineType)
 	c.Header("Accept-Ranges", "bytes")
 
@@ -913,7 +1258,7 @@ func (h *FileHandler) PreAudio(c *gin.Context, file *model.File) {
 	if ext == "mp3" {
 		ext = "mpeg"
 	}
-	MineType := "audio/" + ext
+	MineType := detectedOr(file, "audio/"+ext)
 	c.Header("Content-Type", MineType)
 	c.Header("Accept-Ranges", "bytes")
 
@@ -934,6 +1279,9 @@ func (h *FileHandler) PreAudio(c *gin.Context, file *model.File) {
 
 func (h *FileHandler) PreDoc(c *gin.Context, file *model.File) {
 	ext := file.Ext
+	if file.DetectedMime != "" && filetype.BaseMIME(file.DetectedMime) == "application/pdf" {
+		ext = "pdf"
+	}
 
 	switch ext {
 	case "pdf":
@@ -943,6 +1291,7 @@ func (h *FileHandler) PreDoc(c *gin.Context, file *model.File) {
 	case "txt", "md", "js", "css", "html", "json", "xml", "yaml", "yml":
 		// 文本类文件
 		h.PreText(c, file)
+		return
 	default:
 		// 其他文档类型，返回下载
 		c.Header("Content-Type", "application/octet-stream")
@@ -962,19 +1311,19 @@ func (h *FileHandler) PreDoc(c *gin.Context, file *model.File) {
 }
 
 func (h *FileHandler) PreText(c *gin.Context, file *model.File) {
-	c.Header("Content-Type", "text/plain; charset=utf-8")
-	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", file.Name))
-
-	//从minIO获取文件流
-	stream, err := h.minioClient.GetStream(c, file.Path)
+	//读取文件内容（超出预览上限的部分截断）
+	data, truncated, err := h.fileService.ReadPreviewContent(c.Request.Context(), file)
 	if err != nil {
-		zap.S().Errorf("从minIO获取文件失败: %v", err)
-		util.Error(c, 500, "从minIO获取文件失败"+err.Error())
+		zap.S().Errorf("读取文件内容失败: %v", err)
+		util.Error(c, 500, err.Error())
 		return
 	}
-	defer stream.Close()
 
-	io.Copy(c.Writer, stream)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", file.Name))
+	if truncated {
+		c.Header("X-Preview-Truncated", "true")
+	}
+	c.Data(200, "text/plain; charset=utf-8", data)
 	//=============================================================================================================
 	// 打开文件
 	//fileContent, err := os.Open(file.Path)
@@ -990,6 +1339,92 @@ func (h *FileHandler) PreText(c *gin.Context, file *model.File) {
 
 }
 
+func (h *FileHandler) PreMarkdown(c *gin.Context, file *model.File) {
+	//读取文件内容（超出预览上限的部分截断）
+	data, truncated, err := h.fileService.ReadPreviewContent(c.Request.Context(), file)
+	if err != nil {
+		zap.S().Errorf("读取文件内容失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+	if preview.IsBinary(data) {
+		zap.S().Errorf("二进制文件不支持预览: %s", file.Name)
+		util.Error(c, 415, "二进制文件不支持预览")
+		return
+	}
+
+	//渲染为清洗后的HTML
+	html, err := preview.RenderMarkdown(data)
+	if err != nil {
+		zap.S().Errorf("渲染Markdown失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	util.Success(c, gin.H{
+		"name":      file.Name,
+		"html":      html,
+		"truncated": truncated,
+	}, "预览成功")
+}
+
+func (h *FileHandler) PreTable(c *gin.Context, file *model.File) {
+	//分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	//读取文件内容（超出预览上限的部分截断）
+	data, truncated, err := h.fileService.ReadPreviewContent(c.Request.Context(), file)
+	if err != nil {
+		zap.S().Errorf("读取文件内容失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+	if preview.IsBinary(data) {
+		zap.S().Errorf("文件内容不是文本表格: %s", file.Name)
+		util.Error(c, 415, "文件内容不是文本表格，无法预览")
+		return
+	}
+
+	//解析表格
+	table, err := preview.ParseTable(data, file.Ext, page, pageSize, truncated)
+	if err != nil {
+		zap.S().Errorf("解析表格失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	util.Success(c, gin.H{
+		"name":  file.Name,
+		"table": table,
+	}, "预览成功")
+}
+
+func (h *FileHandler) PreCode(c *gin.Context, file *model.File) {
+	//读取文件内容（超出预览上限的部分截断）
+	data, truncated, err := h.fileService.ReadPreviewContent(c.Request.Context(), file)
+	if err != nil {
+		zap.S().Errorf("读取文件内容失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+	if preview.IsBinary(data) {
+		zap.S().Errorf("二进制文件不支持预览: %s", file.Name)
+		util.Error(c, 415, "二进制文件不支持预览")
+		return
+	}
+
+	util.Success(c, gin.H{
+		"name": file.Name,
+		"code": preview.BuildCode(file.Name, file.Ext, data, truncated),
+	}, "预览成功")
+}
+
+func (h *FileHandler) PreOther(c *gin.Context, file *model.File) {
+	//未知类型 -> 嗅探内容，文本按源码预览（可通过shebang识别脚本语言），二进制直接拒绝
+	h.PreCode(c, file)
+}
+
 //func (h *FileHandler) GetContent(c *gin.Context) {
 //	zap.L().Info("获取文件预览内容请求开始",
 //		zap.String("url", c.Request.RequestURI),
@@ -1133,14 +1568,19 @@ func (h *FileHandler) GetPreInfo(c *gin.Context) {
 	}
 
 	//服务层获取文件类型
-	fileType, err := h.fileService.GetMimeType(ctx, file)
+	fileType, err := h.fileService.PreviewType(ctx, file)
 	if err != nil {
 		zap.S().Errorf("获取文件类型失败: %v", err)
 		util.Error(c, 500, "获取文件类型失败: "+err.Error())
 		return
 	}
-	if fileType == "document" {
+	category := fileType
+	switch fileType {
+	case "document":
 		fileType = "application"
+		category = fileType
+	case "markdown", "table", "code":
+		fileType = "text"
 	}
 	//修改响应头
 	ext := file.Ext
@@ -1186,25 +1626,42 @@ func (h *FileHandler) GetPreInfo(c *gin.Context) {
 	if ext == "md" {
 		ext = "markdown"
 	}
+	if ext == "tsv" {
+		ext = "tab-separated-values"
+	}
+	if category == "code" {
+		ext = "plain"
+	}
 	MimeType := fileType + "/" + ext
+	if file.DetectedMime != "" {
+		MimeType = filetype.BaseMIME(file.DetectedMime)
+	}
+	if category == "other" || category == "archive" {
+		MimeType = "application/octet-stream"
+	}
 
 	canPreview := true
-	if fileType == "other" {
+	if category == "other" || category == "archive" || file.Quarantined {
 		canPreview = false
 	}
 	// 返回预览信息
 	previewInfo := gin.H{
-		"id":           file.ID,
-		"name":         file.Name,
-		"size":         file.Size,
-		"mime_type":    MimeType,
-		"category":     fileType,
-		"can_preview":  canPreview,
-		"extension":    file.Ext,
-		"preview_url":  fmt.Sprintf("/api/files/%d/preview", file.ID),
-		"content_url":  fmt.Sprintf("/api/files/%d/content", file.ID),
-		"download_url": fmt.Sprintf("/api/files/%d/download", file.ID),
-		"created_at":   file.CreatedAt,
+		"id":            file.ID,
+		"name":          file.Name,
+		"size":          file.Size,
+		"mime_type":     MimeType,
+		"category":      category,
+		"can_preview":   canPreview,
+		"extension":     file.Ext,
+		"meta":          file.Meta,
+		"has_gps":       file.Meta.HasGPS(),
+		"mime_mismatch": file.MimeMismatch,
+		"scan_status":   file.ScanStatus,
+		"quarantined":   file.Quarantined,
+		"preview_url":   fmt.Sprintf("/api/files/%d/preview", file.ID),
+		"content_url":   fmt.Sprintf("/api/files/%d/content", file.ID),
+		"download_url":  fmt.Sprintf("/api/files/%d/download", file.ID),
+		"created_at":    file.CreatedAt,
 	}
 
 	zap.L().Info("获取文件预览信息请求结束",
@@ -1219,7 +1676,7 @@ func (h *FileHandler) GetPreInfo(c *gin.Context) {
 
 // SearchFile godoc
 // @Summary 搜索文件
-// @Description 在当前用户的文件中搜索指定关键词
+// @Description 在当前用户的文件中搜索指定关键词，支持按媒体类型与拍摄时间筛选（如2025年拍摄的照片）
 // @Tags 文件管理
 // @Accept json
 // @Produce json
@@ -1241,6 +1698,7 @@ func (h *FileHandler) SearchFile(c *gin.Context) {
 	if err := c.ShouldBind(&req); err != nil {
 		zap.S().Errorf("绑定请求体失败: %v", err)
 		util.Error(c, 400, err.Error())
+		return
 	}
 
 	//服务层
@@ -1248,6 +1706,7 @@ func (h *FileHandler) SearchFile(c *gin.Context) {
 	if err != nil {
 		zap.S().Errorf("搜索文件失败: %v", err)
 		util.Error(c, 400, err.Error())
+		return
 	}
 
 	zap.L().Info("搜索文件请求结束",
@@ -1394,3 +1853,66 @@ func (h *FileHandler) GetBinList(c *gin.Context) {
 		"total": total,
 	}, "获取成功")
 }
+
+// StripGPS godoc
+// @Summary 去除图片GPS信息
+// @Description 删除JPEG图片EXIF中的GPS定位信息（建议分享前使用），其他EXIF字段保留
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "文件ID"
+// @Success 200 {object} map[string]interface{} "去除成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "无访问权限"
+// @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/{id}/strip_gps [post]
+func (h *FileHandler) StripGPS(c *gin.Context) {
+	zap.L().Info("去除GPS信息请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	fileID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的文件ID: %v", err)
+		util.Error(c, 400, "无效的文件ID")
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	file, err := h.fileService.StripGPS(ctx, userID, fileID)
+	if err != nil {
+		zap.S().Errorf("去除GPS信息失败: %v", err)
+		util.Error(c, 500, "去除GPS信息失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("去除GPS信息请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	//返回响应
+	util.Success(c, gin.H{
+		"data": file,
+	}, "去除GPS信息成功")
+}
+
+// policyStatus 违反上传策略时对应的状态码
+func policyStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, services.ErrPolicyExtDenied), errors.Is(err, services.ErrPolicyTypeDenied):
+		return 415, true
+	case errors.Is(err, services.ErrPolicyFileTooLarge):
+		return 413, true
+	case errors.Is(err, services.ErrPolicyFileCount):
+		return 403, true
+	case errors.Is(err, services.ErrPolicyDailyLimit):
+		return 429, true
+	}
+	return 0, false
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type FileRequestHandler struct {
+	fileRequestService *services.FileRequestService
+}
+
+func NewFileRequestHandler(fileRequestService *services.FileRequestService) *FileRequestHandler {
+	return &FileRequestHandler{
+		fileRequestService: fileRequestService,
+	}
+}
+
+// CreateRequest godoc
+// @Summary 创建文件收集
+// @Description 创建只能上传的链接，外部人员无需登录即可向目标文件夹提交文件，上传的文件计入自己的存储空间
+// @Description 可设置密码、有效天数、单个文件大小上限(MB)、允许的扩展名和累计上传总量上限(MB)
+// @Tags 文件收集
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.CreateFileRequestRequest true "文件收集参数"
+// @Success 200 {object} map[string]interface{} "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或文件夹不存在"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Router /request/create [post]
+func (h *FileRequestHandler) CreateRequest(c *gin.Context) {
+	zap.L().Info("创建文件收集请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.CreateFileRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	request, err := h.fileRequestService.CreateRequest(ctx, uint(userID), &req)
+	if err != nil {
+		zap.S().Errorf("创建文件收集失败: %v", err)
+		util.Error(c, 400, "创建文件收集失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("创建文件收集请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"request":   request,
+		"unique_id": request.UniqueID,
+	}, "创建文件收集成功")
+}
+
+// GetMyRequests godoc
+// @Summary 查看我的文件收集
+// @Tags 文件收集
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /request/mine [get]
+func (h *FileRequestHandler) GetMyRequests(c *gin.Context) {
+	zap.L().Info("查看文件收集列表请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+
+	ctx := c.Request.Context()
+	requests, total, err := h.fileRequestService.GetMyRequests(ctx, uint(userID))
+	if err != nil {
+		zap.S().Errorf("获取文件收集列表失败: %v", err)
+		util.Error(c, 500, "获取文件收集列表失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("查看文件收集列表请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"requests": requests,
+		"total":    total,
+	}, "获取文件收集列表成功")
+}
+
+// DeleteRequest godoc
+// @Summary 删除文件收集
+// @Description 删除后链接失效，已提交的文件保留在目标文件夹中
+// @Tags 文件收集
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "文件收集唯一ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "文件收集不存在或无权删除"
+// @Router /request/{unique_id} [delete]
+func (h *FileRequestHandler) DeleteRequest(c *gin.Context) {
+	zap.L().Info("删除文件收集请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+
+	ctx := c.Request.Context()
+	if err := h.fileRequestService.DeleteRequest(ctx, uint(userID), uniqueID); err != nil {
+		zap.S().Errorf("删除文件收集失败: %v", err)
+		util.Error(c, 403, "删除文件收集失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("删除文件收集请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, nil, "删除文件收集成功")
+}
+
+// GetSubmissions godoc
+// @Summary 查看文件收集的提交记录
+// @Description 所有者查看上传者提交的文件、姓名与留言，未完成的分片上传不会出现
+// @Tags 文件收集
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "文件收集唯一ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "文件收集不存在或无权查看"
+// @Router /request/{unique_id}/submissions [get]
+func (h *FileRequestHandler) GetSubmissions(c *gin.Context) {
+	zap.L().Info("查看文件收集提交记录请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	ctx := c.Request.Context()
+	submissions, total, err := h.fileRequestService.GetSubmissions(ctx, uint(userID), uniqueID, page, pageSize)
+	if err != nil {
+		zap.S().Errorf("获取提交记录失败: %v", err)
+		util.Error(c, 403, "获取提交记录失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("查看文件收集提交记录请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"submissions": submissions,
+		"total":       total,
+	}, "获取提交记录成功")
+}
+
+// GetRequestInfo godoc
+// @Summary 查看文件收集
+// @Description 上传者查看文件收集的标题、说明与限制，无需登录与密码；不包含其他人提交的文件
+// @Tags 文件收集
+// @Produce json
+// @Param unique_id path string true "文件收集唯一ID"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 403 {object} map[string]interface{} "文件收集不存在"
+// @Failure 410 {object} map[string]interface{} "文件收集已截止"
+// @Failure 429 {object} map[string]interface{} "访问不存在的链接次数过多，已暂时锁定"
+// @Router /request/{unique_id} [get]
+func (h *FileRequestHandler) GetRequestInfo(c *gin.Context) {
+	zap.L().Info("查看文件收集请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+
+	ctx := c.Request.Context()
+	info, err := h.fileRequestService.GetRequestInfo(ctx, uniqueID, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("获取文件收集失败: %v", err)
+		util.Error(c, fileRequestStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("查看文件收集请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"request": info,
+	}, "获取文件收集成功")
+}
+
+// VerifyPassword godoc
+// @Summary 验证文件收集密码
+// @Description 验证密码，通过后返回访问令牌，之后上传时通过X-Share-Token请求头携带令牌，不必再传递密码
+// @Tags 文件收集
+// @Accept json
+// @Produce json
+// @Param unique_id path string true "文件收集唯一ID"
+// @Param request body model.ShareAccessRequest true "密码"
+// @Success 200 {object} map[string]interface{} "验证成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密码错误"
+// @Failure 403 {object} map[string]interface{} "文件收集不存在"
+// @Failure 410 {object} map[string]interface{} "文件收集已截止"
+// @Failure 429 {object} map[string]interface{} "密码错误次数过多，已暂时锁定"
+// @Router /request/{unique_id}/access [post]
+func (h *FileRequestHandler) VerifyPassword(c *gin.Context) {
+	zap.L().Info("验证文件收集密码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	var req model.ShareAccessRequest
+	if err := c.ShouldBind(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, ttl, err := h.fileRequestService.VerifyPassword(ctx, uniqueID, req.Password, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("验证文件收集密码失败: %v", err)
+		util.Error(c, fileRequestStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("验证文件收集密码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"access_token": token,
+		"expires_in":   int(ttl.Seconds()),
+	}, "验证成功")
+}
+
+// Upload godoc
+// @Summary 向文件收集提交文件
+// @Description 无需登录，上传者填写姓名与留言，文件以"姓名 - 文件名"保存到所有者的目标文件夹
+// @Tags 文件收集
+// @Accept multipart/form-data
+// @Produce json
+// @Param unique_id path string true "文件收集唯一ID"
+// @Param file formData file true "文件"
+// @Param uploader_name formData string true "上传者姓名"
+// @Param note formData string false "留言"
+// @Param password formData string false "密码（如果需要）"
+// @Param X-Share-Token header string false "访问令牌（验证密码后获得，可代替密码）"
+// @Success 200 {object} map[string]interface{} "提交成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密码错误"
+// @Failure 403 {object} map[string]interface{} "文件收集不存在"
+// @Failure 410 {object} map[string]interface{} "文件收集已截止"
+// @Failure 413 {object} map[string]interface{} "文件太大或已达上传总量上限"
+// @Failure 415 {object} map[string]interface{} "不接受该类型的文件"
+// @Failure 429 {object} map[string]interface{} "密码错误次数过多，已暂时锁定"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /request/{unique_id}/upload [post]
+func (h *FileRequestHandler) Upload(c *gin.Context) {
+	zap.L().Info("提交文件请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	password, accessToken := shareCredential(c)
+	file, err := c.FormFile("file")
+	if err != nil {
+		zap.S().Errorf("未选择要上传的文件: %v", err)
+		util.Error(c, 400, "请选择要上传的文件: "+err.Error())
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		zap.S().Errorf("打开文件失败: %v", err)
+		util.Error(c, 500, "打开文件失败: "+err.Error())
+		return
+	}
+	defer src.Close()
+
+	ctx := c.Request.Context()
+	submission, err := h.fileRequestService.Upload(ctx, uniqueID, password, accessToken, c.ClientIP(), c.PostForm("uploader_name"), c.PostForm("note"), src, file)
+	if err != nil {
+		zap.S().Errorf("提交文件失败: %v", err)
+		util.Error(c, fileRequestStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("提交文件请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"submission_id": submission.ID,
+		"size":          submission.Size,
+		"created_at":    submission.CreatedAt,
+	}, "提交成功")
+}
+
+// InitChunkUpload godoc
+// @Summary 初始化文件收集的分片上传
+// @Description 无需登录，参数与/file/chunk_upload/init相同，另需填写上传者姓名与留言
+// @Tags 文件收集
+// @Accept multipart/form-data
+// @Produce json
+// @Param unique_id path string true "文件收集唯一ID"
+// @Param uploader_name formData string true "上传者姓名"
+// @Param note formData string false "留言"
+// @Param file_name formData string true "文件名"
+// @Param file_hash formData string true "整个文件的SHA-256（十六进制），合并后校验"
+// @Param file_size formData int true "文件总字节数"
+// @Param chunk_total formData int true "总分片数"
+// @Param file_mime_type formData string false "客户端声明的MIME类型"
+// @Param password formData string false "密码（如果需要）"
+// @Param X-Share-Token header string false "访问令牌（验证密码后获得，可代替密码）"
+// @Success 200 {object} map[string]interface{} "初始化成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密码错误"
+// @Failure 403 {object} map[string]interface{} "文件收集不存在"
+// @Failure 410 {object} map[string]interface{} "文件收集已截止"
+// @Failure 413 {object} map[string]interface{} "文件太大或已达上传总量上限"
+// @Failure 415 {object} map[string]interface{} "不接受该类型的文件"
+// @Failure 429 {object} map[string]interface{} "密码错误次数过多，已暂时锁定"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /request/{unique_id}/chunk_upload/init [post]
+func (h *FileRequestHandler) InitChunkUpload(c *gin.Context) {
+	zap.L().Info("初始化文件收集分片上传请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	password, accessToken := shareCredential(c)
+	fileName := c.PostForm("file_name")
+	fileHash := c.PostForm("file_hash")
+	fileMimeType := c.PostForm("file_mime_type")
+	fileSize, errSize := strconv.ParseInt(c.PostForm("file_size"), 10, 64)
+	chunkTotal, errTotal := strconv.Atoi(c.PostForm("chunk_total"))
+	if fileName == "" || fileHash == "" || errSize != nil || errTotal != nil || fileSize < 0 || chunkTotal < 1 {
+		zap.S().Errorf("分片上传元数据错误")
+		util.Error(c, 400, "请正确填写file_name、file_hash、file_size、chunk_total")
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, err := h.fileRequestService.InitChunkUpload(ctx, uniqueID, password, accessToken, c.ClientIP(), c.PostForm("uploader_name"), c.PostForm("note"), fileName, fileHash, fileSize, chunkTotal, fileMimeType)
+	if err != nil {
+		zap.S().Errorf("初始化上传失败: %v", err)
+		if errors.Is(err, services.ErrInvalidFileHash) || errors.Is(err, services.ErrTooManyChunks) {
+			util.Error(c, 400, err.Error())
+			return
+		}
+		util.Error(c, fileRequestStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("初始化文件收集分片上传请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"upload_id":   session.UploadID,
+		"chunk_total": session.ChunkTotal,
+	}, "初始化上传成功")
+}
+
+// ChunkUpload godoc
+// @Summary 向文件收集上传分片
+// @Description 无需登录，参数与/file/chunk_upload相同；全部分片到达后合并并提交到目标文件夹
+// @Tags 文件收集
+// @Accept multipart/form-data
+// @Produce json
+// @Param unique_id path string true "文件收集唯一ID"
+// @Param upload_id formData string true "初始化时签发的上传ID"
+// @Param chunk formData file true "文件分片"
+// @Param chunk_index formData int true "分片索引（从0开始）"
+// @Param chunk_hash formData string true "分片的SHA-256（十六进制）"
+// @Param password formData string false "密码（如果需要）"
+// @Param X-Share-Token header string false "访问令牌（验证密码后获得，可代替密码）"
+// @Success 200 {object} map[string]interface{} "分片上传成功"
+// @Success 200 {object} map[string]interface{} "提交成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或分片校验失败"
+// @Failure 401 {object} map[string]interface{} "密码错误"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在或已过期"
+// @Failure 409 {object} map[string]interface{} "文件正在合并"
+// @Failure 410 {object} map[string]interface{} "文件收集已截止"
+// @Failure 413 {object} map[string]interface{} "已达上传总量上限"
+// @Failure 415 {object} map[string]interface{} "不接受该类型的文件"
+// @Failure 422 {object} map[string]interface{} "合并后的文件与声明的哈希不一致"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /request/{unique_id}/chunk_upload [post]
+func (h *FileRequestHandler) ChunkUpload(c *gin.Context) {
+	zap.L().Info("文件收集上传分片请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	password, accessToken := shareCredential(c)
+	file, err := c.FormFile("chunk")
+	if err != nil {
+		zap.S().Errorf("无分片文件: %v", err)
+		util.Error(c, 400, "无分片文件")
+		return
+	}
+	uploadID := c.PostForm("upload_id")
+	chunkHash := c.PostForm("chunk_hash")
+	chunkIndex, err := strconv.Atoi(c.PostForm("chunk_index"))
+	if uploadID == "" || chunkHash == "" || err != nil {
+		zap.S().Errorf("分片元数据错误")
+		util.Error(c, 400, "请正确填写upload_id、chunk_index、chunk_hash")
+		return
+	}
+
+	fileReader, err := file.Open()
+	if err != nil {
+		zap.S().Errorf("打开分片文件: %v", err)
+		util.Error(c, 500, "打开分片文件失败")
+		return
+	}
+	defer fileReader.Close()
+
+	chunkData, err := io.ReadAll(fileReader)
+	if err != nil {
+		zap.S().Errorf("读取分片文件失败: %v", err)
+		util.Error(c, 500, "读取分片文件失败")
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, submission, err := h.fileRequestService.UploadChunk(ctx, uniqueID, password, accessToken, c.ClientIP(), uploadID, chunkIndex, chunkHash, chunkData)
+	if err != nil {
+		zap.S().Errorf("文件收集上传分片失败: %v", err)
+		switch {
+		case errors.Is(err, services.ErrChunkSessionNotFound):
+			util.Error(c, 404, err.Error())
+		case errors.Is(err, services.ErrChunkHashMismatch), errors.Is(err, services.ErrChunkIndexOutOfRange):
+			util.Error(c, 400, err.Error())
+		case errors.Is(err, services.ErrChunkMerging):
+			util.Error(c, 409, err.Error())
+		case errors.Is(err, services.ErrFileHashMismatch):
+			util.Error(c, 422, err.Error())
+		default:
+			util.Error(c, fileRequestStatus(err), err.Error())
+		}
+		return
+	}
+
+	zap.L().Info("文件收集上传分片请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	if submission != nil {
+		util.Success(c, gin.H{
+			"submission_id": submission.ID,
+			"size":          submission.Size,
+			"created_at":    submission.CreatedAt,
+		}, "提交成功")
+		return
+	}
+	util.Success(c, gin.H{
+		"upload_id":   uploadID,
+		"chunk_index": chunkIndex,
+		"chunk_total": session.ChunkTotal,
+		"status":      "uncompleted",
+	}, "分片上传成功")
+}
+
+// fileRequestStatus 上传者访问文件收集出错时返回的状态码
+func fileRequestStatus(err error) int {
+	if status, ok := policyStatus(err); ok {
+		return status
+	}
+	switch {
+	case errors.Is(err, services.ErrFileRequestExpired):
+		return 410
+	case errors.Is(err, services.ErrFileRequestFull), errors.Is(err, services.ErrFileRequestTooLarge),
+		errors.Is(err, services.ErrQuotaExceeded), errors.Is(err, services.ErrFileTooLarge):
+		return 413
+	case errors.Is(err, services.ErrFileRequestExtDenied), errors.Is(err, services.ErrMimeMismatch):
+		return 415
+	case errors.Is(err, services.ErrFileRequestUploaderBad):
+		return 400
+	case errors.Is(err, services.ErrSharePasswordWrong), errors.Is(err, services.ErrShareTokenInvalid), errors.Is(err, services.ErrSharePasswordRequired),
+		errors.Is(err, services.ErrShareLocked):
+		return shareStatus(err)
+	case strings.Contains(err.Error(), "不存在"):
+		return 403
+	default:
+		return 500
+	}
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"ClaranCloudDisk/util/ssrf"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type OfflineHandler struct {
+	offlineService *services.OfflineService
+}
+
+func NewOfflineHandler(offlineService *services.OfflineService) *OfflineHandler {
+	return &OfflineHandler{
+		offlineService: offlineService,
+	}
+}
+
+// offlineStatus 离线下载错误对应的状态码
+func offlineStatus(err error) int {
+	if status, ok := policyStatus(err); ok {
+		return status
+	}
+	switch {
+	case errors.Is(err, services.ErrOfflineTaskNotFound):
+		return 404
+	case errors.Is(err, services.ErrOfflineTaskState):
+		return 409
+	case errors.Is(err, services.ErrOfflineQueueFull):
+		return 503
+	case errors.Is(err, ssrf.ErrUnsupportedScheme), errors.Is(err, ssrf.ErrForbiddenAddress):
+		return 400
+	}
+	return 500
+}
+
+// CreateTask godoc
+// @Summary 创建离线下载任务
+// @Description 提交HTTP(S)链接，服务端在后台下载并存入云盘。禁止访问内网地址；下载过程中按实际大小预留存储空间，受单个文件大小与上传策略约束，完成后与普通上传一样计算哈希、识别类型、扫描并秒传
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.CreateOfflineTaskRequest true "离线下载请求参数"
+// @Success 200 {object} map[string]interface{} "提交成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或链接指向内网地址"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "文件数量已达上限"
+// @Failure 415 {object} map[string]interface{} "上传策略不允许该扩展名"
+// @Failure 503 {object} map[string]interface{} "离线下载队列已满"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/offline [post]
+func (h *OfflineHandler) CreateTask(c *gin.Context) {
+	zap.L().Info("创建离线下载任务请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	var req model.CreateOfflineTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	//服务层
+	task, err := h.offlineService.CreateTask(c.Request.Context(), userID, &req)
+	if err != nil {
+		zap.S().Errorf("创建离线下载任务失败: %v", err)
+		util.Error(c, offlineStatus(err), "创建离线下载任务失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("创建离线下载任务请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"task": task,
+	}, "离线下载任务已提交")
+}
+
+// GetTasks godoc
+// @Summary 获取离线下载任务列表
+// @Description 获取当前用户的离线下载任务，新的在前；下载中的任务返回实时进度
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/offline [get]
+func (h *OfflineHandler) GetTasks(c *gin.Context) {
+	zap.L().Info("获取离线下载任务列表请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+
+	//服务层
+	tasks, total, err := h.offlineService.GetTasks(c.Request.Context(), userID)
+	if err != nil {
+		zap.S().Errorf("获取离线下载任务列表失败: %v", err)
+		util.Error(c, 500, "获取离线下载任务列表失败")
+		return
+	}
+
+	zap.L().Info("获取离线下载任务列表请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"tasks": tasks,
+		"total": total,
+	}, "获取离线下载任务列表成功")
+}
+
+// GetTask godoc
+// @Summary 获取离线下载任务
+// @Description 获取离线下载任务的状态与进度
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "任务不存在"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/offline/{id} [get]
+func (h *OfflineHandler) GetTask(c *gin.Context) {
+	zap.L().Info("获取离线下载任务请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	taskID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的任务ID: %v", err)
+		util.Error(c, 400, "无效的任务ID")
+		return
+	}
+
+	//服务层
+	task, err := h.offlineService.GetTask(c.Request.Context(), userID, uint(taskID))
+	if err != nil {
+		zap.S().Errorf("获取离线下载任务失败: %v", err)
+		util.Error(c, offlineStatus(err), "获取离线下载任务失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("获取离线下载任务请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"task": task,
+	}, "获取离线下载任务成功")
+}
+
+// CancelTask godoc
+// @Summary 取消离线下载任务
+// @Description 取消排队中或下载中的任务，已下载的数据会被删除并释放预留的存储空间
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "任务不存在"
+// @Failure 409 {object} map[string]interface{} "任务已结束"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/offline/{id}/cancel [post]
+func (h *OfflineHandler) CancelTask(c *gin.Context) {
+	zap.L().Info("取消离线下载任务请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	taskID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的任务ID: %v", err)
+		util.Error(c, 400, "无效的任务ID")
+		return
+	}
+
+	//服务层
+	task, err := h.offlineService.CancelTask(c.Request.Context(), userID, uint(taskID))
+	if err != nil {
+		zap.S().Errorf("取消离线下载任务失败: %v", err)
+		util.Error(c, offlineStatus(err), "取消离线下载任务失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("取消离线下载任务请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"task": task,
+	}, "离线下载任务已取消")
+}
+
+// RetryTask godoc
+// @Summary 重试离线下载任务
+// @Description 重新下载失败或已取消的任务，从头开始下载
+// @Tags 文件管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "任务不存在"
+// @Failure 409 {object} map[string]interface{} "任务未失败或未取消"
+// @Failure 503 {object} map[string]interface{} "离线下载队列已满"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /file/offline/{id}/retry [post]
+func (h *OfflineHandler) RetryTask(c *gin.Context) {
+	zap.L().Info("重试离线下载任务请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	taskID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的任务ID: %v", err)
+		util.Error(c, 400, "无效的任务ID")
+		return
+	}
+
+	//服务层
+	task, err := h.offlineService.RetryTask(c.Request.Context(), userID, uint(taskID))
+	if err != nil {
+		zap.S().Errorf("重试离线下载任务失败: %v", err)
+		util.Error(c, offlineStatus(err), "重试离线下载任务失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("重试离线下载任务请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"task": task,
+	}, "离线下载任务已重新提交")
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type PasswordResetHandler struct {
+	passwordResetService *services.PasswordResetService
+}
+
+func NewPasswordResetHandler(passwordResetService *services.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		passwordResetService: passwordResetService,
+	}
+}
+
+// ForgotPassword godoc
+// @Summary 找回密码：获取验证码
+// @Description 向邮箱发送找回密码验证码，验证码5分钟内有效，只能用于找回密码
+// @Description 无论邮箱是否注册都返回相同的结果
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param request body model.ForgotPasswordRequest true "找回密码请求参数"
+// @Success 200 {object} map[string]interface{} "请求已受理"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Router /user/password/forgot [post]
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	zap.L().Info("找回密码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	var req model.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	if err := h.passwordResetService.RequestCode(req.Email); err != nil {
+		zap.S().Errorf("找回密码失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	zap.L().Info("找回密码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"email": req.Email,
+	}, "如果该邮箱已注册，验证码将发送到该邮箱")
+}
+
+// VerifyResetCode godoc
+// @Summary 找回密码：校验验证码
+// @Description 校验找回密码验证码，通过后返回一次性的重置令牌，15分钟内有效
+// @Description 同一个验证码连续输错5次后作废
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param request body model.VerifyResetCodeRequest true "校验验证码请求参数"
+// @Success 200 {object} map[string]interface{} "验证成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误，或验证码错误、已过期"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/password/verify [post]
+func (h *PasswordResetHandler) VerifyResetCode(c *gin.Context) {
+	zap.L().Info("校验找回密码验证码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	var req model.VerifyResetCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	resetToken, expiresIn, err := h.passwordResetService.VerifyCode(c.Request.Context(), req.Email, req.Code)
+	if err != nil {
+		zap.S().Errorf("校验找回密码验证码失败: %v", err)
+		if status := passwordResetStatus(err); status != 500 {
+			util.Error(c, status, err.Error())
+			return
+		}
+		util.Error(c, 500, "校验验证码失败")
+		return
+	}
+
+	zap.L().Info("校验找回密码验证码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Header("Cache-Control", "no-store")
+	util.Success(c, gin.H{
+		"reset_token": resetToken,
+		"expires_in":  expiresIn,
+	}, "验证成功")
+}
+
+// ResetPassword godoc
+// @Summary 找回密码：设置新密码
+// @Description 使用重置令牌设置新密码，重置令牌只能使用一次
+// @Description 重置后该用户之前签发的全部令牌失效、全部登录会话被撤销，并向邮箱发送通知
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param request body model.ResetPasswordRequest true "重置密码请求参数"
+// @Success 200 {object} map[string]interface{} "重置成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或密码格式错误"
+// @Failure 401 {object} map[string]interface{} "重置令牌无效、已过期或已使用"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/password/reset [post]
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	zap.L().Info("重置密码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	var req model.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, "请求参数错误")
+		return
+	}
+
+	if err := h.passwordResetService.Reset(c.Request.Context(), req.ResetToken, req.NewPassword); err != nil {
+		zap.S().Errorf("重置密码失败: %v", err)
+		if status := passwordResetStatus(err); status != 500 {
+			util.Error(c, status, err.Error())
+			return
+		}
+		util.Error(c, 500, "重置密码失败")
+		return
+	}
+
+	zap.L().Info("重置密码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"status": "reset",
+	}, "密码已重置，请使用新密码登录")
+}
+
+func passwordResetStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrResetCodeWrong),
+		errors.Is(err, services.ErrPasswordFormat):
+		return 400
+	case errors.Is(err, services.ErrResetTokenInvalid):
+		return 401
+	}
+	return 500
+}
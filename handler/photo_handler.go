@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type PhotoHandler struct {
+	photoService *services.PhotoService
+}
+
+func NewPhotoHandler(photoService *services.PhotoService) *PhotoHandler {
+	return &PhotoHandler{
+		photoService: photoService,
+	}
+}
+
+// Timeline godoc
+// @Summary 照片时间线
+// @Description 按拍摄时间（EXIF，缺失时使用上传时间）将当前用户的图片按月或按年分组，新的在前
+// @Tags 相册管理
+// @Produce json
+// @Security BearerAuth
+// @Param group_by query string false "分组方式：month（默认）/ year"
+// @Param year query int false "只返回指定年份的照片"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/timeline [get]
+func (h *PhotoHandler) Timeline(c *gin.Context) {
+	zap.L().Info("获取照片时间线请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	groupBy := c.DefaultQuery("group_by", "month")
+	year, err := strconv.Atoi(c.DefaultQuery("year", "0"))
+	if err != nil {
+		zap.S().Errorf("无效的年份: %v", err)
+		util.Error(c, 400, "无效的年份")
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	buckets, total, err := h.photoService.Timeline(ctx, userID, groupBy, year)
+	if err != nil {
+		zap.S().Errorf("获取照片时间线失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	zap.L().Info("获取照片时间线请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"group_by": groupBy,
+		"buckets":  buckets,
+		"total":    total,
+	}, "获取成功")
+}
+
+// CreateAlbum godoc
+// @Summary 创建相册
+// @Description 创建相册，可同时加入已有的图片或视频（只引用文件，不复制内容）
+// @Tags 相册管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.CreateAlbumRequest true "创建相册请求参数"
+// @Success 200 {object} map[string]interface{} "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album [post]
+func (h *PhotoHandler) CreateAlbum(c *gin.Context) {
+	zap.L().Info("创建相册请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	var req model.CreateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	album, err := h.photoService.CreateAlbum(ctx, uint(userID), &req)
+	if err != nil {
+		zap.S().Errorf("创建相册失败: %v", err)
+		util.Error(c, 500, "创建相册失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("创建相册请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"album": album,
+	}, "创建相册成功")
+}
+
+// GetAlbumList godoc
+// @Summary 获取相册列表
+// @Description 获取当前用户的所有相册及封面、照片数量
+// @Tags 相册管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album/list [get]
+func (h *PhotoHandler) GetAlbumList(c *gin.Context) {
+	zap.L().Info("获取相册列表请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+
+	//服务层
+	ctx := c.Request.Context()
+	albums, total, err := h.photoService.GetAlbumList(ctx, uint(userID))
+	if err != nil {
+		zap.S().Errorf("获取相册列表失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("获取相册列表请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"albums": albums,
+		"total":  total,
+	}, "获取成功")
+}
+
+// GetAlbum godoc
+// @Summary 查看相册
+// @Description 获取相册信息及其中的照片
+// @Tags 相册管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "相册ID"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "相册不存在或无权访问"
+// @Router /photo/album/{id} [get]
+func (h *PhotoHandler) GetAlbum(c *gin.Context) {
+	zap.L().Info("查看相册请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的相册ID: %v", err)
+		util.Error(c, 400, "无效的相册ID")
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	album, err := h.photoService.GetAlbum(ctx, uint(userID), uint(albumID))
+	if err != nil {
+		zap.S().Errorf("查看相册失败: %v", err)
+		util.Error(c, 404, err.Error())
+		return
+	}
+
+	zap.L().Info("查看相册请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"data": album,
+	}, "获取成功")
+}
+
+// UpdateAlbum godoc
+// @Summary 修改相册
+// @Description 修改相册名称、描述或封面
+// @Tags 相册管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "相册ID"
+// @Param request body model.UpdateAlbumRequest true "修改相册请求参数"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album/{id} [put]
+func (h *PhotoHandler) UpdateAlbum(c *gin.Context) {
+	zap.L().Info("修改相册请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的相册ID: %v", err)
+		util.Error(c, 400, "无效的相册ID")
+		return
+	}
+	var req model.UpdateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	album, err := h.photoService.UpdateAlbum(ctx, uint(userID), uint(albumID), &req)
+	if err != nil {
+		zap.S().Errorf("修改相册失败: %v", err)
+		util.Error(c, 500, "修改相册失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("修改相册请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"album": album,
+	}, "修改相册成功")
+}
+
+// DeleteAlbum godoc
+// @Summary 删除相册
+// @Description 删除相册，相册中的文件不会被删除
+// @Tags 相册管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "相册ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album/{id} [delete]
+func (h *PhotoHandler) DeleteAlbum(c *gin.Context) {
+	zap.L().Info("删除相册请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的相册ID: %v", err)
+		util.Error(c, 400, "无效的相册ID")
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	if err := h.photoService.DeleteAlbum(ctx, uint(userID), uint(albumID)); err != nil {
+		zap.S().Errorf("删除相册失败: %v", err)
+		util.Error(c, 500, "删除相册失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("删除相册请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{}, "删除相册成功")
+}
+
+// AddAlbumFiles godoc
+// @Summary 向相册添加照片
+// @Description 向相册添加已有的图片或视频，已在相册中的文件自动忽略
+// @Tags 相册管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "相册ID"
+// @Param request body model.AlbumFilesRequest true "文件ID列表"
+// @Success 200 {object} map[string]interface{} "添加成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album/{id}/files [post]
+func (h *PhotoHandler) AddAlbumFiles(c *gin.Context) {
+	zap.L().Info("添加相册照片请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的相册ID: %v", err)
+		util.Error(c, 400, "无效的相册ID")
+		return
+	}
+	var req model.AlbumFilesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	if err := h.photoService.AddFiles(ctx, uint(userID), uint(albumID), req.FileIDs); err != nil {
+		zap.S().Errorf("添加相册照片失败: %v", err)
+		util.Error(c, 500, "添加照片失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("添加相册照片请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"album_id": albumID,
+		"file_ids": req.FileIDs,
+	}, "添加照片成功")
+}
+
+// RemoveAlbumFiles godoc
+// @Summary 从相册移除照片
+// @Description 从相册中移除照片，文件本身不会被删除
+// @Tags 相册管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "相册ID"
+// @Param request body model.AlbumFilesRequest true "文件ID列表"
+// @Success 200 {object} map[string]interface{} "移除成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album/{id}/files [delete]
+func (h *PhotoHandler) RemoveAlbumFiles(c *gin.Context) {
+	zap.L().Info("移除相册照片请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的相册ID: %v", err)
+		util.Error(c, 400, "无效的相册ID")
+		return
+	}
+	var req model.AlbumFilesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	if err := h.photoService.RemoveFiles(ctx, uint(userID), uint(albumID), req.FileIDs); err != nil {
+		zap.S().Errorf("移除相册照片失败: %v", err)
+		util.Error(c, 500, "移除照片失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("移除相册照片请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"album_id": albumID,
+		"file_ids": req.FileIDs,
+	}, "移除照片成功")
+}
+
+// ShareAlbum godoc
+// @Summary 分享相册
+// @Description 将相册中当前的照片创建为一个分享，可设置密码和过期时间
+// @Tags 相册管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "相册ID"
+// @Param request body model.ShareAlbumRequest false "分享设置"
+// @Success 200 {object} map[string]interface{} "分享成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /photo/album/{id}/share [post]
+func (h *PhotoHandler) ShareAlbum(c *gin.Context) {
+	zap.L().Info("分享相册请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	//捕获数据
+	userID := c.GetInt("user_id")
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.S().Errorf("无效的相册ID: %v", err)
+		util.Error(c, 400, "无效的相册ID")
+		return
+	}
+	var req model.ShareAlbumRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			zap.S().Errorf("请求参数错误: %v", err)
+			util.Error(c, 400, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	//服务层
+	ctx := c.Request.Context()
+	share, err := h.photoService.ShareAlbum(ctx, uint(userID), uint(albumID), &req)
+	if err != nil {
+		zap.S().Errorf("分享相册失败: %v", err)
+		util.Error(c, 500, "分享相册失败: "+err.Error())
+		return
+	}
+
+	// 生成分享链接
+	shareURL := h.photoService.ShareURL(requestOrigin(c), share.UniqueID)
+
+	zap.L().Info("分享相册请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"share":       share,
+		"share_url":   shareURL,
+		"password":    req.Password != "",
+		"expire_days": req.ExpireDays,
+		"expire_time": share.ExpireAt,
+	}, "分享相册成功")
+}
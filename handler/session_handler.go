@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type SessionHandler struct {
+	sessionService *services.SessionService
+}
+
+func NewSessionHandler(sessionService *services.SessionService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+// ListSessions godoc
+// @Summary 登录设备列表
+// @Description 列出当前用户未撤销且未过期的登录会话，包括设备、User-Agent、登录IP与最近使用时间，current为true的是当前会话
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	zap.L().Info("获取会话列表请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	sessionID := c.GetString("session_id")
+
+	sessions, err := h.sessionService.List(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		zap.S().Errorf("获取会话列表失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("获取会话列表请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"sessions": sessions,
+		"total":    len(sessions),
+	}, "获取会话列表成功")
+}
+
+// RevokeSession godoc
+// @Summary 撤销登录会话
+// @Description 撤销当前用户的一个会话（下线该设备），该会话的访问令牌与刷新令牌立即失效
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Param session_id path string true "会话ID"
+// @Success 200 {object} map[string]interface{} "撤销成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 404 {object} map[string]interface{} "会话不存在或已撤销"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/sessions/{session_id} [delete]
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	zap.L().Info("撤销会话请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	sessionID := c.Param("session_id")
+
+	err := h.sessionService.Revoke(c.Request.Context(), userID, sessionID, model.SessionRevokeUser)
+	if err != nil {
+		zap.S().Errorf("撤销会话失败: %v", err)
+		if status := sessionStatus(err); status != 500 {
+			util.Error(c, status, err.Error())
+			return
+		}
+		util.Error(c, 500, "撤销会话失败")
+		return
+	}
+
+	zap.L().Info("撤销会话请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"session_id": sessionID,
+		"current":    sessionID == c.GetString("session_id"),
+	}, "撤销会话成功")
+}
+
+// RevokeAllSessions godoc
+// @Summary 撤销全部登录会话
+// @Description 撤销当前用户的全部其他会话（下线其他设备），include_current=true时连同当前会话一起撤销
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Param include_current query bool false "是否同时撤销当前会话"
+// @Success 200 {object} map[string]interface{} "撤销成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/sessions [delete]
+func (h *SessionHandler) RevokeAllSessions(c *gin.Context) {
+	zap.L().Info("撤销全部会话请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	exceptSessionID := c.GetString("session_id")
+	if c.Query("include_current") == "true" {
+		exceptSessionID = ""
+	}
+
+	revoked, err := h.sessionService.RevokeAll(c.Request.Context(), userID, exceptSessionID, model.SessionRevokeUser)
+	if err != nil {
+		zap.S().Errorf("撤销全部会话失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("撤销全部会话请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"revoked": revoked,
+	}, "撤销会话成功")
+}
+
+func sessionStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenInvalid),
+		errors.Is(err, services.ErrRefreshTokenReused):
+		return 401
+	case errors.Is(err, services.ErrUserBanned):
+		return 403
+	case errors.Is(err, services.ErrSessionNotFound):
+		return 404
+	}
+	return 500
+}
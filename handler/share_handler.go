@@ -5,6 +5,10 @@ import (
 	services "ClaranCloudDisk/service"
 	"ClaranCloudDisk/util"
 	"ClaranCloudDisk/util/minIO"
+	"ClaranCloudDisk/util/watermark"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -16,12 +20,14 @@ import (
 
 type ShareHandler struct {
 	shareService *services.ShareService
+	fileHandler  *FileHandler // 复用文件预览
 	minioClient  *minIO.MinIOClient
 }
 
-func NewShareHandler(shareService *services.ShareService, minIOClient *minIO.MinIOClient) *ShareHandler {
+func NewShareHandler(shareService *services.ShareService, fileHandler *FileHandler, minIOClient *minIO.MinIOClient) *ShareHandler {
 	return &ShareHandler{
 		shareService: shareService,
+		fileHandler:  fileHandler,
 		minioClient:  minIOClient,
 	}
 }
@@ -72,7 +78,7 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 	}
 
 	// 生成分享链接
-	shareURL := fmt.Sprintf("%s/share/%s", c.Request.Host, share.UniqueID)
+	shareURL := h.shareService.ShareURL(requestOrigin(c), share.UniqueID)
 
 	zap.L().Info("创建分享请求结束",
 		zap.String("url", c.Request.RequestURI),
@@ -84,7 +90,7 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 		"share_url":   shareURL,
 		"password":    req.Password != "",
 		"expire_days": req.ExpireDays,
-		"expire_time": share.CreatedAt.Add(share.Exp).Format("2006-01-02 15:04:05"),
+		"expire_time": share.ExpireAt,
 	}, "分享创建成功")
 }
 
@@ -161,6 +167,462 @@ func (h *ShareHandler) DeleteShare(c *gin.Context) {
 	util.Success(c, gin.H{}, "删除分享成功")
 }
 
+// GetShareStats godoc
+// @Summary 查看分享统计
+// @Description 分享者查看分享的查看次数、下载次数、独立访客数、剩余下载次数与访问记录
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Param page query int false "访问记录页码（从1开始）"
+// @Param page_size query int false "访问记录每页条数（默认20，最大100）"
+// @Success 200 {object} model.ShareStatsResponse "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权查看"
+// @Router /share/{unique_id}/stats [get]
+func (h *ShareHandler) GetShareStats(c *gin.Context) {
+	zap.L().Info("查看分享统计请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	ctx := c.Request.Context()
+	stats, err := h.shareService.GetShareStats(ctx, uint(userID), uniqueID, page, pageSize)
+	if err != nil {
+		zap.S().Errorf("查看分享统计失败: %v", err)
+		util.Error(c, 403, err.Error())
+		return
+	}
+
+	zap.L().Info("查看分享统计请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"stats": stats,
+	}, "获取分享统计成功")
+}
+
+// RegenerateSharePassword godoc
+// @Summary 重新生成分享密码
+// @Description 分享者为分享生成新的随机密码，旧密码及其签发的分享访问令牌立即失效，分享的锁定一并解除
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Success 200 {object} map[string]interface{} "生成成功，返回新密码"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权修改"
+// @Router /share/{unique_id}/password/regenerate [post]
+func (h *ShareHandler) RegenerateSharePassword(c *gin.Context) {
+	zap.L().Info("重新生成分享密码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+
+	ctx := c.Request.Context()
+	password, err := h.shareService.RegenerateSharePassword(ctx, uint(userID), uniqueID)
+	if err != nil {
+		zap.S().Errorf("重新生成分享密码失败: %v", err)
+		util.Error(c, 403, err.Error())
+		return
+	}
+
+	zap.L().Info("重新生成分享密码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"password": password,
+	}, "重新生成分享密码成功")
+}
+
+// UpdateShare godoc
+// @Summary 修改分享
+// @Description 分享者修改分享的有效期、密码、分享的文件和下载次数上限，未提供的字段保持不变；expire_days为0表示永久有效，password为空字符串表示取消密码，修改密码后旧的分享访问令牌立即失效
+// @Tags 分享管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Param request body model.UpdateShareRequest true "要修改的字段"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在、无权修改或文件无法分享"
+// @Router /share/{unique_id} [put]
+func (h *ShareHandler) UpdateShare(c *gin.Context) {
+	zap.L().Info("修改分享请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+	var req model.UpdateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	share, err := h.shareService.UpdateShare(ctx, uint(userID), uniqueID, &req)
+	if err != nil {
+		zap.S().Errorf("修改分享失败: %v", err)
+		util.Error(c, 403, err.Error())
+		return
+	}
+
+	zap.L().Info("修改分享请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"share": share,
+	}, "修改分享成功")
+}
+
+// DisableShare godoc
+// @Summary 停用分享
+// @Description 分享者临时停用分享，停用期间任何人都无法查看、下载或转存，可以随时重新启用
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Success 200 {object} map[string]interface{} "停用成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权修改"
+// @Router /share/{unique_id}/disable [post]
+func (h *ShareHandler) DisableShare(c *gin.Context) {
+	h.setShareDisabled(c, true)
+}
+
+// EnableShare godoc
+// @Summary 启用分享
+// @Description 分享者重新启用已停用的分享
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Success 200 {object} map[string]interface{} "启用成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权修改"
+// @Router /share/{unique_id}/enable [post]
+func (h *ShareHandler) EnableShare(c *gin.Context) {
+	h.setShareDisabled(c, false)
+}
+
+func (h *ShareHandler) setShareDisabled(c *gin.Context, disabled bool) {
+	action := "启用"
+	if disabled {
+		action = "停用"
+	}
+	zap.L().Info(action+"分享请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+
+	ctx := c.Request.Context()
+	share, err := h.shareService.SetShareDisabled(ctx, uint(userID), uniqueID, disabled)
+	if err != nil {
+		zap.S().Errorf("%s分享失败: %v", action, err)
+		util.Error(c, 403, err.Error())
+		return
+	}
+
+	zap.L().Info(action+"分享请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"share": share,
+	}, action+"分享成功")
+}
+
+// SetShortCode godoc
+// @Summary 设置分享短链接
+// @Description 分享者为分享设置短码，短链接为"公开地址/s/短码"；不传code时随机生成6位短码，已有短码时替换，旧的短链接随之失效
+// @Tags 分享管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Param request body model.SetShortCodeRequest false "自定义短码"
+// @Success 200 {object} map[string]interface{} "设置成功，返回短码与短链接"
+// @Failure 400 {object} map[string]interface{} "短码格式错误"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权修改"
+// @Failure 409 {object} map[string]interface{} "短码已被占用"
+// @Router /share/{unique_id}/short_code [post]
+func (h *ShareHandler) SetShortCode(c *gin.Context) {
+	zap.L().Info("设置分享短链接请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+	var req model.SetShortCodeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			zap.S().Errorf("请求参数错误: %v", err)
+			util.Error(c, 400, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	share, err := h.shareService.SetShortCode(ctx, uint(userID), uniqueID, req.Code)
+	if err != nil {
+		zap.S().Errorf("设置分享短链接失败: %v", err)
+		status := 403
+		switch {
+		case errors.Is(err, services.ErrShortCodeInvalid):
+			status = 400
+		case errors.Is(err, services.ErrShortCodeTaken):
+			status = 409
+		}
+		util.Error(c, status, err.Error())
+		return
+	}
+
+	zap.L().Info("设置分享短链接请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"short_code": share.ShortCode,
+		"short_url":  h.shareService.ShortURL(requestOrigin(c), share),
+	}, "设置分享短链接成功")
+}
+
+// RemoveShortCode godoc
+// @Summary 删除分享短链接
+// @Description 分享者删除分享的短链接，原分享链接不受影响
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 403 {object} map[string]interface{} "分享不存在或无权修改"
+// @Router /share/{unique_id}/short_code [delete]
+func (h *ShareHandler) RemoveShortCode(c *gin.Context) {
+	zap.L().Info("删除分享短链接请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+
+	ctx := c.Request.Context()
+	if err := h.shareService.RemoveShortCode(ctx, uint(userID), uniqueID); err != nil {
+		zap.S().Errorf("删除分享短链接失败: %v", err)
+		util.Error(c, 403, err.Error())
+		return
+	}
+
+	zap.L().Info("删除分享短链接请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{}, "删除分享短链接成功")
+}
+
+// ResolveShortCode godoc
+// @Summary 访问分享短链接
+// @Description 302跳转到短码对应的分享链接，查询参数（如password）原样保留；访问不存在的短码与访问不存在的分享一样按IP计数，超过次数后锁定
+// @Tags 分享管理
+// @Param code path string true "短码"
+// @Success 302 {string} string "跳转到分享链接"
+// @Failure 404 {object} map[string]interface{} "短链接不存在"
+// @Failure 429 {object} map[string]interface{} "尝试次数过多，已暂时锁定"
+// @Router /s/{code} [get]
+func (h *ShareHandler) ResolveShortCode(c *gin.Context) {
+	zap.L().Info("访问分享短链接请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	code := c.Param("code")
+
+	ctx := c.Request.Context()
+	uniqueID, err := h.shareService.ResolveShortCode(ctx, code, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("访问分享短链接失败: %v", err)
+		status := 404
+		if errors.Is(err, services.ErrShareLocked) {
+			status = 429
+		}
+		util.Error(c, status, err.Error())
+		return
+	}
+
+	target := h.shareService.ShareURL(requestOrigin(c), uniqueID)
+	if c.Request.URL.RawQuery != "" {
+		target += "?" + c.Request.URL.RawQuery
+	}
+
+	zap.L().Info("访问分享短链接请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Redirect(302, target)
+}
+
+// GetShareQRCode godoc
+// @Summary 获取分享二维码
+// @Description 生成分享链接的PNG二维码，分享设置了短链接时使用短链接；with_password=true时把密码附在链接中（?password=），此时必须提供正确的分享密码，不能使用分享访问令牌
+// @Tags 分享管理
+// @Produce png
+// @Param unique_id path string true "分享唯一ID"
+// @Param password query string false "分享密码（如需密码）"
+// @Param share_token query string false "分享访问令牌，也可以通过X-Share-Token请求头传递"
+// @Param with_password query bool false "是否在二维码中附带密码"
+// @Param size query int false "边长（像素），128-1024，默认256"
+// @Success 200 {file} binary "PNG二维码"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或附带密码时未提供密码"
+// @Failure 401 {object} map[string]interface{} "需要密码、密码错误或分享访问令牌无效"
+// @Failure 403 {object} map[string]interface{} "分享不存在或已被停用"
+// @Failure 410 {object} map[string]interface{} "分享已过期或下载次数已达上限"
+// @Failure 429 {object} map[string]interface{} "尝试次数过多，已暂时锁定"
+// @Router /share/{unique_id}/qrcode [get]
+func (h *ShareHandler) GetShareQRCode(c *gin.Context) {
+	zap.L().Info("获取分享二维码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	password, accessToken := shareCredential(c)
+	withPassword := c.Query("with_password") == "true"
+	size := 0
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		var err error
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil {
+			zap.S().Errorf("无效的二维码尺寸: %v", err)
+			util.Error(c, 400, "无效的二维码尺寸")
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	png, err := h.shareService.ShareQRCode(ctx, uniqueID, password, accessToken, c.ClientIP(), requestOrigin(c), withPassword, size)
+	if err != nil {
+		zap.S().Errorf("获取分享二维码失败: %v", err)
+		status := shareStatus(err)
+		if errors.Is(err, services.ErrQRCodeNeedPassword) {
+			status = 400
+		}
+		util.Error(c, status, err.Error())
+		return
+	}
+
+	zap.L().Info("获取分享二维码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(200, "image/png", png)
+}
+
+// GetExpiredShares godoc
+// @Summary 查看已过期的分享
+// @Description 获取当前登录用户已过期的分享，可以修改有效期重新启用或删除
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /share/expired [get]
+func (h *ShareHandler) GetExpiredShares(c *gin.Context) {
+	zap.L().Info("查看已过期分享请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+
+	ctx := c.Request.Context()
+	shares, total, err := h.shareService.GetExpiredShares(ctx, uint(userID))
+	if err != nil {
+		zap.S().Errorf("获取已过期分享失败: %v", err)
+		util.Error(c, 500, "获取已过期分享失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("查看已过期分享请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"shares": shares,
+		"total":  total,
+	}, "获取成功")
+}
+
+// VerifySharePassword godoc
+// @Summary 验证分享密码
+// @Description 验证分享密码，通过后返回分享访问令牌，无需登录
+// @Description 之后查看、浏览、下载该分享时通过X-Share-Token请求头或share_token查询参数携带令牌，不必再传递密码
+// @Tags 分享管理
+// @Accept json
+// @Produce json
+// @Param unique_id path string true "分享唯一ID"
+// @Param request body model.ShareAccessRequest true "分享密码"
+// @Success 200 {object} map[string]interface{} "验证成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密码错误"
+// @Failure 403 {object} map[string]interface{} "分享不存在或已过期"
+// @Failure 429 {object} map[string]interface{} "密码错误次数过多，已暂时锁定"
+// @Router /share/{unique_id}/access [post]
+func (h *ShareHandler) VerifySharePassword(c *gin.Context) {
+	zap.L().Info("验证分享密码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	var req model.ShareAccessRequest
+	if err := c.ShouldBind(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, ttl, err := h.shareService.VerifySharePassword(ctx, uniqueID, req.Password, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("验证分享密码失败: %v", err)
+		util.Error(c, shareStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("验证分享密码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"access_token": token,
+		"expires_in":   int(ttl.Seconds()),
+	}, "验证成功")
+}
+
 // GetShareInfo godoc
 // @Summary 查看分享信息
 // @Description 获取分享详细信息，包括文件列表（可能需要密码验证）
@@ -170,11 +632,13 @@ func (h *ShareHandler) DeleteShare(c *gin.Context) {
 // @Security BearerAuth
 // @Param unique_id path string true "分享唯一ID"
 // @Param password formData string false "分享密码（如果需要）"
+// @Param X-Share-Token header string false "分享访问令牌（验证密码后获得，可代替密码）"
 // @Success 200 {object} map[string]interface{} "获取成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
 // @Failure 403 {object} map[string]interface{} "密码错误或无权限"
 // @Failure 404 {object} map[string]interface{} "分享不存在或已过期"
+// @Failure 429 {object} map[string]interface{} "密码错误或访问不存在的分享次数过多，已暂时锁定"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /share/{unique_id} [get]
 func (h *ShareHandler) GetShareInfo(c *gin.Context) {
@@ -183,19 +647,19 @@ func (h *ShareHandler) GetShareInfo(c *gin.Context) {
 		zap.String("method", c.Request.Method),
 		zap.String("client_ip", c.ClientIP()))
 	uniqueID := c.Param("unique_id")
-	password := c.PostForm("password")
+	password, accessToken := shareCredential(c)
 	//zap.S().Info(password)
 
 	ctx := c.Request.Context()
-	shareInfo, err := h.shareService.GetShareInfo(ctx, uniqueID, password)
+	shareInfo, err := h.shareService.GetShareInfo(ctx, uniqueID, password, accessToken, c.GetInt("user_id"), c.ClientIP())
 	if err != nil {
 		zap.S().Errorf("获取分享信息失败: %v", err)
-		util.Error(c, 403, err.Error())
+		util.Error(c, shareStatus(err), err.Error())
 		return
 	}
 
 	// 生成完整的分享链接
-	shareURL := fmt.Sprintf("%s/share/%s", c.Request.Host, uniqueID)
+	shareURL := h.shareService.ShareURL(requestOrigin(c), uniqueID)
 
 	zap.L().Info("获取分享信息请求结束",
 		zap.String("url", c.Request.RequestURI),
@@ -209,25 +673,164 @@ func (h *ShareHandler) GetShareInfo(c *gin.Context) {
 		"is_expired":    shareInfo.IsExpired,
 		"expire_time":   shareInfo.ExpireTime,
 		"share_url":     shareURL,
+		"short_url":     h.shareService.ShortURL(requestOrigin(c), shareInfo.Share),
 		"total_size":    shareInfo.TotalSize,
 		"file_count":    shareInfo.FileCount,
+		"preview_types": shareInfo.PreviewTypes,
 	}, "获取分享信息成功")
 }
 
+// GetShareTree godoc
+// @Summary 浏览分享中的文件夹
+// @Description 不带folder_id时返回分享的根文件列表，带folder_id时返回该文件夹下的内容（须位于分享的文件夹内）
+// @Description 内容实时读取，分享者之后在分享文件夹中新增的文件同样可见
+// @Tags 分享管理
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Param folder_id path int false "文件夹ID"
+// @Param password query string false "分享密码"
+// @Param X-Share-Token header string false "分享访问令牌（验证密码后获得，可代替密码）"
+// @Success 200 {object} model.ShareTreeResponse "获取成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密码错误或分享访问令牌无效"
+// @Failure 403 {object} map[string]interface{} "分享已过期或文件夹不在分享中"
+// @Failure 429 {object} map[string]interface{} "尝试次数过多，已暂时锁定"
+// @Router /share/{unique_id}/tree/{folder_id} [get]
+func (h *ShareHandler) GetShareTree(c *gin.Context) {
+	zap.L().Info("浏览分享文件夹请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	uniqueID := c.Param("unique_id")
+	password, accessToken := shareCredential(c)
+
+	var folderID uint64
+	if raw := c.Param("folder_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			zap.S().Errorf("无效的文件夹ID: %v", err)
+			util.Error(c, 400, "无效的文件夹ID")
+			return
+		}
+		folderID = id
+	}
+
+	ctx := c.Request.Context()
+	tree, err := h.shareService.GetShareTree(ctx, uniqueID, password, accessToken, uint(folderID), c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("浏览分享文件夹失败: %v", err)
+		util.Error(c, shareStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("浏览分享文件夹请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"folder":        tree.Folder,
+		"path":          tree.Path,
+		"files":         tree.Files,
+		"preview_types": tree.PreviewTypes,
+	}, "获取分享文件夹内容成功")
+}
+
+// PreviewSpecFile godoc
+// @Summary 预览分享中的文件
+// @Description 在线预览分享中的文件（可为分享文件夹下的文件），按文件类型返回，格式与/file/{id}/preview相同
+// @Description 无需登录。文本、Markdown、表格与源码只返回预览上限以内的内容，不计入下载次数；
+// @Description 图片、音视频与文档返回整个文件，与下载一样计入下载次数、未登录时按IP限制次数并限速。可预览的文件见查看分享与浏览分享返回的preview_types
+// @Description 分享开启水印时，图片与PDF加上访问者（用户名或IP）与时间的水印后返回
+// @Tags 分享管理
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Param file_id path int true "文件ID"
+// @Param password query string false "分享密码"
+// @Param share_token query string false "分享访问令牌（也可通过X-Share-Token请求头传递）"
+// @Param page query int false "表格预览页码（从1开始）"
+// @Param page_size query int false "表格预览每页行数（默认50，最大500）"
+// @Success 200 {file} binary "文件预览"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密码错误或分享访问令牌无效"
+// @Failure 403 {object} map[string]interface{} "文件不在分享中、是文件夹或已被隔离"
+// @Failure 404 {object} map[string]interface{} "文件已丢失"
+// @Failure 410 {object} map[string]interface{} "分享下载次数已达上限"
+// @Failure 413 {object} map[string]interface{} "文件过大，无法添加水印"
+// @Failure 415 {object} map[string]interface{} "不支持预览的文件类型或无法添加水印"
+// @Failure 429 {object} map[string]interface{} "未登录用户下载过于频繁，或尝试次数过多已暂时锁定"
+// @Router /share/{unique_id}/{file_id}/preview [get]
+func (h *ShareHandler) PreviewSpecFile(c *gin.Context) {
+	zap.L().Info("预览分享文件请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id") // 未登录时为0
+	uniqueID := c.Param("unique_id")
+	password, accessToken := shareCredential(c)
+	fileID, err := strconv.ParseUint(c.Param("file_id"), 10, 32)
+	if err != nil {
+		zap.S().Errorf("无效的文件ID: %v", err)
+		util.Error(c, 400, "无效的文件ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	file, fileType, limitedSpeed, stamp, err := h.shareService.PreviewSpecFile(ctx, uniqueID, password, accessToken, uint(fileID), userID, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("预览分享文件失败: %v", err)
+		util.Error(c, shareStatus(err), err.Error())
+		return
+	}
+
+	// 分享可能过期或被停用，预览结果不允许缓存；返回整个文件的预览与下载一样限速
+	c.Header("Cache-Control", "no-store")
+	if limitedSpeed > 0 {
+		c.Writer = &throttledWriter{ResponseWriter: c.Writer, ctx: ctx, limit: limitedSpeed, start: time.Now()}
+	}
+
+	if stamp == "" {
+		h.fileHandler.servePreviewType(c, file, fileType)
+	} else {
+		// 开启水印的分享，图片与PDF预览加水印后内联返回
+		data, contentType, name, err := h.shareService.WatermarkFile(ctx, file, stamp)
+		if err != nil {
+			zap.S().Errorf("添加水印失败: %v", err)
+			util.Error(c, watermarkStatus(err), err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
+		c.Data(200, contentType, data)
+	}
+
+	zap.L().Info("预览分享文件请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+}
+
 // DownloadSpecFile godoc
 // @Summary 下载分享中的指定文件
 // @Description 下载分享中的单个文件（支持限速，非VIP用户）
+// @Description 无需登录；未登录时按IP限制下载次数并使用单独的限速
+// @Description 分享开启水印时，图片与PDF加上访问者（用户名或IP）与时间的水印后返回，原文件保持不变
 // @Tags 分享管理
 // @Produce application/octet-stream
 // @Security BearerAuth
 // @Param unique_id path string true "分享唯一ID"
 // @Param file_id path int true "文件ID"
 // @Param password query string false "分享密码"
+// @Param share_token query string false "分享访问令牌（也可通过X-Share-Token请求头传递）"
 // @Success 200 {file} binary "文件流"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
-// @Failure 401 {object} map[string]interface{} "未授权"
-// @Failure 403 {object} map[string]interface{} "密码错误或无权限"
+// @Failure 401 {object} map[string]interface{} "密码错误或分享访问令牌无效"
+// @Failure 403 {object} map[string]interface{} "无权限"
 // @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Failure 410 {object} map[string]interface{} "分享下载次数已达上限"
+// @Failure 413 {object} map[string]interface{} "文件过大，无法添加水印"
+// @Failure 415 {object} map[string]interface{} "无法为该文件添加水印"
+// @Failure 429 {object} map[string]interface{} "未登录用户下载过于频繁，或尝试次数过多已暂时锁定"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /share/{unique_id}/{file_id}/download [get]
 func (h *ShareHandler) DownloadSpecFile(c *gin.Context) {
@@ -235,10 +838,10 @@ func (h *ShareHandler) DownloadSpecFile(c *gin.Context) {
 		zap.String("url", c.Request.RequestURI),
 		zap.String("method", c.Request.Method),
 		zap.String("client_ip", c.ClientIP()))
-	userID := c.GetInt("user_id")
+	userID := c.GetInt("user_id") // 未登录时为0
 	uniqueID := c.Param("unique_id")
 	fileIDStr := c.Param("file_id")
-	password := c.DefaultQuery("password", "")
+	password, accessToken := shareCredential(c)
 
 	fileID, err := strconv.ParseUint(fileIDStr, 10, 32)
 	if err != nil {
@@ -248,13 +851,37 @@ func (h *ShareHandler) DownloadSpecFile(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	file, limitedSpeed, err := h.shareService.DownloadSpecFile(ctx, uniqueID, password, uint(fileID), userID)
+	file, limitedSpeed, stamp, err := h.shareService.DownloadSpecFile(ctx, uniqueID, password, accessToken, uint(fileID), userID, c.ClientIP())
 	if err != nil {
 		zap.S().Errorf("下载指定文件失败: %v", err)
-		util.Error(c, 403, err.Error())
+		util.Error(c, shareStatus(err), err.Error())
 		return
 	}
 
+	//开启水印的分享：图片与PDF加水印后再发送，原文件保持不变
+	var stream io.Reader
+	name, size := file.Name, file.Size
+	if stamp != "" {
+		data, _, stampedName, err := h.shareService.WatermarkFile(ctx, file, stamp)
+		if err != nil {
+			zap.S().Errorf("添加水印失败: %v", err)
+			util.Error(c, watermarkStatus(err), err.Error())
+			return
+		}
+		stream = bytes.NewReader(data)
+		name, size = stampedName, int64(len(data))
+	} else {
+		//从minIO获取文件流
+		object, err := h.minioClient.GetStream(c, file.Path)
+		if err != nil {
+			zap.S().Errorf("从minIO获取文件失败: %v", err)
+			util.Error(c, 500, "从minIO获取文件失败"+err.Error())
+			return
+		}
+		defer object.Close()
+		stream = object
+	}
+
 	//// 设置下载响应头
 	//c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.Name))
 	//c.Header("Content-Type", "application/octet-stream")
@@ -271,20 +898,11 @@ func (h *ShareHandler) DownloadSpecFile(c *gin.Context) {
 	//指定传输编码为二进制，确保文件不会因为编码问题而损坏
 	c.Header("Content-Transfer-Encoding", "binary")
 	//强制下载并指定文件名
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.Name))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
 	//设置文件类型为二进制文件
 	c.Header("Content-Type", "application/octet-stream")
 	//提供Size用于为客户端提供下载进度和剩余时间
-	c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
-
-	//从minIO获取文件流
-	stream, err := h.minioClient.GetStream(c, file.Path)
-	if err != nil {
-		zap.S().Errorf("从minIO获取文件失败: %v", err)
-		util.Error(c, 500, "从minIO获取文件失败"+err.Error())
-		return
-	}
-	defer stream.Close()
+	c.Header("Content-Length", fmt.Sprintf("%d", size))
 
 	//不限速
 	if limitedSpeed == 0 {
@@ -415,7 +1033,7 @@ func (h *ShareHandler) DownloadSpecFile(c *gin.Context) {
 
 // SaveSpecFile godoc
 // @Summary 转存分享中的文件
-// @Description 将分享中的文件保存到自己的云盘中
+// @Description 将分享中的文件或文件夹保存到自己的根目录，新文件引用原文件的存储对象，占用自己的存储空间
 // @Tags 分享管理
 // @Produce json
 // @Security BearerAuth
@@ -425,9 +1043,11 @@ func (h *ShareHandler) DownloadSpecFile(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "转存成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "未授权"
-// @Failure 403 {object} map[string]interface{} "密码错误或无权限"
+// @Failure 403 {object} map[string]interface{} "密码错误、无权限或分享开启了水印"
 // @Failure 404 {object} map[string]interface{} "文件不存在"
-// @Failure 409 {object} map[string]interface{} "文件已存在"
+// @Failure 413 {object} map[string]interface{} "超过上传策略限制的单个文件大小或存储空间不足"
+// @Failure 415 {object} map[string]interface{} "上传策略不允许该类型"
+// @Failure 429 {object} map[string]interface{} "今日上传总量已达上限"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /share/{unique_id}/{file_id}/save [post]
 func (h *ShareHandler) SaveSpecFile(c *gin.Context) {
@@ -438,7 +1058,7 @@ func (h *ShareHandler) SaveSpecFile(c *gin.Context) {
 	userID := c.GetInt("user_id")
 	uniqueID := c.Param("unique_id")
 	fileIDStr := c.Param("file_id")
-	password := c.DefaultQuery("password", "")
+	password, accessToken := shareCredential(c)
 
 	fileID, err := strconv.ParseUint(fileIDStr, 10, 32)
 	if err != nil {
@@ -448,10 +1068,10 @@ func (h *ShareHandler) SaveSpecFile(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	savedFile, err := h.shareService.SaveSpecFile(ctx, uint(userID), uniqueID, password, uint(fileID))
+	savedFile, err := h.shareService.SaveSpecFile(ctx, uint(userID), uniqueID, password, accessToken, uint(fileID), c.ClientIP())
 	if err != nil {
 		zap.S().Errorf("转存文件失败: %v", err)
-		util.Error(c, 500, "转存文件失败: "+err.Error())
+		util.Error(c, saveStatus(err), "转存文件失败: "+err.Error())
 		return
 	}
 
@@ -464,3 +1084,172 @@ func (h *ShareHandler) SaveSpecFile(c *gin.Context) {
 		"file": savedFile,
 	}, "文件转存成功")
 }
+
+// SaveFiles godoc
+// @Summary 批量转存分享中的文件
+// @Description 将分享中选中的文件与文件夹（含其下全部内容）转存到自己的文件夹，重名时自动追加序号
+// @Description 新文件引用原文件的存储对象，不复制内容；按实际大小检查并占用存储空间，受上传策略约束；整个选择计一次下载
+// @Tags 分享管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param unique_id path string true "分享唯一ID"
+// @Param request body model.SaveShareRequest true "转存请求参数"
+// @Param X-Share-Token header string false "分享访问令牌（验证密码后获得，可代替密码）"
+// @Success 200 {object} map[string]interface{} "转存成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或目标文件夹不存在"
+// @Failure 401 {object} map[string]interface{} "未授权、密码错误或分享访问令牌无效"
+// @Failure 403 {object} map[string]interface{} "文件不在分享中、无权写入目标文件夹或分享开启了水印"
+// @Failure 410 {object} map[string]interface{} "分享下载次数已达上限"
+// @Failure 413 {object} map[string]interface{} "超过上传策略限制的单个文件大小或存储空间不足"
+// @Failure 415 {object} map[string]interface{} "上传策略不允许该类型"
+// @Failure 429 {object} map[string]interface{} "今日上传总量已达上限或尝试次数过多"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /share/{unique_id}/save [post]
+func (h *ShareHandler) SaveFiles(c *gin.Context) {
+	zap.L().Info("批量转存请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	uniqueID := c.Param("unique_id")
+	var req model.SaveShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("请求参数错误: %v", err)
+		util.Error(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	password, accessToken := shareCredential(c)
+	if req.Password != "" {
+		password = req.Password
+	}
+
+	ctx := c.Request.Context()
+	files, err := h.shareService.SaveFiles(ctx, uint(userID), uniqueID, password, accessToken, req.FileIDs, req.FolderID, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("批量转存失败: %v", err)
+		util.Error(c, saveStatus(err), "转存失败: "+err.Error())
+		return
+	}
+
+	zap.L().Info("批量转存请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"files": files,
+		"total": len(files),
+	}, "转存成功")
+}
+
+// watermarkStatus 添加水印出错时返回的状态码
+func watermarkStatus(err error) int {
+	switch {
+	case errors.Is(err, watermark.ErrTooLarge):
+		return 413
+	case errors.Is(err, watermark.ErrUnsupported):
+		return 415
+	}
+	return 500
+}
+
+// saveStatus 转存出错时返回的状态码
+func saveStatus(err error) int {
+	if status, ok := policyStatus(err); ok {
+		return status
+	}
+	switch {
+	case errors.Is(err, services.ErrQuotaExceeded), errors.Is(err, services.ErrFileTooLarge):
+		return 413
+	case errors.Is(err, services.ErrFileQuarantined), errors.Is(err, services.ErrShareWatermarked):
+		return 403
+	}
+	if status := shareStatus(err); status != 403 {
+		return status
+	}
+	switch err.Error() {
+	case "文件夹不存在", "目标不是文件夹":
+		return 400
+	case "无权访问此文件夹", "文件不存在于分享中":
+		return 403
+	}
+	return 500
+}
+
+// requestOrigin 请求的协议与主机，未配置公开地址时用于生成分享链接
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// shareCredential 获取访问分享的密码与分享访问令牌
+// 令牌可通过X-Share-Token请求头或share_token查询参数传递，后者便于直接打开下载链接
+func shareCredential(c *gin.Context) (string, string) {
+	password := c.PostForm("password")
+	if password == "" {
+		password = c.Query("password")
+	}
+	accessToken := c.GetHeader("X-Share-Token")
+	if accessToken == "" {
+		accessToken = c.Query("share_token")
+	}
+	return password, accessToken
+}
+
+// shareStatus 访问分享出错时返回的状态码
+func shareStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSharePasswordWrong), errors.Is(err, services.ErrShareTokenInvalid), errors.Is(err, services.ErrSharePasswordRequired):
+		return 401
+	case errors.Is(err, services.ErrShareRateLimited), errors.Is(err, services.ErrShareLocked):
+		return 429
+	case errors.Is(err, services.ErrShareDownloadLimit), errors.Is(err, services.ErrShareExpired):
+		return 410
+	case errors.Is(err, services.ErrSharePreviewType):
+		return 415
+	default:
+		return 403
+	}
+}
+
+// throttledWriter 按字节/秒限速写出，用于需要返回整个文件的分享预览（视频、音频按Range分段时同样生效）
+type throttledWriter struct {
+	gin.ResponseWriter
+	ctx     context.Context
+	limit   int64 // 每秒最多写出的字节数
+	written int64
+	start   time.Time
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n := min(int64(len(p)), w.limit)
+		// 已写出的字节数按限速需要的时间未到时先等待
+		wait := time.Duration(float64(w.written)/float64(w.limit)*float64(time.Second)) - time.Since(w.start)
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.ctx.Done():
+				return total, w.ctx.Err()
+			}
+		}
+		m, err := w.ResponseWriter.Write(p[:n])
+		total += m
+		w.written += int64(m)
+		if err != nil {
+			return total, err
+		}
+		w.ResponseWriter.Flush()
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (w *throttledWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
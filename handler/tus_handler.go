@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum,expiration"
+	// 校验和不一致，tus checksum扩展约定的状态码
+	statusChecksumMismatch = 460
+)
+
+type TusHandler struct {
+	tusService *services.TusService
+}
+
+func NewTusHandler(tusService *services.TusService) *TusHandler {
+	return &TusHandler{
+		tusService: tusService,
+	}
+}
+
+// checkTusResumable 所有响应携带Tus-Resumable；除OPTIONS外请求必须声明协议版本
+func (h *TusHandler) checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		util.Error(c, http.StatusPreconditionFailed, "不支持的tus协议版本")
+		return false
+	}
+	return true
+}
+
+// Options godoc
+// @Summary tus服务信息
+// @Description 返回服务端支持的tus版本、扩展、最大上传长度与校验算法
+// @Tags 文件管理
+// @Security BearerAuth
+// @Success 204 "无内容"
+// @Router /file/tus [options]
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.tusService.MaxSize(), 10))
+	c.Header("Tus-Checksum-Algorithm", strings.Join(services.TusChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// Create godoc
+// @Summary 创建tus上传
+// @Description tus creation扩展：根据Upload-Length与Upload-Metadata(filename, filetype)创建上传会话，通过Location返回上传地址
+// @Tags 文件管理
+// @Security BearerAuth
+// @Param Tus-Resumable header string true "协议版本 1.0.0"
+// @Param Upload-Length header int true "文件总长度"
+// @Param Upload-Metadata header string true "filename必填，值为base64编码"
+// @Success 201 "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 403 {object} map[string]interface{} "文件数量已达上限"
+// @Failure 412 {object} map[string]interface{} "协议版本不支持"
+// @Failure 413 {object} map[string]interface{} "文件太大或存储空间不足"
+// @Failure 415 {object} map[string]interface{} "上传策略不允许该扩展名"
+// @Failure 429 {object} map[string]interface{} "今日上传总量已达上限"
+// @Router /file/tus [post]
+func (h *TusHandler) Create(c *gin.Context) {
+	zap.L().Info("创建tus上传请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	//捕获数据
+	userID := c.GetInt("user_id")
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		zap.S().Errorf("Upload-Length非法: %v", c.GetHeader("Upload-Length"))
+		util.Error(c, 400, "Upload-Length非法")
+		return
+	}
+	if length > h.tusService.MaxSize() {
+		zap.S().Errorf("上传长度超出限制: %d", length)
+		util.Error(c, 413, "上传长度超出Tus-Max-Size")
+		return
+	}
+	metadata, err := services.ParseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		zap.S().Errorf("Upload-Metadata非法: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	//调用服务层
+	upload, err := h.tusService.CreateUpload(c.Request.Context(), userID, length, metadata)
+	if err != nil {
+		zap.S().Errorf("创建tus上传失败: %v", err)
+		if status, ok := policyStatus(err); ok {
+			util.Error(c, status, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrQuotaExceeded) || errors.Is(err, services.ErrFileTooLarge) {
+			util.Error(c, 413, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "filename") {
+			util.Error(c, 400, err.Error())
+			return
+		}
+		util.Error(c, 500, "创建上传失败")
+		return
+	}
+
+	zap.L().Info("创建tus上传请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	//返回响应
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// Head godoc
+// @Summary 查询tus上传进度
+// @Description 返回Upload-Offset与Upload-Length，用于断点续传
+// @Tags 文件管理
+// @Security BearerAuth
+// @Param Tus-Resumable header string true "协议版本 1.0.0"
+// @Param upload_id path string true "上传ID"
+// @Success 200 "查询成功"
+// @Failure 404 "上传不存在或已过期"
+// @Router /file/tus/{upload_id} [head]
+func (h *TusHandler) Head(c *gin.Context) {
+	if !h.checkTusResumable(c) {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+
+	upload, err := h.tusService.GetUpload(c.Request.Context(), c.GetInt("user_id"), c.Param("upload_id"))
+	if err != nil {
+		// HEAD响应不能携带body
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// Patch godoc
+// @Summary 上传tus分段
+// @Description 从Upload-Offset处追加数据；可通过Upload-Checksum校验分段，上传完成后创建文件记录并通过X-File-Id返回文件ID
+// @Tags 文件管理
+// @Accept application/offset+octet-stream
+// @Security BearerAuth
+// @Param Tus-Resumable header string true "协议版本 1.0.0"
+// @Param Upload-Offset header int true "当前偏移"
+// @Param Upload-Checksum header string false "校验和，格式: 算法 base64摘要"
+// @Param upload_id path string true "上传ID"
+// @Success 204 "写入成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 404 {object} map[string]interface{} "上传不存在或已过期"
+// @Failure 409 {object} map[string]interface{} "偏移不一致"
+// @Failure 415 {object} map[string]interface{} "Content-Type错误、文件内容与扩展名不一致或上传策略不允许该类型"
+// @Failure 460 {object} map[string]interface{} "校验和不一致"
+// @Router /file/tus/{upload_id} [patch]
+func (h *TusHandler) Patch(c *gin.Context) {
+	zap.L().Info("tus分段上传请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	//捕获数据
+	userID := c.GetInt("user_id")
+	uploadID := c.Param("upload_id")
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		zap.S().Errorf("Content-Type错误: %s", c.GetHeader("Content-Type"))
+		util.Error(c, 415, "Content-Type必须为application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		zap.S().Errorf("Upload-Offset非法: %v", c.GetHeader("Upload-Offset"))
+		util.Error(c, 400, "Upload-Offset非法")
+		return
+	}
+
+	//调用服务层
+	upload, file, err := h.tusService.WriteChunk(c.Request.Context(), userID, uploadID, offset, c.GetHeader("Upload-Checksum"), c.Request.Body)
+	if upload != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if err != nil {
+		zap.S().Errorf("tus分段上传失败: %v", err)
+		switch {
+		case errors.Is(err, services.ErrTusNotFound):
+			util.Error(c, 404, err.Error())
+		case errors.Is(err, services.ErrTusOffsetMismatch):
+			util.Error(c, 409, err.Error())
+		case errors.Is(err, services.ErrTusLocked):
+			util.Error(c, 423, err.Error())
+		case errors.Is(err, services.ErrTusTooLarge):
+			util.Error(c, 413, err.Error())
+		case errors.Is(err, services.ErrTusChecksumMismatch):
+			util.Error(c, statusChecksumMismatch, err.Error())
+		case errors.Is(err, services.ErrTusChecksumAlgo):
+			util.Error(c, 400, err.Error())
+		case errors.Is(err, services.ErrMimeMismatch):
+			util.Error(c, 415, err.Error())
+		case errors.Is(err, services.ErrPolicyExtDenied), errors.Is(err, services.ErrPolicyTypeDenied):
+			util.Error(c, 415, err.Error())
+		default:
+			util.Error(c, 500, "上传失败: "+err.Error())
+		}
+		return
+	}
+
+	zap.L().Info("tus分段上传请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	//返回响应
+	if file != nil {
+		c.Header("X-File-Id", strconv.FormatUint(uint64(file.ID), 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Terminate godoc
+// @Summary 终止tus上传
+// @Description tus termination扩展：删除上传会话与已上传的数据
+// @Tags 文件管理
+// @Security BearerAuth
+// @Param Tus-Resumable header string true "协议版本 1.0.0"
+// @Param upload_id path string true "上传ID"
+// @Success 204 "终止成功"
+// @Failure 404 {object} map[string]interface{} "上传不存在或已过期"
+// @Router /file/tus/{upload_id} [delete]
+func (h *TusHandler) Terminate(c *gin.Context) {
+	zap.L().Info("终止tus上传请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	if !h.checkTusResumable(c) {
+		return
+	}
+
+	err := h.tusService.Terminate(c.Request.Context(), c.GetInt("user_id"), c.Param("upload_id"))
+	if err != nil {
+		zap.S().Errorf("终止tus上传失败: %v", err)
+		switch {
+		case errors.Is(err, services.ErrTusNotFound):
+			util.Error(c, 404, err.Error())
+		case errors.Is(err, services.ErrTusLocked):
+			util.Error(c, 423, err.Error())
+		default:
+			util.Error(c, 500, "终止上传失败")
+		}
+		return
+	}
+
+	zap.L().Info("终止tus上传请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"ClaranCloudDisk/model"
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"encoding/base64"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type TwoFactorHandler struct {
+	twoFactorService *services.TwoFactorService
+	userService      *services.UserService
+}
+
+func NewTwoFactorHandler(twoFactorService *services.TwoFactorService, userService *services.UserService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: twoFactorService,
+		userService:      userService,
+	}
+}
+
+// LoginTwoFactor godoc
+// @Summary 两步验证登录
+// @Description 使用/user/login返回的challenge_token与验证器中的6位动态码（或一次性恢复码）换取访问令牌和刷新令牌
+// @Description 登录挑战5分钟内有效，最多尝试5次，成功后即失效
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param request body model.LoginTwoFactorRequest true "两步验证登录请求参数"
+// @Success 200 {object} map[string]interface{} "登录成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "验证码错误，或登录挑战无效、已过期、尝试次数过多"
+// @Failure 403 {object} map[string]interface{} "用户已被封禁"
+// @Failure 429 {object} map[string]interface{} "累计输错次数过多，两步验证已锁定"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/login/2fa [post]
+func (h *TwoFactorHandler) LoginTwoFactor(c *gin.Context) {
+	zap.L().Info("两步验证登录请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	var req model.LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.twoFactorService.CompleteLogin(ctx, req.ChallengeToken, req.Code, c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("两步验证登录失败: %v", err)
+		util.Error(c, twoFactorStatus(err), err.Error())
+		return
+	}
+
+	token, refreshToken, err := h.userService.IssueTokens(ctx, user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		zap.S().Errorf("签发令牌失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("两步验证登录请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"username":      user.Username,
+		"user_id":       user.UserID,
+		"email":         user.Email,
+		"token":         token,
+		"refresh_token": refreshToken,
+	}, "login successful")
+}
+
+// GetStatus godoc
+// @Summary 查看两步验证状态
+// @Description 查看是否已开启两步验证、剩余恢复码数量，以及安全策略是否要求当前用户开启
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/2fa [get]
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	zap.L().Info("查看两步验证状态请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+
+	ctx := c.Request.Context()
+	enabled, remaining, required, err := h.twoFactorService.Status(ctx, userID)
+	if err != nil {
+		zap.S().Errorf("查看两步验证状态失败: %v", err)
+		util.Error(c, 500, err.Error())
+		return
+	}
+
+	zap.L().Info("查看两步验证状态请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+		"required":                 required,
+	}, "获取两步验证状态成功")
+}
+
+// Setup godoc
+// @Summary 获取两步验证密钥
+// @Description 生成新的TOTP密钥，返回密钥、otpauth链接与二维码（data URI），用验证器扫码后调用/user/2fa/enable确认
+// @Description 密钥10分钟内有效，确认前不会生效；重复调用会生成新的密钥
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 400 {object} map[string]interface{} "已开启两步验证"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/2fa/setup [post]
+func (h *TwoFactorHandler) Setup(c *gin.Context) {
+	zap.L().Info("获取两步验证密钥请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+
+	ctx := c.Request.Context()
+	secret, otpauthURL, png, err := h.twoFactorService.Setup(ctx, userID)
+	if err != nil {
+		zap.S().Errorf("获取两步验证密钥失败: %v", err)
+		util.Error(c, twoFactorStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("获取两步验证密钥请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Header("Cache-Control", "no-store")
+	util.Success(c, gin.H{
+		"secret":      secret,
+		"otpauth_url": otpauthURL,
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		"expires_in":  int(services.TwoFactorSetupTTL.Seconds()),
+	}, "请使用验证器扫描二维码，并提交验证码以开启两步验证")
+}
+
+// Enable godoc
+// @Summary 开启两步验证
+// @Description 提交验证器中的6位动态码确认密钥，成功后开启两步验证并返回10个一次性恢复码
+// @Description 恢复码只在此时返回一次，请妥善保存
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.TwoFactorCodeRequest true "动态码"
+// @Success 200 {object} map[string]interface{} "开启成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误、已开启或未获取密钥"
+// @Failure 401 {object} map[string]interface{} "验证码错误"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/2fa/enable [post]
+func (h *TwoFactorHandler) Enable(c *gin.Context) {
+	zap.L().Info("开启两步验证请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	codes, err := h.twoFactorService.Enable(ctx, userID, req.Code)
+	if err != nil {
+		zap.S().Errorf("开启两步验证失败: %v", err)
+		util.Error(c, twoFactorStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("开启两步验证请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Header("Cache-Control", "no-store")
+	util.Success(c, gin.H{
+		"recovery_codes": codes,
+	}, "开启两步验证成功")
+}
+
+// Disable godoc
+// @Summary 关闭两步验证
+// @Description 提交密码与动态码（或恢复码）关闭两步验证，密钥与恢复码一并清除
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.DisableTwoFactorRequest true "密码与动态码"
+// @Success 200 {object} map[string]interface{} "关闭成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或未开启"
+// @Failure 401 {object} map[string]interface{} "密码或验证码错误"
+// @Failure 403 {object} map[string]interface{} "安全策略要求管理员开启两步验证"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/2fa/disable [post]
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	zap.L().Info("关闭两步验证请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.twoFactorService.Disable(ctx, userID, req.Password, req.Code); err != nil {
+		zap.S().Errorf("关闭两步验证失败: %v", err)
+		util.Error(c, twoFactorStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("关闭两步验证请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	util.Success(c, gin.H{
+		"enabled": false,
+	}, "关闭两步验证成功")
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary 重新生成恢复码
+// @Description 提交验证器中的6位动态码，作废全部旧恢复码并返回10个新的恢复码
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.TwoFactorCodeRequest true "动态码"
+// @Success 200 {object} map[string]interface{} "生成成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或未开启"
+// @Failure 401 {object} map[string]interface{} "验证码错误"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /user/2fa/recovery_codes [post]
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	zap.L().Info("重新生成恢复码请求开始",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+	userID := c.GetInt("user_id")
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zap.S().Errorf("绑定请求体失败: %v", err)
+		util.Error(c, 400, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		zap.S().Errorf("重新生成恢复码失败: %v", err)
+		util.Error(c, twoFactorStatus(err), err.Error())
+		return
+	}
+
+	zap.L().Info("重新生成恢复码请求结束",
+		zap.String("url", c.Request.RequestURI),
+		zap.String("method", c.Request.Method),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.Header("Cache-Control", "no-store")
+	util.Success(c, gin.H{
+		"recovery_codes": codes,
+	}, "重新生成恢复码成功")
+}
+
+func twoFactorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorCodeWrong),
+		errors.Is(err, services.ErrTwoFactorPasswordWrong),
+		errors.Is(err, services.ErrTwoFactorChallenge):
+		return 401
+	case errors.Is(err, services.ErrTwoFactorNotSetup),
+		errors.Is(err, services.ErrTwoFactorEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return 400
+	case errors.Is(err, services.ErrAdminTwoFactorDisabling),
+		errors.Is(err, services.ErrUserBanned):
+		return 403
+	case errors.Is(err, services.ErrTwoFactorLocked):
+		return 429
+	}
+	return 500
+}
@@ -5,6 +5,7 @@ import (
 	"ClaranCloudDisk/service"
 	"ClaranCloudDisk/util"
 	"ClaranCloudDisk/util/minIO"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -18,13 +19,15 @@ import (
 
 type UserHandler struct {
 	userService       *services.UserService
+	twoFactorService  *services.TwoFactorService
 	DefaultAvatarPath string
 	minioClient       *minIO.MinIOClient
 }
 
-func NewUserHandler(userService *services.UserService, DefaultAvatarPath string, minioClient *minIO.MinIOClient) *UserHandler {
+func NewUserHandler(userService *services.UserService, twoFactorService *services.TwoFactorService, DefaultAvatarPath string, minioClient *minIO.MinIOClient) *UserHandler {
 	return &UserHandler{
 		userService:       userService,
+		twoFactorService:  twoFactorService,
 		DefaultAvatarPath: DefaultAvatarPath,
 		minioClient:       minioClient,
 	}
@@ -38,7 +41,7 @@ func NewUserHandler(userService *services.UserService, DefaultAvatarPath string,
 // @Produce json
 // @Param request body model.RegisterRequest true "注册请求参数"
 // @Success 200 {object} util.Response "注册成功"
-// @Failure 400 {object} util.Response "请求参数错误"
+// @Failure 400 {object} util.Response "请求参数错误或邮箱验证凭证无效"
 // @Failure 409 {object} util.Response "用户名或邮箱已存在"
 // @Failure 500 {object} util.Response "服务器内部错误"
 // @Router /user/register [post]
@@ -56,9 +59,13 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 
 	//调用服务层
-	user, invitaionCode, err := h.userService.Register(&req)
+	user, invitaionCode, err := h.userService.Register(c.Request.Context(), &req)
 	if err != nil {
 		zap.S().Errorf("注册失败: %v", err)
+		if errors.Is(err, services.ErrEmailProofInvalid) {
+			util.Error(c, 400, err.Error())
+			return
+		}
 		util.Error(c, 500, err.Error())
 		return
 	}
@@ -80,13 +87,14 @@ func (h *UserHandler) Register(c *gin.Context) {
 
 // Login godoc
 // @Summary 用户登录
-// @Description 用户登录接口，返回访问令牌和刷新令牌
+// @Description 用户登录接口，返回访问令牌和刷新令牌；开启了两步验证时返回two_factor_required与challenge_token，需再调用/user/login/2fa
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Param request body model.LoginRequest true "登录请求参数"
-// @Success 200 {object} map[string]interface{} "登录成功"
+// @Success 200 {object} map[string]interface{} "登录成功或需要两步验证"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 429 {object} map[string]interface{} "两步验证累计输错次数过多，已锁定"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /user/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
@@ -103,7 +111,35 @@ func (h *UserHandler) Login(c *gin.Context) {
 	}
 
 	//调用服务层
-	token, user, err, refreshToken := h.userService.Login(req.LoginKey, req.Password)
+	token, user, err, refreshToken := h.userService.Login(c.Request.Context(), req.LoginKey, req.Password, c.Request.UserAgent(), c.ClientIP())
+	if errors.Is(err, services.ErrTwoFactorRequired) {
+		//密码正确，签发登录挑战，换取令牌还需要动态码
+		challengeToken, expiresIn, err := h.twoFactorService.Challenge(user.UserID)
+		if err != nil {
+			zap.S().Errorf("签发登录挑战失败: %v", err)
+			util.Error(c, 500, err.Error())
+			return
+		}
+
+		zap.L().Info("登录请求结束",
+			zap.String("url", c.Request.RequestURI),
+			zap.String("method", c.Request.Method),
+			zap.String("client_ip", c.ClientIP()))
+
+		util.Success(c, gin.H{
+			"username":            user.Username,
+			"user_id":             user.UserID,
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+			"expires_in":          expiresIn,
+		}, services.ErrTwoFactorRequired.Error())
+		return
+	}
+	if errors.Is(err, services.ErrTwoFactorLocked) {
+		zap.S().Errorf("登录失败: %v", err)
+		util.Error(c, 429, err.Error())
+		return
+	}
 	if err != nil {
 		zap.S().Errorf("登录失败: %v", err)
 		util.Error(c, 500, err.Error())
@@ -168,13 +204,16 @@ func (h *UserHandler) InfoHandler(c *gin.Context) {
 
 // Refresh godoc
 // @Summary 刷新访问令牌
-// @Description 使用刷新令牌获取新的访问令牌
+// @Description 使用刷新令牌获取新的访问令牌与新的刷新令牌，旧的刷新令牌随即作废
+// @Description 再次使用已作废的刷新令牌会撤销整个会话，需要重新登录
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Param request body model.RefreshTokenRequest true "刷新令牌请求参数"
 // @Success 200 {object} map[string]interface{} "刷新成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "刷新令牌无效、已过期或已被使用过"
+// @Failure 403 {object} map[string]interface{} "用户已被封禁"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /user/refresh [post]
 func (h *UserHandler) Refresh(c *gin.Context) {
@@ -191,10 +230,14 @@ func (h *UserHandler) Refresh(c *gin.Context) {
 	}
 
 	//调用服务层
-	token, err := h.userService.Refresh(req)
+	token, refreshToken, err := h.userService.Refresh(c.Request.Context(), req, c.ClientIP())
 	if err != nil {
 		zap.S().Errorf("refresh token失败: %v", err)
-		util.Error(c, 500, err.Error())
+		if status := sessionStatus(err); status != 500 {
+			util.Error(c, status, err.Error())
+			return
+		}
+		util.Error(c, 500, "刷新令牌失败")
 		return
 	}
 
@@ -205,13 +248,14 @@ func (h *UserHandler) Refresh(c *gin.Context) {
 
 	//返回响应
 	util.Success(c, gin.H{
-		"new_token": token,
+		"new_token":     token,
+		"refresh_token": refreshToken,
 	}, "RefreshToken successfully")
 }
 
 // Logout godoc
 // @Summary 用户登出
-// @Description 用户登出，使当前令牌失效
+// @Description 用户登出，使当前令牌失效并撤销当前会话，会话的刷新令牌随之失效
 // @Tags 用户管理
 // @Accept json
 // @Produce json
@@ -236,7 +280,9 @@ func (h *UserHandler) Logout(c *gin.Context) {
 	}
 
 	//调用服务层
-	err := h.userService.Logout(req.Token)
+	userID := c.GetInt("user_id")
+	sessionID := c.GetString("session_id")
+	err := h.userService.Logout(c.Request.Context(), req.Token, userID, sessionID)
 	if err != nil {
 		zap.S().Errorf("登出失败: %v", err)
 		util.Error(c, 500, "登出失败"+err.Error())
@@ -285,6 +331,10 @@ func (h *UserHandler) Update(c *gin.Context) {
 	user, err := h.userService.UpdateInfo(UserID.(int), req)
 	if err != nil {
 		zap.S().Errorf("更新用户信息失败: %v", err)
+		if errors.Is(err, services.ErrEmailVerificationRequired) {
+			util.Error(c, 400, err.Error())
+			return
+		}
 		util.Error(c, 500, "UpdateInfo failed")
 	}
 
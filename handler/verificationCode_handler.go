@@ -65,7 +65,7 @@ func (h *VerificationHandler) GetVerificationCode(c *gin.Context) {
 
 // VerifyVerificationCode godoc
 // @Summary 验证邮箱验证码
-// @Description 验证邮箱接收到的验证码
+// @Description 验证邮箱接收到的验证码，验证通过后返回邮箱验证凭证email_token，30分钟内有效，注册时提交
 // @Tags 用户管理
 // @Accept json
 // @Produce json
@@ -103,13 +103,23 @@ func (h *VerificationHandler) VerifyVerificationCode(c *gin.Context) {
 		return
 	}
 
+	// 签发邮箱验证凭证
+	emailToken, expiresIn, err := h.verificationService.IssueEmailProof(ctx, req.Email)
+	if err != nil {
+		zap.S().Errorf("签发邮箱验证凭证失败: %v", err)
+		util.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	zap.L().Info("验证验证码请求结束",
 		zap.String("url", c.Request.RequestURI),
 		zap.String("method", c.Request.Method),
 		zap.String("client_ip", c.ClientIP()))
 
 	util.Success(c, gin.H{
-		"email":    req.Email,
-		"verified": true,
+		"email":       req.Email,
+		"verified":    true,
+		"email_token": emailToken,
+		"expires_in":  expiresIn,
 	}, "验证成功")
 }
@@ -10,7 +10,9 @@ import (
 	"ClaranCloudDisk/service"
 	"ClaranCloudDisk/util/jwt_util"
 	"ClaranCloudDisk/util/minIO"
+	"ClaranCloudDisk/util/scanner"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -97,26 +99,78 @@ func main() {
 	tokenRepo := mysql.NewMysqlTokenRepo(db, redisClient.(*cache.RedisClient))
 	fileRepo := mysql.NewMysqlFileRepo(db, redisClient.(*cache.RedisClient))
 	shareRepo := mysql.NewMysqlShareRepo(db, redisClient.(*cache.RedisClient))
+	albumRepo := mysql.NewMysqlAlbumRepo(db, redisClient.(*cache.RedisClient))
 	verificationRepo := cache.NewVerificationCodeCache(redisClient.(*cache.RedisClient))
+	tusCache := cache.NewTusUploadCache(redisClient.(*cache.RedisClient))
+	quotaCache := cache.NewQuotaCache(redisClient.(*cache.RedisClient))
+	uploadPolicyRepo := mysql.NewMysqlUploadPolicyRepo(db, redisClient.(*cache.RedisClient))
+	dailyUploadCache := cache.NewDailyUploadCache(redisClient.(*cache.RedisClient))
+	offlineTaskRepo := mysql.NewMysqlOfflineTaskRepo(db, redisClient.(*cache.RedisClient))
+	rateLimitCache := cache.NewRateLimitCache(redisClient.(*cache.RedisClient))
+	shareStatsCache := cache.NewShareStatsCache(redisClient.(*cache.RedisClient))
+	shareGuardCache := cache.NewShareGuardCache(redisClient.(*cache.RedisClient))
+	auditRepo := mysql.NewMysqlAuditRepo(db, redisClient.(*cache.RedisClient))
+	directShareRepo := mysql.NewMysqlDirectShareRepo(db, redisClient.(*cache.RedisClient))
+	fileRequestRepo := mysql.NewMysqlFileRequestRepo(db, redisClient.(*cache.RedisClient))
+	twoFactorRepo := mysql.NewMysqlTwoFactorRepo(db, redisClient.(*cache.RedisClient))
+	twoFactorCache := cache.NewTwoFactorCache(redisClient.(*cache.RedisClient))
+	sessionRepo := mysql.NewMysqlSessionRepo(db, redisClient.(*cache.RedisClient))
+	sessionCache := cache.NewSessionCache(redisClient.(*cache.RedisClient))
+	passwordResetCache := cache.NewPasswordResetCache(redisClient.(*cache.RedisClient))
+	emailCache := cache.NewEmailCache(redisClient.(*cache.RedisClient))
+	// 上传内容扫描
+	contentScanner := scanner.NewScanner(cfg.ScannerAddr, time.Duration(cfg.ScannerTimeout)*time.Second)
 	// JWT工具
 	jwtUtil := jwt_util.NewJWTUtil(cfg)
 	// 业务逻辑层依赖
-	userService := services.NewUserService(userRepo, tokenRepo, jwtUtil, cfg.AvatarDIR, minIOClient)
-	fileService := services.NewUFileService(fileRepo, userRepo, minIOClient, cfg.CloudFileDir, cfg.MaxFileSize, cfg.NormalUserMaxStorage, cfg.LimitedSpeed)
-	shareService := services.NewShareService(shareRepo, fileRepo, userRepo, cfg.CloudFileDir, cfg.LimitedSpeed)
-	verificationService := services.NewVerificationService(verificationRepo, cfg.Email)
-	adminService := services.NewAdminService(userRepo)
+	sessionService := services.NewSessionService(sessionRepo, sessionCache, userRepo, auditRepo, jwtUtil, cfg.JWTExpireHours, cfg.Security)
+	verificationService := services.NewVerificationService(verificationRepo, emailCache, cfg.Email)
+	userService := services.NewUserService(userRepo, tokenRepo, sessionService, verificationService, twoFactorCache, jwtUtil, cfg.AvatarDIR, minIOClient, cfg.Security.RequireEmailVerification)
+	twoFactorService := services.NewTwoFactorService(userRepo, twoFactorRepo, twoFactorCache, auditRepo, jwtUtil, cfg.AppName, cfg.Security)
+	uploadPolicyService := services.NewUploadPolicyService(uploadPolicyRepo, userRepo, fileRepo, dailyUploadCache, cfg.UploadPolicy)
+	fileService := services.NewUFileService(fileRepo, userRepo, quotaCache, minIOClient, contentScanner, uploadPolicyService, directShareRepo, cfg.CloudFileDir, cfg.MaxFileSize, cfg.NormalUserMaxStorage, cfg.LimitedSpeed, cfg.PreviewMaxSize, cfg.MimeMismatchPolicy)
+	passwordResetService := services.NewPasswordResetService(userRepo, passwordResetCache, verificationService, sessionService)
+	emailChangeService := services.NewEmailChangeService(userRepo, emailCache, verificationService)
+	shareService := services.NewShareService(shareRepo, fileRepo, userRepo, fileService, uploadPolicyService, rateLimitCache, shareStatsCache, shareGuardCache, auditRepo, verificationService, jwtUtil, cfg.CloudFileDir, cfg.LimitedSpeed, cfg.Share)
+	directShareService := services.NewDirectShareService(directShareRepo, fileRepo, userRepo)
+	fileRequestService := services.NewFileRequestService(fileRequestRepo, fileService, userRepo, shareGuardCache, jwtUtil, cfg.Share)
+	adminService := services.NewAdminService(userRepo, fileRepo, uploadPolicyService, auditRepo, twoFactorService)
+	photoService := services.NewPhotoService(fileRepo, albumRepo, shareService)
+	tusService := services.NewTusService(tusCache, fileService, cfg.CloudFileDir, cfg.TusExpireHours)
+	offlineService := services.NewOfflineService(offlineTaskRepo, fileService, cfg.CloudFileDir, cfg.OfflineWorkers, cfg.OfflineTimeout)
 	// 处理器层依赖
-	userHandler := handlers.NewUserHandler(userService, cfg.DefaultAvatarPath, minIOClient)
+	userHandler := handlers.NewUserHandler(userService, twoFactorService, cfg.DefaultAvatarPath, minIOClient)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService, userService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
 	fileHandler := handlers.NewFileHandler(fileService, minIOClient)
-	shareHandler := handlers.NewShareHandler(shareService, minIOClient)
+	shareHandler := handlers.NewShareHandler(shareService, fileHandler, minIOClient)
+	directShareHandler := handlers.NewDirectShareHandler(directShareService)
+	fileRequestHandler := handlers.NewFileRequestHandler(fileRequestService)
 	verificationHandler := handlers.NewVerificationHandler(verificationService)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
+	emailChangeHandler := handlers.NewEmailChangeHandler(emailChangeService)
 	adminHandler := handlers.NewAdminHandler(adminService)
+	photoHandler := handlers.NewPhotoHandler(photoService)
+	tusHandler := handlers.NewTusHandler(tusService)
+	offlineHandler := handlers.NewOfflineHandler(offlineService)
+	// 定期清理过期的上传临时文件
+	go fileService.RunUploadCleaner(time.Hour)
+	go tusService.RunUploadCleaner(time.Hour)
+	// 离线下载
+	offlineService.Start()
+	go offlineService.RunTmpCleaner(time.Hour)
+	// 定期写回分享统计
+	go shareService.RunStatsFlusher(time.Duration(cfg.Share.StatsFlushInterval) * time.Second)
 	//创建中间件
 	securityMiddleware := middleware.NewSecurity(cfg.MaxRequests)
-	jwtMiddleware := middleware.NewJWTMiddleware(jwtUtil, tokenRepo)
+	jwtMiddleware := middleware.NewJWTMiddleware(jwtUtil, tokenRepo, userRepo, sessionCache)
+	twoFactorMiddleware := middleware.NewTwoFactorMiddleware(twoFactorService)
 
 	r := gin.Default()
+	// 只信任配置的反向代理转发的客户端IP，未配置时使用连接地址，防止伪造X-Forwarded-For绕过按IP的限流
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		zap.S().Fatalf("可信代理配置错误: %v", err)
+	}
 	//========================================Swagger==================================================
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	//=======================================用户管理路由================================================
@@ -127,19 +181,33 @@ func main() {
 	user := r.Group("/user")
 	user.Use(securityMiddleware.SecurityMiddleware())
 	user.Use(securityMiddleware.UserRateLimitMiddleware())
-	user.POST("/register", userHandler.Register)                                                                 // 注册
-	user.POST("/login", userHandler.Login)                                                                       // 登录
-	user.POST("/refresh", userHandler.Refresh)                                                                   // 刷新token
-	user.GET("/info", jwtMiddleware.JWTAuthentication(), userHandler.InfoHandler)                                // 获取个人信息
-	user.POST("/logout", jwtMiddleware.JWTAuthentication(), userHandler.Logout)                                  // 登出
-	user.PUT("/update", jwtMiddleware.JWTAuthentication(), userHandler.Update)                                   // 更新个人信息
-	user.GET("/generate_invitation_code", jwtMiddleware.JWTAuthentication(), userHandler.GenerateInvitationCode) // 生成邀请码
-	user.GET("/invitation_code_list", jwtMiddleware.JWTAuthentication(), userHandler.InvitationCodeList)         // 生成的邀请码列表
-	user.POST("/upload_avatar", jwtMiddleware.JWTAuthentication(), userHandler.UploadAvatar)                     // 上传头像
-	user.GET("/get_avatar", jwtMiddleware.JWTAuthentication(), userHandler.GetAvatar)                            // 获取当前用户头像
-	user.GET("/:id/get_avatar", userHandler.GetUniqueAvatar)                                                     // 获取特定用户头像
-	user.POST("/get_verification_code", verificationHandler.GetVerificationCode)                                 // 获取邮箱验证码
-	user.POST("/verify_verification_code", verificationHandler.VerifyVerificationCode)                           // 验证邮箱验证码
+	user.POST("/register", userHandler.Register)                                                                  // 注册
+	user.POST("/login", userHandler.Login)                                                                        // 登录
+	user.POST("/login/2fa", twoFactorHandler.LoginTwoFactor)                                                      // 两步验证登录(动态码或恢复码换取令牌)
+	user.POST("/refresh", userHandler.Refresh)                                                                    // 刷新token
+	user.GET("/info", jwtMiddleware.JWTAuthentication(), userHandler.InfoHandler)                                 // 获取个人信息
+	user.POST("/logout", jwtMiddleware.JWTAuthentication(), userHandler.Logout)                                   // 登出
+	user.PUT("/update", jwtMiddleware.JWTAuthentication(), userHandler.Update)                                    // 更新个人信息
+	user.GET("/generate_invitation_code", jwtMiddleware.JWTAuthentication(), userHandler.GenerateInvitationCode)  // 生成邀请码
+	user.GET("/invitation_code_list", jwtMiddleware.JWTAuthentication(), userHandler.InvitationCodeList)          // 生成的邀请码列表
+	user.POST("/upload_avatar", jwtMiddleware.JWTAuthentication(), userHandler.UploadAvatar)                      // 上传头像
+	user.GET("/get_avatar", jwtMiddleware.JWTAuthentication(), userHandler.GetAvatar)                             // 获取当前用户头像
+	user.GET("/:id/get_avatar", userHandler.GetUniqueAvatar)                                                      // 获取特定用户头像
+	user.POST("/get_verification_code", verificationHandler.GetVerificationCode)                                  // 获取邮箱验证码
+	user.POST("/verify_verification_code", verificationHandler.VerifyVerificationCode)                            // 验证邮箱验证码
+	user.POST("/password/forgot", passwordResetHandler.ForgotPassword)                                            // 找回密码: 获取验证码
+	user.POST("/password/verify", passwordResetHandler.VerifyResetCode)                                           // 找回密码: 校验验证码，换取重置令牌
+	user.POST("/password/reset", passwordResetHandler.ResetPassword)                                              // 找回密码: 设置新密码
+	user.POST("/email/change", jwtMiddleware.JWTAuthentication(), emailChangeHandler.RequestEmailChange)          // 修改邮箱: 验证密码，向新邮箱发送验证码
+	user.POST("/email/confirm", jwtMiddleware.JWTAuthentication(), emailChangeHandler.ConfirmEmailChange)         // 修改邮箱: 确认新邮箱验证码
+	user.GET("/2fa", jwtMiddleware.JWTAuthentication(), twoFactorHandler.GetStatus)                               // 查看两步验证状态
+	user.POST("/2fa/setup", jwtMiddleware.JWTAuthentication(), twoFactorHandler.Setup)                            // 获取两步验证密钥与二维码
+	user.POST("/2fa/enable", jwtMiddleware.JWTAuthentication(), twoFactorHandler.Enable)                          // 开启两步验证(返回恢复码)
+	user.POST("/2fa/disable", jwtMiddleware.JWTAuthentication(), twoFactorHandler.Disable)                        // 关闭两步验证
+	user.POST("/2fa/recovery_codes", jwtMiddleware.JWTAuthentication(), twoFactorHandler.RegenerateRecoveryCodes) // 重新生成恢复码
+	user.GET("/sessions", jwtMiddleware.JWTAuthentication(), sessionHandler.ListSessions)                         // 登录设备(会话)列表
+	user.DELETE("/sessions/:session_id", jwtMiddleware.JWTAuthentication(), sessionHandler.RevokeSession)         // 撤销一个会话(下线设备)
+	user.DELETE("/sessions", jwtMiddleware.JWTAuthentication(), sessionHandler.RevokeAllSessions)                 // 撤销其他全部会话
 
 	//=======================================文件管理路由================================================
 	zap.L().Info("启动路由服务",
@@ -150,23 +218,39 @@ func main() {
 	file.Use(securityMiddleware.SecurityMiddleware())
 	file.Use(securityMiddleware.UserRateLimitMiddleware())
 	file.Use(jwtMiddleware.JWTAuthentication())
-	file.POST("/upload", fileHandler.Upload)                     // 上传文件
-	file.POST("/chunk_upload", fileHandler.ChunkUpload)          // 分片上传文件
-	file.GET("/chunk_upload/status", fileHandler.GetChunkStatus) // 断点传续(分片传输状态查询)
-	file.GET("/:id/download", fileHandler.Download)              // 下载文件
-	file.GET("/:id", fileHandler.GetFileInfo)                    // 获取文件详细信息
-	file.GET("/list", fileHandler.GetFileList)                   // 获取文件列表
-	file.PUT("/:id/delete/soft", fileHandler.SoftDelete)         // 软删除文件(将文件放入回收站)
-	file.PUT("/:id/delete/recovery", fileHandler.RecoverFile)    // 恢复文件
-	file.DELETE("/:id/delete/tough", fileHandler.Delete)         // 直接删除文件
-	file.GET("/bin", fileHandler.GetBinList)                     // 获取回收站文件列表
-	file.PUT("/:id/rename", fileHandler.Rename)                  // 重命名文件
-	file.GET("/:id/preview", fileHandler.Preview)                // 预览文件
-	file.GET("/:id/preview_info", fileHandler.GetPreInfo)        // 获取预览信息
-	file.GET("/star_list", fileHandler.GetStarList)              // 获取收藏列表
-	file.POST("/:id/star", fileHandler.Star)                     // 收藏
-	file.POST("/:id/Unstar", fileHandler.Unstar)                 // 取消收藏
-	file.POST("/search", fileHandler.SearchFile)                 // 用户旗下的文件搜索
+	file.POST("/upload", fileHandler.Upload)                              // 上传文件
+	file.POST("/chunk_upload/init", fileHandler.InitChunkUpload)          // 初始化分片上传(签发upload_id)
+	file.POST("/chunk_upload", fileHandler.ChunkUpload)                   // 分片上传文件
+	file.GET("/chunk_upload/status", fileHandler.GetChunkStatus)          // 断点传续(分片传输状态查询)
+	file.DELETE("/chunk_upload/:upload_id", fileHandler.AbortChunkUpload) // 取消分片上传
+	file.GET("/:id/download", fileHandler.Download)                       // 下载文件
+	file.GET("/:id", fileHandler.GetFileInfo)                             // 获取文件详细信息
+	file.GET("/list", fileHandler.GetFileList)                            // 获取文件列表
+	file.PUT("/:id/delete/soft", fileHandler.SoftDelete)                  // 软删除文件(将文件放入回收站)
+	file.PUT("/:id/delete/recovery", fileHandler.RecoverFile)             // 恢复文件
+	file.DELETE("/:id/delete/tough", fileHandler.Delete)                  // 直接删除文件
+	file.GET("/bin", fileHandler.GetBinList)                              // 获取回收站文件列表
+	file.PUT("/:id/rename", fileHandler.Rename)                           // 重命名文件
+	file.PUT("/:id/move", fileHandler.MoveFile)                           // 移动文件或文件夹
+	file.POST("/folder", fileHandler.CreateFolder)                        // 新建文件夹
+	file.GET("/folder", fileHandler.ListFolder)                           // 获取文件夹内容
+	file.GET("/:id/preview", fileHandler.Preview)                         // 预览文件
+	file.GET("/:id/preview_info", fileHandler.GetPreInfo)                 // 获取预览信息
+	file.GET("/star_list", fileHandler.GetStarList)                       // 获取收藏列表
+	file.POST("/:id/star", fileHandler.Star)                              // 收藏
+	file.POST("/:id/Unstar", fileHandler.Unstar)                          // 取消收藏
+	file.POST("/search", fileHandler.SearchFile)                          // 用户旗下的文件搜索
+	file.POST("/:id/strip_gps", fileHandler.StripGPS)                     // 去除图片EXIF中的GPS信息
+	file.OPTIONS("/tus", tusHandler.Options)                              // tus协议: 查询服务端能力
+	file.POST("/tus", tusHandler.Create)                                  // tus协议: 创建上传
+	file.HEAD("/tus/:upload_id", tusHandler.Head)                         // tus协议: 查询上传偏移
+	file.PATCH("/tus/:upload_id", tusHandler.Patch)                       // tus协议: 上传数据
+	file.DELETE("/tus/:upload_id", tusHandler.Terminate)                  // tus协议: 终止上传
+	file.POST("/offline", offlineHandler.CreateTask)                      // 创建离线下载任务
+	file.GET("/offline", offlineHandler.GetTasks)                         // 获取离线下载任务列表
+	file.GET("/offline/:id", offlineHandler.GetTask)                      // 获取离线下载任务进度
+	file.POST("/offline/:id/cancel", offlineHandler.CancelTask)           // 取消离线下载任务
+	file.POST("/offline/:id/retry", offlineHandler.RetryTask)             // 重试离线下载任务
 	//file.GET("/:id/content", fileHandler.GetContent)             // 获取文件内容
 	//=======================================分享管理路由===============================================
 	zap.L().Info("启动路由服务",
@@ -177,13 +261,69 @@ func main() {
 	share := r.Group("/share")
 	share.Use(securityMiddleware.SecurityMiddleware())
 	share.Use(securityMiddleware.UserRateLimitMiddleware())
-	share.Use(jwtMiddleware.JWTAuthentication())
-	share.POST("/create", shareHandler.CreateShare)                           // 新建分享
-	share.GET("/mine", shareHandler.CheckMine)                                // 查看自己的分享列表
-	share.DELETE("/:unique_id", shareHandler.DeleteShare)                     // 删除分享
-	share.GET("/:unique_id", shareHandler.GetShareInfo)                       // 查看分享
-	share.GET("/:unique_id/:file_id/download", shareHandler.DownloadSpecFile) // 下载指定文件
-	share.POST("/:unique_id/:file_id/save", shareHandler.SaveSpecFile)        // 转存指定文件
+	share.POST("/create", jwtMiddleware.JWTAuthentication(), shareHandler.CreateShare)                                     // 新建分享
+	share.GET("/mine", jwtMiddleware.JWTAuthentication(), shareHandler.CheckMine)                                          // 查看自己的分享列表
+	share.GET("/expired", jwtMiddleware.JWTAuthentication(), shareHandler.GetExpiredShares)                                // 查看已过期的分享
+	share.DELETE("/:unique_id", jwtMiddleware.JWTAuthentication(), shareHandler.DeleteShare)                               // 删除分享
+	share.PUT("/:unique_id", jwtMiddleware.JWTAuthentication(), shareHandler.UpdateShare)                                  // 修改分享(有效期、密码、文件、下载上限)
+	share.POST("/:unique_id/disable", jwtMiddleware.JWTAuthentication(), shareHandler.DisableShare)                        // 停用分享
+	share.POST("/:unique_id/enable", jwtMiddleware.JWTAuthentication(), shareHandler.EnableShare)                          // 重新启用分享
+	share.GET("/:unique_id/stats", jwtMiddleware.JWTAuthentication(), shareHandler.GetShareStats)                          // 查看分享统计与访问记录
+	share.POST("/:unique_id/password/regenerate", jwtMiddleware.JWTAuthentication(), shareHandler.RegenerateSharePassword) // 重新生成分享密码
+	share.POST("/:unique_id/short_code", jwtMiddleware.JWTAuthentication(), shareHandler.SetShortCode)                     // 设置短链接
+	share.DELETE("/:unique_id/short_code", jwtMiddleware.JWTAuthentication(), shareHandler.RemoveShortCode)                // 删除短链接
+	share.GET("/:unique_id/qrcode", shareHandler.GetShareQRCode)                                                           // 分享二维码(PNG，可附带密码，无需登录)
+	share.POST("/:unique_id/access", shareHandler.VerifySharePassword)                                                     // 验证分享密码(签发分享访问令牌，无需登录)
+	share.GET("/:unique_id", jwtMiddleware.OptionalJWTAuthentication(), shareHandler.GetShareInfo)                         // 查看分享(无需登录)
+	share.GET("/:unique_id/tree", jwtMiddleware.OptionalJWTAuthentication(), shareHandler.GetShareTree)                    // 浏览分享的根目录(无需登录)
+	share.GET("/:unique_id/tree/:folder_id", jwtMiddleware.OptionalJWTAuthentication(), shareHandler.GetShareTree)         // 浏览分享中的文件夹(无需登录)
+	share.GET("/:unique_id/:file_id/download", jwtMiddleware.OptionalJWTAuthentication(), shareHandler.DownloadSpecFile)   // 下载指定文件(可为分享文件夹下的文件，无需登录)
+	share.GET("/:unique_id/:file_id/preview", jwtMiddleware.OptionalJWTAuthentication(), shareHandler.PreviewSpecFile)     // 预览指定文件(可为分享文件夹下的文件，无需登录，不计下载次数)
+	share.POST("/:unique_id/:file_id/save", jwtMiddleware.JWTAuthentication(), shareHandler.SaveSpecFile)                  // 转存指定文件到根目录
+	share.POST("/:unique_id/save", jwtMiddleware.JWTAuthentication(), shareHandler.SaveFiles)                              // 批量转存到指定文件夹
+	share.POST("/direct", jwtMiddleware.JWTAuthentication(), directShareHandler.ShareWithUsers)                            // 定向分享给指定用户
+	share.GET("/direct", jwtMiddleware.JWTAuthentication(), directShareHandler.GetGranted)                                 // 查看自己的定向分享
+	share.DELETE("/direct/:id", jwtMiddleware.JWTAuthentication(), directShareHandler.Revoke)                              // 撤销定向分享
+	share.GET("/received", jwtMiddleware.JWTAuthentication(), directShareHandler.SharedWithMe)                             // 分享给我的文件
+	shortLink := r.Group("/s")
+	shortLink.Use(securityMiddleware.SecurityMiddleware())
+	shortLink.Use(securityMiddleware.UserRateLimitMiddleware())
+	shortLink.GET("/:code", shareHandler.ResolveShortCode) // 分享短链接(跳转到分享链接，无需登录)
+	//=======================================文件收集路由===============================================
+	zap.L().Info("启动路由服务",
+		zap.String("service", "file-request-service"),
+		zap.String("host", cfg.Host),
+		zap.Int("port", cfg.Port))
+	request := r.Group("/request")
+	request.Use(securityMiddleware.SecurityMiddleware())
+	request.Use(securityMiddleware.UserRateLimitMiddleware())
+	request.POST("/create", jwtMiddleware.JWTAuthentication(), fileRequestHandler.CreateRequest)                 // 新建文件收集
+	request.GET("/mine", jwtMiddleware.JWTAuthentication(), fileRequestHandler.GetMyRequests)                    // 查看自己的文件收集列表
+	request.DELETE("/:unique_id", jwtMiddleware.JWTAuthentication(), fileRequestHandler.DeleteRequest)           // 删除文件收集(已提交的文件保留)
+	request.GET("/:unique_id/submissions", jwtMiddleware.JWTAuthentication(), fileRequestHandler.GetSubmissions) // 查看提交记录
+	request.GET("/:unique_id", fileRequestHandler.GetRequestInfo)                                                // 查看文件收集(无需登录)
+	request.POST("/:unique_id/access", fileRequestHandler.VerifyPassword)                                        // 验证文件收集密码(签发访问令牌，无需登录)
+	request.POST("/:unique_id/upload", fileRequestHandler.Upload)                                                // 提交文件(无需登录)
+	request.POST("/:unique_id/chunk_upload/init", fileRequestHandler.InitChunkUpload)                            // 初始化分片上传(无需登录)
+	request.POST("/:unique_id/chunk_upload", fileRequestHandler.ChunkUpload)                                     // 上传分片(无需登录)
+	//=======================================相册管理路由===============================================
+	zap.L().Info("启动路由服务",
+		zap.String("service", "photo-service"),
+		zap.String("host", cfg.Host),
+		zap.Int("port", cfg.Port))
+	photo := r.Group("/photo")
+	photo.Use(securityMiddleware.SecurityMiddleware())
+	photo.Use(securityMiddleware.UserRateLimitMiddleware())
+	photo.Use(jwtMiddleware.JWTAuthentication())
+	photo.GET("/timeline", photoHandler.Timeline)                   // 照片时间线（按月/年分组）
+	photo.POST("/album", photoHandler.CreateAlbum)                  // 创建相册
+	photo.GET("/album/list", photoHandler.GetAlbumList)             // 获取相册列表
+	photo.GET("/album/:id", photoHandler.GetAlbum)                  // 查看相册
+	photo.PUT("/album/:id", photoHandler.UpdateAlbum)               // 修改相册
+	photo.DELETE("/album/:id", photoHandler.DeleteAlbum)            // 删除相册（不删除文件）
+	photo.POST("/album/:id/files", photoHandler.AddAlbumFiles)      // 向相册添加照片
+	photo.DELETE("/album/:id/files", photoHandler.RemoveAlbumFiles) // 从相册移除照片
+	photo.POST("/album/:id/share", photoHandler.ShareAlbum)         // 分享相册
 	//=======================================后台管理路由===============================================
 	zap.L().Info("启动路由服务",
 		zap.String("service", "admin-service"),
@@ -192,16 +332,25 @@ func main() {
 	admin := r.Group("/admin")
 	admin.Use(securityMiddleware.SecurityMiddleware())
 	admin.Use(securityMiddleware.UserRateLimitMiddleware())
-	admin.Use(jwtMiddleware.JWTAuthentication())                // 登录
-	admin.Use(jwtMiddleware.JWTAuthorization())                 // admin鉴权
-	admin.GET("/info", adminHandler.GetInfo)                    // 获取资源信息
-	admin.POST("/ban_user", adminHandler.BanUser)               // 封禁用户
-	admin.POST("/ban_user/recover", adminHandler.RecoverUser)   // 解封用户
-	admin.GET("/ban_user/list", adminHandler.GetBannedUserList) // 获取封禁用户列表
-	admin.GET("/user_list", adminHandler.GetUsersList)          // 获取所有用户列表
-	admin.POST("/op/give", adminHandler.GiveAdmin)              // 设置用户管理员身份
-	admin.POST("/op/deprive", adminHandler.DepriveAdmin)        // 剥夺用户管理员身份
-	admin.GET("/op", adminHandler.GetAdminList)                 // 获取管理员用户列表
+	admin.Use(jwtMiddleware.JWTAuthentication())                          // 登录
+	admin.Use(jwtMiddleware.JWTAuthorization())                           // admin鉴权
+	admin.Use(twoFactorMiddleware.RequireAdminTwoFactor())                // 安全策略要求时检查两步验证
+	admin.GET("/info", adminHandler.GetInfo)                              // 获取资源信息
+	admin.POST("/ban_user", adminHandler.BanUser)                         // 封禁用户
+	admin.POST("/ban_user/recover", adminHandler.RecoverUser)             // 解封用户
+	admin.GET("/ban_user/list", adminHandler.GetBannedUserList)           // 获取封禁用户列表
+	admin.GET("/user_list", adminHandler.GetUsersList)                    // 获取所有用户列表
+	admin.POST("/op/give", adminHandler.GiveAdmin)                        // 设置用户管理员身份
+	admin.POST("/op/deprive", adminHandler.DepriveAdmin)                  // 剥夺用户管理员身份
+	admin.GET("/op", adminHandler.GetAdminList)                           // 获取管理员用户列表
+	admin.GET("/quarantine", adminHandler.GetQuarantineList)              // 获取隔离文件列表
+	admin.POST("/quarantine/:id/release", adminHandler.ReleaseQuarantine) // 解除文件隔离
+	admin.GET("/upload_policy", adminHandler.GetUploadPolicy)             // 获取上传策略
+	admin.PUT("/upload_policy", adminHandler.UpdateUploadPolicy)          // 修改上传策略
+	admin.DELETE("/upload_policy", adminHandler.ResetUploadPolicy)        // 重置上传策略为默认值
+	admin.GET("/audit", adminHandler.GetAuditLogs)                        // 查看审计记录
+	admin.GET("/security_policy", adminHandler.GetSecurityPolicy)         // 获取账号安全策略
+	admin.PUT("/security_policy", adminHandler.UpdateSecurityPolicy)      // 修改账号安全策略(如要求管理员开启两步验证)
 
 	err = r.Run(cfg.Host + ":" + strconv.Itoa(cfg.Port))
 	if err != nil {
@@ -246,18 +395,6 @@ SMTPHost":"",
 }
 
 
-results, err := client.Scan("/path/to/file")
-if err != nil {
-    // Handle error
-}
-
-for _, result := range results {
-    fmt.Printf("Path: %s, Status: %s\n", result.Path, result.Status)
-    if result.Virus != "" {
-        fmt.Printf("Virus detected: %s\n", result.Virus)
-    }
-}
-
 func loadServe() {
 	//=====================================配置管理======================================================
 	//cfg := config.LoadConfig()
@@ -297,17 +434,20 @@ func loadServe() {
 	// JWT工具
 	jwtUtil := jwt_util.NewJWTUtil(cfg)
 	// 业务逻辑层依赖
-	userService := services.NewUserService(userRepo, tokenRepo, jwtUtil, cfg.AvatarDIR, minIOClient)
+	sessionService := services.NewSessionService(sessionRepo, sessionCache, userRepo, auditRepo, jwtUtil, cfg.JWTExpireHours, cfg.Security)
+	userService := services.NewUserService(userRepo, tokenRepo, sessionService, jwtUtil, cfg.AvatarDIR, minIOClient)
 	fileService := services.NewUFileService(fileRepo, userRepo, minIOClient, cfg.CloudFileDir, cfg.MaxFileSize, cfg.NormalUserMaxStorage, cfg.LimitedSpeed)
 	shareService := services.NewShareService(shareRepo, fileRepo, userRepo, cfg.CloudFileDir)
 	verificationService := services.NewVerificationService(verificationRepo, cfg.Email)
+	passwordResetService := services.NewPasswordResetService(userRepo, passwordResetCache, verificationService, sessionService)
 	// 处理器层依赖
 	userHandler := handlers.NewUserHandler(userService, cfg.DefaultAvatarPath, minIOClient)
 	fileHandler := handlers.NewFileHandler(fileService, minIOClient)
 	shareHandler := handlers.NewShareHandler(shareService)
 	verificationHandler := handlers.NewVerificationHandler(verificationService)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
 	//创建中间件
-	jwtMiddleware := middleware.NewJWTMiddleware(jwtUtil, tokenRepo)
+	jwtMiddleware := middleware.NewJWTMiddleware(jwtUtil, tokenRepo, userRepo, sessionCache)
 
 	r := gin.Default()
 
@@ -348,6 +488,7 @@ func loadServe() {
 	file.POST("/:id/star", fileHandler.Star)                     // 收藏
 	file.POST("/:id/Unstar", fileHandler.Unstar)                 // 取消收藏
 	file.POST("/search", fileHandler.SearchFile)                 // 用户旗下的文件搜索
+	file.POST("/:id/strip_gps", fileHandler.StripGPS)            // 去除图片EXIF中的GPS信息
 	//=======================================分享管理路由=============================================
 	//下载或转存全部文件 = 逐个下载share下的全部文件
 	share := r.Group("/share")
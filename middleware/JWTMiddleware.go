@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"ClaranCloudDisk/dao/cache"
 	"ClaranCloudDisk/dao/mysql"
 	"ClaranCloudDisk/util"
 	"ClaranCloudDisk/util/jwt_util"
@@ -13,14 +14,18 @@ import (
 )
 
 type JWTMiddleware struct {
-	jwtUtil   jwt_util.Util
-	TokenRepo mysql.TokenRepository
+	jwtUtil      jwt_util.Util
+	TokenRepo    mysql.TokenRepository
+	UserRepo     mysql.UserRepository
+	sessionCache cache.SessionCache
 }
 
-func NewJWTMiddleware(jwtUtil jwt_util.Util, tokenRepo mysql.TokenRepository) *JWTMiddleware {
+func NewJWTMiddleware(jwtUtil jwt_util.Util, tokenRepo mysql.TokenRepository, userRepo mysql.UserRepository, sessionCache cache.SessionCache) *JWTMiddleware {
 	return &JWTMiddleware{
-		jwtUtil:   jwtUtil,
-		TokenRepo: tokenRepo,
+		jwtUtil:      jwtUtil,
+		TokenRepo:    tokenRepo,
+		UserRepo:     userRepo,
+		sessionCache: sessionCache,
 	}
 }
 
@@ -48,8 +53,8 @@ func (m *JWTMiddleware) JWTAuthentication() gin.HandlerFunc {
 		//检查token是否在黑名单里
 		status, err := m.TokenRepo.CheckBlackList(tokenString)
 		if err != nil {
-			zap.S().Infof("Token check black list error: %v", err)
-			util.Error(c, 401, err.Error())
+			zap.S().Errorf("Token check black list error: %v", err)
+			util.Error(c, 401, "登录状态校验失败，请重新登录")
 			c.Abort()
 			return
 		}
@@ -81,26 +86,77 @@ func (m *JWTMiddleware) JWTAuthentication() gin.HandlerFunc {
 			return
 		}
 		//fmt.Println("========================================")
+		var userID int
 		if userIDFloat, ok := claims["user_id"].(float64); ok {
 			// 安全转换：float64 转 int
-			userID := int(userIDFloat)
-			c.Set("user_id", userID)
+			userID = int(userIDFloat)
 		} else if userIDInt, ok := claims["user_id"].(int); ok {
 			// 如果已经是 int
-			c.Set("user_id", userIDInt)
+			userID = userIDInt
 		} else {
 			zap.S().Infof("无效的 user_id 类型")
 			util.Error(c, 401, "无效的 user_id 类型")
 			c.Abort()
 			return
 		}
+
+		//检查令牌版本，封禁、修改角色或密码后之前签发的令牌全部失效
+		tokenVersion, _ := claims["ver"].(float64)
+		currentVersion, err := m.UserRepo.GetTokenVersion(userID)
+		if err != nil {
+			zap.S().Errorf("Token version check error: %v", err)
+			util.Error(c, 401, "登录状态校验失败，请重新登录")
+			c.Abort()
+			return
+		}
+		if int(tokenVersion) != currentVersion {
+			zap.S().Infof("token version is outdated: user %d, token %v, current %d", userID, tokenVersion, currentVersion)
+			util.Error(c, 401, "登录状态已失效，请重新登录")
+			c.Abort()
+			return
+		}
+
+		//检查令牌所属的会话是否已被撤销
+		sessionID, _ := claims["sid"].(string)
+		if sessionID != "" {
+			revoked, err := m.sessionCache.IsRevoked(c.Request.Context(), sessionID)
+			if err != nil {
+				zap.S().Errorf("Session check error: %v", err)
+				util.Error(c, 401, "登录状态校验失败，请重新登录")
+				c.Abort()
+				return
+			}
+			if revoked {
+				zap.S().Infof("session is revoked: %v", sessionID)
+				util.Error(c, 401, "会话已失效，请重新登录")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("user_id", userID)
 		c.Set("username", claims["username"])
 		c.Set("role", claims["role"])
+		c.Set("session_id", sessionID)
 		c.Next()
 	}
 }
 
+// OptionalJWTAuthentication 可选的jwt认证，用于允许匿名访问的接口
+// 未携带Authorization时以匿名身份继续(user_id为0)，携带时与JWTAuthentication一样校验
+func (m *JWTMiddleware) OptionalJWTAuthentication() gin.HandlerFunc {
+	authenticate := m.JWTAuthentication()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
 // JWTAuthorization 鉴权
+// 角色变化会使之前签发的令牌失效(JWTAuthentication校验令牌版本)，通过认证的令牌中role声明即为当前角色
 func (m *JWTMiddleware) JWTAuthorization() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, _ := c.Get("role")
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	services "ClaranCloudDisk/service"
+	"ClaranCloudDisk/util"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type TwoFactorMiddleware struct {
+	twoFactorService *services.TwoFactorService
+}
+
+func NewTwoFactorMiddleware(twoFactorService *services.TwoFactorService) *TwoFactorMiddleware {
+	return &TwoFactorMiddleware{
+		twoFactorService: twoFactorService,
+	}
+}
+
+// RequireAdminTwoFactor 安全策略要求时，未开启两步验证的管理员不能访问后台接口，需放在JWTAuthorization之后
+func (m *TwoFactorMiddleware) RequireAdminTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := m.twoFactorService.CheckAdmin(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			if errors.Is(err, services.ErrAdminTwoFactorRequired) {
+				zap.S().Infof("管理员未开启两步验证: %v", c.GetInt("user_id"))
+				util.Error(c, 403, err.Error())
+				c.Abort()
+				return
+			}
+			zap.S().Errorf("检查两步验证失败: %v", err)
+			util.Error(c, 500, "检查两步验证失败")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+)
+
+// Album 相册模型
+// @Description 用户创建的相册，只引用已有文件，不复制文件内容
+type Album struct {
+	ID          uint      `gorm:"primaryKey" json:"id" example:"1"`
+	UserID      uint      `gorm:"index;not null" json:"user_id" example:"1"`
+	Name        string    `gorm:"size:100;not null" json:"name" example:"2025 旅行"`
+	Description string    `gorm:"size:500" json:"description" example:"五一假期"`
+	CoverFileID *uint     `json:"cover_file_id" example:"1"` // 封面文件ID，为空时使用第一张照片
+	CreatedAt   time.Time `json:"created_at" example:"2026-02-18T10:00:00Z"`
+	UpdatedAt   time.Time `json:"updated_at" example:"2026-02-18T10:00:00Z"`
+
+	// 关联
+	AlbumFiles []AlbumFile `gorm:"foreignKey:AlbumID" json:"-"`
+}
+
+// AlbumFile 相册文件关联
+// @Description 相册与文件的关联关系
+type AlbumFile struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	AlbumID   uint      `gorm:"uniqueIndex:idx_album_file;not null" json:"album_id" example:"1"`
+	FileID    uint      `gorm:"uniqueIndex:idx_album_file;index;not null" json:"file_id" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2026-02-18T10:00:00Z"`
+
+	// 关联
+	File File `gorm:"foreignKey:FileID" json:"file,omitempty"`
+}
+
+// AlbumResponse 相册详情响应
+// @Description 相册信息及其中的文件
+type AlbumResponse struct {
+	Album     *Album  `json:"album"`
+	Cover     *File   `json:"cover,omitempty"`
+	Files     []*File `json:"files,omitempty"`
+	FileCount int     `json:"file_count" example:"12"`
+}
+
+// TimelineBucket 时间线分组
+// @Description 按拍摄月份或年份分组的照片
+type TimelineBucket struct {
+	Key   string  `json:"key" example:"2025-05"` // 分组键：YYYY 或 YYYY-MM
+	Year  int     `json:"year" example:"2025"`
+	Month int     `json:"month,omitempty" example:"5"`
+	Count int     `json:"count" example:"42"`
+	Files []*File `json:"files"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+// 审计事件类型
+const (
+	AuditShareBruteForce   = "share_brute_force"   // 分享密码被暴力尝试
+	AuditShareEnumeration  = "share_enumeration"   // 分享ID被枚举
+	AuditTwoFactorFailure  = "two_factor_failure"  // 两步验证码连续输错
+	AuditRefreshTokenReuse = "refresh_token_reuse" // 已轮换的刷新令牌被再次使用
+)
+
+// AuditLog 审计记录
+// @Description 安全相关事件，供管理员查看
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	Type      string    `gorm:"size:50;index" json:"type" example:"share_brute_force"` // 事件类型
+	UserID    uint      `gorm:"index" json:"user_id" example:"0"`                      // 相关用户，未登录为0
+	IP        string    `gorm:"size:64;index" json:"ip" example:"203.0.113.10"`        // 来源IP
+	Target    string    `gorm:"size:100" json:"target" example:"abc123xyz"`            // 事件对象，如分享ID
+	Detail    string    `gorm:"size:500" json:"detail" example:"连续输错分享密码5次，锁定60秒"`     // 详细说明
+	CreatedAt time.Time `gorm:"index" json:"created_at" example:"2026-02-18T10:00:00Z"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+)
+
+// 定向分享的权限
+const (
+	PermissionRead  = "read"  // 只读：查看、预览、下载，浏览文件夹
+	PermissionWrite = "write" // 读写：另外可以重命名、移动、删除到回收站、在文件夹中新建文件夹
+)
+
+// DirectShare 定向分享
+// @Description 将文件或文件夹直接分享给平台内的指定用户，分享文件夹时对其中的所有文件生效
+type DirectShare struct {
+	ID          uint      `gorm:"primaryKey" json:"id" example:"1"`
+	FileID      uint      `gorm:"uniqueIndex:idx_direct_share;not null" json:"file_id" example:"1"`
+	OwnerID     uint      `gorm:"index;not null" json:"owner_id" example:"1"`                                  // 分享者
+	RecipientID uint      `gorm:"uniqueIndex:idx_direct_share;index;not null" json:"recipient_id" example:"2"` // 接收者
+	Permission  string    `gorm:"size:10;not null" json:"permission" example:"read"`                           // read/write
+	CreatedAt   time.Time `json:"created_at" example:"2026-02-18T10:00:00Z"`
+	UpdatedAt   time.Time `json:"updated_at" example:"2026-02-18T10:00:00Z"`
+
+	// 关联
+	File      File `gorm:"foreignKey:FileID" json:"file,omitempty"`
+	Owner     User `gorm:"foreignKey:OwnerID;references:UserID" json:"owner,omitempty"`
+	Recipient User `gorm:"foreignKey:RecipientID;references:UserID" json:"recipient,omitempty"`
+}
+
+// DirectShareRequest 定向分享请求
+// @Description 按用户名或邮箱指定接收者，已分享过的接收者会更新为新的权限
+type DirectShareRequest struct {
+	FileID     uint     `json:"file_id" binding:"required" example:"1"`
+	Recipients []string `json:"recipients" binding:"required,min=1,max=50" example:"alice,bob@example.com"` // 用户名或邮箱
+	Permission string   `json:"permission" binding:"required,oneof=read write" example:"read"`
+}
@@ -16,7 +16,7 @@ type File struct {
 	Path      string `gorm:"size:500;not null" json:"path" example:"/CloudFiles/user_1/1_abc123.pdf"` // 存储路径
 	Size      int64  `json:"size" example:"1024000"`                                                  // 文件大小（字节）
 	Hash      string `gorm:"size:64;index" json:"hash" example:"a1b2c3d4e5f6"`                        // 文件哈希（用于秒传）
-	MimeType  string `gorm:"size:100" json:"mime_type" example:"application/pdf"`                     // 文件类型
+	MimeType  string `gorm:"size:100" json:"mime_type" example:"application/pdf"`                     // 客户端声明的文件类型
 	Ext       string `gorm:"size:10" json:"ext" example:"pdf"`                                        // 文件拓展名
 	IsStarred bool   `gorm:"default:false" json:"is_starred" example:"false"`                         // 是否被收藏
 	IsDeleted bool   `gorm:"default:false" json:"is_deleted" example:"false"`                         // 是否被软删除
@@ -26,6 +26,59 @@ type File struct {
 	ParentID *uint `gorm:"index" json:"parent_id" example:"null"`             // 父文件夹ID
 	IsShared bool  `gorm:"default:false" json:"is_shared" example:"false"`    // 是否已分享
 
+	// 内容识别（上传时根据文件头识别，不信任扩展名与客户端声明的类型）
+	DetectedMime string `gorm:"size:100" json:"detected_mime" example:"application/pdf"` // 识别出的文件类型
+	MimeMismatch bool   `gorm:"default:false" json:"mime_mismatch" example:"false"`      // 内容与扩展名不一致（flag策略下标记）
+
+	// 媒体元数据（上传时从文件头解析）
+	Meta FileMeta `gorm:"embedded;embeddedPrefix:meta_" json:"meta"`
+
+	// 内容扫描（上传完成后由扫描器检查）
+	ScanStatus  string `gorm:"size:20;index" json:"scan_status" example:"clean"`       // 扫描状态 clean/infected/error/skipped/released
+	ScanResult  string `gorm:"size:255" json:"scan_result,omitempty" example:""`       // 命中的病毒/策略名称
+	Quarantined bool   `gorm:"default:false;index" json:"quarantined" example:"false"` // 是否被隔离（隔离的文件不可下载、预览与分享）
+
 	// 时间戳
 	CreatedAt time.Time `json:"created_at" example:"2026-02-18T10:00:00Z"`
 }
+
+// FileMeta 媒体元数据
+// @Description 图片尺寸、EXIF拍摄信息，音视频时长、码率与编码
+type FileMeta struct {
+	Width       int        `json:"width,omitempty" example:"4032"`                                 // 宽度（像素）
+	Height      int        `json:"height,omitempty" example:"3024"`                                // 高度（像素）
+	TakenAt     *time.Time `gorm:"index" json:"taken_at,omitempty" example:"2025-05-01T08:00:00Z"` // 拍摄时间
+	CameraMake  string     `gorm:"size:100" json:"camera_make,omitempty" example:"Apple"`          // 相机厂商
+	CameraModel string     `gorm:"size:100" json:"camera_model,omitempty" example:"iPhone 15"`     // 相机型号
+	Latitude    *float64   `json:"latitude,omitempty" example:"31.2304"`                           // GPS纬度
+	Longitude   *float64   `json:"longitude,omitempty" example:"121.4737"`                         // GPS经度
+	Duration    float64    `json:"duration,omitempty" example:"63.5"`                              // 时长（秒）
+	Bitrate     int64      `json:"bitrate,omitempty" example:"320000"`                             // 码率（bit/s）
+	Codec       string     `gorm:"size:50" json:"codec,omitempty" example:"h264"`                  // 编码格式
+}
+
+// HasGPS 是否包含GPS信息
+func (m FileMeta) HasGPS() bool {
+	return m.Latitude != nil && m.Longitude != nil
+}
+
+// FileSearchFilter 文件搜索条件
+type FileSearchFilter struct {
+	Keywords  string     `json:"keywords"`
+	Exts      []string   `json:"exts"`       // 限定扩展名（按媒体类型筛选）
+	TakenFrom *time.Time `json:"taken_from"` // 拍摄时间起（含）
+	TakenTo   *time.Time `json:"taken_to"`   // 拍摄时间止（不含）
+}
+
+// ChunkUploadSession 分片上传会话，保存在redis中
+// 由服务端签发upload_id，临时分片按用户隔离，同一文件被多人同时上传也互不影响
+type ChunkUploadSession struct {
+	UploadID   string    `json:"upload_id"`
+	UserID     int       `json:"user_id"`
+	FileName   string    `json:"file_name"`
+	FileHash   string    `json:"file_hash"` // 客户端声明的SHA-256，合并后校验
+	FileSize   int64     `json:"file_size"`
+	MimeType   string    `json:"mime_type"`
+	ChunkTotal int       `json:"chunk_total"`
+	CreatedAt  time.Time `json:"created_at"`
+}
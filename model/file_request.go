@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+)
+
+// FileRequest 文件收集链接
+// @Description 只能上传的链接，绑定到所有者的一个文件夹，上传者看不到其他人提交的文件
+type FileRequest struct {
+	ID          uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UniqueID    string     `gorm:"size:32;uniqueIndex;not null" json:"unique_id" example:"abc123xyz"`
+	UserID      uint       `gorm:"index;not null" json:"user_id" example:"1"`             // 所有者，上传的文件计入其存储空间
+	FolderID    uint       `gorm:"index;not null" json:"folder_id" example:"3"`           // 上传的文件保存到的文件夹
+	Title       string     `gorm:"size:100;not null" json:"title" example:"期末作业提交"`       // 标题
+	Description string     `gorm:"size:500" json:"description" example:"请以 学号-姓名 命名"`     // 说明
+	Password    string     `gorm:"size:100" json:"-"`                                     // 密码哈希，为空时无需密码
+	ExpireAt    *time.Time `gorm:"index" json:"expire_at" example:"2026-02-25T10:00:00Z"` // 过期时间，为空时不过期
+	CreatedAt   time.Time  `json:"created_at" example:"2026-02-18T10:00:00Z"`
+
+	// 限制
+	MaxFileSize  int64    `gorm:"default:0" json:"max_file_size" example:"100"`                   // 单个文件大小上限 (MB)，0为不限制
+	AllowExts    []string `gorm:"type:text;serializer:json" json:"allow_exts" example:"pdf,docx"` // 允许的扩展名（不含"."），为空时不限制
+	MaxTotalSize int64    `gorm:"default:0" json:"max_total_size" example:"1024"`                 // 累计上传总量上限 (MB)，0为不限制
+	UsedSize     int64    `gorm:"default:0" json:"used_size" example:"1048576"`                   // 已上传总量（字节）
+	FileCount    int64    `gorm:"default:0" json:"file_count" example:"12"`                       // 已提交的文件数
+}
+
+// FileSubmission 文件收集的一次提交
+// @Description 上传者提交的文件及其填写的姓名与留言，分片上传未完成时FileID为空
+type FileSubmission struct {
+	ID           uint      `gorm:"primaryKey" json:"id" example:"1"`
+	RequestID    uint      `gorm:"index;not null" json:"request_id" example:"1"`
+	FileID       *uint     `gorm:"index" json:"file_id" example:"42"`
+	UploadID     string    `gorm:"size:64;index" json:"-"`                             // 分片上传的会话ID
+	UploaderName string    `gorm:"size:50;not null" json:"uploader_name" example:"张三"` // 上传者填写的姓名
+	Note         string    `gorm:"size:500" json:"note" example:"第二版，修改了第三章"`          // 上传者的留言
+	IP           string    `gorm:"size:64" json:"ip" example:"203.0.113.10"`
+	Size         int64     `json:"size" example:"1048576"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at" example:"2026-02-18T10:00:00Z"`
+
+	// 关联
+	File *File `gorm:"foreignKey:FileID" json:"file,omitempty"`
+}
+
+// CreateFileRequestRequest 创建文件收集链接请求
+// @Description 目标文件夹必须属于当前用户
+type CreateFileRequestRequest struct {
+	FolderID     uint     `json:"folder_id" binding:"required" example:"3"`
+	Title        string   `json:"title" binding:"required,max=100" example:"期末作业提交"`
+	Description  string   `json:"description" binding:"max=500" example:"请以 学号-姓名 命名"`
+	Password     string   `json:"password" example:"123456"`
+	ExpireDays   int      `json:"expire_days" binding:"min=0" example:"7"` // 0为不过期
+	MaxFileSize  int64    `json:"max_file_size" binding:"min=0" example:"100"`
+	AllowExts    []string `json:"allow_exts" example:"pdf,docx"`
+	MaxTotalSize int64    `json:"max_total_size" binding:"min=0" example:"1024"`
+}
+
+// FileRequestInfoResponse 上传者看到的文件收集信息
+// @Description 不包含目标文件夹与已提交的文件
+type FileRequestInfoResponse struct {
+	UniqueID      string     `json:"unique_id" example:"abc123xyz"`
+	Title         string     `json:"title" example:"期末作业提交"`
+	Description   string     `json:"description" example:"请以 学号-姓名 命名"`
+	Owner         User       `json:"owner"`
+	NeedPassword  bool       `json:"need_password" example:"true"`
+	ExpireAt      *time.Time `json:"expire_at" example:"2026-02-25T10:00:00Z"`
+	MaxFileSize   int64      `json:"max_file_size" example:"100"`
+	AllowExts     []string   `json:"allow_exts" example:"pdf,docx"`
+	RemainingSize int64      `json:"remaining_size" example:"1072693248"` // 剩余可上传字节数，不限制时为-1
+}
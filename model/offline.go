@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// 离线下载任务状态
+const (
+	OfflineStatusPending  = "pending"  // 排队中
+	OfflineStatusRunning  = "running"  // 下载中
+	OfflineStatusSuccess  = "success"  // 已完成
+	OfflineStatusFailed   = "failed"   // 失败
+	OfflineStatusCanceled = "canceled" // 已取消
+)
+
+// OfflineTask 离线下载任务
+// @Description 服务端在后台下载用户提交的链接并存入其云盘
+type OfflineTask struct {
+	ID         uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID     uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	URL        string     `gorm:"size:2048;not null" json:"url" example:"https://example.com/video.mp4"`
+	FileName   string     `gorm:"size:255" json:"file_name" example:"video.mp4"`        // 用户指定或根据响应推断的文件名
+	Status     string     `gorm:"size:20;index" json:"status" example:"running"`        // pending/running/success/failed/canceled
+	Size       int64      `json:"size" example:"10485760"`                              // 总大小（字节），-1为未知
+	Downloaded int64      `json:"downloaded" example:"5242880"`                         // 已下载（字节）
+	FileID     *uint      `json:"file_id" example:"12"`                                 // 下载完成后的文件ID
+	Error      string     `gorm:"size:500" json:"error,omitempty" example:""`           // 失败原因
+	CreatedAt  time.Time  `json:"created_at" example:"2026-02-18T10:00:00Z"`            // 提交时间
+	UpdatedAt  time.Time  `json:"updated_at" example:"2026-02-18T10:00:00Z"`            // 更新时间
+	FinishedAt *time.Time `json:"finished_at,omitempty" example:"2026-02-18T10:05:00Z"` // 结束时间
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// UploadPolicy 上传策略
+// @Description config.yaml中的配置为默认值，管理员修改后保存在数据库中并覆盖默认值
+type UploadPolicy struct {
+	ID uint `gorm:"primaryKey" json:"-"`
+
+	// 类型限制：白名单非空时只允许名单内的类型，黑名单优先于白名单
+	AllowExts  []string `gorm:"type:text;serializer:json" json:"allow_exts" example:"jpg,png,pdf"` // 允许的扩展名（不含"."）
+	DenyExts   []string `gorm:"type:text;serializer:json" json:"deny_exts" example:"exe,bat"`      // 禁止的扩展名
+	AllowMimes []string `gorm:"type:text;serializer:json" json:"allow_mimes" example:"image/*"`    // 允许的识别类型，支持"image/*"
+	DenyMimes  []string `gorm:"type:text;serializer:json" json:"deny_mimes" example:"text/html"`   // 禁止的识别类型，支持"image/*"
+
+	// 按角色限制单个文件大小 (MB)，0为不限制（仍受MAX_FILE_SIZE约束）
+	UserMaxFileSize  int64 `json:"user_max_file_size" example:"1024"`
+	VIPMaxFileSize   int64 `json:"vip_max_file_size" example:"10240"`
+	AdminMaxFileSize int64 `json:"admin_max_file_size" example:"0"`
+
+	MaxFileCount     int64 `json:"max_file_count" example:"10000"`    // 每个用户最多文件数，0为不限制
+	DailyUploadLimit int64 `json:"daily_upload_limit" example:"5120"` // 每个用户每天上传总量 (MB)，0为不限制
+
+	UpdatedAt time.Time `json:"updated_at" example:"2026-02-18T10:00:00Z"`
+}
@@ -7,6 +7,7 @@ type RegisterRequest struct {
 	Password   string `json:"password" binding:"required" example:"password123"`
 	Email      string `json:"email" binding:"required" example:"john@example.com"`
 	InviteCode string `json:"invite_code" binding:"required" example:"INVITE123"`
+	EmailToken string `json:"email_token" example:"9b74c9897bac770ffc029102a200c5de..."` // 验证邮箱后获得的凭证，开启邮箱验证时必填
 }
 
 // LoginRequest "/user/login"
@@ -19,7 +20,7 @@ type LoginRequest struct {
 // RefreshTokenRequest "/user/refresh"
 // @Description 刷新访问令牌所需的请求参数
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token" binding:"required" example:"3f1c9a0e5b7d4c2a8e6f0b1d3c5a7e9f3f1c9a0e5b7d4c2a8e6f0b1d3c5a7e9f"`
 }
 
 // LogoutRequest "/user/logout"
@@ -28,6 +29,26 @@ type LogoutRequest struct {
 	Token string `json:"token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
 }
 
+// LoginTwoFactorRequest "/user/login/2fa"
+// @Description 两步验证登录所需的请求参数，code可以是验证器中的6位动态码或一次性恢复码
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code           string `json:"code" binding:"required" example:"123456"`
+}
+
+// TwoFactorCodeRequest "/user/2fa/enable"、"/user/2fa/recovery_codes"
+// @Description 开启两步验证、重新生成恢复码所需的请求参数
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// DisableTwoFactorRequest "/user/2fa/disable"
+// @Description 关闭两步验证所需的请求参数，code可以是动态码或恢复码
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required" example:"password123"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
 // UpdateRequest "/user/update"
 // @Description 更新用户信息所需的请求参数
 type UpdateRequest struct {
@@ -50,6 +71,55 @@ type CreateShareRequest struct {
 	FileIDs    []uint `json:"file_ids" binding:"required,min=1" example:"[1,2,3]"`
 	Password   string `json:"password" example:"share123"`
 	ExpireDays int    `json:"expire_days" example:"7"`
+
+	MaxDownloads int64 `json:"max_downloads" binding:"min=0" example:"100"` // 最大下载次数（含转存），0为不限制
+	Watermark    bool  `json:"watermark" example:"false"`                   // 下载与预览图片、PDF时加水印
+}
+
+// UpdateShareRequest "/share/:unique_id"
+// @Description 修改分享所需的请求参数，未传的字段保持不变
+type UpdateShareRequest struct {
+	ExpireDays   *int    `json:"expire_days" binding:"omitempty,min=0" example:"7"`     // 从现在起的有效天数，0为不过期
+	Password     *string `json:"password" example:"share123"`                           // 空字符串为取消密码
+	FileIDs      *[]uint `json:"file_ids" binding:"omitempty,min=1" example:"1,2,3"`    // 替换分享的文件
+	MaxDownloads *int64  `json:"max_downloads" binding:"omitempty,min=0" example:"100"` // 0为不限制
+	Watermark    *bool   `json:"watermark" example:"true"`                              // 下载与预览图片、PDF时加水印
+}
+
+// SetShortCodeRequest "/share/:unique_id/short_code"
+// @Description 设置分享短链接所需的请求参数
+type SetShortCodeRequest struct {
+	Code string `json:"code" binding:"omitempty,min=4,max=32" example:"spring"` // 自定义短码，只能包含字母、数字、-和_，为空时随机生成
+}
+
+// CreateAlbumRequest "/photo/album"
+// @Description 创建相册所需的请求参数
+type CreateAlbumRequest struct {
+	Name        string `json:"name" binding:"required,max=100" example:"2025 旅行"`
+	Description string `json:"description" binding:"max=500" example:"五一假期"`
+	FileIDs     []uint `json:"file_ids" example:"[1,2,3]"` // 创建时一并加入的照片
+}
+
+// UpdateAlbumRequest "/photo/album/:id"
+// @Description 修改相册信息所需的请求参数，未传的字段保持不变
+type UpdateAlbumRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100" example:"2025 旅行"`
+	Description *string `json:"description" binding:"omitempty,max=500" example:"五一假期"`
+	CoverFileID *uint   `json:"cover_file_id" example:"1"` // 传0清除封面
+}
+
+// AlbumFilesRequest "/photo/album/:id/files"
+// @Description 向相册添加或移除文件所需的请求参数
+type AlbumFilesRequest struct {
+	FileIDs []uint `json:"file_ids" binding:"required,min=1" example:"[1,2,3]"`
+}
+
+// ShareAlbumRequest "/photo/album/:id/share"
+// @Description 分享相册所需的请求参数
+type ShareAlbumRequest struct {
+	Password   string `json:"password" example:"share123"`
+	ExpireDays int    `json:"expire_days" example:"7"`
+	Watermark  bool   `json:"watermark" example:"false"` // 下载与预览照片时加水印
 }
 
 // GetVerificationCodeRequest "/user/get_verification_code"
@@ -65,10 +135,47 @@ type VerifyVerificationCodeRequest struct {
 	Code  string `json:"code" binding:"required" example:"123456"`
 }
 
+// ChangeEmailRequest "/user/email/change"
+// @Description 申请修改邮箱所需的请求参数，验证码发送到新邮箱
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required" example:"new@example.com"`
+	Password string `json:"password" binding:"required" example:"password123"`
+}
+
+// ConfirmEmailChangeRequest "/user/email/confirm"
+// @Description 确认修改邮箱所需的请求参数
+type ConfirmEmailChangeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// ForgotPasswordRequest "/user/password/forgot"
+// @Description 找回密码时获取验证码所需的请求参数
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required" example:"john@example.com"`
+}
+
+// VerifyResetCodeRequest "/user/password/verify"
+// @Description 校验找回密码验证码所需的请求参数
+type VerifyResetCodeRequest struct {
+	Email string `json:"email" binding:"required" example:"john@example.com"`
+	Code  string `json:"code" binding:"required" example:"123456"`
+}
+
+// ResetPasswordRequest "/user/password/reset"
+// @Description 使用重置令牌设置新密码所需的请求参数
+type ResetPasswordRequest struct {
+	ResetToken  string `json:"reset_token" binding:"required" example:"5d41402abc4b2a76b9719d911017c592..."`
+	NewPassword string `json:"new_password" binding:"required" example:"newpassword123"`
+}
+
 // SearchFileRequest "/file/search"
 // @Description 搜索文件所需的请求参数
 type SearchFileRequest struct {
-	Keywords string `json:"keywords" binding:"required" example:"文档"`
+	Keywords  string `json:"keywords" example:"文档"`
+	MediaType string `json:"media_type" binding:"omitempty,oneof=image video audio" example:"image"` // 媒体类型
+	TakenYear int    `json:"taken_year" binding:"omitempty,min=1900,max=9999" example:"2025"`        // 拍摄年份
+	TakenFrom string `json:"taken_from" example:"2025-01-01"`                                        // 拍摄时间起（含）
+	TakenTo   string `json:"taken_to" example:"2025-12-31"`                                          // 拍摄时间止（含）
 }
 
 // BanUserRequest "/admin/ban_user"
@@ -94,3 +201,57 @@ type GiveAdminRequest struct {
 type DepriveAdminRequest struct {
 	UserID int `json:"user_id" binding:"required" example:"2"`
 }
+
+// UpdateUploadPolicyRequest "/admin/upload_policy"
+// @Description 修改上传策略所需的请求参数，未传的字段保持不变，传空数组清空名单
+type UpdateUploadPolicyRequest struct {
+	AllowExts        *[]string `json:"allow_exts" example:"jpg,png,pdf"`
+	DenyExts         *[]string `json:"deny_exts" example:"exe,bat"`
+	AllowMimes       *[]string `json:"allow_mimes" example:"image/*"`
+	DenyMimes        *[]string `json:"deny_mimes" example:"text/html"`
+	UserMaxFileSize  *int64    `json:"user_max_file_size" binding:"omitempty,min=0" example:"1024"`
+	VIPMaxFileSize   *int64    `json:"vip_max_file_size" binding:"omitempty,min=0" example:"10240"`
+	AdminMaxFileSize *int64    `json:"admin_max_file_size" binding:"omitempty,min=0" example:"0"`
+	MaxFileCount     *int64    `json:"max_file_count" binding:"omitempty,min=0" example:"10000"`
+	DailyUploadLimit *int64    `json:"daily_upload_limit" binding:"omitempty,min=0" example:"5120"`
+}
+
+// UpdateSecurityPolicyRequest "/admin/security_policy"
+// @Description 修改账号安全策略所需的请求参数，未传的字段保持不变
+type UpdateSecurityPolicyRequest struct {
+	RequireAdmin2FA *bool `json:"require_admin_2fa" example:"true"`
+}
+
+// CreateOfflineTaskRequest "/file/offline"
+// @Description 创建离线下载任务所需的请求参数
+type CreateOfflineTaskRequest struct {
+	URL      string `json:"url" binding:"required,url" example:"https://example.com/video.mp4"`
+	FileName string `json:"file_name" binding:"omitempty,max=255" example:"video.mp4"` // 为空时根据响应推断
+}
+
+// CreateFolderRequest "/file/folder"
+// @Description 新建文件夹所需的请求参数
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required,max=255" example:"课程资料"`
+	ParentID *uint  `json:"parent_id" example:"1"` // 为空时建在根目录
+}
+
+// MoveFileRequest "/file/:id/move"
+// @Description 移动文件所需的请求参数
+type MoveFileRequest struct {
+	ParentID *uint `json:"parent_id" example:"1"` // 目标文件夹ID，为空时移动到根目录
+}
+
+// ShareAccessRequest "/share/:unique_id/access"
+// @Description 验证分享密码所需的请求参数
+type ShareAccessRequest struct {
+	Password string `json:"password" form:"password" example:"share123"`
+}
+
+// SaveShareRequest "/share/:unique_id/save"
+// @Description 将分享中选中的文件与文件夹转存到自己的文件夹所需的请求参数
+type SaveShareRequest struct {
+	FileIDs  []uint `json:"file_ids" binding:"required,min=1,max=100" example:"3,4"`
+	FolderID *uint  `json:"folder_id" example:"1"` // 目标文件夹ID，为空时转存到根目录
+	Password string `json:"password" example:"share123"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+)
+
+// 会话被撤销的原因
+const (
+	SessionRevokeLogout = "logout"         // 用户登出
+	SessionRevokeUser   = "user"           // 用户在会话列表中撤销
+	SessionRevokeReuse  = "reuse"          // 已轮换的刷新令牌被再次使用，疑似泄露
+	SessionRevokeReset  = "password_reset" // 找回密码后撤销全部会话
+)
+
+// Session 登录会话
+// @Description 每次登录创建一个会话，刷新令牌在会话内轮换，撤销会话后其访问令牌与刷新令牌立即失效
+type Session struct {
+	ID           uint       `gorm:"primaryKey" json:"-"`
+	SessionID    string     `gorm:"size:32;uniqueIndex;not null" json:"session_id" example:"9f86d081884c7d659a2feaa0c55ad015"` // 对外的会话ID，写入访问令牌
+	UserID       int        `gorm:"index;not null" json:"-"`
+	Device       string     `gorm:"size:100" json:"device" example:"Chrome on Windows"` // 由User-Agent识别的设备
+	UserAgent    string     `gorm:"size:500" json:"user_agent" example:"Mozilla/5.0 (Windows NT 10.0; Win64; x64) ..."`
+	IP           string     `gorm:"size:64" json:"ip" example:"203.0.113.10"`      // 登录IP
+	LastIP       string     `gorm:"size:64" json:"last_ip" example:"203.0.113.10"` // 最近一次刷新令牌的IP
+	CreatedAt    time.Time  `json:"created_at" example:"2026-02-18T10:00:00Z"`
+	LastUsedAt   time.Time  `json:"last_used_at" example:"2026-02-18T12:00:00Z"` // 最近一次刷新令牌的时间
+	ExpiresAt    time.Time  `gorm:"index" json:"expires_at" example:"2026-02-25T12:00:00Z"`
+	TokenVersion int        `gorm:"not null;default:0" json:"-"` // 创建会话时用户的令牌版本，版本变化后会话无法再刷新
+	RevokedAt    *time.Time `json:"-"`
+	RevokeReason string     `gorm:"size:20" json:"-"`                // logout/user/reuse
+	Current      bool       `gorm:"-" json:"current" example:"true"` // 是否为当前请求使用的会话
+}
+
+// RefreshToken 会话签发过的刷新令牌
+// @Description 只保存SHA-256摘要，每次刷新后旧令牌作废，再次使用已作废的令牌会撤销整个会话
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	SessionID string     `gorm:"size:32;index;not null"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null"`
+	UsedAt    *time.Time // 已轮换
+	CreatedAt time.Time
+}
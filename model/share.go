@@ -11,8 +11,20 @@ type Share struct {
 	UniqueID  string        `gorm:"size:32;uniqueIndex;not null" json:"unique_id" example:"abc123xyz"`
 	UserID    uint          `gorm:"index;not null" json:"user_id" example:"1"`
 	Password  string        `gorm:"size:100" json:"-" example:"share123"`
-	Exp       time.Duration `gorm:"index" json:"exp" example:"86400000000000"` //单位为天
+	Exp       time.Duration `gorm:"index" json:"-"`                                                   // 已弃用：旧版本保存的有效时长，启动时迁移到ExpireAt
+	ExpireAt  *time.Time    `gorm:"index" json:"expire_at" example:"2026-02-25T10:00:00Z"`            // 过期时间，为空时不过期
+	Disabled  bool          `gorm:"default:false" json:"disabled" example:"false"`                    // 分享者暂时停用，停用期间不能访问
+	AlbumID   *uint         `gorm:"index" json:"album_id,omitempty" example:"1"`                      // 由相册创建的分享
+	ShortCode *string       `gorm:"size:32;uniqueIndex" json:"short_code,omitempty" example:"spring"` // 短链接的短码，为空时没有短链接
+	Watermark bool          `gorm:"default:false" json:"watermark" example:"false"`                   // 下载与预览图片、PDF时加上访问者与时间的水印，开启后不能转存
 	CreatedAt time.Time     `json:"created_at" example:"2026-02-18T10:00:00Z"`
+	UpdatedAt time.Time     `json:"updated_at" example:"2026-02-18T10:00:00Z"`
+
+	// 下载限制与统计（计数先在redis中累计，定期写回）
+	MaxDownloads  int64 `gorm:"default:0" json:"max_downloads" example:"100"` // 最大下载次数（含转存），0为不限制，达到后分享失效
+	ViewCount     int64 `gorm:"default:0" json:"view_count" example:"20"`     // 查看次数
+	DownloadCount int64 `gorm:"default:0" json:"download_count" example:"5"`  // 下载次数（含转存）
+	VisitorCount  int64 `gorm:"default:0" json:"visitor_count" example:"8"`   // 独立访客数（登录用户按用户、未登录按IP）
 
 	// 关联
 	User       User        `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -41,4 +53,52 @@ type ShareInfoResponse struct {
 	ExpireTime   *time.Time `json:"expire_time,omitempty" example:"2026-02-25T10:00:00Z"`
 	TotalSize    int64      `json:"total_size" example:"1024000"`
 	FileCount    int        `json:"file_count" example:"3"`
+
+	PreviewTypes map[uint]string `json:"preview_types"` // 可以在线预览的文件ID及其预览类别(image/video/audio/document/text/markdown/table/code)
+}
+
+// ShareTreeResponse 浏览分享文件夹的响应
+// @Description 分享中某个文件夹的内容及从分享根目录到该文件夹的路径
+type ShareTreeResponse struct {
+	Folder *File   `json:"folder"` // 当前文件夹，浏览分享根目录时为空
+	Path   []*File `json:"path"`   // 从分享的根文件夹到当前文件夹的路径
+	Files  []*File `json:"files"`  // 当前文件夹下的文件
+
+	PreviewTypes map[uint]string `json:"preview_types"` // 可以在线预览的文件ID及其预览类别
+}
+
+// 分享访问记录的操作类型
+const (
+	ShareActionView     = "view"     // 查看分享
+	ShareActionDownload = "download" // 下载文件
+	ShareActionPreview  = "preview"  // 预览需要返回整个文件的类型（图片、音视频、文档）
+	ShareActionSave     = "save"     // 转存文件
+
+	ShareActionPasswordFailed = "password_failed" // 分享密码错误
+)
+
+// ShareAccessLog 分享访问记录
+// @Description 分享被查看、下载、转存的记录，先写入redis再批量写回
+type ShareAccessLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	ShareID   uint      `gorm:"index;not null" json:"share_id" example:"1"`
+	FileID    *uint     `json:"file_id,omitempty" example:"3"`            // 下载/转存的文件，查看时为空
+	Action    string    `gorm:"size:20" json:"action" example:"download"` // view/download/save/password_failed
+	UserID    uint      `gorm:"index" json:"user_id" example:"0"`         // 访问者用户ID，未登录为0
+	Anonymous bool      `json:"anonymous" example:"true"`                 // 是否为未登录访问者
+	IP        string    `gorm:"size:64" json:"ip" example:"203.0.113.10"` // 访问者IP
+	CreatedAt time.Time `gorm:"index" json:"created_at" example:"2026-02-18T10:00:00Z"`
+}
+
+// ShareStatsResponse 分享统计
+// @Description 分享的查看、下载、独立访客数与访问记录
+type ShareStatsResponse struct {
+	UniqueID           string            `json:"unique_id" example:"abc123xyz"`
+	ViewCount          int64             `json:"view_count" example:"20"`
+	DownloadCount      int64             `json:"download_count" example:"5"`
+	VisitorCount       int64             `json:"visitor_count" example:"8"`
+	MaxDownloads       int64             `json:"max_downloads" example:"100"`      // 0为不限制
+	RemainingDownloads int64             `json:"remaining_downloads" example:"95"` // 不限制时为-1
+	Logs               []*ShareAccessLog `json:"logs"`                             // 访问记录，新的在前
+	TotalLogs          int64             `json:"total_logs" example:"25"`
 }
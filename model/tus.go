@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// TusUpload tus协议上传会话，保存在redis中
+type TusUpload struct {
+	ID        string            `json:"id"`
+	UserID    int               `json:"user_id"`
+	Length    int64             `json:"length"`   // Upload-Length
+	Offset    int64             `json:"offset"`   // 已接收字节数
+	FileName  string            `json:"filename"` // Upload-Metadata: filename
+	MimeType  string            `json:"filetype"` // Upload-Metadata: filetype
+	Metadata  map[string]string `json:"metadata"`
+	TmpPath   string            `json:"tmp_path"` // 本地临时文件
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
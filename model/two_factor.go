@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// RecoveryCode 两步验证恢复码
+// @Description 开启两步验证时生成，只保存SHA-256摘要，每个恢复码只能使用一次
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"-"`
+	UserID    int        `gorm:"index;not null" json:"-"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// SecurityPolicy 账号安全策略
+// @Description config.yaml中的配置为默认值，管理员修改后保存在数据库中并覆盖默认值
+type SecurityPolicy struct {
+	ID              uint      `gorm:"primaryKey" json:"-"`
+	RequireAdmin2FA bool      `json:"require_admin_2fa" example:"true"` // 管理员是否必须开启两步验证才能访问后台接口
+	UpdatedAt       time.Time `json:"updated_at" example:"2026-02-18T10:00:00Z"`
+}
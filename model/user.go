@@ -10,7 +10,10 @@ type User struct {
 	Role                       string `json:"role" gorm:"column:role;type:varchar(50);default:user"` // admin/user
 	IsVIP                      bool   `json:"is_vip" gorm:"column:is_vip;type:tinyint(1);default:false"`
 	IsBanned                   bool   `json:"is_banned" gorm:"column:is_banned;type:tinyint(1);default:false"`
-	Storage                    int64  `json:"storage" gorm:"column:storage"` // 以字节为单位
-	GeneratedInvitationCodeNum int64  `json:"generated_invitation_code_num" gorm:"column:generated_invitation_code_num" // 已生成的邀请码数量`
-	Avatar                     string `json:"avatar" gorm:"column:avatar"` // 头像路径
+	Storage                    int64  `json:"storage" gorm:"column:storage"`                                             // 以字节为单位
+	GeneratedInvitationCodeNum int64  `json:"generated_invitation_code_num" gorm:"column:generated_invitation_code_num"` // 已生成的邀请码数量
+	Avatar                     string `json:"avatar" gorm:"column:avatar"`                                               // 头像路径
+	TOTPSecret                 string `json:"-" gorm:"column:totp_secret;type:varchar(64)"`                              // 两步验证密钥(base32)
+	TOTPEnabled                bool   `json:"totp_enabled" gorm:"column:totp_enabled;type:tinyint(1);default:false"`     // 是否已开启两步验证
+	TokenVersion               int    `json:"-" gorm:"column:token_version;not null;default:0"`                          // 令牌版本，封禁、修改角色或密码时加一
 }
@@ -3,14 +3,21 @@ package services
 import (
 	"ClaranCloudDisk/dao/mysql"
 	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util/scanner"
+	"context"
+	"fmt"
 )
 
 type AdminService struct {
-	userRepo mysql.UserRepository
+	userRepo            mysql.UserRepository
+	fileRepo            mysql.FileRepository
+	uploadPolicyService *UploadPolicyService
+	auditRepo           mysql.AuditRepository
+	twoFactorService    *TwoFactorService
 }
 
-func NewAdminService(userRepo mysql.UserRepository) AdminService {
-	return AdminService{userRepo}
+func NewAdminService(userRepo mysql.UserRepository, fileRepo mysql.FileRepository, uploadPolicyService *UploadPolicyService, auditRepo mysql.AuditRepository, twoFactorService *TwoFactorService) AdminService {
+	return AdminService{userRepo, fileRepo, uploadPolicyService, auditRepo, twoFactorService}
 }
 
 func (s *AdminService) GetInfo() (int64, int64, error) {
@@ -84,3 +91,81 @@ func (s *AdminService) GetAdminList() ([]model.User, int64, error) {
 
 	return users, total, nil
 }
+
+func (s *AdminService) GetQuarantineList(ctx context.Context) ([]*model.File, int64, error) {
+	files, total, err := s.fileRepo.FindQuarantined(ctx)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	return files, total, nil
+}
+
+// ReleaseQuarantine 复核后解除隔离
+// 秒传的记录共用同一对象，因此内容相同的记录一并解除
+func (s *AdminService) ReleaseQuarantine(ctx context.Context, fileID int) (int, error) {
+	file, err := s.fileRepo.FindByID(ctx, uint(fileID))
+	if err != nil {
+		return -1, fmt.Errorf("文件不存在: %v", err)
+	}
+	if !file.Quarantined {
+		return -1, fmt.Errorf("文件未被隔离")
+	}
+
+	files, err := s.fileRepo.FindAllByHash(ctx, file.Hash)
+	if err != nil {
+		return -1, err
+	}
+
+	released := 0
+	for _, f := range files {
+		if !f.Quarantined {
+			continue
+		}
+		f.Quarantined = false
+		f.ScanStatus = scanner.StatusReleased
+		if err := s.fileRepo.Update(ctx, f); err != nil {
+			return released, fmt.Errorf("解除隔离失败: %v", err)
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+func (s *AdminService) GetUploadPolicy(ctx context.Context) (*model.UploadPolicy, error) {
+	return s.uploadPolicyService.Get(ctx)
+}
+
+func (s *AdminService) UpdateUploadPolicy(ctx context.Context, req *model.UpdateUploadPolicyRequest) (*model.UploadPolicy, error) {
+	return s.uploadPolicyService.Update(ctx, req)
+}
+
+// ResetUploadPolicy 恢复为config.yaml中的默认策略
+func (s *AdminService) ResetUploadPolicy(ctx context.Context) (*model.UploadPolicy, error) {
+	return s.uploadPolicyService.Reset(ctx)
+}
+
+func (s *AdminService) GetSecurityPolicy(ctx context.Context) (*model.SecurityPolicy, error) {
+	return s.twoFactorService.GetPolicy(ctx)
+}
+
+func (s *AdminService) UpdateSecurityPolicy(ctx context.Context, req *model.UpdateSecurityPolicyRequest) (*model.SecurityPolicy, error) {
+	return s.twoFactorService.UpdatePolicy(ctx, req)
+}
+
+// GetAuditLogs 查看审计记录，logType为空时返回全部类型
+func (s *AdminService) GetAuditLogs(ctx context.Context, logType string, page, pageSize int) ([]*model.AuditLog, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	logs, total, err := s.auditRepo.GetAuditLogs(ctx, logType, page, pageSize)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	return logs, total, nil
+}
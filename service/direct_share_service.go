@@ -0,0 +1,142 @@
+package services
+
+import (
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DirectShareService 定向分享：将文件或文件夹直接分享给平台内的指定用户
+// 接收者的访问权限由FileService.fileAccess检查
+type DirectShareService struct {
+	directShareRepo mysql.DirectShareRepository
+	fileRepo        mysql.FileRepository
+	userRepo        mysql.UserRepository
+}
+
+func NewDirectShareService(directShareRepo mysql.DirectShareRepository, fileRepo mysql.FileRepository, userRepo mysql.UserRepository) *DirectShareService {
+	return &DirectShareService{
+		directShareRepo: directShareRepo,
+		fileRepo:        fileRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// ShareWithUsers 分享给指定用户，已分享过的接收者更新为新的权限
+func (s *DirectShareService) ShareWithUsers(ctx context.Context, ownerID uint, req *model.DirectShareRequest) ([]*model.DirectShare, error) {
+	file, err := s.fileRepo.FindByID(ctx, req.FileID)
+	if err != nil || file.ID == 0 || file.IsDeleted {
+		return nil, fmt.Errorf("文件不存在: %d", req.FileID)
+	}
+	if file.UserID != ownerID {
+		return nil, fmt.Errorf("无权分享文件: %d", req.FileID)
+	}
+	if file.Quarantined {
+		return nil, fmt.Errorf("%w: %d", ErrFileQuarantined, req.FileID)
+	}
+
+	// 先全部解析，有不存在的用户时不做任何修改
+	recipients := make([]*model.User, 0, len(req.Recipients))
+	seen := make(map[int]bool, len(req.Recipients))
+	for _, name := range req.Recipients {
+		recipient, err := s.findUser(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if recipient.UserID == int(ownerID) {
+			return nil, errors.New("不能分享给自己")
+		}
+		if seen[recipient.UserID] {
+			continue
+		}
+		seen[recipient.UserID] = true
+		recipients = append(recipients, recipient)
+	}
+
+	shares := make([]*model.DirectShare, 0, len(recipients))
+	for _, recipient := range recipients {
+		share := &model.DirectShare{
+			FileID:      file.ID,
+			OwnerID:     ownerID,
+			RecipientID: uint(recipient.UserID),
+			Permission:  req.Permission,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		if err := s.directShareRepo.SaveDirectShare(ctx, share); err != nil {
+			return nil, fmt.Errorf("分享给%s失败: %v", recipient.Username, err)
+		}
+		share.Recipient = publicUser(*recipient)
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// GetGranted 分享者查看自己的定向分享，fileID为0时返回全部
+func (s *DirectShareService) GetGranted(ctx context.Context, ownerID uint, fileID uint) ([]*model.DirectShare, error) {
+	shares, err := s.directShareRepo.GetByOwner(ctx, ownerID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("获取定向分享失败: %v", err)
+	}
+	for _, share := range shares {
+		share.Recipient = publicUser(share.Recipient)
+	}
+	return shares, nil
+}
+
+// SharedWithMe 别人分享给我的文件，已被分享者删除的文件不再显示
+func (s *DirectShareService) SharedWithMe(ctx context.Context, recipientID uint) ([]*model.DirectShare, error) {
+	shares, err := s.directShareRepo.GetByRecipient(ctx, recipientID)
+	if err != nil {
+		return nil, fmt.Errorf("获取分享给我的文件失败: %v", err)
+	}
+	result := make([]*model.DirectShare, 0, len(shares))
+	for _, share := range shares {
+		if share.File.ID == 0 || share.File.IsDeleted {
+			continue
+		}
+		share.Owner = publicUser(share.Owner)
+		result = append(result, share)
+	}
+	return result, nil
+}
+
+// Revoke 撤销对某个接收者的定向分享，接收者也可以移除分享给自己的文件
+func (s *DirectShareService) Revoke(ctx context.Context, userID uint, id uint) error {
+	share, err := s.directShareRepo.GetDirectShareByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("定向分享不存在: %v", err)
+	}
+	if share.OwnerID != userID && share.RecipientID != userID {
+		return errors.New("无权撤销此分享")
+	}
+	return s.directShareRepo.DeleteDirectShare(ctx, id)
+}
+
+// findUser 包含@时按邮箱查找，否则按用户名查找
+func (s *DirectShareService) findUser(name string) (*model.User, error) {
+	var user *model.User
+	var err error
+	if strings.Contains(name, "@") {
+		user, err = s.userRepo.SelectByEmail(name)
+	} else {
+		user, err = s.userRepo.SelectByUsername(name)
+	}
+	if err != nil || user == nil || user.UserID == 0 {
+		return nil, fmt.Errorf("用户不存在: %s", name)
+	}
+	return user, nil
+}
+
+// publicUser 返回给其他用户时只保留公开信息
+func publicUser(user model.User) model.User {
+	return model.User{
+		UserID:   user.UserID,
+		Username: user.Username,
+		Avatar:   user.Avatar,
+	}
+}
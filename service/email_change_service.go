@@ -0,0 +1,137 @@
+package services
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/util"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmailChangePassword   = errors.New("密码错误")
+	ErrEmailUnchanged        = errors.New("新邮箱与当前邮箱相同")
+	ErrEmailTaken            = errors.New("该邮箱已被使用")
+	ErrEmailChangeNotPending = errors.New("没有待确认的邮箱修改或已过期，请重新申请")
+	ErrEmailChangeFormat     = errors.New("邮箱格式不正确")
+	ErrEmailChangeCode       = errors.New("验证码校验失败")
+)
+
+// emailChangeTTL 申请修改邮箱后等待确认的时间
+const emailChangeTTL = 10 * time.Minute
+
+type EmailChangeService struct {
+	userRepo            mysql.UserRepository
+	emailCache          cache.EmailCache
+	verificationService *VerificationService
+}
+
+func NewEmailChangeService(userRepo mysql.UserRepository, emailCache cache.EmailCache, verificationService *VerificationService) *EmailChangeService {
+	return &EmailChangeService{
+		userRepo:            userRepo,
+		emailCache:          emailCache,
+		verificationService: verificationService,
+	}
+}
+
+// Request 验证密码后向新邮箱发送验证码，确认前不修改邮箱
+func (s *EmailChangeService) Request(ctx context.Context, userID int, password, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if !strings.Contains(newEmail, "@") {
+		return ErrEmailChangeFormat
+	}
+
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if !util.CheckPassword(user.Password, password) {
+		return ErrEmailChangePassword
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailUnchanged
+	}
+	if err := s.checkEmailAvailable(newEmail); err != nil {
+		return err
+	}
+
+	if err := s.emailCache.SavePendingChange(ctx, userID, newEmail, emailChangeTTL); err != nil {
+		return err
+	}
+	if err := s.verificationService.SendCode(ctx, newEmail, VerificationPurposeChangeEmail); err != nil {
+		// 发送失败，回滚
+		errEx := s.emailCache.DeletePendingChange(ctx, userID)
+		return fmt.Errorf("%v & %v", err, errEx)
+	}
+	return nil
+}
+
+// Confirm 使用新邮箱收到的验证码确认修改，修改后向旧邮箱发送通知，返回新邮箱
+func (s *EmailChangeService) Confirm(ctx context.Context, userID int, code string) (string, error) {
+	newEmail, err := s.emailCache.GetPendingChange(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if newEmail == "" {
+		return "", ErrEmailChangeNotPending
+	}
+
+	ok, err := s.verificationService.VerifyCode(ctx, newEmail, VerificationPurposeChangeEmail, code)
+	if !ok {
+		return "", fmt.Errorf("%w: %v", ErrEmailChangeCode, err)
+	}
+
+	// 申请后新邮箱可能已被其他用户使用
+	if err := s.checkEmailAvailable(newEmail); err != nil {
+		return "", err
+	}
+
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return "", fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	oldEmail := user.Email
+	if err := s.userRepo.UpdateEmail(userID, newEmail); err != nil {
+		return "", fmt.Errorf("修改邮箱失败: %v", err)
+	}
+	if err := s.emailCache.DeletePendingChange(ctx, userID); err != nil {
+		zap.S().Errorf("删除待确认邮箱失败: %v", err)
+	}
+
+	// 通知旧邮箱，账号被盗用时原主人能及时发现
+	go func() {
+		text := fmt.Sprintf("您的账号 %s 的邮箱已于 %s 由 %s 修改为 %s。如非本人操作，请立即联系管理员。",
+			user.Username, time.Now().Format("2006-01-02 15:04:05"), oldEmail, maskEmail(newEmail))
+		if err := s.verificationService.SendNotification(oldEmail, "ClaranCloudDisk邮箱已修改", text); err != nil {
+			zap.S().Errorf("发送邮箱修改通知失败: %v", err)
+		}
+	}()
+	return newEmail, nil
+}
+
+func (s *EmailChangeService) checkEmailAvailable(email string) error {
+	// 未注册的邮箱可能命中空值缓存，返回UserID为0的用户
+	existing, err := s.userRepo.SelectByEmail(email)
+	if err == nil && existing.UserID != 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// maskEmail 通知旧邮箱时隐藏新邮箱的部分内容，如 jo***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	name := email[:at]
+	if len(name) > 2 {
+		name = name[:2]
+	}
+	return name + "***" + email[at:]
+}
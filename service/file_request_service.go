@@ -0,0 +1,495 @@
+package services
+
+import (
+	"ClaranCloudDisk/config"
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util"
+	"ClaranCloudDisk/util/jwt_util"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFileRequestExpired     = errors.New("文件收集已截止")
+	ErrFileRequestFull        = errors.New("文件收集的上传总量已达上限")
+	ErrFileRequestTooLarge    = errors.New("文件超过文件收集允许的大小")
+	ErrFileRequestExtDenied   = errors.New("文件收集不接受该类型的文件")
+	ErrFileRequestUploaderBad = errors.New("请填写姓名（不超过50个字符），留言不超过500个字符")
+)
+
+// FileRequestService 文件收集：所有者创建只能上传的链接，外部人员无需登录即可提交文件
+// 提交的文件以所有者身份保存到目标文件夹，计入所有者的存储空间，上传者看不到其他人提交的文件
+type FileRequestService struct {
+	requestRepo mysql.FileRequestRepository
+	fileService *FileService
+	userRepo    mysql.UserRepository
+	guardCache  cache.ShareGuardCache
+	jwtUtil     jwt_util.Util
+
+	AccessTokenTTL      time.Duration // 访问令牌有效期，与分享一致
+	PasswordMaxAttempts int64         // 每个IP连续输错密码的次数上限，每个链接为其4倍
+	LockoutBase         time.Duration // 首次锁定时长，之后每次失败翻倍
+	EnumMaxMisses       int64         // 每个IP访问不存在链接的次数上限
+}
+
+func NewFileRequestService(requestRepo mysql.FileRequestRepository, fileService *FileService, userRepo mysql.UserRepository, guardCache cache.ShareGuardCache, jwtUtil jwt_util.Util, cfg config.ShareConfig) *FileRequestService {
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = 30
+	}
+	if cfg.PasswordMaxAttempts <= 0 {
+		cfg.PasswordMaxAttempts = 5
+	}
+	if cfg.LockoutBase <= 0 {
+		cfg.LockoutBase = 60
+	}
+	if cfg.EnumMaxMisses <= 0 {
+		cfg.EnumMaxMisses = 20
+	}
+	return &FileRequestService{
+		requestRepo:         requestRepo,
+		fileService:         fileService,
+		userRepo:            userRepo,
+		guardCache:          guardCache,
+		jwtUtil:             jwtUtil,
+		AccessTokenTTL:      time.Duration(cfg.AccessTokenTTL) * time.Minute,
+		PasswordMaxAttempts: cfg.PasswordMaxAttempts,
+		LockoutBase:         time.Duration(cfg.LockoutBase) * time.Second,
+		EnumMaxMisses:       cfg.EnumMaxMisses,
+	}
+}
+
+// CreateRequest 创建文件收集链接，目标文件夹必须属于当前用户
+func (s *FileRequestService) CreateRequest(ctx context.Context, userID uint, req *model.CreateFileRequestRequest) (*model.FileRequest, error) {
+	if _, err := s.fileService.accessibleFolder(ctx, int(userID), req.FolderID, accessOwner); err != nil {
+		return nil, err
+	}
+
+	var hashedPassword string
+	if req.Password != "" {
+		hashed, err := util.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword = hashed
+	}
+
+	uniqueID, err := generateUniqueID()
+	if err != nil {
+		return nil, fmt.Errorf("生成收集链接ID失败: %v", err)
+	}
+	request := &model.FileRequest{
+		UniqueID:     uniqueID,
+		UserID:       userID,
+		FolderID:     req.FolderID,
+		Title:        strings.TrimSpace(req.Title),
+		Description:  req.Description,
+		Password:     hashedPassword,
+		MaxFileSize:  req.MaxFileSize,
+		AllowExts:    normalizeExts(req.AllowExts),
+		MaxTotalSize: req.MaxTotalSize,
+		CreatedAt:    time.Now(),
+	}
+	if req.ExpireDays > 0 {
+		expireAt := time.Now().Add(time.Duration(req.ExpireDays) * 24 * time.Hour)
+		request.ExpireAt = &expireAt
+	}
+
+	if err := s.requestRepo.CreateFileRequest(ctx, request); err != nil {
+		return nil, fmt.Errorf("创建文件收集失败: %v", err)
+	}
+	return request, nil
+}
+
+func (s *FileRequestService) GetMyRequests(ctx context.Context, userID uint) ([]*model.FileRequest, int64, error) {
+	return s.requestRepo.GetUserFileRequests(ctx, userID)
+}
+
+// DeleteRequest 删除文件收集链接，已提交的文件保留在目标文件夹中
+func (s *FileRequestService) DeleteRequest(ctx context.Context, userID uint, uniqueID string) error {
+	request, err := s.ownedRequest(ctx, userID, uniqueID)
+	if err != nil {
+		return err
+	}
+	return s.requestRepo.DeleteFileRequest(ctx, request.ID)
+}
+
+// GetSubmissions 所有者查看提交记录
+func (s *FileRequestService) GetSubmissions(ctx context.Context, userID uint, uniqueID string, page, pageSize int) ([]*model.FileSubmission, int64, error) {
+	request, err := s.ownedRequest(ctx, userID, uniqueID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return s.requestRepo.GetSubmissions(ctx, request.ID, page, pageSize)
+}
+
+func (s *FileRequestService) ownedRequest(ctx context.Context, userID uint, uniqueID string) (*model.FileRequest, error) {
+	request, err := s.requestRepo.GetFileRequestByUniqueID(ctx, uniqueID)
+	if err != nil {
+		return nil, errors.New("文件收集不存在")
+	}
+	if request.UserID != userID {
+		return nil, errors.New("无权操作此文件收集")
+	}
+	return request, nil
+}
+
+// GetRequestInfo 上传者查看文件收集的说明与限制，不需要密码
+func (s *FileRequestService) GetRequestInfo(ctx context.Context, uniqueID, clientIP string) (*model.FileRequestInfoResponse, error) {
+	request, err := s.findRequest(ctx, uniqueID, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := s.userRepo.SelectByUserID(int(request.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+
+	remaining := int64(-1)
+	if request.MaxTotalSize > 0 {
+		remaining = max(request.MaxTotalSize*1048576-request.UsedSize, 0)
+	}
+	return &model.FileRequestInfoResponse{
+		UniqueID:      request.UniqueID,
+		Title:         request.Title,
+		Description:   request.Description,
+		Owner:         publicUser(owner),
+		NeedPassword:  request.Password != "",
+		ExpireAt:      request.ExpireAt,
+		MaxFileSize:   request.MaxFileSize,
+		AllowExts:     request.AllowExts,
+		RemainingSize: remaining,
+	}, nil
+}
+
+// VerifyPassword 验证文件收集密码，通过后签发访问令牌，之后上传只需携带令牌
+func (s *FileRequestService) VerifyPassword(ctx context.Context, uniqueID, password, clientIP string) (string, time.Duration, error) {
+	request, err := s.loadRequest(ctx, uniqueID, password, "", clientIP)
+	if err != nil {
+		return "", 0, err
+	}
+
+	token, err := s.jwtUtil.GenerateShareToken(requestTokenSubject(request.UniqueID), passwordFingerprint(request.Password), s.AccessTokenTTL)
+	if err != nil {
+		return "", 0, fmt.Errorf("签发访问令牌失败: %v", err)
+	}
+	return token, s.AccessTokenTTL, nil
+}
+
+// Upload 上传者提交一个文件
+func (s *FileRequestService) Upload(ctx context.Context, uniqueID, password, accessToken, clientIP, uploaderName, note string, file multipart.File, fileHeader *multipart.FileHeader) (*model.FileSubmission, error) {
+	uploaderName, err := checkUploader(uploaderName, note)
+	if err != nil {
+		return nil, err
+	}
+	request, err := s.loadRequest(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFile(request, fileHeader.Filename, fileHeader.Size); err != nil {
+		return nil, err
+	}
+	if _, err := s.fileService.accessibleFolder(ctx, int(request.UserID), request.FolderID, accessOwner); err != nil {
+		return nil, fmt.Errorf("文件收集的目标文件夹已失效: %v", err)
+	}
+
+	// 先占用上传总量，避免并发上传超过上限
+	if err := s.addUsage(ctx, request, fileHeader.Size); err != nil {
+		return nil, err
+	}
+
+	newFile, err := s.fileService.Upload(ctx, int(request.UserID), file, fileHeader)
+	if err != nil {
+		s.releaseUsage(ctx, request, fileHeader.Size)
+		return nil, err
+	}
+
+	submission := &model.FileSubmission{
+		RequestID:    request.ID,
+		UploaderName: uploaderName,
+		Note:         note,
+		IP:           clientIP,
+		Size:         newFile.Size,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.finishSubmission(ctx, request, submission, newFile); err != nil {
+		s.releaseUsage(ctx, request, fileHeader.Size)
+		return nil, err
+	}
+	return submission, nil
+}
+
+// InitChunkUpload 上传者初始化分片上传，会话属于文件收集的所有者
+// 提交记录在全部分片合并后才会出现在所有者的列表中
+func (s *FileRequestService) InitChunkUpload(ctx context.Context, uniqueID, password, accessToken, clientIP, uploaderName, note string, fileName, fileHash string, fileSize int64, chunkTotal int, mimetype string) (*model.ChunkUploadSession, error) {
+	uploaderName, err := checkUploader(uploaderName, note)
+	if err != nil {
+		return nil, err
+	}
+	request, err := s.loadRequest(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFile(request, fileName, fileSize); err != nil {
+		return nil, err
+	}
+	if request.MaxTotalSize > 0 && request.UsedSize+fileSize > request.MaxTotalSize*1048576 {
+		return nil, ErrFileRequestFull
+	}
+	if _, err := s.fileService.accessibleFolder(ctx, int(request.UserID), request.FolderID, accessOwner); err != nil {
+		return nil, fmt.Errorf("文件收集的目标文件夹已失效: %v", err)
+	}
+
+	session, err := s.fileService.InitChunkUpload(ctx, int(request.UserID), fileName, fileHash, fileSize, chunkTotal, mimetype)
+	if err != nil {
+		return nil, err
+	}
+
+	submission := &model.FileSubmission{
+		RequestID:    request.ID,
+		UploadID:     session.UploadID,
+		UploaderName: uploaderName,
+		Note:         note,
+		IP:           clientIP,
+		Size:         fileSize,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.requestRepo.CreateSubmission(ctx, submission); err != nil {
+		if errEx := s.fileService.AbortChunkUpload(int(request.UserID), session.UploadID); errEx != nil {
+			zap.S().Errorf("取消分片上传失败: %v", errEx)
+		}
+		return nil, fmt.Errorf("创建提交记录失败: %v", err)
+	}
+	return session, nil
+}
+
+// UploadChunk 上传者上传一个分片，全部分片到达后合并并保存到目标文件夹
+// 返回的submission不为nil时表示文件已提交完成
+func (s *FileRequestService) UploadChunk(ctx context.Context, uniqueID, password, accessToken, clientIP, uploadID string, chunkIndex int, chunkHash string, chunkData []byte) (*model.ChunkUploadSession, *model.FileSubmission, error) {
+	request, err := s.loadRequest(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 只能继续本链接发起的上传
+	submission, err := s.requestRepo.GetSubmissionByUploadID(ctx, uploadID)
+	if err != nil || submission.RequestID != request.ID || submission.FileID != nil {
+		return nil, nil, ErrChunkSessionNotFound
+	}
+
+	ownerID := int(request.UserID)
+	session, err := s.fileService.SaveChunk(ownerID, uploadID, chunkIndex, chunkHash, chunkData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	finished, err := s.fileService.IsChunkUploadFinished(uploadID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("检查上传状态失败: %v", err)
+	}
+	if !finished {
+		return session, nil, nil
+	}
+
+	if err := s.addUsage(ctx, request, submission.Size); err != nil {
+		if errEx := s.fileService.AbortChunkUpload(ownerID, uploadID); errEx != nil {
+			zap.S().Errorf("取消分片上传失败: %v", errEx)
+		}
+		return nil, nil, err
+	}
+
+	newFile, err := s.fileService.MergeAllChunks(ownerID, uploadID)
+	if err != nil {
+		s.releaseUsage(ctx, request, submission.Size)
+		return nil, nil, err
+	}
+
+	if err := s.finishSubmission(ctx, request, submission, newFile); err != nil {
+		s.releaseUsage(ctx, request, submission.Size)
+		return nil, nil, err
+	}
+	return session, submission, nil
+}
+
+// finishSubmission 检查识别后的真实类型，将文件以"上传者 - 文件名"保存到目标文件夹并记录提交
+func (s *FileRequestService) finishSubmission(ctx context.Context, request *model.FileRequest, submission *model.FileSubmission, file *model.File) error {
+	ownerID := int(request.UserID)
+
+	// 扩展名可能在识别真实类型后被修正
+	if len(request.AllowExts) > 0 && !slices.Contains(request.AllowExts, extOf(file.Name)) {
+		if err := s.fileService.DeleteFile(ctx, ownerID, int64(file.ID)); err != nil {
+			zap.S().Errorf("删除不符合要求的文件失败: %v", err)
+		}
+		return ErrFileRequestExtDenied
+	}
+
+	name, err := s.submissionName(ctx, request, submission.UploaderName, file.Name)
+	if err != nil {
+		return err
+	}
+	file.Name = name
+	file.ParentID = &request.FolderID
+	if err := s.fileService.FileRepo.Update(ctx, file); err != nil {
+		return fmt.Errorf("保存到目标文件夹失败: %v", err)
+	}
+
+	submission.FileID = &file.ID
+	submission.UploadID = ""
+	submission.Size = file.Size
+	if submission.ID == 0 {
+		err = s.requestRepo.CreateSubmission(ctx, submission)
+	} else {
+		err = s.requestRepo.UpdateSubmission(ctx, submission)
+	}
+	if err != nil {
+		return fmt.Errorf("创建提交记录失败: %v", err)
+	}
+	return nil
+}
+
+// submissionName 目标文件夹中已有同名文件时追加序号
+func (s *FileRequestService) submissionName(ctx context.Context, request *model.FileRequest, uploaderName, fileName string) (string, error) {
+	siblings, err := s.fileService.FileRepo.FindChildren(ctx, request.UserID, &request.FolderID)
+	if err != nil {
+		return "", fmt.Errorf("获取目录失败: %v", err)
+	}
+	names := make(map[string]bool, len(siblings))
+	for _, sibling := range siblings {
+		names[sibling.Name] = true
+	}
+	return uniqueSiblingName(names, uploaderName+" - "+fileName), nil
+}
+
+// checkFile 按文件收集的限制检查声明的文件名与大小
+func (s *FileRequestService) checkFile(request *model.FileRequest, fileName string, fileSize int64) error {
+	if request.MaxFileSize > 0 && fileSize > request.MaxFileSize*1048576 {
+		return fmt.Errorf("%w: 单个文件不能超过%dMB", ErrFileRequestTooLarge, request.MaxFileSize)
+	}
+	if len(request.AllowExts) > 0 && !slices.Contains(request.AllowExts, extOf(fileName)) {
+		return fmt.Errorf("%w，仅接受: %s", ErrFileRequestExtDenied, strings.Join(request.AllowExts, ", "))
+	}
+	return nil
+}
+
+func (s *FileRequestService) addUsage(ctx context.Context, request *model.FileRequest, size int64) error {
+	ok, err := s.requestRepo.AddUsage(ctx, request.ID, size)
+	if err != nil {
+		return fmt.Errorf("更新上传总量失败: %v", err)
+	}
+	if !ok {
+		return ErrFileRequestFull
+	}
+	return nil
+}
+
+func (s *FileRequestService) releaseUsage(ctx context.Context, request *model.FileRequest, size int64) {
+	if err := s.requestRepo.ReleaseUsage(ctx, request.ID, size); err != nil {
+		zap.S().Errorf("释放上传总量失败: %v", err)
+	}
+}
+
+// findRequest 获取未过期的文件收集，访问不存在的链接与分享共用按IP的计数
+func (s *FileRequestService) findRequest(ctx context.Context, uniqueID, clientIP string) (*model.FileRequest, error) {
+	if err := s.checkLocked(ctx, "enum:"+clientIP); err != nil {
+		return nil, err
+	}
+
+	request, err := s.requestRepo.GetFileRequestByUniqueID(ctx, uniqueID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if _, _, err := s.guardCache.Fail(ctx, "enum:"+clientIP, s.EnumMaxMisses, shareEnumWindow, s.LockoutBase, shareLockoutMax); err != nil {
+				zap.S().Errorf("记录文件收集访问失败: %v", err)
+			}
+		}
+		return nil, errors.New("文件收集不存在")
+	}
+
+	if request.ExpireAt != nil && time.Now().After(*request.ExpireAt) {
+		return nil, ErrFileRequestExpired
+	}
+	return request, nil
+}
+
+// loadRequest 获取文件收集，有密码时需要正确的密码或有效的访问令牌
+// 输错密码按IP和按链接计数，与分享的防暴力破解一致
+func (s *FileRequestService) loadRequest(ctx context.Context, uniqueID, password, accessToken, clientIP string) (*model.FileRequest, error) {
+	request, err := s.findRequest(ctx, uniqueID, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if request.Password == "" {
+		return request, nil
+	}
+
+	if accessToken != "" {
+		subject, fingerprint, err := s.jwtUtil.ValidateShareToken(accessToken)
+		if err != nil || subject != requestTokenSubject(request.UniqueID) || fingerprint != passwordFingerprint(request.Password) {
+			return nil, ErrShareTokenInvalid
+		}
+		return request, nil
+	}
+
+	if password == "" {
+		return nil, ErrSharePasswordRequired
+	}
+
+	requestKey := "request:" + request.UniqueID
+	if err := s.checkLocked(ctx, requestKey); err != nil {
+		return nil, err
+	}
+	if err := s.checkLocked(ctx, "ip:"+clientIP); err != nil {
+		return nil, err
+	}
+
+	if !util.CheckPassword(request.Password, password) {
+		if _, _, err := s.guardCache.Fail(ctx, "ip:"+clientIP, s.PasswordMaxAttempts, shareFailWindow, s.LockoutBase, shareLockoutMax); err != nil {
+			zap.S().Errorf("记录文件收集密码错误失败: %v", err)
+		}
+		if _, _, err := s.guardCache.Fail(ctx, requestKey, s.PasswordMaxAttempts*4, shareFailWindow, s.LockoutBase, shareLockoutMax); err != nil {
+			zap.S().Errorf("记录文件收集密码错误失败: %v", err)
+		}
+		return nil, ErrSharePasswordWrong
+	}
+	return request, nil
+}
+
+func (s *FileRequestService) checkLocked(ctx context.Context, key string) error {
+	lock, err := s.guardCache.LockedFor(ctx, key)
+	if err != nil {
+		return err
+	}
+	if lock > 0 {
+		return fmt.Errorf("%w，请%d秒后再试", ErrShareLocked, int64((lock+time.Second-1)/time.Second))
+	}
+	return nil
+}
+
+// checkUploader 上传者必须填写姓名，便于所有者区分提交
+func checkUploader(uploaderName, note string) (string, error) {
+	uploaderName = strings.TrimSpace(uploaderName)
+	if uploaderName == "" || len([]rune(uploaderName)) > 50 || strings.ContainsAny(uploaderName, `/\`) || len([]rune(note)) > 500 {
+		return "", ErrFileRequestUploaderBad
+	}
+	return uploaderName, nil
+}
+
+// requestTokenSubject 文件收集的访问令牌与分享访问令牌共用签发方式，加前缀区分，不能互相使用
+func requestTokenSubject(uniqueID string) string {
+	return "request:" + uniqueID
+}
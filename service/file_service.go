@@ -1,10 +1,16 @@
 package services
 
 import (
+	"ClaranCloudDisk/dao/cache"
 	"ClaranCloudDisk/dao/mysql"
 	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util/filetype"
+	"ClaranCloudDisk/util/media"
 	"ClaranCloudDisk/util/minIO"
+	"ClaranCloudDisk/util/preview"
+	"ClaranCloudDisk/util/scanner"
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -14,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -22,44 +29,95 @@ import (
 type FileService struct {
 	FileRepo             mysql.FileRepository
 	UserRepo             mysql.UserRepository
+	quotaCache           cache.QuotaCache
 	minioClient          *minIO.MinIOClient
+	scanner              scanner.Scanner
+	policyService        *UploadPolicyService
+	directShareRepo      mysql.DirectShareRepository
 	uploadDir            string
 	MaxFileSize          int64
 	NormalUserMaxStorage int64
 	LimitedSpeed         int64
+	PreviewMaxSize       int64
+	MimeMismatchPolicy   string
 }
 
-func NewUFileService(fileRepo mysql.FileRepository, userRepo mysql.UserRepository, minioClient *minIO.MinIOClient, uploadDir string, maxFileSize int64, NormalUserMaxStorage int64, LimitedSpeed int64) *FileService {
+// 文件内容与扩展名不一致时的处理策略
+const (
+	MimePolicyReject = "reject" // 拒绝上传
+	MimePolicyRename = "rename" // 按识别出的类型修改扩展名
+	MimePolicyFlag   = "flag"   // 保留文件名，标记MimeMismatch
+)
+
+func NewUFileService(fileRepo mysql.FileRepository, userRepo mysql.UserRepository, quotaCache cache.QuotaCache, minioClient *minIO.MinIOClient, contentScanner scanner.Scanner, policyService *UploadPolicyService, directShareRepo mysql.DirectShareRepository, uploadDir string, maxFileSize int64, NormalUserMaxStorage int64, LimitedSpeed int64, PreviewMaxSize int64, MimeMismatchPolicy string) *FileService {
+	if PreviewMaxSize <= 0 {
+		PreviewMaxSize = 2 // 未配置时默认2MB
+	}
+	switch MimeMismatchPolicy {
+	case MimePolicyReject, MimePolicyRename, MimePolicyFlag:
+	default:
+		MimeMismatchPolicy = MimePolicyFlag // 未配置时默认仅标记
+	}
 	return &FileService{
 		FileRepo:             fileRepo,
 		UserRepo:             userRepo,
+		quotaCache:           quotaCache,
 		minioClient:          minioClient,
+		scanner:              contentScanner,
+		policyService:        policyService,
+		directShareRepo:      directShareRepo,
 		uploadDir:            uploadDir,
 		MaxFileSize:          maxFileSize * 1073741824, // GB -> 字节
 		NormalUserMaxStorage: NormalUserMaxStorage * 1073741824,
-		LimitedSpeed:         LimitedSpeed * 1048576, // MB -> 字节
+		LimitedSpeed:         LimitedSpeed * 1048576,   // MB -> 字节
+		PreviewMaxSize:       PreviewMaxSize * 1048576, // MB -> 字节
+		MimeMismatchPolicy:   MimeMismatchPolicy,
 	}
 }
 
-func (s *FileService) Upload(ctx context.Context, userID int, file multipart.File, fileHeader *multipart.FileHeader) (*model.File, error) {
-	isVIP, err := s.UserRepo.GetVIP(userID)
-	if err != nil {
-		return nil, fmt.Errorf("获取用户信息失败:%v", err)
-	}
+// 分片上传相关错误，handler据此返回对应的状态码
+var (
+	ErrChunkSessionNotFound = errors.New("上传会话不存在或已过期，请重新上传")
+	ErrChunkHashMismatch    = errors.New("分片SHA-256校验失败")
+	ErrFileHashMismatch     = errors.New("合并后的文件与声明的哈希不一致")
+	ErrChunkMerging         = errors.New("文件正在合并，请稍候")
+	ErrQuotaExceeded        = errors.New("存储空间不足")
+	ErrFileTooLarge         = errors.New("文件太大")
+	ErrFileQuarantined      = errors.New("文件未通过安全扫描，已被隔离")
+	ErrMimeMismatch         = errors.New("文件内容与扩展名不一致")
+	ErrInvalidFileHash      = errors.New("file_hash必须是十六进制SHA-256")
+	ErrTooManyChunks        = errors.New("分片数超出上限")
+	ErrChunkIndexOutOfRange = errors.New("chunk_index超出范围")
+)
 
-	// 验证单个文件大小
-	if fileHeader.Size > s.MaxFileSize {
-		return nil, fmt.Errorf("单个文件大小不能超过 %.2fGB", float64(s.MaxFileSize)/(1024*1024*1024))
+const (
+	maxChunkTotal  = 10000     // 单个文件最多分片数
+	staleUploadAge = time.Hour // 会话失效且超过该时间无写入的临时数据才会被清理
+
+	uploadReservationTTL = time.Hour      // 普通上传的存储空间预留有效期
+	chunkReservationTTL  = 27 * time.Hour // 覆盖分片会话24小时(±10%)的有效期
+)
+
+func (s *FileService) Upload(ctx context.Context, userID int, file multipart.File, fileHeader *multipart.FileHeader) (*model.File, error) {
+	// 上传策略
+	if err := s.policyService.CheckFile(ctx, userID, fileHeader.Filename, fileHeader.Size); err != nil {
+		return nil, err
 	}
 
-	// 验证用户是否拥有足够存储空间
-	userStorage, err := s.UserRepo.GetStorage(userID)
+	// 预留存储空间：成功后提交，失败时释放
+	reservationID, err := newUploadID()
 	if err != nil {
-		return nil, fmt.Errorf("获取用户信息失败" + err.Error())
+		return nil, fmt.Errorf("生成预留ID失败: %v", err)
 	}
-	if !isVIP && fileHeader.Size+userStorage > s.NormalUserMaxStorage {
-		return nil, fmt.Errorf("非VIP用户总存储空间已超额！")
+	if err := s.ReserveQuota(ctx, userID, reservationID, fileHeader.Size, uploadReservationTTL); err != nil {
+		return nil, err
 	}
+	committed := false
+	defer func() {
+		if !committed {
+			s.ReleaseQuota(ctx, userID, reservationID)
+		}
+	}()
 
 	// 计算Hash
 	hash, err := s.FileHash(file)
@@ -67,6 +125,15 @@ func (s *FileService) Upload(ctx context.Context, userID int, file multipart.Fil
 		return nil, fmt.Errorf("计算文件哈希失败: %v", err)
 	}
 
+	// 根据文件头识别类型
+	detected, err := s.detectType(ctx, file, fileHeader.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析媒体元数据
+	meta := s.ExtractMeta(file, fileHeader.Size, detected.Name)
+
 	// 检测秒传
 	existingFile, err := s.FileRepo.FindByHash(ctx, hash)
 	if err == nil && existingFile != nil {
@@ -78,18 +145,21 @@ func (s *FileService) Upload(ctx context.Context, userID int, file multipart.Fil
 			}
 		}
 		// 创建文件记录（秒传）
-		ext := filepath.Ext(fileHeader.Filename)
-		ext = ext[1:]
 		newFile := &model.File{
 			UserID:   uint(userID),
-			Name:     fileHeader.Filename,
+			Name:     detected.Name,
 			Filename: existingFile.Filename,
 			Path:     existingFile.Path,
 			Size:     fileHeader.Size,
 			Hash:     hash,
 			MimeType: fileHeader.Header.Get("Content-Type"),
-			Ext:      ext,
+			Ext:      detected.Ext,
+			Meta:     existingFile.Meta, // 内容相同，直接复用
+
+			DetectedMime: detected.MIME,
+			MimeMismatch: detected.Mismatch,
 		}
+		s.inheritScan(ctx, newFile, existingFile, file)
 
 		//数据层
 		if err := s.FileRepo.Create(ctx, newFile); err != nil {
@@ -97,32 +167,45 @@ func (s *FileService) Upload(ctx context.Context, userID int, file multipart.Fil
 		}
 
 		//更新用户存储空间
-		s.UpdateUserStorage(ctx, uint(userID), fileHeader.Size)
+		committed = true
+		s.CommitQuota(ctx, userID, reservationID, fileHeader.Size)
 
 		return newFile, nil
 	}
 
 	// 生成filename
-	fileName := s.CreateName(fileHeader.Filename, uint(userID))
+	fileName := s.CreateName(detected.Name, uint(userID))
 	filePath := filepath.Join(s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), fileName)
 
+	// 内容扫描
+	scanStatus, scanResult, quarantined := s.scanContent(ctx, file, detected.Name)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+
 	// 保存文件
 	if err := s.Save(file, filePath); err != nil {
 		return nil, fmt.Errorf("保存文件失败: %v", err)
 	}
 
 	// 创建文件记录
-	ext := filepath.Ext(fileHeader.Filename)
-	ext = ext[1:]
 	newFile := &model.File{
 		UserID:   uint(userID),
-		Name:     fileHeader.Filename,
+		Name:     detected.Name,
 		Filename: fileName,
 		Path:     filePath,
 		Size:     fileHeader.Size,
 		Hash:     hash,
 		MimeType: fileHeader.Header.Get("Content-Type"),
-		Ext:      ext,
+		Ext:      detected.Ext,
+		Meta:     meta,
+
+		DetectedMime: detected.MIME,
+		MimeMismatch: detected.Mismatch,
+
+		ScanStatus:  scanStatus,
+		ScanResult:  scanResult,
+		Quarantined: quarantined,
 	}
 	if err := s.FileRepo.Create(ctx, newFile); err != nil {
 		// 回滚
@@ -137,7 +220,8 @@ func (s *FileService) Upload(ctx context.Context, userID int, file multipart.Fil
 	}
 
 	//更新用户存储空间
-	s.UpdateUserStorage(ctx, uint(userID), fileHeader.Size)
+	committed = true
+	s.CommitQuota(ctx, userID, reservationID, fileHeader.Size)
 
 	return newFile, nil
 }
@@ -150,7 +234,7 @@ func (s *FileService) Download(ctx context.Context, userID int, fileID int64) (*
 	}
 	isVIP, err := s.UserRepo.GetVIP(userID)
 	if err != nil {
-		return nil, -1, fmt.Errorf("获取用户信息失败" + err.Error())
+		return nil, -1, fmt.Errorf("获取用户信息失败: %v", err)
 	}
 	LimitedSpeed := s.LimitedSpeed
 	user, _ := s.UserRepo.SelectByUserID(int(userID))
@@ -159,9 +243,12 @@ func (s *FileService) Download(ctx context.Context, userID int, fileID int64) (*
 	}
 
 	//鉴权
-	if file.UserID != uint(userID) {
+	if s.fileAccess(ctx, userID, file) < accessRead {
 		return nil, -1, fmt.Errorf("无权访问此文件")
 	}
+	if file.Quarantined {
+		return nil, -1, ErrFileQuarantined
+	}
 
 	//检查是否存在
 	exist, err := s.minioClient.Exists(ctx, file.Path)
@@ -208,8 +295,8 @@ func (s *FileService) Star(ctx context.Context, userID int, fileID int64) (*mode
 		return nil, fmt.Errorf("已收藏过该文件")
 	}
 
-	//鉴权
-	if file.UserID != uint(userID) {
+	//鉴权，收藏只对文件所有者生效
+	if s.fileAccess(ctx, userID, file) < accessOwner {
 		return nil, fmt.Errorf("无权访问此文件")
 	}
 
@@ -233,8 +320,8 @@ func (s *FileService) Unstar(ctx context.Context, userID int, fileID int64) (*mo
 		return nil, fmt.Errorf("未收藏过该文件")
 	}
 
-	//鉴权
-	if file.UserID != uint(userID) {
+	//鉴权，收藏只对文件所有者生效
+	if s.fileAccess(ctx, userID, file) < accessOwner {
 		return nil, fmt.Errorf("无权访问此文件")
 	}
 
@@ -255,7 +342,7 @@ func (s *FileService) GetFileInfo(ctx context.Context, userID int, fileID int64)
 	}
 
 	//鉴权
-	if file.UserID != uint(userID) {
+	if s.fileAccess(ctx, userID, file) < accessRead {
 		return nil, fmt.Errorf("无权访问此文件")
 	}
 
@@ -269,20 +356,28 @@ func (s *FileService) DeleteFile(ctx context.Context, userID int, fileID int64)
 		return fmt.Errorf("文件不存在: %v", err)
 	}
 
-	//鉴权
-	if file.UserID != uint(userID) {
+	//鉴权，彻底删除只能由文件所有者操作
+	if s.fileAccess(ctx, userID, file) < accessOwner {
 		return fmt.Errorf("无权删除此文件")
 	}
 
-	if err := s.minioClient.Delete(ctx, file.Path); err != nil {
-		return err
-	}
-
 	//删除
 	if err := s.FileRepo.Delete(ctx, uint(fileID)); err != nil {
 		return fmt.Errorf("删除文件失败: %v", err)
 	}
 
+	//秒传与转存的文件共用同一个对象，不再被引用时才删除
+	if file.Path != "" {
+		if count, err := s.FileRepo.CountByPath(ctx, file.Path); err == nil && count == 0 {
+			if err := s.minioClient.Delete(ctx, file.Path); err != nil {
+				zap.S().Warnf("删除文件对象失败: %v", err)
+			}
+		}
+	}
+	if err := s.directShareRepo.DeleteByFileID(ctx, uint(fileID)); err != nil {
+		zap.S().Errorf("删除定向分享失败: %v", err)
+	}
+
 	//更新存储空间
 	s.UpdateUserStorage(ctx, uint(userID), -file.Size)
 
@@ -297,12 +392,12 @@ func (s *FileService) RenameFile(ctx context.Context, userID int, fileID int64,
 	}
 
 	//鉴权
-	if file.UserID != uint(userID) {
+	if s.fileAccess(ctx, userID, file) < accessWrite {
 		return nil, fmt.Errorf("无权重命名此文件")
 	}
 
 	//检查名称是否存在
-	files, _, _ := s.FileRepo.FindByUserID(ctx, uint(userID))
+	files, _, _ := s.FileRepo.FindByUserID(ctx, file.UserID)
 	for _, file := range files {
 		if file.Name == name {
 			return nil, fmt.Errorf("文件名已存在")
@@ -372,29 +467,27 @@ func (s *FileService) Save(file multipart.File, filePath string) error {
 	//=============================================================================================================
 }
 
+// UpdateUserStorage 原子地增减用户已用存储空间
 func (s *FileService) UpdateUserStorage(ctx context.Context, userID uint, sizeDelta int64) {
-	user, err := s.UserRepo.SelectByUserID(int(userID))
-	if err != nil {
-		return
-	}
-
-	user.Storage += sizeDelta
-	if user.Storage <= 0 {
-		user.Storage = 0
-	}
-
-	err = s.UserRepo.UpdateStorage(user.UserID, user.Storage)
-	if err != nil {
-		return
+	if err := s.UserRepo.IncrStorage(int(userID), sizeDelta); err != nil {
+		zap.S().Errorf("更新用户存储空间失败: %v", err)
 	}
 }
 
+var (
+	imageExts = []string{"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg"}
+	videoExts = []string{"mp4", "avi", "mov", "wmv", "flv", "mkv", "webm"}
+	audioExts = []string{"mp3", "wav", "flac", "aac", "ogg", "m4a"}
+)
+
 func (s *FileService) GetMimeType(ctx context.Context, file *model.File) (string, error) {
-	image := []string{"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg"}
-	video := []string{"mp4", "avi", "mov", "wmv", "flv", "mkv", "webm"}
-	audio := []string{"mp3", "wav", "flac", "aac", "ogg", "m4a"}
+	image := imageExts
+	video := videoExts
+	audio := audioExts
 	document := []string{"docx", "doc", "pdf", "xls", "xlsx", "ppt", "pptx"}
-	text := []string{"txt", "html", "js", "xml", "csv", "md", "yaml", "yml"}
+	markdown := []string{"md", "markdown"}
+	table := []string{"csv", "tsv"}
+	text := []string{"txt", "log"}
 	archive := []string{"zip", "rar", "7z", "tar", "gz"}
 	for _, ext := range image {
 		if file.Ext == ext {
@@ -416,11 +509,24 @@ func (s *FileService) GetMimeType(ctx context.Context, file *model.File) (string
 			return "document", nil
 		}
 	}
+	for _, ext := range markdown {
+		if file.Ext == ext {
+			return "markdown", nil
+		}
+	}
+	for _, ext := range table {
+		if file.Ext == ext {
+			return "table", nil
+		}
+	}
 	for _, ext := range text {
 		if file.Ext == ext {
 			return "text", nil
 		}
 	}
+	if preview.IsCodeExt(file.Ext) {
+		return "code", nil
+	}
 	for _, ext := range archive {
 		if file.Ext == ext {
 			return "archive", nil
@@ -429,9 +535,68 @@ func (s *FileService) GetMimeType(ctx context.Context, file *model.File) (string
 	return "other", nil
 }
 
+// ReadPreviewContent 读取用于在线预览的文件内容，超过PreviewMaxSize的部分被截断
+func (s *FileService) ReadPreviewContent(ctx context.Context, file *model.File) ([]byte, bool, error) {
+	stream, err := s.minioClient.GetStream(ctx, file.Path)
+	if err != nil {
+		return nil, false, fmt.Errorf("从minIO获取文件失败: %v", err)
+	}
+	defer stream.Close()
+
+	// 多读一个字节用于判断是否被截断
+	data, err := io.ReadAll(io.LimitReader(stream, s.PreviewMaxSize+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("读取文件失败: %v", err)
+	}
+
+	truncated := int64(len(data)) > s.PreviewMaxSize
+	if truncated {
+		data = data[:s.PreviewMaxSize]
+	}
+
+	return data, truncated, nil
+}
+
 func (s *FileService) SearchFile(userID int, req model.SearchFileRequest) ([]*model.File, int, error) {
+	//构造搜索条件
+	filter := model.FileSearchFilter{Keywords: req.Keywords}
+	switch req.MediaType {
+	case "image":
+		filter.Exts = imageExts
+	case "video":
+		filter.Exts = videoExts
+	case "audio":
+		filter.Exts = audioExts
+	}
+
+	//拍摄时间：年份与区间可同时使用，取交集
+	if req.TakenYear > 0 {
+		from := time.Date(req.TakenYear, 1, 1, 0, 0, 0, 0, time.Local)
+		to := from.AddDate(1, 0, 0)
+		filter.TakenFrom, filter.TakenTo = &from, &to
+	}
+	if req.TakenFrom != "" {
+		from, err := time.ParseInLocation("2006-01-02", req.TakenFrom, time.Local)
+		if err != nil {
+			return nil, 0, fmt.Errorf("taken_from格式应为YYYY-MM-DD")
+		}
+		if filter.TakenFrom == nil || from.After(*filter.TakenFrom) {
+			filter.TakenFrom = &from
+		}
+	}
+	if req.TakenTo != "" {
+		to, err := time.ParseInLocation("2006-01-02", req.TakenTo, time.Local)
+		if err != nil {
+			return nil, 0, fmt.Errorf("taken_to格式应为YYYY-MM-DD")
+		}
+		to = to.AddDate(0, 0, 1) // 包含当天
+		if filter.TakenTo == nil || to.Before(*filter.TakenTo) {
+			filter.TakenTo = &to
+		}
+	}
+
 	//数据层
-	files, total, err := s.FileRepo.SearchFiles(userID, req.Keywords)
+	files, total, err := s.FileRepo.SearchFiles(userID, filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -440,65 +605,132 @@ func (s *FileService) SearchFile(userID int, req model.SearchFileRequest) ([]*mo
 	return files, total, nil
 }
 
-func (s *FileService) InitChunkUpload(userID int, fileName string, fileHash string, chunkTotal int) error {
-	//检查文件是否已存在
-	_, err := s.FileRepo.FindByHash(context.Background(), fileHash)
-	if err == nil {
-		return fmt.Errorf("文件已存在")
+// InitChunkUpload 初始化分片上传，签发upload_id
+// fileHash为客户端声明的SHA-256，仅用于合并后校验，不会据此秒传
+func (s *FileService) InitChunkUpload(ctx context.Context, userID int, fileName string, fileHash string, fileSize int64, chunkTotal int, mimetype string) (*model.ChunkUploadSession, error) {
+	fileHash = strings.ToLower(fileHash)
+	if !isSHA256Hex(fileHash) {
+		return nil, ErrInvalidFileHash
+	}
+	if chunkTotal > maxChunkTotal {
+		return nil, fmt.Errorf("%w: 不能超过%d", ErrTooManyChunks, maxChunkTotal)
 	}
 
-	//初始化redis -> 开始记录当前分片上传状态
-	err = s.FileRepo.InitChunkUploadSession(fileHash, chunkTotal)
+	//上传策略
+	if err := s.policyService.CheckFile(ctx, userID, fileName, fileSize); err != nil {
+		return nil, err
+	}
+
+	uploadID, err := newUploadID()
 	if err != nil {
-		return fmt.Errorf("初始化缓存失败: %v", err)
+		return nil, fmt.Errorf("生成上传ID失败: %v", err)
+	}
+
+	//按声明大小预留存储空间，合并成功后提交
+	if err := s.ReserveQuota(ctx, userID, uploadID, fileSize, chunkReservationTTL); err != nil {
+		return nil, err
 	}
 
 	//创建临时分片文件夹
-	tmpPath := filepath.Join(".", s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), "tmp_uploads/", fileHash) // ./user_:id/tmp_uploads/fileHash/
-	err = os.MkdirAll(tmpPath, 0755)
-	if err != nil {
+	tmpPath := s.chunkTmpPath(userID, uploadID)
+	if err := os.MkdirAll(tmpPath, 0755); err != nil {
+		s.ReleaseQuota(ctx, userID, uploadID)
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+
+	//初始化redis -> 开始记录当前分片上传状态
+	session := &model.ChunkUploadSession{
+		UploadID:   uploadID,
+		UserID:     userID,
+		FileName:   filepath.Base(fileName),
+		FileHash:   fileHash,
+		FileSize:   fileSize,
+		MimeType:   mimetype,
+		ChunkTotal: chunkTotal,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.FileRepo.InitChunkUploadSession(session); err != nil {
 		//回滚
-		s.FileRepo.CleanChunkUploadSession(fileHash)
-		return fmt.Errorf("创建临时目录失败: %v", err)
+		os.RemoveAll(tmpPath)
+		s.ReleaseQuota(ctx, userID, uploadID)
+		return nil, fmt.Errorf("初始化缓存失败: %v", err)
 	}
 
-	return nil
+	return session, nil
 }
 
-func (s *FileService) SaveChunk(fileHash string, userID int, chunkIndex int, chunkData []byte) error {
+// GetChunkUploadSession 获取当前用户的分片上传会话
+func (s *FileService) GetChunkUploadSession(userID int, uploadID string) (*model.ChunkUploadSession, error) {
+	session, err := s.FileRepo.GetChunkUploadSession(uploadID)
+	if err != nil {
+		return nil, ErrChunkSessionNotFound
+	}
+	// 不属于当前用户的会话一律视为不存在
+	if session.UserID != userID {
+		return nil, ErrChunkSessionNotFound
+	}
+	return session, nil
+}
+
+// SaveChunk 校验分片SHA-256后保存到临时文件夹
+func (s *FileService) SaveChunk(userID int, uploadID string, chunkIndex int, chunkHash string, chunkData []byte) (*model.ChunkUploadSession, error) {
 	//验证：判定redis数据是否过期 -> 结束会话
-	err := s.FileRepo.CheckChunkUploadSession(fileHash)
+	session, err := s.GetChunkUploadSession(userID, uploadID)
 	if err != nil {
-		if err.Error() == "redis: nil" {
-			return errors.New("上传会话已过期，请重新上传" + err.Error())
-		}
-		return fmt.Errorf("访问缓存失败: %v", err)
+		return nil, err
+	}
+	if chunkIndex < 0 || chunkIndex >= session.ChunkTotal {
+		return nil, fmt.Errorf("%w[0, %d)", ErrChunkIndexOutOfRange, session.ChunkTotal)
 	}
 
-	//将分片保存在临时文件夹内
-	tmpPath := filepath.Join(s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), "tmp_uploads/", fileHash) // ./user_:id/tmp_uploads/fileHash/
-	chunkPath := filepath.Join("."+tmpPath, fmt.Sprintf("chunk_%d", chunkIndex))
+	//校验分片
+	sum := sha256.Sum256(chunkData)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(chunkHash) {
+		return nil, ErrChunkHashMismatch
+	}
 
-	zap.S().Info(chunkPath)
+	//将分片保存在临时文件夹内
+	chunkPath := filepath.Join(s.chunkTmpPath(userID, uploadID), fmt.Sprintf("chunk_%d", chunkIndex))
 	err = os.WriteFile(chunkPath, chunkData, 0644)
 	if err != nil {
-		return fmt.Errorf("保存分片失败: %v", err)
+		return nil, fmt.Errorf("保存分片失败: %v", err)
 	}
 
 	//更新redis信息
-	err = s.FileRepo.UpdateChunkUploadSession(fileHash, chunkIndex)
+	err = s.FileRepo.UpdateChunkUploadSession(uploadID, chunkIndex)
 	if err != nil {
 		os.Remove(chunkPath)
-		return fmt.Errorf("更新分片状态失败: %v", err)
+		return nil, fmt.Errorf("更新分片状态失败: %v", err)
 	}
+	s.ExtendQuota(context.Background(), userID, uploadID, chunkReservationTTL)
 
-	return nil
+	return session, nil
 }
 
-func (s *FileService) MergeAllChunks(userID int, fileHash string, fileName string, mimetype string) (*model.File, error) {
+// IsChunkUploadFinished 所有分片是否均已上传
+func (s *FileService) IsChunkUploadFinished(uploadID string) (bool, error) {
+	return s.FileRepo.IsChunkUploadFinished(uploadID)
+}
+
+func (s *FileService) MergeAllChunks(userID int, uploadID string) (*model.File, error) {
+	session, err := s.GetChunkUploadSession(userID, uploadID)
+	if err != nil {
+		return &model.File{}, err
+	}
+
+	//同一会话只合并一次
+	locked, err := s.FileRepo.LockChunkMerge(uploadID)
+	if err != nil {
+		return &model.File{}, fmt.Errorf("获取合并锁失败: %v", err)
+	}
+	if !locked {
+		return &model.File{}, ErrChunkMerging
+	}
+	defer s.FileRepo.UnlockChunkMerge(uploadID)
+
 	//在临时文件夹内合并所有分片
 	//分片信息是否完整
-	finished, err := s.FileRepo.IsChunkUploadFinished(fileHash)
+	finished, err := s.FileRepo.IsChunkUploadFinished(uploadID)
 	if err != nil {
 		return &model.File{}, fmt.Errorf("检查上传状态失败: %v", err)
 	}
@@ -507,7 +739,7 @@ func (s *FileService) MergeAllChunks(userID int, fileHash string, fileName strin
 	}
 
 	//获取分片列表
-	chunks, err := s.FileRepo.GetChunks(fileHash)
+	chunks, err := s.FileRepo.GetChunks(uploadID)
 	if err != nil {
 		return &model.File{}, fmt.Errorf("获取分片列表失败: %v", err)
 	}
@@ -516,42 +748,32 @@ func (s *FileService) MergeAllChunks(userID int, fileHash string, fileName strin
 	sort.Ints(chunks)
 
 	//合并分片
-	filePath, fileSize, _, err := s.MergeChunks(userID, fileHash, fileName, chunks)
+	filePath, fileSize, _, err := s.MergeChunks(userID, uploadID, session.FileName, chunks)
 	if err != nil {
 		return &model.File{}, fmt.Errorf("合并分片失败: %v", err)
 	}
+	defer os.Remove(filePath)
 
-	//删除redis数据
-	s.FileRepo.CleanChunkUploadSession(fileHash)
+	//删除redis数据，会话作废后失败需要释放预留
+	s.FileRepo.CleanChunkUploadSession(uploadID)
 
-	//将分片整合为file
-	ext := filepath.Ext(fileName)
-	//zap.S().Info(filePath, ext, mimetype, fileName)
-	ext = ext[1:]
-	file := model.File{
-		UserID:   uint(userID),
-		Name:     fileName,
-		Filename: s.CreateName(fileName, uint(userID)),
-		Path:     filePath,
-		Size:     fileSize,
-		Hash:     fileHash,
-		MimeType: mimetype,
-		Ext:      ext,
+	if fileSize != session.FileSize {
+		s.ReleaseQuota(context.Background(), userID, uploadID)
+		return &model.File{}, fmt.Errorf("%w: 声明大小%d，实际大小%d", ErrFileHashMismatch, session.FileSize, fileSize)
 	}
 
-	//将file信息存储在mysql中
-	err = s.FileRepo.Create(context.Background(), &file)
+	//将合并后的文件存入minIO并创建file记录
+	file, err := s.CreateFromLocal(context.Background(), userID, filePath, session.FileName, session.MimeType, session.FileHash, uploadID)
 	if err != nil {
-		return &model.File{}, fmt.Errorf("上传文件失败: %v", err)
+		s.ReleaseQuota(context.Background(), userID, uploadID)
+		return &model.File{}, fmt.Errorf("上传文件失败: %w", err)
 	}
 
-	//更新file
-	//finalFile, _ := s.FileRepo.FindByHash(context.Background(), fileHash)
-
-	return &file, nil
+	return file, nil
 }
 
-func (s *FileService) MergeChunks(userID int, fileHash string, filename string, chunks []int) (string, int64, string, error) {
+// MergeChunks 在本地合并分片，返回合并后的本地文件路径
+func (s *FileService) MergeChunks(userID int, uploadID string, filename string, chunks []int) (string, int64, string, error) {
 	fileName := s.CreateName(filename, uint(userID))
 	filePath := filepath.Join(s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), fileName)
 	ext := filepath.Ext(filePath)
@@ -569,7 +791,7 @@ func (s *FileService) MergeChunks(userID int, fileHash string, filename string,
 
 	//合并分片
 	var totalSize int64
-	tmpPath := filepath.Join(".", s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), "tmp_uploads/", fileHash) // ./user_:id/tmp_uploads/fileHash/
+	tmpPath := s.chunkTmpPath(userID, uploadID)
 	for _, chunkIndex := range chunks {
 		//寻找当前chunk路径
 		chunkPath := filepath.Join(tmpPath, fmt.Sprintf("chunk_%d", chunkIndex))
@@ -577,6 +799,7 @@ func (s *FileService) MergeChunks(userID int, fileHash string, filename string,
 		//打开当前chunk
 		chunkFile, err := os.Open(chunkPath)
 		if err != nil {
+			os.Remove(filePath)
 			return "", -1, "", errors.New("打开分片失败: %v" + err.Error())
 		}
 
@@ -584,37 +807,296 @@ func (s *FileService) MergeChunks(userID int, fileHash string, filename string,
 		writer, err := io.Copy(finalFile, chunkFile)
 		chunkFile.Close()
 		if err != nil {
+			os.Remove(filePath)
 			return "", -1, "", errors.New("合并分片失败: %v" + err.Error())
 		}
 
 		totalSize += writer
-
-		//删除当前临时chunk
-		os.Remove(chunkPath)
 	}
 
-	//合并后把file存入minIO
 	//删除临时文件夹
-	//获取字节数据
-	finalFileData, err := io.ReadAll(finalFile)
+	os.RemoveAll(tmpPath)
+
+	return filePath, totalSize, ext, nil
+}
+
+// AbortChunkUpload 放弃分片上传，删除会话与已上传的分片
+func (s *FileService) AbortChunkUpload(userID int, uploadID string) error {
+	if _, err := s.GetChunkUploadSession(userID, uploadID); err != nil {
+		return err
+	}
+
+	s.FileRepo.CleanChunkUploadSession(uploadID)
+	s.ReleaseQuota(context.Background(), userID, uploadID)
+	if err := os.RemoveAll(s.chunkTmpPath(userID, uploadID)); err != nil {
+		return fmt.Errorf("删除临时分片失败: %v", err)
+	}
+	return nil
+}
+
+func (s *FileService) chunkTmpPath(userID int, uploadID string) string {
+	return filepath.Join(".", s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), "tmp_uploads", uploadID) // ./user_:id/tmp_uploads/uploadID/
+}
+
+// RunUploadCleaner 定期清理已过期的分片上传会话遗留的临时分片
+func (s *FileService) RunUploadCleaner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.cleanStaleUploads("tmp_uploads", s.FileRepo.ChunkUploadSessionExists)
+	}
+}
+
+// cleanStaleUploads 删除 ./uploadDir/user_*/<sub>/ 下会话已失效的临时数据
+// 最近仍有写入的目录先保留，避免与正在初始化的会话冲突；redis异常时不清理
+func (s *FileService) cleanStaleUploads(sub string, exists func(uploadID string) (bool, error)) {
+	userDirs, err := filepath.Glob(filepath.Join(".", s.uploadDir, "user_*", sub))
 	if err != nil {
-		return "", -1, "", errors.New("读取合并文件失败" + err.Error())
+		return
 	}
 
-	//保存到minIO
-	if err := s.minioClient.Save(context.Background(), filePath, finalFileData, ext); err != nil {
-		return "", -1, "", err
+	for _, dir := range userDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < staleUploadAge {
+				continue
+			}
+			ok, err := exists(entry.Name())
+			if err != nil {
+				zap.S().Errorf("检查上传会话失败，跳过清理: %v", err)
+				return
+			}
+			if ok {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				zap.S().Errorf("清理过期上传失败: %v", err)
+				continue
+			}
+			zap.S().Infof("已清理过期上传: %s", filepath.Join(dir, entry.Name()))
+		}
 	}
+}
 
-	//删除本地文件
-	//os.Remove(filePath)
-	os.Remove(tmpPath)
+func isSHA256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
 
-	return filePath, totalSize, ext, nil
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
 
-func (s *FileService) GetUploadedChunks(fileHash string) ([]int, error) {
-	return s.FileRepo.GetUploadedChunks(fileHash)
+// ReserveQuota 上传开始时按声明大小原子地预留存储空间
+// 已用空间 + 未过期的预留 + 本次大小超过上限时返回ErrQuotaExceeded；VIP用户不限额
+func (s *FileService) ReserveQuota(ctx context.Context, userID int, reservationID string, size int64, ttl time.Duration) error {
+	// 验证单个文件大小
+	if size > s.MaxFileSize {
+		return fmt.Errorf("%w: 单个文件大小不能超过 %.2fGB", ErrFileTooLarge, float64(s.MaxFileSize)/(1024*1024*1024))
+	}
+
+	isVIP, err := s.UserRepo.GetVIP(userID)
+	if err != nil {
+		return fmt.Errorf("获取用户信息失败:%v", err)
+	}
+	limit := s.NormalUserMaxStorage
+	if isVIP {
+		limit = -1
+	}
+
+	unlock, err := s.lockQuota(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	userStorage, err := s.UserRepo.GetStorage(userID)
+	if err != nil {
+		return fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	ok, err := s.quotaCache.Reserve(ctx, userID, reservationID, size, userStorage, limit, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: 非VIP用户总存储空间已超额！", ErrQuotaExceeded)
+	}
+
+	// 每日上传总量，与存储空间一同预留、一同释放
+	if err := s.policyService.ReserveDaily(ctx, userID, reservationID, size); err != nil {
+		if errRelease := s.quotaCache.Release(ctx, userID, reservationID); errRelease != nil {
+			zap.S().Errorf("释放存储空间预留失败: %v", errRelease)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ExtendQuota 上传仍在进行时延长预留
+func (s *FileService) ExtendQuota(ctx context.Context, userID int, reservationID string, ttl time.Duration) {
+	if err := s.quotaCache.Extend(ctx, userID, reservationID, ttl); err != nil {
+		zap.S().Errorf("延长存储空间预留失败: %v", err)
+	}
+}
+
+// CommitQuota 上传成功：按实际大小计入已用空间并释放预留
+func (s *FileService) CommitQuota(ctx context.Context, userID int, reservationID string, size int64) {
+	unlock, err := s.lockQuota(ctx, userID)
+	if err != nil {
+		zap.S().Errorf("提交存储空间预留失败: %v", err)
+		return
+	}
+	defer unlock()
+
+	s.UpdateUserStorage(ctx, uint(userID), size)
+	if err := s.quotaCache.Release(ctx, userID, reservationID); err != nil {
+		zap.S().Errorf("释放存储空间预留失败: %v", err)
+	}
+}
+
+// ReleaseQuota 上传失败或取消时释放预留并退回每日上传量；过期的预留在下次预留时自动清理
+func (s *FileService) ReleaseQuota(ctx context.Context, userID int, reservationID string) {
+	if err := s.quotaCache.Release(ctx, userID, reservationID); err != nil {
+		zap.S().Errorf("释放存储空间预留失败: %v", err)
+	}
+	s.policyService.ReleaseDaily(ctx, userID, reservationID)
+}
+
+// lockQuota 读取已用空间到写入预留、计入已用空间到释放预留之间需要互斥
+func (s *FileService) lockQuota(ctx context.Context, userID int) (func(), error) {
+	for i := 0; i < 50; i++ {
+		ok, err := s.quotaCache.Lock(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("获取存储空间锁失败: %v", err)
+		}
+		if ok {
+			return func() { s.quotaCache.Unlock(ctx, userID) }, nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil, errors.New("存储空间操作繁忙，请稍后重试")
+}
+
+// CreateFromLocal 将已在本地落盘的完整文件存入minIO并创建file记录
+// 分片上传与tus上传完成后共用；内容已存在时直接复用已有对象（秒传）
+// expectedHash非空时校验SHA-256，不一致则不创建记录；成功后提交reservationID对应的存储空间预留
+// 本地文件由调用方负责删除
+func (s *FileService) CreateFromLocal(ctx context.Context, userID int, localPath string, fileName string, mimetype string, expectedHash string, reservationID string) (*model.File, error) {
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开本地文件失败: %v", err)
+	}
+	defer localFile.Close()
+
+	info, err := localFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("读取本地文件信息失败: %v", err)
+	}
+	fileSize := info.Size()
+
+	//计算Hash
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, localFile); err != nil {
+		return nil, fmt.Errorf("计算文件哈希失败: %v", err)
+	}
+	fileHash := hex.EncodeToString(hasher.Sum(nil))
+	if expectedHash != "" && fileHash != strings.ToLower(expectedHash) {
+		return nil, fmt.Errorf("%w: 声明%s，实际%s", ErrFileHashMismatch, expectedHash, fileHash)
+	}
+
+	//根据文件头识别类型
+	if _, err := localFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("读取本地文件失败: %v", err)
+	}
+	detected, err := s.detectType(ctx, localFile, fileName)
+	if err != nil {
+		return nil, err
+	}
+	fileName = detected.Name
+
+	file := &model.File{
+		UserID:   uint(userID),
+		Name:     fileName,
+		Size:     fileSize,
+		Hash:     fileHash,
+		MimeType: mimetype,
+		Ext:      detected.Ext,
+
+		DetectedMime: detected.MIME,
+		MimeMismatch: detected.Mismatch,
+	}
+
+	existingFile, err := s.FileRepo.FindByHash(ctx, fileHash)
+	instant := err == nil && existingFile != nil
+	if instant {
+		//秒传：复用已有对象
+		file.Filename = existingFile.Filename
+		file.Path = existingFile.Path
+		file.Meta = existingFile.Meta
+		s.inheritScan(ctx, file, existingFile, localFile)
+	} else {
+		//解析媒体元数据
+		file.Meta = s.ExtractMeta(localFile, fileSize, fileName)
+
+		//内容扫描
+		if _, err := localFile.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("读取本地文件失败: %v", err)
+		}
+		file.ScanStatus, file.ScanResult, file.Quarantined = s.scanContent(ctx, localFile, fileName)
+
+		//保存到minIO
+		file.Filename = s.CreateName(fileName, uint(userID))
+		file.Path = filepath.Join(s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), file.Filename)
+		if _, err := localFile.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("读取本地文件失败: %v", err)
+		}
+		if err := s.minioClient.SaveStream(ctx, file.Path, localFile, fileSize, filepath.Ext(fileName)); err != nil {
+			return nil, err
+		}
+	}
+
+	//将file信息存储在mysql中
+	if err := s.FileRepo.Create(ctx, file); err != nil {
+		if !instant {
+			// 回滚
+			if errEx := s.minioClient.Delete(ctx, file.Path); errEx != nil {
+				zap.S().Errorf("回滚数据失败: %v", errEx)
+			}
+		}
+		return nil, fmt.Errorf("创建文件记录失败: %v", err)
+	}
+
+	//更新用户存储空间
+	s.CommitQuota(ctx, userID, reservationID, fileSize)
+
+	return file, nil
+}
+
+func (s *FileService) GetUploadedChunks(userID int, uploadID string) (*model.ChunkUploadSession, []int, error) {
+	session, err := s.GetChunkUploadSession(userID, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chunks, err := s.FileRepo.GetUploadedChunks(uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Ints(chunks)
+
+	return session, chunks, nil
 }
 
 func (s *FileService) SoftDelete(userID, fileID int) error {
@@ -624,7 +1106,8 @@ func (s *FileService) SoftDelete(userID, fileID int) error {
 		return fmt.Errorf("获取文件信息失败: %v", err)
 	}
 	//鉴权
-	if uint(userID) != file.UserID {
+	//回收站属于所有者，定向分享的接收者不能删除或恢复
+	if s.fileAccess(context.Background(), userID, file) < accessOwner {
 		return fmt.Errorf("无权访问该文件")
 	}
 
@@ -646,7 +1129,8 @@ func (s *FileService) RecoverFile(userID, fileID int) error {
 		return fmt.Errorf("获取文件信息失败: %v", err)
 	}
 	//鉴权
-	if uint(userID) != file.UserID {
+	//回收站属于所有者，定向分享的接收者不能删除或恢复
+	if s.fileAccess(context.Background(), userID, file) < accessOwner {
 		return fmt.Errorf("无权访问该文件")
 	}
 
@@ -671,3 +1155,410 @@ func (s *FileService) GetBinList(ctx context.Context, userID int) ([]*model.File
 	}
 	return finalFiles, int(total), err
 }
+
+// ExtractMeta 解析媒体元数据，解析失败只记录日志，不影响上传
+func (s *FileService) ExtractMeta(r io.ReaderAt, size int64, fileName string) model.FileMeta {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	meta, err := media.Extract(r, size, ext)
+	if err != nil {
+		zap.S().Warnf("解析媒体元数据失败: %s: %v", fileName, err)
+	}
+	if meta == nil {
+		return model.FileMeta{}
+	}
+
+	return model.FileMeta{
+		Width:       meta.Width,
+		Height:      meta.Height,
+		TakenAt:     meta.TakenAt,
+		CameraMake:  meta.CameraMake,
+		CameraModel: meta.CameraModel,
+		Latitude:    meta.Latitude,
+		Longitude:   meta.Longitude,
+		Duration:    meta.Duration,
+		Bitrate:     meta.Bitrate,
+		Codec:       meta.Codec,
+	}
+}
+
+// StripGPS 去除图片EXIF中的GPS信息
+// 文件内容可能被秒传的其他记录共享，因此写入新的对象而不是覆盖原对象
+func (s *FileService) StripGPS(ctx context.Context, userID int, fileID int64) (*model.File, error) {
+	//获取信息
+	file, err := s.FileRepo.FindByID(ctx, uint(fileID))
+	if err != nil {
+		return nil, fmt.Errorf("文件不存在: %v", err)
+	}
+
+	//鉴权
+	if s.fileAccess(ctx, userID, file) < accessWrite {
+		return nil, fmt.Errorf("无权访问此文件")
+	}
+
+	ext := strings.ToLower(file.Ext)
+	if ext != "jpg" && ext != "jpeg" {
+		return nil, fmt.Errorf("仅支持去除JPEG图片的GPS信息")
+	}
+
+	//读取原文件
+	data, err := s.minioClient.GetBytes(ctx, file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+
+	stripped, ok, err := media.StripGPS(data)
+	if err != nil {
+		return nil, fmt.Errorf("去除GPS信息失败: %v", err)
+	}
+	if !ok {
+		//本身不含GPS信息，只同步元数据
+		if file.Meta.HasGPS() {
+			file.Meta.Latitude, file.Meta.Longitude = nil, nil
+			if err := s.FileRepo.Update(ctx, file); err != nil {
+				return nil, fmt.Errorf("更新文件信息失败: %v", err)
+			}
+		}
+		return file, nil
+	}
+
+	//写入新对象
+	sum := sha256.Sum256(stripped)
+	fileName := s.CreateName(file.Name, file.UserID)
+	filePath := filepath.Join(s.uploadDir, fmt.Sprintf("user_%d", file.UserID), fileName)
+	if err := s.minioClient.Save(ctx, filePath, stripped, filepath.Ext(filePath)); err != nil {
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+
+	//更新文件记录
+	oldPath, oldSize := file.Path, file.Size
+	file.Filename = fileName
+	file.Path = filePath
+	file.Hash = hex.EncodeToString(sum[:])
+	file.Size = int64(len(stripped))
+	file.Meta.Latitude, file.Meta.Longitude = nil, nil
+	if err := s.FileRepo.Update(ctx, file); err != nil {
+		// 回滚
+		if errEx := s.minioClient.Delete(ctx, filePath); errEx != nil {
+			zap.S().Errorf("回滚数据失败: %v", errEx)
+		}
+		return nil, fmt.Errorf("更新文件信息失败: %v", err)
+	}
+
+	//原对象不再被引用时删除
+	if count, err := s.FileRepo.CountByPath(ctx, oldPath); err == nil && count == 0 {
+		if err := s.minioClient.Delete(ctx, oldPath); err != nil {
+			zap.S().Warnf("删除原文件失败: %v", err)
+		}
+	}
+
+	//更新存储空间，计入文件所有者
+	s.UpdateUserStorage(ctx, file.UserID, file.Size-oldSize)
+
+	return file, nil
+}
+
+// scanContent 扫描上传内容，返回扫描状态、命中的签名与是否隔离
+// 扫描服务不可用时放行（状态记为error），避免扫描故障导致无法上传
+func (s *FileService) scanContent(ctx context.Context, r io.Reader, fileName string) (string, string, bool) {
+	if s.scanner == nil {
+		return scanner.StatusSkipped, "", false
+	}
+	if _, ok := s.scanner.(scanner.NoopScanner); ok {
+		return scanner.StatusSkipped, "", false
+	}
+
+	result, err := s.scanner.Scan(ctx, r)
+	if err != nil {
+		zap.S().Errorf("扫描文件失败: %s: %v", fileName, err)
+		return scanner.StatusError, "", false
+	}
+	if result.Infected {
+		zap.S().Warnf("文件未通过扫描，已隔离: %s: %s", fileName, result.Signature)
+		return scanner.StatusInfected, result.Signature, true
+	}
+	return scanner.StatusClean, "", false
+}
+
+// inheritScan 秒传时沿用已有对象的扫描结果；已有对象未经有效扫描时重新扫描
+func (s *FileService) inheritScan(ctx context.Context, file *model.File, existingFile *model.File, content io.ReadSeeker) {
+	switch existingFile.ScanStatus {
+	case scanner.StatusClean, scanner.StatusInfected, scanner.StatusReleased:
+		file.ScanStatus = existingFile.ScanStatus
+		file.ScanResult = existingFile.ScanResult
+		file.Quarantined = existingFile.Quarantined
+		return
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		zap.S().Errorf("读取待扫描文件失败: %v", err)
+		file.ScanStatus = scanner.StatusError
+		return
+	}
+	file.ScanStatus, file.ScanResult, file.Quarantined = s.scanContent(ctx, content, file.Name)
+}
+
+// detectedType 上传文件的类型识别结果
+type detectedType struct {
+	Name     string // 按策略处理后的文件名
+	Ext      string
+	MIME     string
+	Mismatch bool
+}
+
+// detectType 根据文件头识别真实类型，并按MimeMismatchPolicy处理内容与扩展名不一致的文件
+// 识别后r被重置到开头
+func (s *FileService) detectType(ctx context.Context, r io.ReadSeeker, fileName string) (*detectedType, error) {
+	ext := strings.TrimPrefix(filepath.Ext(fileName), ".")
+	result := &detectedType{Name: fileName, Ext: ext}
+
+	detected, err := filetype.Detect(r)
+	if _, errSeek := r.Seek(0, io.SeekStart); errSeek != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", errSeek)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("识别文件类型失败: %v", err)
+	}
+	result.MIME = detected.MIME
+
+	extCategory, _ := s.GetMimeType(ctx, &model.File{Ext: strings.ToLower(ext)})
+	if filetype.Consistent(detected, extCategory) {
+		return result, s.policyService.CheckType(ctx, result.Ext, result.MIME)
+	}
+
+	zap.S().Warnf("文件内容与扩展名不一致: %s: %s", fileName, detected.MIME)
+	switch s.MimeMismatchPolicy {
+	case MimePolicyReject:
+		return nil, fmt.Errorf("%w: 扩展名为%s，实际内容为%s", ErrMimeMismatch, ext, filetype.BaseMIME(detected.MIME))
+	case MimePolicyRename:
+		if detected.Ext != "" {
+			result.Name = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "." + detected.Ext
+			result.Ext = detected.Ext
+			break
+		}
+		// 无法确定真实扩展名时退化为标记
+		result.Mismatch = true
+	default:
+		result.Mismatch = true
+	}
+
+	// 按最终扩展名与识别类型检查上传策略
+	return result, s.policyService.CheckType(ctx, result.Ext, result.MIME)
+}
+
+// PreviewType 预览时使用的类别：按识别出的类型路由，未识别过的历史文件按扩展名
+func (s *FileService) PreviewType(ctx context.Context, file *model.File) (string, error) {
+	extType, err := s.GetMimeType(ctx, file)
+	if err != nil || file.DetectedMime == "" {
+		return extType, err
+	}
+
+	switch filetype.CategoryOf(file.DetectedMime) {
+	case filetype.CategoryText:
+		// html/xml等活动内容与纯文本一样只按文本返回，不内联渲染
+		switch extType {
+		case "markdown", "table", "text", "code":
+			return extType, nil
+		}
+		return "code", nil
+	case filetype.CategoryImage:
+		return "image", nil
+	case filetype.CategoryVideo:
+		return "video", nil
+	case filetype.CategoryAudio:
+		return "audio", nil
+	case filetype.CategoryDocument:
+		return "document", nil
+	case filetype.CategoryArchive:
+		return "archive", nil
+	}
+	return "other", nil
+}
+
+// CreateFolder 新建文件夹，parentID为nil时建在根目录
+// 在别人定向分享（读写）的文件夹中新建时，新文件夹属于该文件夹的所有者
+func (s *FileService) CreateFolder(ctx context.Context, userID int, name string, parentID *uint) (*model.File, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("文件夹名称不合法")
+	}
+	ownerID := uint(userID)
+	if parentID != nil {
+		parent, err := s.accessibleFolder(ctx, userID, *parentID, accessWrite)
+		if err != nil {
+			return nil, err
+		}
+		ownerID = parent.UserID
+	}
+
+	//同一目录下不能重名
+	siblings, err := s.FileRepo.FindChildren(ctx, ownerID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("获取目录失败: %v", err)
+	}
+	for _, sibling := range siblings {
+		if sibling.Name == name {
+			return nil, fmt.Errorf("文件名已存在")
+		}
+	}
+
+	folder := &model.File{
+		UserID:   ownerID,
+		Name:     name,
+		IsDir:    true,
+		ParentID: parentID,
+	}
+	if err := s.FileRepo.Create(ctx, folder); err != nil {
+		return nil, fmt.Errorf("创建文件夹失败: %v", err)
+	}
+	return folder, nil
+}
+
+// ListFolder 列出文件夹下的文件，folderID为nil时列出根目录
+func (s *FileService) ListFolder(ctx context.Context, userID int, folderID *uint) ([]*model.File, error) {
+	if folderID != nil {
+		folder, err := s.accessibleFolder(ctx, userID, *folderID, accessRead)
+		if err != nil {
+			return nil, err
+		}
+		return s.FileRepo.FindChildren(ctx, folder.UserID, folderID)
+	}
+	return s.FileRepo.FindChildren(ctx, uint(userID), nil)
+}
+
+// MoveFile 将文件或文件夹移动到目标文件夹，parentID为nil时移动到根目录
+// 定向分享的接收者只能在同一所有者的、自己有读写权限的文件夹之间移动
+func (s *FileService) MoveFile(ctx context.Context, userID int, fileID uint, parentID *uint) (*model.File, error) {
+	file, err := s.FileRepo.FindByID(ctx, fileID)
+	if err != nil || file.ID == 0 {
+		return nil, fmt.Errorf("文件不存在")
+	}
+	access := s.fileAccess(ctx, userID, file)
+	if access < accessWrite {
+		return nil, fmt.Errorf("无权移动此文件")
+	}
+
+	if parentID != nil {
+		parent, err := s.accessibleFolder(ctx, userID, *parentID, accessWrite)
+		if err != nil {
+			return nil, err
+		}
+		if parent.UserID != file.UserID {
+			return nil, fmt.Errorf("不能移动到其他用户的文件夹中")
+		}
+		//不能移动到自身或自己的子文件夹中
+		if file.IsDir {
+			ancestors, err := fileAncestors(ctx, s.FileRepo, *parentID)
+			if err != nil {
+				return nil, err
+			}
+			for _, ancestor := range ancestors {
+				if ancestor.ID == file.ID {
+					return nil, fmt.Errorf("不能将文件夹移动到自身或其子文件夹中")
+				}
+			}
+		}
+	} else if access < accessOwner {
+		return nil, fmt.Errorf("无权移动到根目录")
+	}
+
+	siblings, err := s.FileRepo.FindChildren(ctx, file.UserID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("获取目录失败: %v", err)
+	}
+	for _, sibling := range siblings {
+		if sibling.ID != file.ID && sibling.Name == file.Name {
+			return nil, fmt.Errorf("目标文件夹中已存在同名文件")
+		}
+	}
+
+	file.ParentID = parentID
+	if err := s.FileRepo.Update(ctx, file); err != nil {
+		return nil, fmt.Errorf("移动文件失败: %v", err)
+	}
+	return file, nil
+}
+
+// maxFolderDepth 向上查找父文件夹的最大层数，防止异常数据造成死循环
+const maxFolderDepth = 64
+
+// fileAncestors 从fileID开始（含自身）逐级向上返回所在的文件夹链，直到根目录
+func fileAncestors(ctx context.Context, fileRepo mysql.FileRepository, fileID uint) ([]*model.File, error) {
+	var chain []*model.File
+	id := fileID
+	for depth := 0; depth < maxFolderDepth; depth++ {
+		file, err := fileRepo.FindByID(ctx, id)
+		if err != nil || file.ID == 0 {
+			return nil, fmt.Errorf("文件不存在")
+		}
+		chain = append(chain, file)
+		if file.ParentID == nil {
+			return chain, nil
+		}
+		id = *file.ParentID
+	}
+	return nil, fmt.Errorf("文件夹层级过深")
+}
+
+// 用户对文件的权限等级，数值越大权限越高
+const (
+	accessNone  = iota
+	accessRead  // 定向分享-只读
+	accessWrite // 定向分享-读写
+	accessOwner // 文件所有者
+)
+
+// fileAccess 用户对文件的权限：文件所有者，或通过定向分享获得的权限
+// 定向分享可以是文件本身，也可以是它所在的任意一层文件夹，取其中最高的权限
+func (s *FileService) fileAccess(ctx context.Context, userID int, file *model.File) int {
+	if file.ID != 0 && file.UserID == uint(userID) {
+		return accessOwner
+	}
+	//被所有者删除到回收站的文件，接收者不能再访问
+	if file.IsDeleted {
+		return accessNone
+	}
+
+	chain, err := fileAncestors(ctx, s.FileRepo, file.ID)
+	if err != nil {
+		return accessNone
+	}
+	fileIDs := make([]uint, 0, len(chain))
+	for _, f := range chain {
+		//所在的文件夹被删除后，通过它获得的权限不再生效
+		if f.UserID != file.UserID || f.IsDeleted {
+			break
+		}
+		fileIDs = append(fileIDs, f.ID)
+	}
+
+	grants, err := s.directShareRepo.GetRecipientGrants(ctx, uint(userID), fileIDs)
+	if err != nil {
+		zap.S().Errorf("获取定向分享失败: %v", err)
+		return accessNone
+	}
+	access := accessNone
+	for _, grant := range grants {
+		switch grant.Permission {
+		case model.PermissionWrite:
+			access = max(access, accessWrite)
+		case model.PermissionRead:
+			access = max(access, accessRead)
+		}
+	}
+	return access
+}
+
+// accessibleFolder 获取文件夹并检查用户至少拥有need权限
+func (s *FileService) accessibleFolder(ctx context.Context, userID int, folderID uint, need int) (*model.File, error) {
+	folder, err := s.FileRepo.FindByID(ctx, folderID)
+	if err != nil || folder.ID == 0 || folder.IsDeleted {
+		return nil, fmt.Errorf("文件夹不存在")
+	}
+	if s.fileAccess(ctx, userID, folder) < need {
+		return nil, fmt.Errorf("无权访问此文件夹")
+	}
+	if !folder.IsDir {
+		return nil, fmt.Errorf("目标不是文件夹")
+	}
+	return folder, nil
+}
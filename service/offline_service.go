@@ -0,0 +1,505 @@
+package services
+
+import (
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util/ssrf"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 离线下载相关错误，handler据此返回对应的状态码
+var (
+	ErrOfflineTaskNotFound = errors.New("离线下载任务不存在")
+	ErrOfflineTaskState    = errors.New("任务当前状态不支持该操作")
+	ErrOfflineQueueFull    = errors.New("离线下载队列已满，请稍后重试")
+)
+
+const (
+	offlineQueueSize      = 1024
+	offlineReserveStep    = 64 << 20 // 未知长度时每次追加预留64MB
+	offlineReservationTTL = 27 * time.Hour
+	offlineTmpDir         = "offline_downloads"
+)
+
+type OfflineService struct {
+	taskRepo    mysql.OfflineTaskRepository
+	fileService *FileService
+	client      *http.Client
+	uploadDir   string
+	workers     int
+
+	queue   chan uint
+	mu      sync.Mutex
+	running map[uint]*offlineJob // 正在下载的任务
+}
+
+type offlineJob struct {
+	cancel     context.CancelFunc
+	canceled   atomic.Bool
+	downloaded atomic.Int64
+}
+
+func NewOfflineService(taskRepo mysql.OfflineTaskRepository, fileService *FileService, uploadDir string, workers int, timeoutMinutes int) *OfflineService {
+	if workers <= 0 {
+		workers = 3 // 未配置时默认3个并发
+	}
+	if timeoutMinutes <= 0 {
+		timeoutMinutes = 60 // 未配置时默认单个任务60分钟超时
+	}
+	return &OfflineService{
+		taskRepo:    taskRepo,
+		fileService: fileService,
+		client:      ssrf.NewClient(time.Duration(timeoutMinutes) * time.Minute),
+		uploadDir:   uploadDir,
+		workers:     workers,
+		queue:       make(chan uint, offlineQueueSize),
+		running:     make(map[uint]*offlineJob),
+	}
+}
+
+// Start 启动下载协程，并恢复服务重启前未完成的任务
+func (s *OfflineService) Start() {
+	for i := 0; i < s.workers; i++ {
+		go s.worker()
+	}
+
+	tasks, err := s.taskRepo.GetTasksByStatus(context.Background(), model.OfflineStatusPending, model.OfflineStatusRunning)
+	if err != nil {
+		zap.S().Errorf("恢复离线下载任务失败: %v", err)
+		return
+	}
+	for _, task := range tasks {
+		if task.Status == model.OfflineStatusRunning {
+			// 下载到一半的任务从头开始
+			task.Status = model.OfflineStatusPending
+			task.Downloaded = 0
+			if err := s.taskRepo.UpdateTask(context.Background(), task); err != nil {
+				zap.S().Errorf("恢复离线下载任务失败: %v", err)
+				continue
+			}
+		}
+		select {
+		case s.queue <- task.ID:
+		default:
+			s.fail(context.Background(), task, ErrOfflineQueueFull)
+		}
+	}
+}
+
+// CreateTask 提交离线下载任务
+func (s *OfflineService) CreateTask(ctx context.Context, userID int, req *model.CreateOfflineTaskRequest) (*model.OfflineTask, error) {
+	if _, err := ssrf.CheckURL(ctx, req.URL); err != nil {
+		return nil, err
+	}
+
+	// 提前检查扩展名与文件数量，大小与类型在下载过程中检查
+	fileName := filepath.Base(strings.TrimSpace(req.FileName))
+	if fileName == "." || fileName == "/" {
+		fileName = ""
+	}
+	if err := s.fileService.policyService.CheckFile(ctx, userID, fileName, 0); err != nil {
+		// 未指定文件名时扩展名在拿到响应后检查
+		if fileName != "" || !errors.Is(err, ErrPolicyExtDenied) {
+			return nil, err
+		}
+	}
+
+	task := &model.OfflineTask{
+		UserID:   uint(userID),
+		URL:      req.URL,
+		FileName: fileName,
+		Status:   model.OfflineStatusPending,
+		Size:     -1,
+	}
+	if err := s.taskRepo.CreateTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("创建任务失败: %v", err)
+	}
+
+	if err := s.enqueue(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// GetTasks 当前用户的离线下载任务，下载中的任务返回实时进度
+func (s *OfflineService) GetTasks(ctx context.Context, userID int) ([]*model.OfflineTask, int64, error) {
+	tasks, total, err := s.taskRepo.GetUserTasks(ctx, uint(userID))
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取任务列表失败: %v", err)
+	}
+	for _, task := range tasks {
+		s.fillProgress(task)
+	}
+	return tasks, total, nil
+}
+
+func (s *OfflineService) GetTask(ctx context.Context, userID int, taskID uint) (*model.OfflineTask, error) {
+	task, err := s.taskRepo.GetTaskByID(ctx, taskID)
+	if err != nil || task.UserID != uint(userID) {
+		return nil, ErrOfflineTaskNotFound
+	}
+	s.fillProgress(task)
+	return task, nil
+}
+
+// CancelTask 取消排队中或下载中的任务
+func (s *OfflineService) CancelTask(ctx context.Context, userID int, taskID uint) (*model.OfflineTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, err := s.taskRepo.GetTaskByID(ctx, taskID)
+	if err != nil || task.UserID != uint(userID) {
+		return nil, ErrOfflineTaskNotFound
+	}
+
+	switch task.Status {
+	case model.OfflineStatusPending:
+		// 出队时会跳过非pending的任务
+		now := time.Now()
+		task.Status = model.OfflineStatusCanceled
+		task.FinishedAt = &now
+		if err := s.taskRepo.UpdateTask(ctx, task); err != nil {
+			return nil, fmt.Errorf("取消任务失败: %v", err)
+		}
+	case model.OfflineStatusRunning:
+		// 下载协程收到取消后更新状态、释放预留并删除临时文件
+		if job, ok := s.running[task.ID]; ok {
+			job.canceled.Store(true)
+			job.cancel()
+		}
+		task.Status = model.OfflineStatusCanceled
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrOfflineTaskState, task.Status)
+	}
+
+	return task, nil
+}
+
+// RetryTask 重新下载失败或已取消的任务
+func (s *OfflineService) RetryTask(ctx context.Context, userID int, taskID uint) (*model.OfflineTask, error) {
+	s.mu.Lock()
+	task, err := s.taskRepo.GetTaskByID(ctx, taskID)
+	if err != nil || task.UserID != uint(userID) {
+		s.mu.Unlock()
+		return nil, ErrOfflineTaskNotFound
+	}
+	if task.Status != model.OfflineStatusFailed && task.Status != model.OfflineStatusCanceled {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrOfflineTaskState, task.Status)
+	}
+	if _, ok := s.running[task.ID]; ok {
+		// 取消后下载协程尚未退出
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: 任务正在取消", ErrOfflineTaskState)
+	}
+
+	task.Status = model.OfflineStatusPending
+	task.Size = -1
+	task.Downloaded = 0
+	task.Error = ""
+	task.FinishedAt = nil
+	if err := s.taskRepo.UpdateTask(ctx, task); err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("重试任务失败: %v", err)
+	}
+	s.mu.Unlock()
+
+	if err := s.enqueue(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *OfflineService) enqueue(ctx context.Context, task *model.OfflineTask) error {
+	select {
+	case s.queue <- task.ID:
+		return nil
+	default:
+		s.fail(ctx, task, ErrOfflineQueueFull)
+		return ErrOfflineQueueFull
+	}
+}
+
+func (s *OfflineService) fillProgress(task *model.OfflineTask) {
+	if task.Status != model.OfflineStatusRunning {
+		return
+	}
+	s.mu.Lock()
+	job, ok := s.running[task.ID]
+	s.mu.Unlock()
+	if ok {
+		task.Downloaded = job.downloaded.Load()
+	}
+}
+
+func (s *OfflineService) worker() {
+	for taskID := range s.queue {
+		s.run(taskID)
+	}
+}
+
+func (s *OfflineService) run(taskID uint) {
+	// 领取任务：与取消互斥，已取消的任务直接跳过
+	s.mu.Lock()
+	task, err := s.taskRepo.GetTaskByID(context.Background(), taskID)
+	if err != nil || task.Status != model.OfflineStatusPending {
+		s.mu.Unlock()
+		return
+	}
+	task.Status = model.OfflineStatusRunning
+	if err := s.taskRepo.UpdateTask(context.Background(), task); err != nil {
+		s.mu.Unlock()
+		zap.S().Errorf("更新离线下载任务失败: %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &offlineJob{cancel: cancel}
+	s.running[task.ID] = job
+	s.mu.Unlock()
+
+	defer func() {
+		cancel()
+		s.mu.Lock()
+		delete(s.running, task.ID)
+		s.mu.Unlock()
+	}()
+
+	zap.S().Infof("开始离线下载: task=%d url=%s", task.ID, task.URL)
+	file, err := s.download(ctx, task, job)
+	task.Downloaded = job.downloaded.Load()
+	if err != nil {
+		if job.canceled.Load() {
+			now := time.Now()
+			task.Status = model.OfflineStatusCanceled
+			task.FinishedAt = &now
+			if errUpdate := s.taskRepo.UpdateTask(context.Background(), task); errUpdate != nil {
+				zap.S().Errorf("更新离线下载任务失败: %v", errUpdate)
+			}
+			zap.S().Infof("离线下载已取消: task=%d", task.ID)
+			return
+		}
+		zap.S().Errorf("离线下载失败: task=%d: %v", task.ID, err)
+		s.fail(context.Background(), task, err)
+		return
+	}
+
+	now := time.Now()
+	task.Status = model.OfflineStatusSuccess
+	task.FileID = &file.ID
+	task.FileName = file.Name
+	task.FinishedAt = &now
+	if err := s.taskRepo.UpdateTask(context.Background(), task); err != nil {
+		zap.S().Errorf("更新离线下载任务失败: %v", err)
+	}
+	zap.S().Infof("离线下载完成: task=%d file=%d", task.ID, file.ID)
+}
+
+// download 流式写入临时文件，边下载边预留存储空间，完成后与分片/tus上传共用file创建逻辑（含哈希与秒传）
+func (s *OfflineService) download(ctx context.Context, task *model.OfflineTask, job *offlineJob) (*model.File, error) {
+	userID := int(task.UserID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, task.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("链接格式错误: %v", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("下载超时")
+		}
+		return nil, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("远程服务器返回 %s", resp.Status)
+	}
+
+	// 文件名：用户指定 > Content-Disposition > 链接路径
+	fileName := task.FileName
+	if fileName == "" {
+		fileName = remoteFileName(resp)
+		if err := s.fileService.policyService.CheckFile(ctx, userID, fileName, 0); err != nil {
+			return nil, err
+		}
+		task.FileName = fileName
+	}
+
+	// 已知长度时一次预留，否则边下载边追加
+	size := resp.ContentLength
+	task.Size = size
+	if err := s.taskRepo.UpdateTask(ctx, task); err != nil {
+		zap.S().Errorf("更新离线下载任务失败: %v", err)
+	}
+	if size >= 0 {
+		if err := s.fileService.policyService.CheckFile(ctx, userID, fileName, size); err != nil {
+			return nil, err
+		}
+	}
+	// 无Content-Length时按实际写入量检查角色大小上限
+	checkSize, err := s.fileService.policyService.MaxFileSizeChecker(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	reservationID, err := newUploadID()
+	if err != nil {
+		return nil, fmt.Errorf("生成预留ID失败: %v", err)
+	}
+	reserved := size
+	if reserved < 0 {
+		reserved = min(offlineReserveStep, s.fileService.MaxFileSize)
+	}
+	if err := s.fileService.ReserveQuota(ctx, userID, reservationID, reserved, offlineReservationTTL); err != nil {
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			s.fileService.ReleaseQuota(context.Background(), userID, reservationID)
+		}
+	}()
+
+	tmpPath := filepath.Join(".", s.uploadDir, fmt.Sprintf("user_%d", task.UserID), offlineTmpDir, strconv.FormatUint(uint64(task.ID), 10))
+	if err := os.MkdirAll(filepath.Dir(tmpPath), 0755); err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.Remove(tmpPath)
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			written += int64(n)
+			if size >= 0 && written > size {
+				tmpFile.Close()
+				return nil, fmt.Errorf("实际数据超出Content-Length")
+			}
+			if written > s.fileService.MaxFileSize {
+				tmpFile.Close()
+				return nil, fmt.Errorf("%w: 单个文件大小不能超过 %.2fGB", ErrFileTooLarge, float64(s.fileService.MaxFileSize)/(1024*1024*1024))
+			}
+			if err := checkSize(written); err != nil {
+				tmpFile.Close()
+				return nil, err
+			}
+			if written > reserved {
+				// 追加预留，同一预留ID覆盖原大小
+				reserved = min(reserved+offlineReserveStep, s.fileService.MaxFileSize)
+				if err := s.fileService.ReserveQuota(ctx, userID, reservationID, reserved, offlineReservationTTL); err != nil {
+					tmpFile.Close()
+					return nil, err
+				}
+			}
+			if _, err := tmpFile.Write(buf[:n]); err != nil {
+				tmpFile.Close()
+				return nil, fmt.Errorf("写入临时文件失败: %v", err)
+			}
+			job.downloaded.Store(written)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			tmpFile.Close()
+			if errors.Is(readErr, context.DeadlineExceeded) || errors.Is(readErr, os.ErrDeadlineExceeded) {
+				return nil, fmt.Errorf("下载超时")
+			}
+			return nil, fmt.Errorf("下载中断: %v", readErr)
+		}
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	if size >= 0 && written != size {
+		return nil, fmt.Errorf("下载不完整: %d/%d", written, size)
+	}
+	task.Size = written
+
+	// 下载期间策略可能变更，按实际大小再完整检查一次
+	if err := s.fileService.policyService.CheckFile(ctx, userID, fileName, written); err != nil {
+		return nil, err
+	}
+
+	// 按实际大小修正预留与当天上传量
+	if written != reserved {
+		if err := s.fileService.ReserveQuota(ctx, userID, reservationID, written, offlineReservationTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := s.fileService.CreateFromLocal(ctx, userID, tmpPath, fileName, resp.Header.Get("Content-Type"), "", reservationID)
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+	return file, nil
+}
+
+func (s *OfflineService) fail(ctx context.Context, task *model.OfflineTask, cause error) {
+	now := time.Now()
+	msg := cause.Error()
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	task.Status = model.OfflineStatusFailed
+	task.Error = msg
+	task.FinishedAt = &now
+	if err := s.taskRepo.UpdateTask(ctx, task); err != nil {
+		zap.S().Errorf("更新离线下载任务失败: %v", err)
+	}
+}
+
+// RunTmpCleaner 定期清理异常退出时遗留的临时文件
+func (s *OfflineService) RunTmpCleaner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.fileService.cleanStaleUploads(offlineTmpDir, func(name string) (bool, error) {
+			taskID, err := strconv.ParseUint(name, 10, 64)
+			if err != nil {
+				return false, nil
+			}
+			s.mu.Lock()
+			_, ok := s.running[uint(taskID)]
+			s.mu.Unlock()
+			return ok, nil
+		})
+	}
+}
+
+// remoteFileName 从Content-Disposition或最终请求的链接路径推断文件名
+func remoteFileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(params["filename"]); params["filename"] != "" && name != "." && name != "/" {
+			return name
+		}
+	}
+
+	u := resp.Request.URL
+	if p, err := url.PathUnescape(u.EscapedPath()); err == nil {
+		if name := path.Base(p); name != "." && name != "/" && name != "" {
+			return name
+		}
+	}
+	return "download"
+}
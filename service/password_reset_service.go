@@ -0,0 +1,126 @@
+package services
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrResetCodeWrong    = errors.New("验证码错误或已过期")
+	ErrResetTokenInvalid = errors.New("重置令牌无效或已过期，请重新获取验证码")
+)
+
+// ResetTokenTTL 验证码校验通过后签发的重置令牌有效期
+const ResetTokenTTL = 15 * time.Minute
+
+type PasswordResetService struct {
+	userRepo            mysql.UserRepository
+	resetCache          cache.PasswordResetCache
+	verificationService *VerificationService
+	sessionService      *SessionService
+}
+
+func NewPasswordResetService(userRepo mysql.UserRepository, resetCache cache.PasswordResetCache, verificationService *VerificationService, sessionService *SessionService) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:            userRepo,
+		resetCache:          resetCache,
+		verificationService: verificationService,
+		sessionService:      sessionService,
+	}
+}
+
+// RequestCode 向邮箱发送找回密码验证码
+// 无论邮箱是否注册都返回相同结果，邮件在后台发送，避免通过响应内容或耗时判断邮箱是否注册
+func (s *PasswordResetService) RequestCode(email string) error {
+	if !strings.Contains(email, "@") {
+		return errors.New("邮箱格式不正确")
+	}
+
+	go func() {
+		// 未注册的邮箱可能命中空值缓存，返回UserID为0的用户
+		if user, err := s.userRepo.SelectByEmail(email); err != nil || user.UserID == 0 {
+			zap.S().Infof("找回密码: 邮箱未注册 %s", email)
+			return
+		}
+		if err := s.verificationService.SendCode(context.Background(), email, VerificationPurposeResetPassword); err != nil {
+			zap.S().Errorf("发送找回密码验证码失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// VerifyCode 校验找回密码验证码，通过后签发一次性的重置令牌
+func (s *PasswordResetService) VerifyCode(ctx context.Context, email, code string) (string, int, error) {
+	ok, err := s.verificationService.VerifyCode(ctx, email, VerificationPurposeResetPassword, code)
+	if !ok {
+		// 验证码不存在与验证码错误返回相同的错误，避免判断邮箱是否注册
+		zap.S().Infof("找回密码验证码校验失败: %v", err)
+		return "", 0, ErrResetCodeWrong
+	}
+
+	user, err := s.userRepo.SelectByEmail(email)
+	if err != nil || user.UserID == 0 {
+		return "", 0, ErrResetCodeWrong
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return "", 0, fmt.Errorf("生成重置令牌失败: %v", err)
+	}
+	if err := s.resetCache.SaveResetToken(ctx, hashToken(token), user.UserID, ResetTokenTTL); err != nil {
+		return "", 0, err
+	}
+	return token, int(ResetTokenTTL.Seconds()), nil
+}
+
+// Reset 使用重置令牌设置新密码，令牌只能使用一次
+// 修改密码会使用户令牌版本加一，之前签发的访问令牌全部失效，同时撤销全部登录会话
+func (s *PasswordResetService) Reset(ctx context.Context, resetToken, newPassword string) error {
+	// 先检查密码格式，格式错误时不消耗重置令牌
+	if err := checkPasswordFormat(newPassword); err != nil {
+		return err
+	}
+
+	userID, ok, err := s.resetCache.ConsumeResetToken(ctx, hashToken(resetToken))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrResetTokenInvalid
+	}
+
+	hashedPassword, err := util.HashPassword(newPassword)
+	if err != nil {
+		return errors.New("password hash failed" + err.Error())
+	}
+	if err := s.userRepo.UpdatePassword(userID, hashedPassword); err != nil {
+		return fmt.Errorf("重置密码失败: %v", err)
+	}
+
+	if _, err := s.sessionService.RevokeAll(ctx, userID, "", model.SessionRevokeReset); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		zap.S().Errorf("获取用户信息失败: %v", err)
+		return nil
+	}
+	go func() {
+		text := fmt.Sprintf("您的账号 %s 的密码已于 %s 通过邮箱验证码重置，所有设备已退出登录。如非本人操作，请立即找回密码并联系管理员。",
+			user.Username, time.Now().Format("2006-01-02 15:04:05"))
+		if err := s.verificationService.SendNotification(user.Email, "ClaranCloudDisk密码已重置", text); err != nil {
+			zap.S().Errorf("发送密码重置通知失败: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PhotoService struct {
+	fileRepo     mysql.FileRepository
+	albumRepo    mysql.AlbumRepository
+	shareService *ShareService
+}
+
+func NewPhotoService(fileRepo mysql.FileRepository, albumRepo mysql.AlbumRepository, shareService *ShareService) *PhotoService {
+	return &PhotoService{
+		fileRepo:     fileRepo,
+		albumRepo:    albumRepo,
+		shareService: shareService,
+	}
+}
+
+// Timeline 按拍摄时间（EXIF，缺失时使用上传时间）将图片按月或按年分组，新的在前
+func (s *PhotoService) Timeline(ctx context.Context, userID int, groupBy string, year int) ([]*model.TimelineBucket, int, error) {
+	if groupBy == "" {
+		groupBy = "month"
+	}
+	if groupBy != "month" && groupBy != "year" {
+		return nil, 0, errors.New("group_by只能为month或year")
+	}
+
+	files, _, err := s.fileRepo.FindByUserID(ctx, uint(userID))
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取文件列表失败: %v", err)
+	}
+
+	//筛选图片
+	var photos []*model.File
+	for _, file := range files {
+		if file.IsDeleted || file.IsDir || !hasExt(imageExts, file.Ext) {
+			continue
+		}
+		if year > 0 && PhotoTime(file).Year() != year {
+			continue
+		}
+		photos = append(photos, file)
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		return PhotoTime(photos[i]).After(PhotoTime(photos[j]))
+	})
+
+	//分组（已排序，相同分组一定相邻）
+	var buckets []*model.TimelineBucket
+	var current *model.TimelineBucket
+	for _, photo := range photos {
+		t := PhotoTime(photo)
+		key := t.Format("2006")
+		if groupBy == "month" {
+			key = t.Format("2006-01")
+		}
+
+		if current == nil || current.Key != key {
+			current = &model.TimelineBucket{Key: key, Year: t.Year()}
+			if groupBy == "month" {
+				current.Month = int(t.Month())
+			}
+			buckets = append(buckets, current)
+		}
+		current.Files = append(current.Files, photo)
+		current.Count++
+	}
+
+	return buckets, len(photos), nil
+}
+
+func (s *PhotoService) CreateAlbum(ctx context.Context, userID uint, req *model.CreateAlbumRequest) (*model.Album, error) {
+	//验证文件
+	if err := s.checkFiles(ctx, userID, req.FileIDs); err != nil {
+		return nil, err
+	}
+
+	album := &model.Album{
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := s.albumRepo.CreateAlbum(ctx, album); err != nil {
+		return nil, fmt.Errorf("创建相册失败: %v", err)
+	}
+
+	if len(req.FileIDs) > 0 {
+		if err := s.albumRepo.AddFiles(ctx, album.ID, req.FileIDs); err != nil {
+			return nil, fmt.Errorf("添加照片失败: %v", err)
+		}
+	}
+
+	return album, nil
+}
+
+func (s *PhotoService) GetAlbumList(ctx context.Context, userID uint) ([]*model.AlbumResponse, int64, error) {
+	albums, total, err := s.albumRepo.GetUserAlbums(ctx, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取相册列表失败: %v", err)
+	}
+
+	responses := make([]*model.AlbumResponse, 0, len(albums))
+	for _, album := range albums {
+		count, err := s.albumRepo.CountAlbumFiles(ctx, album.ID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("获取相册文件数失败: %v", err)
+		}
+		responses = append(responses, &model.AlbumResponse{
+			Album:     album,
+			Cover:     s.cover(ctx, album, nil),
+			FileCount: int(count),
+		})
+	}
+
+	return responses, total, nil
+}
+
+func (s *PhotoService) GetAlbum(ctx context.Context, userID uint, albumID uint) (*model.AlbumResponse, error) {
+	album, err := s.getOwnAlbum(ctx, userID, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.albumRepo.GetAlbumFiles(ctx, album.ID)
+	if err != nil {
+		return nil, fmt.Errorf("获取相册文件失败: %v", err)
+	}
+
+	return &model.AlbumResponse{
+		Album:     album,
+		Cover:     s.cover(ctx, album, files),
+		Files:     files,
+		FileCount: len(files),
+	}, nil
+}
+
+func (s *PhotoService) UpdateAlbum(ctx context.Context, userID uint, albumID uint, req *model.UpdateAlbumRequest) (*model.Album, error) {
+	album, err := s.getOwnAlbum(ctx, userID, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		album.Name = *req.Name
+	}
+	if req.Description != nil {
+		album.Description = *req.Description
+	}
+	if req.CoverFileID != nil {
+		if *req.CoverFileID == 0 {
+			album.CoverFileID = nil
+		} else {
+			//封面必须是相册中的照片
+			files, err := s.albumRepo.GetAlbumFiles(ctx, album.ID)
+			if err != nil {
+				return nil, fmt.Errorf("获取相册文件失败: %v", err)
+			}
+			found := false
+			for _, file := range files {
+				if file.ID == *req.CoverFileID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.New("封面必须是相册中的照片")
+			}
+			album.CoverFileID = req.CoverFileID
+		}
+	}
+
+	if err := s.albumRepo.UpdateAlbum(ctx, album); err != nil {
+		return nil, fmt.Errorf("更新相册失败: %v", err)
+	}
+
+	return album, nil
+}
+
+func (s *PhotoService) DeleteAlbum(ctx context.Context, userID uint, albumID uint) error {
+	album, err := s.getOwnAlbum(ctx, userID, albumID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.albumRepo.DeleteAlbum(ctx, album.ID); err != nil {
+		return fmt.Errorf("删除相册失败: %v", err)
+	}
+	return nil
+}
+
+func (s *PhotoService) AddFiles(ctx context.Context, userID uint, albumID uint, fileIDs []uint) error {
+	album, err := s.getOwnAlbum(ctx, userID, albumID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFiles(ctx, userID, fileIDs); err != nil {
+		return err
+	}
+
+	if err := s.albumRepo.AddFiles(ctx, album.ID, fileIDs); err != nil {
+		return fmt.Errorf("添加照片失败: %v", err)
+	}
+	return nil
+}
+
+func (s *PhotoService) RemoveFiles(ctx context.Context, userID uint, albumID uint, fileIDs []uint) error {
+	album, err := s.getOwnAlbum(ctx, userID, albumID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.albumRepo.RemoveFiles(ctx, album.ID, fileIDs); err != nil {
+		return fmt.Errorf("移除照片失败: %v", err)
+	}
+
+	//封面被移除时清空封面
+	if album.CoverFileID != nil && hasID(fileIDs, *album.CoverFileID) {
+		album.CoverFileID = nil
+		if err := s.albumRepo.UpdateAlbum(ctx, album); err != nil {
+			return fmt.Errorf("更新相册失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// ShareAlbum 通过分享模块分享相册中当前的照片
+func (s *PhotoService) ShareAlbum(ctx context.Context, userID uint, albumID uint, req *model.ShareAlbumRequest) (*model.Share, error) {
+	album, err := s.getOwnAlbum(ctx, userID, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.albumRepo.GetAlbumFiles(ctx, album.ID)
+	if err != nil {
+		return nil, fmt.Errorf("获取相册文件失败: %v", err)
+	}
+	fileIDs := make([]uint, 0, len(files))
+	for _, file := range files {
+		fileIDs = append(fileIDs, file.ID)
+	}
+
+	return s.shareService.CreateAlbumShare(ctx, userID, album.ID, fileIDs, req)
+}
+
+// ShareURL 相册分享的公开链接
+func (s *PhotoService) ShareURL(origin, uniqueID string) string {
+	return s.shareService.ShareURL(origin, uniqueID)
+}
+
+func (s *PhotoService) getOwnAlbum(ctx context.Context, userID uint, albumID uint) (*model.Album, error) {
+	album, err := s.albumRepo.GetAlbumByID(ctx, albumID)
+	if err != nil {
+		return nil, fmt.Errorf("相册不存在: %v", err)
+	}
+
+	//鉴权
+	if album.UserID != userID {
+		return nil, errors.New("无权访问此相册")
+	}
+	return album, nil
+}
+
+// checkFiles 相册只能加入自己的图片和视频
+func (s *PhotoService) checkFiles(ctx context.Context, userID uint, fileIDs []uint) error {
+	for _, fileID := range fileIDs {
+		file, err := s.fileRepo.FindByID(ctx, fileID)
+		if err != nil {
+			return fmt.Errorf("文件不存在: %d", fileID)
+		}
+		if file.UserID != userID {
+			return fmt.Errorf("无权访问文件: %d", fileID)
+		}
+		if file.IsDeleted {
+			return fmt.Errorf("文件已在回收站中: %d", fileID)
+		}
+		if !hasExt(imageExts, file.Ext) && !hasExt(videoExts, file.Ext) {
+			return fmt.Errorf("相册只能加入图片或视频: %s", file.Name)
+		}
+	}
+	return nil
+}
+
+// cover 返回相册封面，未设置时使用最新加入的照片
+func (s *PhotoService) cover(ctx context.Context, album *model.Album, files []*model.File) *model.File {
+	if album.CoverFileID != nil {
+		if file, err := s.fileRepo.FindByID(ctx, *album.CoverFileID); err == nil && !file.IsDeleted {
+			return file
+		}
+	}
+	if files == nil {
+		files, _ = s.albumRepo.GetAlbumFiles(ctx, album.ID)
+	}
+	for _, file := range files {
+		if hasExt(imageExts, file.Ext) {
+			return file
+		}
+	}
+	return nil
+}
+
+// PhotoTime 照片的时间线时间：优先EXIF拍摄时间，其次上传时间
+func PhotoTime(file *model.File) time.Time {
+	if file.Meta.TakenAt != nil {
+		return file.Meta.TakenAt.Local()
+	}
+	return file.CreatedAt.Local()
+}
+
+func hasExt(exts []string, ext string) bool {
+	ext = strings.ToLower(ext)
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func hasID(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"ClaranCloudDisk/config"
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util/jwt_util"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或已过期，请重新登录")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用过，为安全起见该会话已被撤销，请重新登录")
+	ErrSessionNotFound     = errors.New("会话不存在或已撤销")
+)
+
+// accessTokenExtraHours 访问令牌在jwt.exp_time_hours基础上额外的有效期 (小时)
+const accessTokenExtraHours = 1
+
+type SessionService struct {
+	sessionRepo  mysql.SessionRepository
+	sessionCache cache.SessionCache
+	userRepo     mysql.UserRepository
+	auditRepo    mysql.AuditRepository
+	jwtUtil      jwt_util.Util
+	sessionTTL   time.Duration // 会话有效期，每次刷新顺延
+	accessTTL    time.Duration // 访问令牌有效期，撤销标记至少保留这么久
+}
+
+func NewSessionService(sessionRepo mysql.SessionRepository, sessionCache cache.SessionCache, userRepo mysql.UserRepository, auditRepo mysql.AuditRepository, jwtUtil jwt_util.Util, jwtExpireHours int, cfg config.SecurityConfig) *SessionService {
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 168
+	}
+	return &SessionService{
+		sessionRepo:  sessionRepo,
+		sessionCache: sessionCache,
+		userRepo:     userRepo,
+		auditRepo:    auditRepo,
+		jwtUtil:      jwtUtil,
+		sessionTTL:   time.Duration(cfg.SessionTTL) * time.Hour,
+		accessTTL:    time.Duration(jwtExpireHours+accessTokenExtraHours) * time.Hour,
+	}
+}
+
+// Create 登录成功后创建会话，签发访问令牌与第一个刷新令牌
+func (s *SessionService) Create(ctx context.Context, user *model.User, userAgent, clientIP string) (string, string, error) {
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return "", "", fmt.Errorf("生成会话ID失败: %v", err)
+	}
+	refreshToken, err := randomHex(32)
+	if err != nil {
+		return "", "", fmt.Errorf("生成刷新令牌失败: %v", err)
+	}
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	now := time.Now()
+	session := &model.Session{
+		SessionID:    sessionID,
+		UserID:       user.UserID,
+		Device:       deviceFromUserAgent(userAgent),
+		UserAgent:    userAgent,
+		IP:           clientIP,
+		LastIP:       clientIP,
+		TokenVersion: user.TokenVersion,
+		LastUsedAt:   now,
+		ExpiresAt:    now.Add(s.sessionTTL),
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session, hashToken(refreshToken)); err != nil {
+		return "", "", fmt.Errorf("创建会话失败: %v", err)
+	}
+
+	token, err := s.jwtUtil.GenerateToken(user.UserID, user.Username, user.Role, sessionID, user.TokenVersion, accessTokenExtraHours)
+	if err != nil {
+		return "", "", fmt.Errorf("签发访问令牌失败: %v", err)
+	}
+	return token, refreshToken, nil
+}
+
+// Refresh 用刷新令牌换取新的访问令牌与刷新令牌，旧的刷新令牌随即作废
+// 已作废的刷新令牌再次出现说明令牌可能已泄露，撤销整个会话，攻击者与用户都需要重新登录
+func (s *SessionService) Refresh(ctx context.Context, refreshToken, clientIP string) (string, string, error) {
+	stored, err := s.sessionRepo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", ErrRefreshTokenInvalid
+		}
+		return "", "", fmt.Errorf("查询刷新令牌失败: %v", err)
+	}
+	session, err := s.sessionRepo.GetSession(ctx, stored.SessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", ErrRefreshTokenInvalid
+		}
+		return "", "", fmt.Errorf("查询会话失败: %v", err)
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return "", "", ErrRefreshTokenInvalid
+	}
+	if stored.UsedAt != nil {
+		return "", "", s.revokeReused(ctx, session, clientIP)
+	}
+
+	user, err := s.userRepo.SelectByUserID(session.UserID)
+	if err != nil {
+		return "", "", fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if user.IsBanned {
+		return "", "", ErrUserBanned
+	}
+	if user.TokenVersion != session.TokenVersion {
+		//会话创建后用户被封禁过、修改过角色或密码，需要重新登录
+		return "", "", ErrRefreshTokenInvalid
+	}
+
+	newRefreshToken, err := randomHex(32)
+	if err != nil {
+		return "", "", fmt.Errorf("生成刷新令牌失败: %v", err)
+	}
+	rotated, err := s.sessionRepo.RotateRefreshToken(ctx, stored.ID, session.SessionID, hashToken(newRefreshToken), clientIP, time.Now().Add(s.sessionTTL))
+	if err != nil {
+		return "", "", fmt.Errorf("轮换刷新令牌失败: %v", err)
+	}
+	if !rotated {
+		//同一个刷新令牌被并发使用，同样按重放处理
+		return "", "", s.revokeReused(ctx, session, clientIP)
+	}
+
+	//用户名与角色以数据库为准
+	token, err := s.jwtUtil.GenerateToken(user.UserID, user.Username, user.Role, session.SessionID, user.TokenVersion, accessTokenExtraHours)
+	if err != nil {
+		return "", "", fmt.Errorf("签发访问令牌失败: %v", err)
+	}
+	return token, newRefreshToken, nil
+}
+
+// List 列出用户的有效会话，currentSessionID对应的会话标记为当前会话
+func (s *SessionService) List(ctx context.Context, userID int, currentSessionID string) ([]model.Session, error) {
+	sessions, err := s.sessionRepo.ListActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话列表失败: %v", err)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke 撤销用户的一个会话
+func (s *SessionService) Revoke(ctx context.Context, userID int, sessionID, reason string) error {
+	ok, err := s.sessionRepo.RevokeSession(ctx, userID, sessionID, reason)
+	if err != nil {
+		return fmt.Errorf("撤销会话失败: %v", err)
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if err := s.sessionCache.MarkRevoked(ctx, []string{sessionID}, s.accessTTL); err != nil {
+		return fmt.Errorf("撤销会话失败: %v", err)
+	}
+	return nil
+}
+
+// RevokeAll 撤销用户除exceptSessionID外的全部会话，返回撤销的数量
+func (s *SessionService) RevokeAll(ctx context.Context, userID int, exceptSessionID, reason string) (int, error) {
+	sessionIDs, err := s.sessionRepo.RevokeUserSessions(ctx, userID, exceptSessionID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("撤销会话失败: %v", err)
+	}
+	if err := s.sessionCache.MarkRevoked(ctx, sessionIDs, s.accessTTL); err != nil {
+		return 0, fmt.Errorf("撤销会话失败: %v", err)
+	}
+	return len(sessionIDs), nil
+}
+
+// revokeReused 刷新令牌被重放时撤销整个会话并记录审计
+func (s *SessionService) revokeReused(ctx context.Context, session *model.Session, clientIP string) error {
+	if err := s.Revoke(ctx, session.UserID, session.SessionID, model.SessionRevokeReuse); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+
+	log := &model.AuditLog{
+		Type:   model.AuditRefreshTokenReuse,
+		UserID: uint(session.UserID),
+		IP:     clientIP,
+		Target: session.SessionID,
+		Detail: fmt.Sprintf("已轮换的刷新令牌被再次使用，撤销会话(%s, 登录IP %s)", session.Device, session.IP),
+	}
+	if err := s.auditRepo.CreateAuditLog(ctx, log); err != nil {
+		zap.S().Errorf("写入审计记录失败: %v", err)
+	}
+	return ErrRefreshTokenReused
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken 刷新令牌与重置令牌只保存SHA-256摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// deviceFromUserAgent 由User-Agent粗略识别浏览器与系统，如 "Chrome on Windows"
+func deviceFromUserAgent(userAgent string) string {
+	browsers := []struct{ key, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp/", "okhttp"},
+	}
+	systems := []struct{ key, name string }{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.key) {
+			browser = b.name
+			break
+		}
+	}
+	for _, sys := range systems {
+		if strings.Contains(userAgent, sys.key) {
+			system = sys.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "未知设备"
+	}
+}
@@ -1,63 +1,196 @@
 package services
 
 import (
+	"ClaranCloudDisk/config"
+	"ClaranCloudDisk/dao/cache"
 	"ClaranCloudDisk/dao/mysql"
 	"ClaranCloudDisk/model"
 	"ClaranCloudDisk/util"
+	"ClaranCloudDisk/util/jwt_util"
+	"ClaranCloudDisk/util/watermark"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/rand"
-	"os"
+	"io"
+	"net/url"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 分享访问相关错误，handler据此返回对应的状态码
+var (
+	ErrSharePasswordWrong = errors.New("分享密码错误")
+	ErrShareTokenInvalid  = errors.New("分享访问令牌无效或已过期")
+	ErrShareRateLimited   = errors.New("下载过于频繁，请登录或稍后再试")
+	ErrShareDownloadLimit = errors.New("分享下载次数已达上限，已失效")
+	ErrShareExpired       = errors.New("分享已过期")
+	ErrShareDisabled      = errors.New("分享已被分享者停用")
+	ErrShortCodeTaken     = errors.New("短码已被占用")
+	ErrShortCodeInvalid   = errors.New("短码只能包含字母、数字、-和_，长度4-32")
+	ErrQRCodeNeedPassword = errors.New("在二维码中附带密码需要提供正确的分享密码")
+	ErrShareWatermarked   = errors.New("该分享开启了水印，不能转存")
+	ErrSharePreviewType   = errors.New("该文件类型不支持在线预览")
+
+	ErrSharePasswordRequired = errors.New("该分享需要密码")
+	ErrShareLocked           = errors.New("尝试次数过多，已暂时锁定")
 )
 
+const (
+	shareFailWindow = 24 * time.Hour // 密码错误次数的统计周期
+	shareEnumWindow = time.Hour      // 访问不存在分享次数的统计周期
+	shareLockoutMax = 24 * time.Hour // 最长锁定时长
+
+	shortCodeLength   = 6    // 随机生成的短码长度
+	qrCodeSizeMin     = 128  // 二维码最小边长（像素）
+	qrCodeSizeMax     = 1024 // 二维码最大边长（像素）
+	qrCodeSizeDefault = 256  // 二维码默认边长（像素）
+)
+
+var shortCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{4,32}$`)
+
 type ShareService struct {
-	shareRepo    mysql.ShareRepository
-	fileRepo     mysql.FileRepository
-	userRepo     mysql.UserRepository
-	uploadDir    string
-	LimitedSpeed int64
+	shareRepo      mysql.ShareRepository
+	fileRepo       mysql.FileRepository
+	userRepo       mysql.UserRepository
+	fileService    *FileService
+	policyService  *UploadPolicyService
+	rateLimitCache cache.RateLimitCache
+	statsCache     cache.ShareStatsCache
+	guardCache     cache.ShareGuardCache
+	auditRepo      mysql.AuditRepository
+	notifier       *VerificationService
+	jwtUtil        jwt_util.Util
+	uploadDir      string
+	LimitedSpeed   int64
+
+	AnonLimitedSpeed    int64         // 未登录用户下载限速（字节/秒）
+	AnonRateLimit       int64         // 未登录用户每个IP每分钟最多下载次数
+	AccessTokenTTL      time.Duration // 分享访问令牌有效期
+	PasswordMaxAttempts int64         // 每个IP连续输错密码的次数上限，每个分享为其4倍
+	LockoutBase         time.Duration // 首次锁定时长，之后每次失败翻倍
+	EnumMaxMisses       int64         // 每个IP访问不存在分享的次数上限
+	PublicBaseURL       string        // 分享链接使用的公开地址，为空时使用请求的地址
 }
 
-func NewShareService(shareRepo mysql.ShareRepository, fileRepo mysql.FileRepository, userRepo mysql.UserRepository, uploadDir string, LimitedSpeed int64) *ShareService {
-	return &ShareService{shareRepo, fileRepo, userRepo, uploadDir, LimitedSpeed}
+func NewShareService(shareRepo mysql.ShareRepository, fileRepo mysql.FileRepository, userRepo mysql.UserRepository, fileService *FileService, policyService *UploadPolicyService, rateLimitCache cache.RateLimitCache, statsCache cache.ShareStatsCache, guardCache cache.ShareGuardCache, auditRepo mysql.AuditRepository, notifier *VerificationService, jwtUtil jwt_util.Util, uploadDir string, LimitedSpeed int64, cfg config.ShareConfig) *ShareService {
+	if cfg.AnonLimitedSpeed <= 0 {
+		cfg.AnonLimitedSpeed = 2
+	}
+	if cfg.AnonRateLimit <= 0 {
+		cfg.AnonRateLimit = 10
+	}
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = 30
+	}
+	if cfg.PasswordMaxAttempts <= 0 {
+		cfg.PasswordMaxAttempts = 5
+	}
+	if cfg.LockoutBase <= 0 {
+		cfg.LockoutBase = 60
+	}
+	if cfg.EnumMaxMisses <= 0 {
+		cfg.EnumMaxMisses = 20
+	}
+	return &ShareService{
+		shareRepo:           shareRepo,
+		fileRepo:            fileRepo,
+		userRepo:            userRepo,
+		fileService:         fileService,
+		policyService:       policyService,
+		rateLimitCache:      rateLimitCache,
+		statsCache:          statsCache,
+		guardCache:          guardCache,
+		auditRepo:           auditRepo,
+		notifier:            notifier,
+		jwtUtil:             jwtUtil,
+		uploadDir:           uploadDir,
+		LimitedSpeed:        LimitedSpeed * 1048576,         // MB -> 字节
+		AnonLimitedSpeed:    cfg.AnonLimitedSpeed * 1048576, // MB -> 字节
+		AnonRateLimit:       cfg.AnonRateLimit,
+		AccessTokenTTL:      time.Duration(cfg.AccessTokenTTL) * time.Minute,
+		PasswordMaxAttempts: cfg.PasswordMaxAttempts,
+		LockoutBase:         time.Duration(cfg.LockoutBase) * time.Second,
+		EnumMaxMisses:       cfg.EnumMaxMisses,
+		PublicBaseURL:       strings.TrimRight(cfg.PublicBaseURL, "/"),
+	}
 }
 
 func (s *ShareService) CreateShare(ctx context.Context, userID uint, req *model.CreateShareRequest) (*model.Share, error) {
+	return s.createShare(ctx, userID, req, nil)
+}
+
+// CreateAlbumShare 将相册当前的照片创建为一个分享
+func (s *ShareService) CreateAlbumShare(ctx context.Context, userID uint, albumID uint, fileIDs []uint, req *model.ShareAlbumRequest) (*model.Share, error) {
+	if len(fileIDs) == 0 {
+		return nil, errors.New("相册中没有可分享的文件")
+	}
+
+	return s.createShare(ctx, userID, &model.CreateShareRequest{
+		FileIDs:    fileIDs,
+		Password:   req.Password,
+		ExpireDays: req.ExpireDays,
+		Watermark:  req.Watermark,
+	}, &albumID)
+}
+
+func (s *ShareService) createShare(ctx context.Context, userID uint, req *model.CreateShareRequest, albumID *uint) (*model.Share, error) {
 	// 验证文件所有权
 	for _, fileID := range req.FileIDs {
 		file, err := s.fileRepo.FindByID(ctx, fileID)
-		if err != nil {
+		if err != nil || file.ID == 0 || file.IsDeleted {
 			return nil, fmt.Errorf("文件不存在: %d", fileID)
 		}
 
 		if file.UserID != userID {
 			return nil, fmt.Errorf("无权分享文件: %d", fileID)
 		}
+		if file.Quarantined {
+			return nil, fmt.Errorf("%w: %d", ErrFileQuarantined, fileID)
+		}
 	}
 
 	// 生成唯一ID
-	uniqueID := s.GenerateUniqueID()
-
-	hashedPassword, err := util.HashPassword(req.Password)
+	uniqueID, err := s.GenerateUniqueID()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("生成分享ID失败: %v", err)
+	}
+
+	// 未设置密码时不保存哈希，访问时无需密码
+	var hashedPassword string
+	if req.Password != "" {
+		hashed, err := util.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword = hashed
 	}
 
 	user, err := s.userRepo.SelectByUserID(int(userID))
+	if err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
 
 	// 创建分享记录
 	share := &model.Share{
-		UniqueID:  uniqueID,
-		UserID:    userID,
-		Password:  hashedPassword,
-		Exp:       time.Duration(req.ExpireDays) * 24 * time.Hour,
-		CreatedAt: time.Now(),
-		User:      user,
+		UniqueID:     uniqueID,
+		UserID:       userID,
+		Password:     hashedPassword,
+		ExpireAt:     shareExpireAt(req.ExpireDays),
+		AlbumID:      albumID,
+		CreatedAt:    time.Now(),
+		User:         user,
+		MaxDownloads: req.MaxDownloads,
+		Watermark:    req.Watermark,
 	}
 
 	// 数据库
@@ -68,10 +201,116 @@ func (s *ShareService) CreateShare(ctx context.Context, userID uint, req *model.
 	return share, nil
 }
 
+// shareExpireAt 有效天数换算为过期时间，0表示永久有效
+func shareExpireAt(expireDays int) *time.Time {
+	if expireDays <= 0 {
+		return nil
+	}
+	expireAt := time.Now().Add(time.Duration(expireDays) * 24 * time.Hour)
+	return &expireAt
+}
+
 func (s *ShareService) GetMyShares(ctx context.Context, userID uint) ([]*model.Share, int64, error) {
 	return s.shareRepo.GetUserShares(ctx, userID)
 }
 
+// GetExpiredShares 用户已过期的分享，可以延长有效期或删除
+func (s *ShareService) GetExpiredShares(ctx context.Context, userID uint) ([]*model.Share, int64, error) {
+	return s.shareRepo.GetExpiredShares(ctx, userID)
+}
+
+// UpdateShare 修改分享的有效期、密码、文件和下载上限，未提供的字段保持不变
+// 修改密码后旧密码签发的分享访问令牌随之失效
+func (s *ShareService) UpdateShare(ctx context.Context, userID uint, uniqueID string, req *model.UpdateShareRequest) (*model.Share, error) {
+	share, err := s.ownShare(ctx, userID, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ExpireDays != nil {
+		share.ExpireAt = shareExpireAt(*req.ExpireDays)
+	}
+
+	passwordChanged := false
+	if req.Password != nil {
+		share.Password = ""
+		if *req.Password != "" {
+			hashed, err := util.HashPassword(*req.Password)
+			if err != nil {
+				return nil, err
+			}
+			share.Password = hashed
+		}
+		passwordChanged = true
+	}
+
+	if req.MaxDownloads != nil {
+		share.MaxDownloads = *req.MaxDownloads
+	}
+	if req.Watermark != nil {
+		share.Watermark = *req.Watermark
+	}
+
+	var fileIDs []uint
+	if req.FileIDs != nil {
+		fileIDs = *req.FileIDs
+		for _, fileID := range fileIDs {
+			file, err := s.fileRepo.FindByID(ctx, fileID)
+			if err != nil || file.ID == 0 || file.IsDeleted {
+				return nil, fmt.Errorf("文件不存在: %d", fileID)
+			}
+			if file.UserID != userID {
+				return nil, fmt.Errorf("无权分享文件: %d", fileID)
+			}
+			if file.Quarantined {
+				return nil, fmt.Errorf("%w: %d", ErrFileQuarantined, fileID)
+			}
+		}
+	}
+
+	share.UpdatedAt = time.Now()
+	if err := s.shareRepo.UpdateShare(ctx, share, fileIDs); err != nil {
+		return nil, fmt.Errorf("修改分享失败: %v", err)
+	}
+
+	if passwordChanged {
+		if err := s.guardCache.Reset(ctx, "share:"+share.UniqueID); err != nil {
+			zap.S().Errorf("解除分享锁定失败: %v", err)
+		}
+	}
+	if err := s.shareRepo.LoadFiles(ctx, share); err != nil {
+		return nil, fmt.Errorf("获取分享文件失败: %v", err)
+	}
+	return share, nil
+}
+
+// SetShareDisabled 临时停用或重新启用分享，停用期间任何人都无法访问
+func (s *ShareService) SetShareDisabled(ctx context.Context, userID uint, uniqueID string, disabled bool) (*model.Share, error) {
+	share, err := s.ownShare(ctx, userID, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	share.Disabled = disabled
+	share.UpdatedAt = time.Now()
+	if err := s.shareRepo.UpdateShare(ctx, share, nil); err != nil {
+		return nil, fmt.Errorf("修改分享失败: %v", err)
+	}
+	return share, nil
+}
+
+// ownShare 获取分享并验证是否为分享者本人
+func (s *ShareService) ownShare(ctx context.Context, userID uint, uniqueID string) (*model.Share, error) {
+	share, err := s.shareRepo.GetShareByUniqueID(ctx, uniqueID)
+	if err != nil {
+		return nil, errors.New("分享不存在" + err.Error())
+	}
+	if share.UserID != userID {
+		return nil, errors.New("无权修改此分享")
+	}
+	return share, nil
+}
+
 func (s *ShareService) DeleteShare(ctx context.Context, userID uint, uniqueID string) error {
 	// 获取分享信息
 	share, err := s.shareRepo.GetShareByUniqueID(ctx, uniqueID)
@@ -85,25 +324,27 @@ func (s *ShareService) DeleteShare(ctx context.Context, userID uint, uniqueID st
 	}
 
 	// 删除分享
-	return s.shareRepo.DeleteShare(ctx, share.ID)
+	if err := s.shareRepo.DeleteShare(ctx, share.ID); err != nil {
+		return err
+	}
+	if err := s.statsCache.Clear(ctx, share.ID); err != nil {
+		zap.S().Errorf("清理分享统计失败: %v", err)
+	}
+	return nil
 }
 
-func (s *ShareService) GetShareInfo(ctx context.Context, uniqueID, password string) (*model.ShareInfoResponse, error) {
-	// 获取分享信息
-	share, err := s.shareRepo.GetShareByUniqueID(ctx, uniqueID)
+// GetShareInfo 查看分享，记一次查看，userID为0表示未登录的访问者
+func (s *ShareService) GetShareInfo(ctx context.Context, uniqueID, password, accessToken string, userID int, clientIP string) (*model.ShareInfoResponse, error) {
+	// 获取分享信息并验证
+	share, err := s.loadShare(ctx, uniqueID, password, accessToken, clientIP)
 	if err != nil {
-		return nil, errors.New("分享不存在 err：" + err.Error() + "uniqueID: " + uniqueID)
-	}
-
-	// 检查是否过期
-	if s.shareRepo.IsExp(share) {
-		return nil, errors.New("分享已过期")
+		return nil, err
 	}
 
-	// 验证密码
-	if share.Password == "" || util.CheckPassword(password, share.Password) {
-		return &model.ShareInfoResponse{}, errors.New("password is incorrect")
+	if err := s.statsCache.View(ctx, share.ID, visitorKey(userID, clientIP)); err != nil {
+		zap.S().Errorf("记录分享查看失败: %v", err)
 	}
+	s.logAccess(ctx, share.ID, nil, model.ShareActionView, userID, clientIP)
 
 	// 提取文件信息
 	var files []*model.File
@@ -111,7 +352,7 @@ func (s *ShareService) GetShareInfo(ctx context.Context, uniqueID, password stri
 
 	for _, shareFile := range share.ShareFiles {
 		file, err := s.fileRepo.FindByID(ctx, shareFile.FileID)
-		if err != nil {
+		if err != nil || file.ID == 0 || file.IsDeleted {
 			continue
 		}
 
@@ -119,20 +360,18 @@ func (s *ShareService) GetShareInfo(ctx context.Context, uniqueID, password stri
 		totalSize += file.Size
 	}
 
-	// 5. 计算过期时间
-	var expireTime *time.Time
-	if share.Exp > 0 {
-		expTime := share.CreatedAt.Add(share.Exp)
-		expireTime = &expTime
-	}
+	// 未登录也可以查看分享信息，分享者只返回公开信息
+	publicShare := *share
+	publicShare.User = publicUser(share.User)
 
 	// 6. 返回响应
 	response := &model.ShareInfoResponse{
-		Share:        share,
+		Share:        &publicShare,
 		Files:        files,
+		PreviewTypes: s.previewTypes(ctx, files),
 		NeedPassword: share.Password != "",
 		IsExpired:    false,
-		ExpireTime:   expireTime,
+		ExpireTime:   share.ExpireAt,
 		TotalSize:    totalSize,
 		FileCount:    len(files),
 	}
@@ -140,109 +379,947 @@ func (s *ShareService) GetShareInfo(ctx context.Context, uniqueID, password stri
 	return response, nil
 }
 
-func (s *ShareService) DownloadSpecFile(ctx context.Context, uniqueID, password string, fileID uint, userID int) (*model.File, int64, error) {
+// DownloadSpecFile 检查下载权限并返回文件、限速与水印文字，userID为0表示未登录的访问者
+// 未登录的访问者按IP限制下载次数并使用单独的限速；分享未开启水印或文件不能加水印时水印文字为空
+func (s *ShareService) DownloadSpecFile(ctx context.Context, uniqueID, password, accessToken string, fileID uint, userID int, clientIP string) (*model.File, int64, string, error) {
 	// 验证分享访问权限
+	share, err := s.loadShare(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		return nil, -1, "", err
+	}
+
+	file, limitedSpeed, err := s.accessFile(ctx, share, fileID, userID, clientIP, model.ShareActionDownload)
+	if err != nil {
+		return nil, -1, "", err
+	}
+	return file, limitedSpeed, s.watermarkFor(ctx, share, file, userID, clientIP), nil
+}
+
+// accessFile 检查文件是否可以下载，计入下载次数并返回限速
+func (s *ShareService) accessFile(ctx context.Context, share *model.Share, fileID uint, userID int, clientIP string, action string) (*model.File, int64, error) {
+
+	// 检查文件是否属于此分享（分享的文件本身或分享文件夹下的文件）
+	targetFile, _, err := s.resolveShareFile(ctx, share, fileID)
+	if err != nil {
+		return nil, -1, err
+	}
+	if targetFile.IsDir {
+		return nil, -1, errors.New("文件夹不能直接下载")
+	}
+	if targetFile.Quarantined {
+		return nil, -1, ErrFileQuarantined
+	}
+
+	//获取信息
+	LimitedSpeed := s.LimitedSpeed
+	if userID == 0 {
+		//未登录：按IP限制下载次数，使用单独的限速
+		allowed, err := s.rateLimitCache.Allow(ctx, "share:anon_download:"+clientIP, s.AnonRateLimit, time.Minute)
+		if err != nil {
+			return nil, -1, err
+		}
+		if !allowed {
+			return nil, -1, ErrShareRateLimited
+		}
+		LimitedSpeed = s.AnonLimitedSpeed
+	} else {
+		isVIP, err := s.userRepo.GetVIP(userID)
+		if err != nil {
+			return nil, -1, fmt.Errorf("获取用户信息失败: %v", err)
+		}
+		user, _ := s.userRepo.SelectByUserID(int(userID))
+		if isVIP || user.Role == "admin" {
+			LimitedSpeed = 0
+		}
+	}
+
+	// 计入下载次数，达到上限后分享失效
+	ok, err := s.statsCache.Download(ctx, share.ID, share.DownloadCount, share.MaxDownloads, visitorKey(userID, clientIP))
+	if err != nil {
+		return nil, -1, err
+	}
+	if !ok {
+		return nil, -1, ErrShareDownloadLimit
+	}
+	s.logAccess(ctx, share.ID, &targetFile.ID, action, userID, clientIP)
+
+	return targetFile, LimitedSpeed, nil
+}
+
+func (s *ShareService) GetShareTree(ctx context.Context, uniqueID, password, accessToken string, folderID uint, clientIP string) (*model.ShareTreeResponse, error) {
+	share, err := s.loadShare(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	if folderID == 0 {
+		var files []*model.File
+		for _, shareFile := range share.ShareFiles {
+			file, err := s.fileRepo.FindByID(ctx, shareFile.FileID)
+			if err != nil || file.ID == 0 || file.IsDeleted {
+				continue
+			}
+			files = append(files, file)
+		}
+		return &model.ShareTreeResponse{Path: []*model.File{}, Files: files, PreviewTypes: s.previewTypes(ctx, files)}, nil
+	}
+
+	folder, path, err := s.resolveShareFile(ctx, share, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !folder.IsDir {
+		return nil, errors.New("目标不是文件夹")
+	}
+
+	files, err := s.fileRepo.FindChildren(ctx, share.UserID, &folder.ID)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件夹内容失败: %v", err)
+	}
+
+	return &model.ShareTreeResponse{Folder: folder, Path: path, Files: files, PreviewTypes: s.previewTypes(ctx, files)}, nil
+}
+
+// PreviewSpecFile 检查预览权限并返回文件、预览类别、限速与水印文字，userID为0表示未登录的访问者
+// 文本、Markdown、表格与源码只返回预览上限以内的内容，不计入下载次数；
+// 图片、音视频与文档需要返回整个文件，与下载一样计入下载次数、未登录时按IP限制次数并限速
+func (s *ShareService) PreviewSpecFile(ctx context.Context, uniqueID, password, accessToken string, fileID uint, userID int, clientIP string) (*model.File, string, int64, string, error) {
+	share, err := s.loadShare(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		return nil, "", -1, "", err
+	}
+
+	file, _, err := s.resolveShareFile(ctx, share, fileID)
+	if err != nil {
+		return nil, "", -1, "", err
+	}
+	if file.IsDir {
+		return nil, "", -1, "", errors.New("文件夹不能预览")
+	}
+	if file.Quarantined {
+		return nil, "", -1, "", ErrFileQuarantined
+	}
+
+	fileType, err := s.fileService.PreviewType(ctx, file)
+	if err != nil {
+		return nil, "", -1, "", fmt.Errorf("获取文件类型失败: %v", err)
+	}
+	switch fileType {
+	case "text", "markdown", "table", "code", "other":
+		return file, fileType, 0, "", nil
+	case "image", "video", "audio", "document":
+		file, limitedSpeed, err := s.accessFile(ctx, share, fileID, userID, clientIP, model.ShareActionPreview)
+		if err != nil {
+			return nil, "", -1, "", err
+		}
+		return file, fileType, limitedSpeed, s.watermarkFor(ctx, share, file, userID, clientIP), nil
+	}
+	return nil, "", -1, "", ErrSharePreviewType
+}
+
+// watermarkFor 开启水印的分享中图片与PDF的水印文字：登录用户为用户名，未登录为IP，加上当前时间
+// 内置字体只支持拉丁字符，用户名包含其他字符时使用用户ID
+func (s *ShareService) watermarkFor(ctx context.Context, share *model.Share, file *model.File, userID int, clientIP string) string {
+	if !share.Watermark || watermark.KindOf(file.DetectedMime, file.Ext) == "" {
+		return ""
+	}
+
+	viewer := clientIP
+	if userID != 0 {
+		viewer = fmt.Sprintf("user#%d", userID)
+		if user, err := s.userRepo.SelectByUserID(userID); err == nil && isPrintableASCII(user.Username) {
+			viewer = user.Username
+		}
+	}
+	return viewer + " " + time.Now().Format("2006-01-02 15:04")
+}
+
+func isPrintableASCII(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// WatermarkFile 读取文件并加上水印，原文件保持不变，返回新的内容、MIME类型与文件名
+// 图片除jpeg外都转为png，文件名的扩展名随之改变
+func (s *ShareService) WatermarkFile(ctx context.Context, file *model.File, text string) ([]byte, string, string, error) {
+	if file.Size > watermark.MaxSize {
+		return nil, "", "", watermark.ErrTooLarge
+	}
+
+	stream, err := s.fileService.minioClient.GetStream(ctx, file.Path)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("从minIO获取文件失败: %v", err)
+	}
+	defer stream.Close()
+	data, err := io.ReadAll(io.LimitReader(stream, watermark.MaxSize+1))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("读取文件失败: %v", err)
+	}
+	if len(data) > watermark.MaxSize {
+		return nil, "", "", watermark.ErrTooLarge
+	}
+
+	name := file.Name
+	switch watermark.KindOf(file.DetectedMime, file.Ext) {
+	case watermark.KindImage:
+		out, contentType, err := watermark.Image(data, text)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if contentType == "image/png" && !strings.EqualFold(filepath.Ext(name), ".png") {
+			name = strings.TrimSuffix(name, filepath.Ext(name)) + ".png"
+		}
+		return out, contentType, name, nil
+	case watermark.KindPDF:
+		out, err := watermark.PDF(data, text)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return out, "application/pdf", name, nil
+	}
+	return nil, "", "", watermark.ErrUnsupported
+}
+
+// previewTypes 可以在线预览的文件及其预览类别，文件夹、被隔离的文件与压缩包等不返回
+func (s *ShareService) previewTypes(ctx context.Context, files []*model.File) map[uint]string {
+	types := make(map[uint]string)
+	for _, file := range files {
+		if file.IsDir || file.Quarantined {
+			continue
+		}
+		fileType, err := s.fileService.PreviewType(ctx, file)
+		if err != nil || fileType == "other" || fileType == "archive" {
+			continue
+		}
+		types[file.ID] = fileType
+	}
+	return types
+}
+
+// VerifySharePassword 验证分享密码，通过后签发分享访问令牌
+// 之后访问该分享只需携带令牌，不必每次传递密码；分享者修改密码后旧令牌失效
+func (s *ShareService) VerifySharePassword(ctx context.Context, uniqueID, password, clientIP string) (string, time.Duration, error) {
+	share, err := s.loadShare(ctx, uniqueID, password, "", clientIP)
+	if err != nil {
+		return "", 0, err
+	}
+
+	token, err := s.jwtUtil.GenerateShareToken(share.UniqueID, passwordFingerprint(share.Password), s.AccessTokenTTL)
+	if err != nil {
+		return "", 0, fmt.Errorf("签发分享访问令牌失败: %v", err)
+	}
+	return token, s.AccessTokenTTL, nil
+}
+
+// loadShare 获取分享并检查是否过期，有密码的分享需要正确的密码或有效的分享访问令牌
+// 访问不存在的分享和输错密码都会按IP计数，超过次数后锁定
+func (s *ShareService) loadShare(ctx context.Context, uniqueID, password, accessToken, clientIP string) (*model.Share, error) {
+	if err := s.checkLocked(ctx, "enum:"+clientIP); err != nil {
+		return nil, err
+	}
+
 	share, err := s.shareRepo.GetShareByUniqueID(ctx, uniqueID)
 	if err != nil {
-		return nil, -1, errors.New("分享不存在" + err.Error())
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.recordShareMiss(ctx, uniqueID, clientIP)
+		}
+		return nil, errors.New("分享不存在" + err.Error())
 	}
 
+	if share.Disabled {
+		return nil, ErrShareDisabled
+	}
 	if s.shareRepo.IsExp(share) {
-		return nil, -1, errors.New("分享已过期")
+		return nil, ErrShareExpired
+	}
+
+	// 下载次数达到上限后分享失效
+	if share.MaxDownloads > 0 {
+		downloads, err := s.statsCache.Downloads(ctx, share.ID, share.DownloadCount)
+		if err != nil {
+			return nil, fmt.Errorf("获取分享下载次数失败: %v", err)
+		}
+		if downloads >= share.MaxDownloads {
+			return nil, ErrShareDownloadLimit
+		}
+	}
+
+	if share.Password == "" {
+		return share, nil
+	}
+
+	if accessToken != "" {
+		tokenShareID, fingerprint, err := s.jwtUtil.ValidateShareToken(accessToken)
+		if err != nil || tokenShareID != share.UniqueID || fingerprint != passwordFingerprint(share.Password) {
+			return nil, ErrShareTokenInvalid
+		}
+		return share, nil
+	}
+
+	// 未提供密码只是提示需要密码，不计入失败次数
+	if password == "" {
+		return nil, ErrSharePasswordRequired
+	}
+
+	if err := s.checkLocked(ctx, "share:"+share.UniqueID); err != nil {
+		return nil, err
+	}
+	if err := s.checkLocked(ctx, "ip:"+clientIP); err != nil {
+		return nil, err
+	}
+
+	if !util.CheckPassword(share.Password, password) {
+		s.recordPasswordFailure(ctx, share, clientIP)
+		return nil, ErrSharePasswordWrong
+	}
+
+	return share, nil
+}
+
+// checkLocked key处于锁定状态时返回ErrShareLocked
+func (s *ShareService) checkLocked(ctx context.Context, key string) error {
+	lock, err := s.guardCache.LockedFor(ctx, key)
+	if err != nil {
+		return err
+	}
+	if lock > 0 {
+		return fmt.Errorf("%w，请%d秒后再试", ErrShareLocked, int64((lock+time.Second-1)/time.Second))
+	}
+	return nil
+}
+
+// recordPasswordFailure 记录一次密码错误，同时按IP和按分享计数
+// 按分享的上限更高，避免单个访问者就能锁定分享，但能拦住换IP的尝试
+func (s *ShareService) recordPasswordFailure(ctx context.Context, share *model.Share, clientIP string) {
+	// 此时还不知道访问者是谁，按IP记录
+	s.logAccess(ctx, share.ID, nil, model.ShareActionPasswordFailed, 0, clientIP)
+
+	ipFailures, ipLock, err := s.guardCache.Fail(ctx, "ip:"+clientIP, s.PasswordMaxAttempts, shareFailWindow, s.LockoutBase, shareLockoutMax)
+	if err != nil {
+		zap.S().Errorf("记录分享密码错误失败: %v", err)
+	}
+	shareFailures, shareLock, err := s.guardCache.Fail(ctx, "share:"+share.UniqueID, s.PasswordMaxAttempts*4, shareFailWindow, s.LockoutBase, shareLockoutMax)
+	if err != nil {
+		zap.S().Errorf("记录分享密码错误失败: %v", err)
+	}
+
+	if ipLock > 0 {
+		s.audit(ctx, model.AuditShareBruteForce, share.UserID, clientIP, share.UniqueID,
+			fmt.Sprintf("该IP输错分享密码%d次，锁定%d秒", ipFailures, int64(ipLock/time.Second)))
+	}
+	if shareLock > 0 {
+		s.audit(ctx, model.AuditShareBruteForce, share.UserID, clientIP, share.UniqueID,
+			fmt.Sprintf("分享密码被输错%d次，锁定分享%d秒", shareFailures, int64(shareLock/time.Second)))
+	}
+	if ipLock > 0 || shareLock > 0 {
+		s.notifyOwner(share, shareFailures)
+	}
+}
+
+// recordShareMiss 记录一次访问不存在的分享，分享ID较短，连续访问不存在的分享视为枚举
+func (s *ShareService) recordShareMiss(ctx context.Context, uniqueID, clientIP string) {
+	misses, lock, err := s.guardCache.Fail(ctx, "enum:"+clientIP, s.EnumMaxMisses, shareEnumWindow, s.LockoutBase, shareLockoutMax)
+	if err != nil {
+		zap.S().Errorf("记录分享访问失败: %v", err)
+		return
+	}
+	if lock > 0 {
+		s.audit(ctx, model.AuditShareEnumeration, 0, clientIP, uniqueID,
+			fmt.Sprintf("该IP访问不存在的分享%d次，锁定%d秒", misses, int64(lock/time.Second)))
+	}
+}
+
+func (s *ShareService) audit(ctx context.Context, logType string, userID uint, clientIP, target, detail string) {
+	log := &model.AuditLog{
+		Type:      logType,
+		UserID:    userID,
+		IP:        clientIP,
+		Target:    target,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	}
+	if err := s.auditRepo.CreateAuditLog(ctx, log); err != nil {
+		zap.S().Errorf("写入审计记录失败: %v", err)
+	}
+}
+
+// notifyOwner 邮件提醒分享者分享密码正在被尝试，每个分享每小时最多提醒一次
+func (s *ShareService) notifyOwner(share *model.Share, failures int64) {
+	if s.notifier == nil {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		allowed, err := s.rateLimitCache.Allow(ctx, fmt.Sprintf("share:notify:%d", share.ID), 1, time.Hour)
+		if err != nil || !allowed {
+			return
+		}
+		owner, err := s.userRepo.SelectByUserID(int(share.UserID))
+		if err != nil {
+			zap.S().Errorf("获取分享者信息失败: %v", err)
+			return
+		}
+		text := fmt.Sprintf("您的分享 %s 的密码已被输错%d次，相关访问已被暂时锁定。\n如果不是您分享的对象在尝试，建议重新生成分享密码。", share.UniqueID, failures)
+		if err := s.notifier.SendNotification(owner.Email, "ClaranCloudDisk分享安全提醒", text); err != nil {
+			zap.S().Errorf("发送分享安全提醒失败: %v", err)
+		}
+	}()
+}
+
+// RegenerateSharePassword 分享者重新生成分享密码，返回新密码
+// 旧密码签发的分享访问令牌随之失效，分享的锁定也一并解除
+func (s *ShareService) RegenerateSharePassword(ctx context.Context, userID uint, uniqueID string) (string, error) {
+	share, err := s.shareRepo.GetShareByUniqueID(ctx, uniqueID)
+	if err != nil {
+		return "", errors.New("分享不存在" + err.Error())
+	}
+	if share.UserID != userID {
+		return "", errors.New("无权修改此分享")
 	}
 
-	if share.Password != "" && util.CheckPassword(password, share.Password) {
-		return nil, -1, errors.New("密码错误")
+	password, err := util.GenerateRandomPassword(6)
+	if err != nil {
+		return "", fmt.Errorf("生成密码失败: %v", err)
 	}
+	hashed, err := util.HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	if err := s.shareRepo.UpdateSharePassword(ctx, share, hashed); err != nil {
+		return "", fmt.Errorf("更新分享密码失败: %v", err)
+	}
+
+	if err := s.guardCache.Reset(ctx, "share:"+share.UniqueID); err != nil {
+		zap.S().Errorf("解除分享锁定失败: %v", err)
+	}
+	return password, nil
+}
+
+// ShareURL 分享的公开链接，配置了公开地址时使用配置，否则使用请求的地址origin
+func (s *ShareService) ShareURL(origin, uniqueID string) string {
+	return s.baseURL(origin) + "/share/" + uniqueID
+}
 
-	// 检查文件是否属于此分享
-	var targetFile *model.File
+// ShortURL 分享的短链接，没有短码时返回空字符串
+func (s *ShareService) ShortURL(origin string, share *model.Share) string {
+	if share.ShortCode == nil {
+		return ""
+	}
+	return s.baseURL(origin) + "/s/" + *share.ShortCode
+}
+
+func (s *ShareService) baseURL(origin string) string {
+	if s.PublicBaseURL != "" {
+		return s.PublicBaseURL
+	}
+	return origin
+}
+
+// SetShortCode 为分享设置短码，code为空时随机生成，已有短码时替换
+func (s *ShareService) SetShortCode(ctx context.Context, userID uint, uniqueID, code string) (*model.Share, error) {
+	share, err := s.ownShare(ctx, userID, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	if code == "" {
+		code, err = s.generateShortCode(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if !shortCodePattern.MatchString(code) {
+			return nil, ErrShortCodeInvalid
+		}
+		other, err := s.shareRepo.GetShareByShortCode(ctx, code)
+		if err == nil && other.ID != share.ID {
+			return nil, ErrShortCodeTaken
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("查询短码失败: %v", err)
+		}
+	}
+
+	share.ShortCode = &code
+	if err := s.shareRepo.UpdateShortCode(ctx, share); err != nil {
+		return nil, fmt.Errorf("保存短码失败: %v", err)
+	}
+	return share, nil
+}
+
+// generateShortCode 随机生成未被占用的短码
+func (s *ShareService) generateShortCode(ctx context.Context) (string, error) {
+	for i := 0; i < 5; i++ {
+		code, err := util.GenerateRandomPassword(shortCodeLength)
+		if err != nil {
+			return "", fmt.Errorf("生成短码失败: %v", err)
+		}
+		_, err = s.shareRepo.GetShareByShortCode(ctx, code)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return code, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("查询短码失败: %v", err)
+		}
+	}
+	return "", errors.New("生成短码失败，请重试")
+}
+
+// RemoveShortCode 删除分享的短链接，原分享链接不受影响
+func (s *ShareService) RemoveShortCode(ctx context.Context, userID uint, uniqueID string) error {
+	share, err := s.ownShare(ctx, userID, uniqueID)
+	if err != nil {
+		return err
+	}
+
+	share.ShortCode = nil
+	if err := s.shareRepo.UpdateShortCode(ctx, share); err != nil {
+		return fmt.Errorf("删除短码失败: %v", err)
+	}
+	return nil
+}
+
+// ResolveShortCode 短码对应的分享ID，访问不存在的短码与访问不存在的分享一样计数
+func (s *ShareService) ResolveShortCode(ctx context.Context, code, clientIP string) (string, error) {
+	if err := s.checkLocked(ctx, "enum:"+clientIP); err != nil {
+		return "", err
+	}
+
+	share, err := s.shareRepo.GetShareByShortCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.recordShareMiss(ctx, code, clientIP)
+		}
+		return "", errors.New("短链接不存在" + err.Error())
+	}
+	return share.UniqueID, nil
+}
+
+// ShareQRCode 生成分享链接的PNG二维码，有短链接时使用短链接
+// embedPassword为true时把密码附在链接中，需要提供正确的分享密码（分享访问令牌不包含密码）
+func (s *ShareService) ShareQRCode(ctx context.Context, uniqueID, password, accessToken, clientIP, origin string, embedPassword bool, size int) ([]byte, error) {
+	if embedPassword {
+		accessToken = ""
+	}
+	share, err := s.loadShare(ctx, uniqueID, password, accessToken, clientIP)
+	if err != nil {
+		if embedPassword && errors.Is(err, ErrSharePasswordRequired) {
+			return nil, ErrQRCodeNeedPassword
+		}
+		return nil, err
+	}
+
+	link := s.ShortURL(origin, share)
+	if link == "" {
+		link = s.ShareURL(origin, share.UniqueID)
+	}
+	if embedPassword && share.Password != "" {
+		link += "?password=" + url.QueryEscape(password)
+	}
+
+	if size == 0 {
+		size = qrCodeSizeDefault
+	}
+	size = min(max(size, qrCodeSizeMin), qrCodeSizeMax)
+	png, err := qrcode.Encode(link, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+	return png, nil
+}
+
+// passwordFingerprint 分享密码哈希的指纹，写入访问令牌，密码修改后旧令牌随之失效
+func passwordFingerprint(hashedPassword string) string {
+	sum := sha256.Sum256([]byte(hashedPassword))
+	return hex.EncodeToString(sum[:8])
+}
+
+// resolveShareFile 检查fileID是分享的文件本身，或是某个分享文件夹下的文件
+// 返回文件以及从分享根目录到该文件的路径
+func (s *ShareService) resolveShareFile(ctx context.Context, share *model.Share, fileID uint) (*model.File, []*model.File, error) {
+	roots := make(map[uint]bool, len(share.ShareFiles))
 	for _, shareFile := range share.ShareFiles {
-		if shareFile.FileID == fileID {
-			file, err := s.fileRepo.FindByID(ctx, fileID)
-			if err != nil {
-				return nil, -1, errors.New("文件不存在" + err.Error())
-			}
-			targetFile = file
+		roots[shareFile.FileID] = true
+	}
+
+	chain, err := fileAncestors(ctx, s.fileRepo, fileID)
+	if err != nil {
+		return nil, nil, errors.New("文件不存在于分享中")
+	}
+
+	// 从文件向上查找，直到遇到分享的根，路径上的文件都必须属于分享者且未被删除
+	for i, file := range chain {
+		if file.UserID != share.UserID || file.IsDeleted {
 			break
 		}
+		if roots[file.ID] {
+			path := make([]*model.File, 0, i+1)
+			for j := i; j >= 0; j-- {
+				path = append(path, chain[j])
+			}
+			return chain[0], path, nil
+		}
 	}
 
-	if targetFile == nil {
-		return nil, -1, errors.New("文件不存在于分享中")
+	return nil, nil, errors.New("文件不存在于分享中")
+}
+
+// SaveSpecFile 将分享中的一个文件或文件夹转存到自己的根目录
+func (s *ShareService) SaveSpecFile(ctx context.Context, userID uint, uniqueID, password, accessToken string, fileID uint, clientIP string) (*model.File, error) {
+	saved, err := s.SaveFiles(ctx, userID, uniqueID, password, accessToken, []uint{fileID}, nil, clientIP)
+	if err != nil {
+		return nil, err
 	}
+	return saved[0], nil
+}
 
-	//获取信息
-	isVIP, err := s.userRepo.GetVIP(userID)
+// shareSaveMaxFiles 一次转存最多包含的文件数（含所选文件夹下的全部文件）
+const shareSaveMaxFiles = 1000
+
+// saveNode 待转存的文件或文件夹，文件夹带有其下未删除、未隔离的内容
+type saveNode struct {
+	file     *model.File
+	children []*saveNode
+}
+
+// SaveFiles 将分享中选中的文件与文件夹转存到folderID，folderID为nil时转存到根目录
+// 转存不复制对象，新记录引用原文件的存储对象；按实际大小占用存储空间，并受上传策略约束
+// 转存到别人定向分享（读写）的文件夹时，文件属于该文件夹的所有者，计入其存储空间
+// 整个选择计一次下载
+func (s *ShareService) SaveFiles(ctx context.Context, userID uint, uniqueID, password, accessToken string, fileIDs []uint, folderID *uint, clientIP string) ([]*model.File, error) {
+	share, err := s.loadShare(ctx, uniqueID, password, accessToken, clientIP)
 	if err != nil {
-		return nil, -1, fmt.Errorf("获取用户信息失败: %v", err)
+		return nil, err
 	}
-	LimitedSpeed := s.LimitedSpeed
-	user, _ := s.userRepo.SelectByUserID(int(userID))
-	if isVIP || user.Role == "admin" {
-		LimitedSpeed = 0
+	// 转存得到的是不带水印的原文件
+	if share.Watermark {
+		return nil, ErrShareWatermarked
 	}
 
-	return targetFile, LimitedSpeed, nil
-}
+	// 目标文件夹
+	ownerID := userID
+	if folderID != nil {
+		folder, err := s.fileService.accessibleFolder(ctx, int(userID), *folderID, accessWrite)
+		if err != nil {
+			return nil, err
+		}
+		ownerID = folder.UserID
+	}
+
+	// 展开选择，同一文件只转存一次
+	var roots []*saveNode
+	var files []*model.File
+	seen := make(map[uint]bool)
+	for _, fileID := range fileIDs {
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
+		file, _, err := s.resolveShareFile(ctx, share, fileID)
+		if err != nil {
+			return nil, err
+		}
+		if file.Quarantined {
+			return nil, fmt.Errorf("%w: %d", ErrFileQuarantined, fileID)
+		}
+		node, err := s.expandSaveNode(ctx, share, file, &files)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, node)
+	}
+
+	// 转存同样受上传策略约束
+	for _, file := range files {
+		if err := s.policyService.CheckFile(ctx, int(ownerID), file.Name, file.Size); err != nil {
+			return nil, err
+		}
+		if err := s.policyService.CheckType(ctx, extOf(file.Name), file.DetectedMime); err != nil {
+			return nil, err
+		}
+	}
+
+	// 逐个预留存储空间与每日上传量，任意一个失败则全部释放
+	reservations := make(map[uint]string, len(files))
+	defer func() {
+		for _, reservationID := range reservations {
+			s.fileService.ReleaseQuota(ctx, int(ownerID), reservationID)
+		}
+	}()
+	for _, file := range files {
+		reservationID, err := newUploadID()
+		if err != nil {
+			return nil, fmt.Errorf("生成预留ID失败: %v", err)
+		}
+		if err := s.fileService.ReserveQuota(ctx, int(ownerID), reservationID, file.Size, uploadReservationTTL); err != nil {
+			return nil, err
+		}
+		reservations[file.ID] = reservationID
+	}
 
-func (s *ShareService) SaveSpecFile(ctx context.Context, userID uint, uniqueID, password string, fileID uint) (*model.File, error) {
-	// 获取分享文件
-	shareFile, _, err := s.DownloadSpecFile(ctx, uniqueID, password, fileID, int(userID))
+	// 计入下载次数，达到上限后分享失效
+	ok, err := s.statsCache.Download(ctx, share.ID, share.DownloadCount, share.MaxDownloads, visitorKey(int(userID), clientIP))
 	if err != nil {
 		return nil, err
 	}
+	if !ok {
+		return nil, ErrShareDownloadLimit
+	}
 
-	// 检查是否已有相同文件
-	existingFile, err := s.fileRepo.FindByHash(ctx, shareFile.Hash)
-	if err == nil && existingFile != nil && existingFile.UserID == userID {
-		return existingFile, nil // 已存在相同文件
+	names, err := s.siblingNames(ctx, ownerID, folderID)
+	if err != nil {
+		return nil, err
 	}
+	saved := make([]*model.File, 0, len(roots))
+	for _, node := range roots {
+		newFile, err := s.createSaved(ctx, ownerID, node, folderID, names, reservations)
+		if err != nil {
+			return nil, err
+		}
+		s.logAccess(ctx, share.ID, &node.file.ID, model.ShareActionSave, int(userID), clientIP)
+		saved = append(saved, newFile)
+	}
+	return saved, nil
+}
 
-	// 生成文件名
-	newFileName := s.GenerateUniqueFileName(shareFile.Name, userID)
-	newFilePath := filepath.Join(s.uploadDir, fmt.Sprintf("user_%d", userID), newFileName)
+// expandSaveNode 展开分享中的文件夹，文件追加到files；文件夹中被隔离的文件跳过
+func (s *ShareService) expandSaveNode(ctx context.Context, share *model.Share, file *model.File, files *[]*model.File) (*saveNode, error) {
+	node := &saveNode{file: file}
+	if !file.IsDir {
+		*files = append(*files, file)
+		if len(*files) > shareSaveMaxFiles {
+			return nil, fmt.Errorf("一次最多转存%d个文件", shareSaveMaxFiles)
+		}
+		return node, nil
+	}
 
-	//// 复制文件
-	//err = s.fileRepo.Create(context.Background(), shareFile)
-	//if err != nil {
-	//	return nil, err
-	//}
+	children, err := s.fileRepo.FindChildren(ctx, share.UserID, &file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件夹内容失败: %v", err)
+	}
+	for _, child := range children {
+		if child.Quarantined {
+			continue
+		}
+		childNode, err := s.expandSaveNode(ctx, share, child, files)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, childNode)
+	}
+	return node, nil
+}
 
-	// 创建新文件记录
+// createSaved 在parentID下创建文件或文件夹记录，文件引用原对象并提交对应的存储空间预留
+func (s *ShareService) createSaved(ctx context.Context, ownerID uint, node *saveNode, parentID *uint, names map[string]bool, reservations map[uint]string) (*model.File, error) {
+	src := node.file
 	newFile := &model.File{
-		UserID:   userID,
-		Name:     shareFile.Name,
-		Filename: newFileName,
-		Path:     newFilePath,
-		Size:     shareFile.Size,
-		Hash:     shareFile.Hash,
-		MimeType: shareFile.MimeType,
+		UserID:   ownerID,
+		Name:     uniqueSiblingName(names, src.Name),
+		IsDir:    src.IsDir,
+		ParentID: parentID,
+	}
+	if !src.IsDir {
+		newFile.Filename = src.Filename
+		newFile.Path = src.Path
+		newFile.Size = src.Size
+		newFile.Hash = src.Hash
+		newFile.MimeType = src.MimeType
+		newFile.Ext = src.Ext
+		newFile.Meta = src.Meta
+		newFile.DetectedMime = src.DetectedMime
+		newFile.MimeMismatch = src.MimeMismatch
+		newFile.ScanStatus = src.ScanStatus
+		newFile.ScanResult = src.ScanResult
 	}
+	names[newFile.Name] = true
 
 	if err := s.fileRepo.Create(ctx, newFile); err != nil {
-		// 清理已复制的文件
-		//os.Remove(newFilePath)
 		return nil, fmt.Errorf("创建文件记录失败: %v", err)
 	}
+	if !src.IsDir {
+		s.fileService.CommitQuota(ctx, int(ownerID), reservations[src.ID], src.Size)
+		delete(reservations, src.ID)
+		return newFile, nil
+	}
 
-	user, _ := s.userRepo.SelectByUserID(int(userID))
-	newStorage := user.Storage + shareFile.Size
+	childNames := make(map[string]bool, len(node.children))
+	for _, child := range node.children {
+		if _, err := s.createSaved(ctx, ownerID, child, &newFile.ID, childNames, reservations); err != nil {
+			return nil, err
+		}
+	}
+	return newFile, nil
+}
 
-	// 更新用户存储空间
-	err = s.userRepo.UpdateStorage(int(userID), newStorage)
+// siblingNames 目标文件夹中已有的名称
+func (s *ShareService) siblingNames(ctx context.Context, ownerID uint, folderID *uint) (map[string]bool, error) {
+	siblings, err := s.fileRepo.FindChildren(ctx, ownerID, folderID)
 	if err != nil {
-		os.Remove(newFilePath)
-		return nil, fmt.Errorf("更新存储空间失败: %v", err)
+		return nil, fmt.Errorf("获取目录失败: %v", err)
+	}
+	names := make(map[string]bool, len(siblings))
+	for _, sibling := range siblings {
+		names[sibling.Name] = true
 	}
+	return names, nil
+}
 
-	return newFile, nil
+// uniqueSiblingName 同一目录下已有同名文件时追加序号
+func uniqueSiblingName(names map[string]bool, name string) string {
+	if !names[name] {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !names[candidate] {
+			return candidate
+		}
+	}
 }
 
-func (s *ShareService) GenerateUniqueID() string {
+// GetShareStats 分享者查看分享的统计与访问记录，计数包含尚未写回数据库的部分
+func (s *ShareService) GetShareStats(ctx context.Context, userID uint, uniqueID string, page, pageSize int) (*model.ShareStatsResponse, error) {
+	share, err := s.shareRepo.GetShareByUniqueID(ctx, uniqueID)
+	if err != nil {
+		return nil, errors.New("分享不存在" + err.Error())
+	}
+	if share.UserID != userID {
+		return nil, errors.New("无权查看此分享的统计")
+	}
+
+	views, downloads, err := s.statsCache.Pending(ctx, share.ID)
+	if err != nil {
+		return nil, fmt.Errorf("获取分享统计失败: %v", err)
+	}
+	visitors, err := s.statsCache.Visitors(ctx, share.ID)
+	if err != nil {
+		return nil, fmt.Errorf("获取分享统计失败: %v", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	logs, total, err := s.shareRepo.GetAccessLogs(ctx, share.ID, page, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("获取访问记录失败: %v", err)
+	}
+
+	stats := &model.ShareStatsResponse{
+		UniqueID:           share.UniqueID,
+		ViewCount:          share.ViewCount + views,
+		DownloadCount:      share.DownloadCount + downloads,
+		VisitorCount:       max(share.VisitorCount, visitors),
+		MaxDownloads:       share.MaxDownloads,
+		RemainingDownloads: -1,
+		Logs:               logs,
+		TotalLogs:          total,
+	}
+	if share.MaxDownloads > 0 {
+		stats.RemainingDownloads = max(share.MaxDownloads-stats.DownloadCount, 0)
+	}
+	return stats, nil
+}
+
+// FlushStats 将redis中累计的计数与访问记录写回数据库
+func (s *ShareService) FlushStats(ctx context.Context) {
+	deltas, err := s.statsCache.Drain(ctx)
+	if err != nil {
+		zap.S().Errorf("获取分享统计增量失败: %v", err)
+	}
+	for shareID, delta := range deltas {
+		visitors, err := s.statsCache.Visitors(ctx, shareID)
+		if err != nil {
+			visitors = 0
+		}
+		if err := s.shareRepo.AddShareStats(ctx, shareID, delta[0], delta[1], visitors); err != nil {
+			zap.S().Errorf("写回分享统计失败: %v", err)
+			if err := s.statsCache.Restore(ctx, shareID, delta[0], delta[1]); err != nil {
+				zap.S().Errorf("退回分享统计增量失败: %v", err)
+			}
+		}
+	}
+
+	for {
+		logs, err := s.statsCache.PopLogs(ctx, shareLogBatch)
+		if err != nil {
+			zap.S().Errorf("获取分享访问记录失败: %v", err)
+			return
+		}
+		if len(logs) == 0 {
+			return
+		}
+		if err := s.shareRepo.CreateAccessLogs(ctx, logs); err != nil {
+			zap.S().Errorf("写回分享访问记录失败: %v", err)
+			return
+		}
+		if len(logs) < shareLogBatch {
+			return
+		}
+	}
+}
+
+// RunStatsFlusher 定期写回分享统计
+func (s *ShareService) RunStatsFlusher(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.FlushStats(context.Background())
+	}
+}
+
+// 每次写回的访问记录条数
+const shareLogBatch = 500
+
+func (s *ShareService) logAccess(ctx context.Context, shareID uint, fileID *uint, action string, userID int, clientIP string) {
+	log := &model.ShareAccessLog{
+		ShareID:   shareID,
+		FileID:    fileID,
+		Action:    action,
+		UserID:    uint(userID),
+		Anonymous: userID == 0,
+		IP:        clientIP,
+		CreatedAt: time.Now(),
+	}
+	if err := s.statsCache.PushLog(ctx, log); err != nil {
+		zap.S().Errorf("记录分享访问失败: %v", err)
+	}
+}
+
+// visitorKey 统计独立访客，登录用户按用户，未登录按IP
+func visitorKey(userID int, clientIP string) string {
+	if userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + clientIP
+}
+
+func (s *ShareService) GenerateUniqueID() (string, error) {
+	return generateUniqueID()
+}
+
+// generateUniqueID 分享与文件收集链接的唯一ID
+func generateUniqueID() (string, error) {
 	b := make([]byte, 12)
-	rand.Read(b)
-	return strings.ToLower(base64.URLEncoding.EncodeToString(b)[:16])
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base64.URLEncoding.EncodeToString(b)[:16]), nil
 }
 
 func (s *ShareService) GenerateUniqueFileName(name string, userID uint) string {
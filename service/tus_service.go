@@ -0,0 +1,332 @@
+package services
+
+import (
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/model"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tus协议相关错误，handler据此返回对应的状态码
+var (
+	ErrTusNotFound         = errors.New("上传会话不存在或已过期")
+	ErrTusOffsetMismatch   = errors.New("Upload-Offset与服务端记录不一致")
+	ErrTusChecksumMismatch = errors.New("分段校验和不一致")
+	ErrTusChecksumAlgo     = errors.New("不支持的校验算法")
+	ErrTusLocked           = errors.New("该上传正在被其他请求写入")
+	ErrTusTooLarge         = errors.New("写入数据超出Upload-Length")
+)
+
+// TusChecksumAlgorithms 支持的checksum扩展算法
+var TusChecksumAlgorithms = []string{"sha1", "sha256", "md5"}
+
+type TusService struct {
+	tusCache    cache.TusUploadCache
+	fileService *FileService
+	uploadDir   string
+	expire      time.Duration
+}
+
+func NewTusService(tusCache cache.TusUploadCache, fileService *FileService, uploadDir string, expireHours int) *TusService {
+	if expireHours <= 0 {
+		expireHours = 24 // 未配置时默认24小时
+	}
+	return &TusService{
+		tusCache:    tusCache,
+		fileService: fileService,
+		uploadDir:   uploadDir,
+		expire:      time.Duration(expireHours) * time.Hour,
+	}
+}
+
+// MaxSize 单个上传允许的最大长度 (Tus-Max-Size)
+func (s *TusService) MaxSize() int64 {
+	return s.fileService.MaxFileSize
+}
+
+// CreateUpload 创建上传会话 (creation扩展)
+func (s *TusService) CreateUpload(ctx context.Context, userID int, length int64, metadata map[string]string) (*model.TusUpload, error) {
+	fileName := filepath.Base(metadata["filename"])
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return nil, fmt.Errorf("Upload-Metadata缺少filename")
+	}
+
+	//上传策略
+	if err := s.fileService.policyService.CheckFile(ctx, userID, fileName, length); err != nil {
+		return nil, err
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return nil, fmt.Errorf("生成上传ID失败: %v", err)
+	}
+
+	//按Upload-Length预留存储空间，上传完成后提交
+	if err := s.fileService.ReserveQuota(ctx, userID, uploadID, length, s.expire); err != nil {
+		return nil, err
+	}
+
+	//创建临时文件
+	tmpPath := filepath.Join(".", s.uploadDir, fmt.Sprintf("user_%d", uint(userID)), "tus_uploads", uploadID) // ./user_:id/tus_uploads/uploadID
+	if err := os.MkdirAll(filepath.Dir(tmpPath), 0755); err != nil {
+		s.fileService.ReleaseQuota(ctx, userID, uploadID)
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		s.fileService.ReleaseQuota(ctx, userID, uploadID)
+		return nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	tmpFile.Close()
+
+	now := time.Now()
+	upload := &model.TusUpload{
+		ID:        uploadID,
+		UserID:    userID,
+		Length:    length,
+		FileName:  fileName,
+		MimeType:  metadata["filetype"],
+		Metadata:  metadata,
+		TmpPath:   tmpPath,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.expire),
+	}
+	if err := s.tusCache.SaveUpload(ctx, upload, s.expire); err != nil {
+		os.Remove(tmpPath)
+		s.fileService.ReleaseQuota(ctx, userID, uploadID)
+		return nil, fmt.Errorf("保存上传会话失败: %v", err)
+	}
+
+	return upload, nil
+}
+
+// GetUpload 获取当前用户的上传会话 (HEAD)
+func (s *TusService) GetUpload(ctx context.Context, userID int, uploadID string) (*model.TusUpload, error) {
+	upload, err := s.tusCache.GetUpload(ctx, uploadID)
+	if err != nil {
+		return nil, ErrTusNotFound
+	}
+	// 不属于当前用户的会话一律视为不存在
+	if upload.UserID != userID {
+		return nil, ErrTusNotFound
+	}
+	return upload, nil
+}
+
+// WriteChunk 在offset处追加数据 (PATCH)
+// checksum为Upload-Checksum请求头，格式为"算法 base64摘要"，为空时不校验
+// 上传完成时返回创建的file记录
+func (s *TusService) WriteChunk(ctx context.Context, userID int, uploadID string, offset int64, checksum string, body io.Reader) (*model.TusUpload, *model.File, error) {
+	//同一上传同时只允许一个写入
+	locked, err := s.tusCache.LockUpload(ctx, uploadID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取上传锁失败: %v", err)
+	}
+	if !locked {
+		return nil, nil, ErrTusLocked
+	}
+	defer s.tusCache.UnlockUpload(ctx, uploadID)
+
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset != upload.Offset {
+		return upload, nil, ErrTusOffsetMismatch
+	}
+
+	//解析校验算法
+	var hasher hash.Hash
+	var expected []byte
+	if checksum != "" {
+		hasher, expected, err = parseTusChecksum(checksum)
+		if err != nil {
+			return upload, nil, err
+		}
+	}
+
+	tmpFile, err := os.OpenFile(upload.TmpPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return upload, nil, fmt.Errorf("打开临时文件失败: %v", err)
+	}
+	defer tmpFile.Close()
+	if _, err := tmpFile.Seek(offset, io.SeekStart); err != nil {
+		return upload, nil, fmt.Errorf("定位临时文件失败: %v", err)
+	}
+
+	var writer io.Writer = tmpFile
+	if hasher != nil {
+		writer = io.MultiWriter(tmpFile, hasher)
+	}
+	//多读一个字节用于判断是否超出Upload-Length
+	written, copyErr := io.Copy(writer, io.LimitReader(body, upload.Length-offset+1))
+
+	rollback := func() {
+		if err := tmpFile.Truncate(offset); err != nil {
+			zap.S().Errorf("回滚tus分段失败: %v", err)
+		}
+	}
+	if written > upload.Length-offset {
+		rollback()
+		return upload, nil, ErrTusTooLarge
+	}
+	if hasher != nil {
+		// 带校验和的分段必须完整到达且校验通过才能落盘
+		if copyErr != nil {
+			rollback()
+			return upload, nil, fmt.Errorf("读取请求体失败: %v", copyErr)
+		}
+		if !bytes.Equal(hasher.Sum(nil), expected) {
+			rollback()
+			return upload, nil, ErrTusChecksumMismatch
+		}
+	}
+
+	//更新会话：未带校验和时连接中断，已收到的数据仍然保留，客户端可通过HEAD续传
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(s.expire)
+	if err := s.tusCache.SaveUpload(ctx, upload, s.expire); err != nil {
+		rollback()
+		return upload, nil, fmt.Errorf("更新上传会话失败: %v", err)
+	}
+	s.fileService.ExtendQuota(ctx, userID, uploadID, s.expire)
+	if copyErr != nil {
+		return upload, nil, fmt.Errorf("读取请求体失败: %v", copyErr)
+	}
+	if upload.Offset < upload.Length {
+		return upload, nil, nil
+	}
+
+	//上传完成
+	tmpFile.Close()
+	file, err := s.finish(ctx, upload)
+	if err != nil {
+		return upload, nil, err
+	}
+	return upload, file, nil
+}
+
+// finish 上传完成后与分片上传共用file创建逻辑
+func (s *TusService) finish(ctx context.Context, upload *model.TusUpload) (*model.File, error) {
+	file, err := s.fileService.CreateFromLocal(ctx, upload.UserID, upload.TmpPath, upload.FileName, upload.MimeType, "", upload.ID)
+	if errors.Is(err, ErrMimeMismatch) || errors.Is(err, ErrPolicyExtDenied) || errors.Is(err, ErrPolicyTypeDenied) {
+		// 内容被拒绝，重试也不会通过
+		s.cleanup(ctx, upload)
+		s.fileService.ReleaseQuota(ctx, upload.UserID, upload.ID)
+		return nil, err
+	}
+	if err != nil {
+		// 保留会话、临时文件与空间预留，客户端可以用offset等于Upload-Length的空PATCH重试
+		return nil, fmt.Errorf("创建文件失败: %v", err)
+	}
+
+	s.cleanup(ctx, upload)
+	return file, nil
+}
+
+// Terminate 终止上传并删除已上传的数据 (termination扩展)
+func (s *TusService) Terminate(ctx context.Context, userID int, uploadID string) error {
+	locked, err := s.tusCache.LockUpload(ctx, uploadID)
+	if err != nil {
+		return fmt.Errorf("获取上传锁失败: %v", err)
+	}
+	if !locked {
+		return ErrTusLocked
+	}
+	defer s.tusCache.UnlockUpload(ctx, uploadID)
+
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return err
+	}
+
+	s.cleanup(ctx, upload)
+	s.fileService.ReleaseQuota(ctx, userID, uploadID)
+	return nil
+}
+
+// RunUploadCleaner 定期清理已过期的tus会话遗留的临时文件
+func (s *TusService) RunUploadCleaner(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.fileService.cleanStaleUploads("tus_uploads", func(uploadID string) (bool, error) {
+			return s.tusCache.UploadExists(context.Background(), uploadID)
+		})
+	}
+}
+
+func (s *TusService) cleanup(ctx context.Context, upload *model.TusUpload) {
+	if err := s.tusCache.DeleteUpload(ctx, upload.ID); err != nil {
+		zap.S().Errorf("删除tus上传会话失败: %v", err)
+	}
+	if err := os.Remove(upload.TmpPath); err != nil && !os.IsNotExist(err) {
+		zap.S().Errorf("删除tus临时文件失败: %v", err)
+	}
+}
+
+// ParseTusMetadata 解析Upload-Metadata: "key base64value,key2 base64value2"
+func ParseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Upload-Metadata中%s的值不是合法的base64: %v", parts[0], err)
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("Upload-Metadata格式错误: %s", pair)
+		}
+	}
+
+	return metadata, nil
+}
+
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("Upload-Checksum格式错误")
+	}
+
+	var hasher hash.Hash
+	switch strings.ToLower(parts[0]) {
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	case "md5":
+		hasher = md5.New()
+	default:
+		return nil, nil, ErrTusChecksumAlgo
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("Upload-Checksum不是合法的base64: %v", err)
+	}
+
+	return hasher, expected, nil
+}
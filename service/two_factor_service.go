@@ -0,0 +1,461 @@
+package services
+
+import (
+	"ClaranCloudDisk/config"
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util"
+	"ClaranCloudDisk/util/jwt_util"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorRequired       = errors.New("该账号已开启两步验证，请输入验证码")
+	ErrTwoFactorCodeWrong      = errors.New("验证码错误或已使用")
+	ErrTwoFactorNotSetup       = errors.New("请先获取两步验证密钥，密钥10分钟内有效")
+	ErrTwoFactorEnabled        = errors.New("已开启两步验证")
+	ErrTwoFactorNotEnabled     = errors.New("未开启两步验证")
+	ErrTwoFactorPasswordWrong  = errors.New("密码错误")
+	ErrTwoFactorChallenge      = errors.New("登录已失效或尝试次数过多，请重新输入密码登录")
+	ErrTwoFactorLocked         = errors.New("两步验证码错误次数过多，请15分钟后再试")
+	ErrAdminTwoFactorRequired  = errors.New("安全策略要求管理员开启两步验证，请先在/user/2fa/setup开启")
+	ErrAdminTwoFactorDisabling = errors.New("安全策略要求管理员开启两步验证，不能关闭")
+	ErrUserBanned              = errors.New("用户已被封禁")
+)
+
+// TwoFactorSetupTTL 获取密钥后需要在这段时间内确认开启
+const TwoFactorSetupTTL = 10 * time.Minute
+
+const (
+	// totpPeriod 与 totpSkew 按RFC 6238的推荐值，允许前后各一个时间步的时钟误差
+	totpPeriod = 30
+	totpSkew   = 1
+	// totpReplayTTL 动态码在前后时间步内都有效，记录至少这么久才能防止重放
+	totpReplayTTL = 2 * totpPeriod * (totpSkew + 1) * time.Second
+
+	challengeTTL         = 5 * time.Minute
+	challengeMaxAttempts = 5
+	recoveryCodeCount    = 10
+	recoveryCodeCharset  = "abcdefghjkmnpqrstuvwxyz23456789" // 去掉了容易混淆的0、o、1、l、i
+	recoveryCodeHalfLen  = 5
+	twoFactorQRCodeSize  = 256
+
+	// 每个挑战只能试5次，重新输入密码即可获得新挑战，按用户累计失败次数防止反复换挑战穷举动态码
+	userMaxFailures = 10
+	userLockoutTTL  = 15 * time.Minute
+)
+
+type TwoFactorService struct {
+	userRepo  mysql.UserRepository
+	repo      mysql.TwoFactorRepository
+	cache     cache.TwoFactorCache
+	auditRepo mysql.AuditRepository
+	jwtUtil   jwt_util.Util
+	issuer    string
+	defaults  config.SecurityConfig
+}
+
+func NewTwoFactorService(userRepo mysql.UserRepository, repo mysql.TwoFactorRepository, twoFactorCache cache.TwoFactorCache, auditRepo mysql.AuditRepository, jwtUtil jwt_util.Util, issuer string, defaults config.SecurityConfig) *TwoFactorService {
+	return &TwoFactorService{
+		userRepo:  userRepo,
+		repo:      repo,
+		cache:     twoFactorCache,
+		auditRepo: auditRepo,
+		jwtUtil:   jwtUtil,
+		issuer:    issuer,
+		defaults:  defaults,
+	}
+}
+
+// Setup 生成新的密钥，返回密钥、otpauth链接与二维码，调用Enable并提交正确的动态码后才会生效
+func (s *TwoFactorService) Setup(ctx context.Context, userID int) (string, string, []byte, error) {
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if user.TOTPEnabled {
+		return "", "", nil, ErrTwoFactorEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: user.Username,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return "", "", nil, fmt.Errorf("生成两步验证密钥失败: %v", err)
+	}
+
+	png, err := qrcode.Encode(key.URL(), qrcode.Medium, twoFactorQRCodeSize)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+
+	if err := s.cache.SavePendingSecret(ctx, userID, key.Secret(), TwoFactorSetupTTL); err != nil {
+		return "", "", nil, err
+	}
+
+	return key.Secret(), key.URL(), png, nil
+}
+
+// Enable 校验验证器生成的动态码，通过后开启两步验证并返回恢复码，恢复码只在这里返回一次
+func (s *TwoFactorService) Enable(ctx context.Context, userID int, code string) ([]string, error) {
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := s.cache.GetPendingSecret(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorNotSetup
+	}
+	if err := s.checkTOTP(ctx, userID, secret, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.EnableTOTP(ctx, userID, secret, hashes); err != nil {
+		return nil, fmt.Errorf("开启两步验证失败: %v", err)
+	}
+	if err := s.cache.DeletePendingSecret(ctx, userID); err != nil {
+		zap.S().Warnf("删除两步验证临时密钥失败: %v", err)
+	}
+
+	return codes, nil
+}
+
+// Disable 校验密码与动态码（或恢复码）后关闭两步验证
+func (s *TwoFactorService) Disable(ctx context.Context, userID int, password, code string) error {
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if !util.CheckPassword(user.Password, password) {
+		return ErrTwoFactorPasswordWrong
+	}
+	if user.Role == "admin" {
+		policy, err := s.GetPolicy(ctx)
+		if err != nil {
+			return err
+		}
+		if policy.RequireAdmin2FA {
+			return ErrAdminTwoFactorDisabling
+		}
+	}
+	if err := s.verify(ctx, &user, code); err != nil {
+		return err
+	}
+
+	if err := s.repo.DisableTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("关闭两步验证失败: %v", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes 作废全部旧恢复码并生成新的，需要验证器中的动态码
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := s.checkTOTP(ctx, userID, user.TOTPSecret, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("保存恢复码失败: %v", err)
+	}
+	return codes, nil
+}
+
+// Status 返回是否已开启、剩余恢复码数量，以及安全策略是否要求该用户开启
+func (s *TwoFactorService) Status(ctx context.Context, userID int) (bool, int64, bool, error) {
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return false, 0, false, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+
+	var remaining int64
+	if user.TOTPEnabled {
+		remaining, err = s.repo.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return false, 0, false, err
+		}
+	}
+
+	required := false
+	if user.Role == "admin" {
+		policy, err := s.GetPolicy(ctx)
+		if err != nil {
+			return false, 0, false, err
+		}
+		required = policy.RequireAdmin2FA
+	}
+
+	return user.TOTPEnabled, remaining, required, nil
+}
+
+// Challenge 密码验证通过后签发登录挑战令牌
+func (s *TwoFactorService) Challenge(userID int) (string, int, error) {
+	token, err := s.jwtUtil.GenerateChallengeToken(userID, challengeTTL)
+	if err != nil {
+		return "", 0, fmt.Errorf("签发登录挑战失败: %v", err)
+	}
+	return token, int(challengeTTL.Seconds()), nil
+}
+
+// CompleteLogin 用登录挑战令牌与动态码（或恢复码）完成登录，每个挑战最多尝试5次、只能成功使用一次
+// 同一用户累计输错10次后锁定15分钟，期间不再校验验证码也不签发新的挑战
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, challengeToken, code, clientIP string) (*model.User, error) {
+	userID, challengeID, err := s.jwtUtil.ValidateChallengeToken(challengeToken)
+	if err != nil {
+		return nil, ErrTwoFactorChallenge
+	}
+
+	//已经换取过令牌或尝试次数过多的挑战不再校验验证码，避免白白消耗恢复码
+	attempts, consumed, err := s.cache.Attempt(ctx, challengeID, challengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if consumed || attempts > challengeMaxAttempts {
+		return nil, ErrTwoFactorChallenge
+	}
+
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if user.IsBanned {
+		return nil, ErrUserBanned
+	}
+	if !user.TOTPEnabled {
+		// 签发挑战后关闭了两步验证，重新走密码登录
+		return nil, ErrTwoFactorChallenge
+	}
+	if err := checkTwoFactorLock(ctx, s.cache, user.UserID); err != nil {
+		return nil, err
+	}
+
+	if err := s.verify(ctx, &user, code); err != nil {
+		if errors.Is(err, ErrTwoFactorCodeWrong) {
+			if attempts == challengeMaxAttempts {
+				s.audit(ctx, user.UserID, clientIP, user.Username, fmt.Sprintf("连续输错两步验证码%d次，本次登录已失效", attempts))
+			}
+			failures, recordErr := s.cache.RecordFailure(ctx, user.UserID, userMaxFailures, userLockoutTTL)
+			if recordErr != nil {
+				return nil, recordErr
+			}
+			if failures == userMaxFailures {
+				s.audit(ctx, user.UserID, clientIP, user.Username, fmt.Sprintf("累计输错两步验证码%d次，锁定%d分钟", failures, int(userLockoutTTL.Minutes())))
+			}
+		}
+		return nil, err
+	}
+	if err := s.cache.ClearFailures(ctx, user.UserID); err != nil {
+		zap.S().Errorf("清除两步验证失败次数失败: %v", err)
+	}
+
+	ok, err := s.cache.ConsumeChallenge(ctx, challengeID, challengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTwoFactorChallenge
+	}
+
+	return &user, nil
+}
+
+// checkTwoFactorLock 用户累计输错两步验证码达到上限时返回ErrTwoFactorLocked
+func checkTwoFactorLock(ctx context.Context, twoFactorCache cache.TwoFactorCache, userID int) error {
+	failures, err := twoFactorCache.Failures(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if failures >= userMaxFailures {
+		return ErrTwoFactorLocked
+	}
+	return nil
+}
+
+// GetPolicy 返回当前生效的安全策略，未修改过时为config.yaml中的默认值
+func (s *TwoFactorService) GetPolicy(ctx context.Context) (*model.SecurityPolicy, error) {
+	policy, err := s.repo.GetSecurityPolicy(ctx)
+	if err == nil {
+		return policy, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("获取安全策略失败: %v", err)
+	}
+	return &model.SecurityPolicy{
+		RequireAdmin2FA: s.defaults.RequireAdmin2FA,
+	}, nil
+}
+
+// UpdatePolicy 未传的字段保持不变
+func (s *TwoFactorService) UpdatePolicy(ctx context.Context, req *model.UpdateSecurityPolicyRequest) (*model.SecurityPolicy, error) {
+	policy, err := s.GetPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.RequireAdmin2FA != nil {
+		policy.RequireAdmin2FA = *req.RequireAdmin2FA
+	}
+	if err := s.repo.SaveSecurityPolicy(ctx, policy); err != nil {
+		return nil, fmt.Errorf("保存安全策略失败: %v", err)
+	}
+	return policy, nil
+}
+
+// CheckAdmin 安全策略要求时，未开启两步验证的管理员返回ErrAdminTwoFactorRequired
+func (s *TwoFactorService) CheckAdmin(ctx context.Context, userID int) error {
+	policy, err := s.GetPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if !policy.RequireAdmin2FA {
+		return nil
+	}
+
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	if !user.TOTPEnabled {
+		return ErrAdminTwoFactorRequired
+	}
+	return nil
+}
+
+// verify 6位数字按动态码校验，其余按恢复码校验
+func (s *TwoFactorService) verify(ctx context.Context, user *model.User, code string) error {
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		return s.checkTOTP(ctx, user.UserID, user.TOTPSecret, code)
+	}
+
+	ok, err := s.repo.UseRecoveryCode(ctx, user.UserID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTwoFactorCodeWrong
+	}
+	return nil
+}
+
+// checkTOTP 校验动态码，同一个动态码通过一次后在有效期内不能再次使用
+func (s *TwoFactorService) checkTOTP(ctx context.Context, userID int, secret, code string) error {
+	code = strings.TrimSpace(code)
+	ok, err := totp.ValidateCustom(code, secret, time.Now(), totp.ValidateOpts{
+		Period:    totpPeriod,
+		Skew:      totpSkew,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil || !ok {
+		return ErrTwoFactorCodeWrong
+	}
+
+	fresh, err := s.cache.MarkCodeUsed(ctx, userID, code, totpReplayTTL)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrTwoFactorCodeWrong
+	}
+	return nil
+}
+
+func (s *TwoFactorService) audit(ctx context.Context, userID int, clientIP, target, detail string) {
+	log := &model.AuditLog{
+		Type:   model.AuditTwoFactorFailure,
+		UserID: uint(userID),
+		IP:     clientIP,
+		Target: target,
+		Detail: detail,
+	}
+	if err := s.auditRepo.CreateAuditLog(ctx, log); err != nil {
+		zap.S().Errorf("写入审计记录失败: %v", err)
+	}
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// generateRecoveryCodes 生成形如 k7m2p-x9q4r 的恢复码，返回明文与保存到数据库的摘要
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeHalfLen*2)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeCharset))))
+			if err != nil {
+				return nil, nil, fmt.Errorf("生成恢复码失败: %v", err)
+			}
+			b[j] = recoveryCodeCharset[n.Int64()]
+		}
+		code := string(b[:recoveryCodeHalfLen]) + "-" + string(b[recoveryCodeHalfLen:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 恢复码是随机生成的，熵足够，使用SHA-256即可；忽略大小写、空格与"-"
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
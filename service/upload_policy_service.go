@@ -0,0 +1,305 @@
+package services
+
+import (
+	"ClaranCloudDisk/config"
+	"ClaranCloudDisk/dao/cache"
+	"ClaranCloudDisk/dao/mysql"
+	"ClaranCloudDisk/model"
+	"ClaranCloudDisk/util/filetype"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 上传策略相关错误，handler据此返回对应的状态码
+var (
+	ErrPolicyExtDenied    = errors.New("上传策略不允许该扩展名")
+	ErrPolicyTypeDenied   = errors.New("上传策略不允许该文件类型")
+	ErrPolicyFileTooLarge = errors.New("超过上传策略限制的单个文件大小")
+	ErrPolicyFileCount    = errors.New("文件数量已达上限")
+	ErrPolicyDailyLimit   = errors.New("今日上传总量已达上限")
+)
+
+type UploadPolicyService struct {
+	policyRepo mysql.UploadPolicyRepository
+	userRepo   mysql.UserRepository
+	fileRepo   mysql.FileRepository
+	dailyCache cache.DailyUploadCache
+	defaults   config.UploadPolicyConfig
+}
+
+func NewUploadPolicyService(policyRepo mysql.UploadPolicyRepository, userRepo mysql.UserRepository, fileRepo mysql.FileRepository, dailyCache cache.DailyUploadCache, defaults config.UploadPolicyConfig) *UploadPolicyService {
+	return &UploadPolicyService{
+		policyRepo: policyRepo,
+		userRepo:   userRepo,
+		fileRepo:   fileRepo,
+		dailyCache: dailyCache,
+		defaults:   defaults,
+	}
+}
+
+// Get 当前生效的上传策略：管理员修改过则使用数据库中的策略，否则使用config.yaml中的默认值
+func (s *UploadPolicyService) Get(ctx context.Context) (*model.UploadPolicy, error) {
+	policy, err := s.policyRepo.GetUploadPolicy(ctx)
+	if err == nil {
+		return policy, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("获取上传策略失败: %v", err)
+	}
+
+	return &model.UploadPolicy{
+		AllowExts:        normalizeExts(s.defaults.AllowExts),
+		DenyExts:         normalizeExts(s.defaults.DenyExts),
+		AllowMimes:       normalizeMimes(s.defaults.AllowMimes),
+		DenyMimes:        normalizeMimes(s.defaults.DenyMimes),
+		UserMaxFileSize:  s.defaults.UserMaxFileSize,
+		VIPMaxFileSize:   s.defaults.VIPMaxFileSize,
+		AdminMaxFileSize: s.defaults.AdminMaxFileSize,
+		MaxFileCount:     s.defaults.MaxFileCount,
+		DailyUploadLimit: s.defaults.DailyUploadLimit,
+	}, nil
+}
+
+// Update 在当前策略的基础上修改，未传的字段保持不变
+func (s *UploadPolicyService) Update(ctx context.Context, req *model.UpdateUploadPolicyRequest) (*model.UploadPolicy, error) {
+	policy, err := s.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AllowExts != nil {
+		policy.AllowExts = normalizeExts(*req.AllowExts)
+	}
+	if req.DenyExts != nil {
+		policy.DenyExts = normalizeExts(*req.DenyExts)
+	}
+	if req.AllowMimes != nil {
+		policy.AllowMimes = normalizeMimes(*req.AllowMimes)
+	}
+	if req.DenyMimes != nil {
+		policy.DenyMimes = normalizeMimes(*req.DenyMimes)
+	}
+	if req.UserMaxFileSize != nil {
+		policy.UserMaxFileSize = *req.UserMaxFileSize
+	}
+	if req.VIPMaxFileSize != nil {
+		policy.VIPMaxFileSize = *req.VIPMaxFileSize
+	}
+	if req.AdminMaxFileSize != nil {
+		policy.AdminMaxFileSize = *req.AdminMaxFileSize
+	}
+	if req.MaxFileCount != nil {
+		policy.MaxFileCount = *req.MaxFileCount
+	}
+	if req.DailyUploadLimit != nil {
+		policy.DailyUploadLimit = *req.DailyUploadLimit
+	}
+
+	if err := s.policyRepo.SaveUploadPolicy(ctx, policy); err != nil {
+		return nil, fmt.Errorf("保存上传策略失败: %v", err)
+	}
+
+	return policy, nil
+}
+
+// Reset 删除管理员修改过的策略，恢复为config.yaml中的默认值
+func (s *UploadPolicyService) Reset(ctx context.Context) (*model.UploadPolicy, error) {
+	if err := s.policyRepo.DeleteUploadPolicy(ctx); err != nil {
+		return nil, fmt.Errorf("重置上传策略失败: %v", err)
+	}
+	return s.Get(ctx)
+}
+
+// CheckFile 上传开始前检查扩展名、按角色的单个文件大小与文件数量
+func (s *UploadPolicyService) CheckFile(ctx context.Context, userID int, fileName string, size int64) error {
+	policy, err := s.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkExt(policy, extOf(fileName)); err != nil {
+		return err
+	}
+
+	// 按角色限制单个文件大小
+	maxSize, err := s.roleMaxFileSize(policy, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkRoleSize(maxSize, size); err != nil {
+		return err
+	}
+
+	// 文件数量
+	if policy.MaxFileCount > 0 {
+		count, err := s.fileRepo.CountByUserID(ctx, uint(userID))
+		if err != nil {
+			return fmt.Errorf("获取文件数量失败: %v", err)
+		}
+		if count >= policy.MaxFileCount {
+			return fmt.Errorf("%w: 最多 %d 个文件", ErrPolicyFileCount, policy.MaxFileCount)
+		}
+	}
+
+	return nil
+}
+
+// MaxFileSizeChecker 计算一次用户角色对应的单个文件大小上限，返回的函数用于大小未知时（如离线下载无Content-Length）边写入边检查
+func (s *UploadPolicyService) MaxFileSizeChecker(ctx context.Context, userID int) (func(size int64) error, error) {
+	policy, err := s.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := s.roleMaxFileSize(policy, userID)
+	if err != nil {
+		return nil, err
+	}
+	return func(size int64) error {
+		return checkRoleSize(maxSize, size)
+	}, nil
+}
+
+// roleMaxFileSize 按角色取单个文件大小上限（MB），0表示不限制
+func (s *UploadPolicyService) roleMaxFileSize(policy *model.UploadPolicy, userID int) (int64, error) {
+	user, err := s.userRepo.SelectByUserID(userID)
+	if err != nil {
+		return 0, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+	switch {
+	case user.Role == "admin":
+		return policy.AdminMaxFileSize, nil
+	case user.IsVIP:
+		return policy.VIPMaxFileSize, nil
+	default:
+		return policy.UserMaxFileSize, nil
+	}
+}
+
+func checkRoleSize(maxSize, size int64) error {
+	if maxSize > 0 && size > maxSize*1048576 {
+		return fmt.Errorf("%w: 单个文件大小不能超过 %dMB", ErrPolicyFileTooLarge, maxSize)
+	}
+	return nil
+}
+
+// CheckType 根据文件头识别出类型后检查扩展名与识别类型
+// ext为按MimeMismatchPolicy处理后的最终扩展名
+func (s *UploadPolicyService) CheckType(ctx context.Context, ext string, mime string) error {
+	policy, err := s.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkExt(policy, strings.ToLower(ext)); err != nil {
+		return err
+	}
+
+	// 未识别过类型的历史文件（如转存旧文件）只检查扩展名
+	if mime == "" {
+		return nil
+	}
+	mime = strings.ToLower(filetype.BaseMIME(mime))
+	for _, pattern := range policy.DenyMimes {
+		if matchMime(pattern, mime) {
+			return fmt.Errorf("%w: %s", ErrPolicyTypeDenied, mime)
+		}
+	}
+	if len(policy.AllowMimes) == 0 {
+		return nil
+	}
+	for _, pattern := range policy.AllowMimes {
+		if matchMime(pattern, mime) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrPolicyTypeDenied, mime)
+}
+
+// ReserveDaily 记入当天上传总量，超过上限时返回ErrPolicyDailyLimit
+// 上传失败或取消时需调用ReleaseDaily退回
+func (s *UploadPolicyService) ReserveDaily(ctx context.Context, userID int, reservationID string, size int64) error {
+	policy, err := s.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if policy.DailyUploadLimit <= 0 {
+		return nil
+	}
+
+	ok, err := s.dailyCache.Reserve(ctx, userID, reservationID, size, policy.DailyUploadLimit*1048576)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: 每天最多上传 %dMB，请明天再试", ErrPolicyDailyLimit, policy.DailyUploadLimit)
+	}
+	return nil
+}
+
+// ReleaseDaily 退回ReserveDaily记入的上传量
+func (s *UploadPolicyService) ReleaseDaily(ctx context.Context, userID int, reservationID string) {
+	if err := s.dailyCache.Release(ctx, userID, reservationID); err != nil {
+		zap.S().Errorf("退回每日上传量失败: %v", err)
+	}
+}
+
+func checkExt(policy *model.UploadPolicy, ext string) error {
+	for _, denied := range policy.DenyExts {
+		if ext == denied {
+			return fmt.Errorf("%w: .%s", ErrPolicyExtDenied, ext)
+		}
+	}
+	if len(policy.AllowExts) == 0 {
+		return nil
+	}
+	for _, allowed := range policy.AllowExts {
+		if ext == allowed {
+			return nil
+		}
+	}
+	if ext == "" {
+		return fmt.Errorf("%w: 无扩展名", ErrPolicyExtDenied)
+	}
+	return fmt.Errorf("%w: .%s", ErrPolicyExtDenied, ext)
+}
+
+// matchMime 支持"image/*"形式的通配
+func matchMime(pattern, mime string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mime, prefix+"/")
+	}
+	return pattern == mime
+}
+
+func extOf(fileName string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+}
+
+// normalizeExts 统一为小写、不含"."
+func normalizeExts(exts []string) []string {
+	list := []string{}
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			list = append(list, ext)
+		}
+	}
+	return list
+}
+
+func normalizeMimes(mimes []string) []string {
+	list := []string{}
+	for _, m := range mimes {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m != "" {
+			list = append(list, m)
+		}
+	}
+	return list
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"ClaranCloudDisk/dao/cache"
 	"ClaranCloudDisk/dao/mysql"
 	"ClaranCloudDisk/model"
 	"ClaranCloudDisk/util"
@@ -16,27 +17,40 @@ import (
 	"mime/multipart"
 	"path/filepath"
 	"strings"
+
+	"go.uber.org/zap"
 )
 
 type UserService struct {
-	UserRepo    mysql.UserRepository
-	TokenRepo   mysql.TokenRepository
-	jwtUtil     jwt_util.Util
-	AvatarDIR   string
-	minioClient *minIO.MinIOClient
+	UserRepo                 mysql.UserRepository
+	TokenRepo                mysql.TokenRepository
+	sessionService           *SessionService
+	verificationService      *VerificationService
+	twoFactorCache           cache.TwoFactorCache
+	jwtUtil                  jwt_util.Util
+	AvatarDIR                string
+	minioClient              *minIO.MinIOClient
+	requireEmailVerification bool // 注册时是否必须提交邮箱验证凭证
 }
 
-func NewUserService(userRepo mysql.UserRepository, tokenRepo mysql.TokenRepository, jwtUtil jwt_util.Util, avatarDIR string, minioClient *minIO.MinIOClient) *UserService {
+func NewUserService(userRepo mysql.UserRepository, tokenRepo mysql.TokenRepository, sessionService *SessionService, verificationService *VerificationService, twoFactorCache cache.TwoFactorCache, jwtUtil jwt_util.Util, avatarDIR string, minioClient *minIO.MinIOClient, requireEmailVerification bool) *UserService {
 	return &UserService{
-		UserRepo:    userRepo,
-		TokenRepo:   tokenRepo,
-		jwtUtil:     jwtUtil,
-		AvatarDIR:   avatarDIR,
-		minioClient: minioClient,
+		UserRepo:                 userRepo,
+		TokenRepo:                tokenRepo,
+		sessionService:           sessionService,
+		verificationService:      verificationService,
+		twoFactorCache:           twoFactorCache,
+		jwtUtil:                  jwtUtil,
+		AvatarDIR:                avatarDIR,
+		minioClient:              minioClient,
+		requireEmailVerification: requireEmailVerification,
 	}
 }
 
-func (s *UserService) Register(req *model.RegisterRequest) (*model.User, *model.InvitationCode, error) {
+// ErrEmailVerificationRequired 开启邮箱验证后不能直接修改邮箱
+var ErrEmailVerificationRequired = errors.New("修改邮箱需要验证新邮箱，请使用/user/email/change")
+
+func (s *UserService) Register(ctx context.Context, req *model.RegisterRequest) (*model.User, *model.InvitationCode, error) {
 	//邀请码是否正确
 	invitationCode, err := s.UserRepo.ValidateInvitationCode(req.InviteCode)
 	if err != nil {
@@ -59,6 +73,13 @@ func (s *UserService) Register(req *model.RegisterRequest) (*model.User, *model.
 		return nil, nil, errors.New("email format Error" + err.Error())
 	}
 
+	//邮箱验证凭证，证明邮箱属于本人
+	if s.requireEmailVerification {
+		if err := s.verificationService.CheckEmailProof(ctx, req.Email, req.EmailToken); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	//加密密码
 	hashedPassword, err := util.HashPassword(req.Password)
 	if err != nil {
@@ -92,10 +113,17 @@ func (s *UserService) Register(req *model.RegisterRequest) (*model.User, *model.
 		return nil, nil, errors.New("使用邀请码时出现错误" + err.Error())
 	}
 
+	//注册成功后作废邮箱验证凭证
+	if s.requireEmailVerification {
+		if err := s.verificationService.DeleteEmailProof(ctx, req.EmailToken); err != nil {
+			zap.S().Errorf("作废邮箱验证凭证失败: %v", err)
+		}
+	}
+
 	return user, &invitationCode, nil
 }
 
-func (s *UserService) Login(loginKey, password string) (string, *model.User, error, string) {
+func (s *UserService) Login(ctx context.Context, loginKey, password, userAgent, clientIP string) (string, *model.User, error, string) {
 	//判断是邮箱登录还是用户名登录
 	var user *model.User
 	var at, point bool
@@ -136,41 +164,35 @@ func (s *UserService) Login(loginKey, password string) (string, *model.User, err
 		return "", nil, errors.New("password error"), ""
 	}
 
-	//access token
-	token, err := s.jwtUtil.GenerateToken(user.UserID, user.Username, user.Role, 1)
-	//refresh token
-	refreshToken, err := s.jwtUtil.GenerateToken(user.UserID, user.Username, user.Role, 255)
+	//开启了两步验证，先不签发令牌；两步验证被锁定时也不签发登录挑战
+	if user.TOTPEnabled {
+		if err := checkTwoFactorLock(ctx, s.twoFactorCache, user.UserID); err != nil {
+			return "", nil, err, ""
+		}
+		return "", user, ErrTwoFactorRequired, ""
+	}
+
+	token, refreshToken, err := s.IssueTokens(ctx, user, userAgent, clientIP)
 	if err != nil {
-		return "", nil, errors.New("token Error" + err.Error()), ""
+		return "", nil, err, ""
 	}
 
 	return token, user, nil, refreshToken
 }
 
-func (s *UserService) Refresh(refreshToken model.RefreshTokenRequest) (string, error) {
-	//验证token
-	token, err := s.jwtUtil.ValidateToken(refreshToken.RefreshToken)
+// IssueTokens 创建登录会话并签发access token与refresh token，密码登录与两步验证登录共用
+func (s *UserService) IssueTokens(ctx context.Context, user *model.User, userAgent, clientIP string) (string, string, error) {
+	token, refreshToken, err := s.sessionService.Create(ctx, user, userAgent, clientIP)
 	if err != nil {
-		return "", errors.New("refresh Token Error" + err.Error())
+		return "", "", errors.New("token Error" + err.Error())
 	}
 
-	//提取声明
-	claims, err := s.jwtUtil.ExtractClaims(token)
-	if err != nil {
-		return "", errors.New("extract claims failed" + err.Error())
-	}
-
-	var userID int
-	if userIDFloat, ok := claims["user_id"].(float64); ok {
-		// 安全转换：float64 转 int
-		userID = int(userIDFloat)
-	}
-	newToken, err := s.jwtUtil.GenerateToken(userID, claims["username"].(string), claims["role"].(string), 1)
-	if err != nil {
-		return "", errors.New("token generate failed" + err.Error())
-	}
+	return token, refreshToken, nil
+}
 
-	return newToken, nil
+// Refresh 轮换刷新令牌，返回新的access token与refresh token
+func (s *UserService) Refresh(ctx context.Context, refreshToken model.RefreshTokenRequest, clientIP string) (string, string, error) {
+	return s.sessionService.Refresh(ctx, refreshToken.RefreshToken, clientIP)
 }
 
 func (s *UserService) CheckStorage(UserID int) (int64, error) {
@@ -181,12 +203,21 @@ func (s *UserService) CheckStorage(UserID int) (int64, error) {
 	return UsedStorage, nil
 }
 
-func (s *UserService) Logout(token string) error {
+func (s *UserService) Logout(ctx context.Context, token string, userID int, sessionID string) error {
 	//加入token黑名单
 	err := s.TokenRepo.AddBlackList(token)
 	if err != nil {
 		return errors.New("add black list failed: " + err.Error())
 	}
+
+	//撤销当前会话，刷新令牌随之失效
+	if sessionID == "" {
+		return nil
+	}
+	err = s.sessionService.Revoke(ctx, userID, sessionID, model.SessionRevokeLogout)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
 	return nil
 }
 
@@ -199,6 +230,9 @@ func (s *UserService) UpdateInfo(UserID int, req model.UpdateRequest) (model.Use
 	}
 
 	if req.Email != "" {
+		if s.requireEmailVerification {
+			return model.User{}, ErrEmailVerificationRequired
+		}
 		//邮箱是否符合格式
 		if !strings.Contains(req.Email, "@") {
 			return model.User{}, errors.New("email format Error")
@@ -218,14 +252,8 @@ func (s *UserService) UpdateInfo(UserID int, req model.UpdateRequest) (model.Use
 
 	if req.Password != "" {
 		//密码时候否符合格式
-		var flagPassword bool
-		for i := 0; i < len(req.Password); i++ {
-			if !((req.Password[i] >= 'a' && req.Password[i] <= 'z') || (req.Password[i] >= '0' && req.Password[i] <= '9') || (req.Password[i] >= 'A' && req.Password[i] <= 'Z')) {
-				flagPassword = true
-			}
-		}
-		if flagPassword {
-			return model.User{}, errors.New("password format Error")
+		if err := checkPasswordFormat(req.Password); err != nil {
+			return model.User{}, err
 		}
 		//加密密码
 		hashedPassword, err := util.HashPassword(req.Password)
@@ -420,3 +448,16 @@ func (s *UserService) GetAvatar(userID int) (string, error) {
 	}
 	return avatarPath, nil
 }
+
+// ErrPasswordFormat 密码只能由字母和数字组成
+var ErrPasswordFormat = errors.New("password format Error")
+
+// checkPasswordFormat 修改密码与找回密码共用
+func checkPasswordFormat(password string) error {
+	for i := 0; i < len(password); i++ {
+		if !((password[i] >= 'a' && password[i] <= 'z') || (password[i] >= '0' && password[i] <= '9') || (password[i] >= 'A' && password[i] <= 'Z')) {
+			return ErrPasswordFormat
+		}
+	}
+	return nil
+}
@@ -12,17 +12,41 @@ import (
 	"net/smtp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jordan-wright/email"
 )
 
+// 验证码用途，不同用途的验证码互不通用，注册时获取的验证码不能用于找回密码
+const (
+	VerificationPurposeRegister      = "register"       // 注册等通用的邮箱验证
+	VerificationPurposeResetPassword = "reset_password" // 找回密码
+	VerificationPurposeChangeEmail   = "change_email"   // 修改邮箱时验证新邮箱
+)
+
+// verificationPurposeTitles 验证码邮件中按用途显示的标题
+var verificationPurposeTitles = map[string]string{
+	VerificationPurposeRegister:      "邮箱验证码",
+	VerificationPurposeResetPassword: "找回密码",
+	VerificationPurposeChangeEmail:   "修改邮箱",
+}
+
+// maxVerificationAttempts 同一个验证码最多输错的次数，超过后验证码作废
+const maxVerificationAttempts = 5
+
+// EmailProofTTL 验证邮箱后签发的邮箱验证凭证有效期
+const EmailProofTTL = 30 * time.Minute
+
+var ErrEmailProofInvalid = errors.New("邮箱验证凭证无效或已过期，请重新验证邮箱")
+
 type VerificationService struct {
 	verificationCache cache.VerificationCodeCache
+	emailCache        cache.EmailCache
 	emailConfig       *config.EmailConfig
 	//pool              *email.Pool
 }
 
-func NewVerificationService(verificationCache cache.VerificationCodeCache, emailConfig config.EmailConfig) *VerificationService {
+func NewVerificationService(verificationCache cache.VerificationCodeCache, emailCache cache.EmailCache, emailConfig config.EmailConfig) *VerificationService {
 	// 创建邮件连接池
 	//pool, err := email.NewPool(
 	//	fmt.Sprintf("%s:%d", emailConfig.SMTPHost, emailConfig.SMTPPort),
@@ -35,19 +59,25 @@ func NewVerificationService(verificationCache cache.VerificationCodeCache, email
 
 	return &VerificationService{
 		verificationCache: verificationCache,
+		emailCache:        emailCache,
 		emailConfig:       &emailConfig,
 		//pool:              pool,
 	}
 }
 
 func (s *VerificationService) SendVerificationCode(ctx context.Context, req model.GetVerificationCodeRequest) error {
+	return s.SendCode(ctx, req.Email, VerificationPurposeRegister)
+}
+
+// SendCode 向邮箱发送指定用途的验证码
+func (s *VerificationService) SendCode(ctx context.Context, email, purpose string) error {
 	// 验证邮箱格式
-	if !strings.Contains(req.Email, "@") {
+	if !strings.Contains(email, "@") {
 		return errors.New("邮箱格式不正确")
 	}
 
 	// 限流
-	rateLimited, err := s.verificationCache.CheckRateLimit(ctx, req.Email)
+	rateLimited, err := s.verificationCache.CheckRateLimit(ctx, email)
 	if err != nil {
 		return fmt.Errorf("检查频率限制失败: %v", err)
 	}
@@ -68,19 +98,19 @@ func (s *VerificationService) SendVerificationCode(ctx context.Context, req mode
 	code := string(basicCode)
 
 	// 下沉数据层
-	if err := s.verificationCache.SaveVerificationCode(ctx, req.Email, code); err != nil {
+	if err := s.verificationCache.SaveVerificationCode(ctx, purpose, email, code); err != nil {
 		return fmt.Errorf("保存验证码失败: %v", err)
 	}
 
 	// 发送邮件
-	if err := s.SendEmail(ctx, req.Email, code); err != nil {
+	if err := s.SendEmail(ctx, email, code, purpose); err != nil {
 		// 发送失败，回滚
-		errEx := s.verificationCache.DeleteVerificationCode(ctx, req.Email)
+		errEx := s.verificationCache.DeleteVerificationCode(ctx, purpose, email)
 		return fmt.Errorf("发送邮件失败: %v & %v", err, errEx)
 	}
 
 	// 设置频率锁
-	err = s.verificationCache.SetRateLimit(ctx, req.Email)
+	err = s.verificationCache.SetRateLimit(ctx, email)
 	if err != nil {
 		return fmt.Errorf("设置频率锁失败: %v", err)
 	}
@@ -89,13 +119,18 @@ func (s *VerificationService) SendVerificationCode(ctx context.Context, req mode
 }
 
 func (s *VerificationService) VerifyVerificationCode(ctx context.Context, req model.VerifyVerificationCodeRequest) (bool, error) {
+	return s.VerifyCode(ctx, req.Email, VerificationPurposeRegister, req.Code)
+}
+
+// VerifyCode 校验指定用途的验证码，验证通过或连续输错5次后验证码作废
+func (s *VerificationService) VerifyCode(ctx context.Context, email, purpose, inputCode string) (bool, error) {
 	// 检查验证码格式
-	if len(req.Code) != 6 {
+	if len(inputCode) != 6 {
 		return false, errors.New("验证码必须是6位数字")
 	}
 
 	// 访问数据层
-	code, err := s.verificationCache.GetVerificationCode(ctx, req.Email)
+	code, err := s.verificationCache.GetVerificationCode(ctx, purpose, email)
 	if err != nil {
 		if err.Error() == "redis: nil" {
 			return false, errors.New("验证码不存在或已过期")
@@ -104,12 +139,23 @@ func (s *VerificationService) VerifyVerificationCode(ctx context.Context, req mo
 	}
 
 	// 验证
-	if code != req.Code {
+	if code != inputCode {
+		attempts, err := s.verificationCache.IncrAttempts(ctx, purpose, email)
+		if err != nil {
+			return false, err
+		}
+		if attempts >= maxVerificationAttempts {
+			// 输错次数过多，作废验证码防止暴力尝试
+			if err := s.verificationCache.DeleteVerificationCode(ctx, purpose, email); err != nil {
+				return false, errors.New("删除验证码失败" + err.Error())
+			}
+			return false, errors.New("验证码错误次数过多，请重新获取")
+		}
 		return false, errors.New("验证码错误")
 	}
 
 	// 删除验证码
-	err = s.verificationCache.DeleteVerificationCode(ctx, req.Email)
+	err = s.verificationCache.DeleteVerificationCode(ctx, purpose, email)
 	if err != nil {
 		return true, errors.New("删除验证码失败" + err.Error())
 	}
@@ -117,9 +163,45 @@ func (s *VerificationService) VerifyVerificationCode(ctx context.Context, req mo
 	return true, nil
 }
 
-func (s *VerificationService) SendEmail(ctx context.Context, toEmail, code string) error {
+// IssueEmailProof 验证码校验通过后签发邮箱验证凭证，注册时提交以证明邮箱属于本人
+func (s *VerificationService) IssueEmailProof(ctx context.Context, email string) (string, int, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", 0, fmt.Errorf("生成邮箱验证凭证失败: %v", err)
+	}
+	if err := s.emailCache.SaveProof(ctx, hashToken(token), email, EmailProofTTL); err != nil {
+		return "", 0, err
+	}
+	return token, int(EmailProofTTL.Seconds()), nil
+}
+
+// CheckEmailProof 校验邮箱验证凭证与邮箱是否对应，不会使凭证失效
+func (s *VerificationService) CheckEmailProof(ctx context.Context, email, token string) error {
+	if token == "" {
+		return ErrEmailProofInvalid
+	}
+	verified, err := s.emailCache.GetProof(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if verified == "" || !strings.EqualFold(verified, email) {
+		return ErrEmailProofInvalid
+	}
+	return nil
+}
+
+// DeleteEmailProof 使用后作废邮箱验证凭证
+func (s *VerificationService) DeleteEmailProof(ctx context.Context, token string) error {
+	return s.emailCache.DeleteProof(ctx, hashToken(token))
+}
+
+func (s *VerificationService) SendEmail(ctx context.Context, toEmail, code, purpose string) error {
 	// 构建邮件主题
 	subject := fmt.Sprintf("ClaranCloudDisk验证码")
+	title, ok := verificationPurposeTitles[purpose]
+	if !ok {
+		title = verificationPurposeTitles[VerificationPurposeRegister]
+	}
 
 	// 构建邮件内容，前端框架由AI生成
 	htmlContent := fmt.Sprintf(`
@@ -142,12 +224,12 @@ func (s *VerificationService) SendEmail(ctx context.Context, toEmail, code strin
 	</head>
 	<body>
 		<div>
-			<h3>邮箱验证码</h3>
+			<h3>%s</h3>
 			<p>您的验证码是：<span class="code">%s</span></p>
-			<p>验证码5分钟内有效，请尽快使用。</p>
+			<p>验证码5分钟内有效，请尽快使用。如非本人操作，请忽略本邮件。</p>
 		</div>
 	</body>
-	</html>`, code)
+	</html>`, title, code)
 
 	// 创建邮件
 	e := email.NewEmail()
@@ -161,3 +243,18 @@ func (s *VerificationService) SendEmail(ctx context.Context, toEmail, code strin
 	//return s.pool.Send(e, 10*time.Second)
 	return e.Send(s.emailConfig.SMTPHost+":"+strconv.Itoa(s.emailConfig.SMTPPort), smtp.PlainAuth("", s.emailConfig.FromEmail, s.emailConfig.SMTPPass, s.emailConfig.SMTPHost))
 }
+
+// SendNotification 发送纯文本通知邮件，未配置SMTP时直接返回
+func (s *VerificationService) SendNotification(toEmail, subject, text string) error {
+	if s.emailConfig.SMTPHost == "" || toEmail == "" {
+		return nil
+	}
+
+	e := email.NewEmail()
+	e.From = fmt.Sprintf("%s <%s>", s.emailConfig.FromName, s.emailConfig.FromEmail)
+	e.To = []string{toEmail}
+	e.Subject = subject
+	e.Text = []byte(text)
+
+	return e.Send(s.emailConfig.SMTPHost+":"+strconv.Itoa(s.emailConfig.SMTPPort), smtp.PlainAuth("", s.emailConfig.FromEmail, s.emailConfig.SMTPPass, s.emailConfig.SMTPHost))
+}
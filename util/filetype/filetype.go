@@ -0,0 +1,139 @@
+package filetype
+
+import (
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// 文件类别，与FileService.GetMimeType按扩展名得到的类别取值一致
+const (
+	CategoryImage    = "image"
+	CategoryVideo    = "video"
+	CategoryAudio    = "audio"
+	CategoryDocument = "document"
+	CategoryArchive  = "archive"
+	CategoryText     = "text"
+	CategoryOther    = "other"
+)
+
+// Type 根据文件头识别出的类型
+type Type struct {
+	MIME     string // 完整的MIME类型，文本类包含charset，如 "text/plain; charset=utf-8"
+	Ext      string // 该类型常用的扩展名（不含"."），无法识别时为空
+	Category string
+}
+
+// Detect 读取文件头（默认前3KB）识别真实类型，不信任扩展名与客户端声明的Content-Type
+func Detect(r io.Reader) (*Type, error) {
+	m, err := mimetype.DetectReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Type{
+		MIME:     m.String(),
+		Ext:      strings.TrimPrefix(m.Extension(), "."),
+		Category: category(m),
+	}, nil
+}
+
+var documentMIMEs = []string{
+	"application/pdf",
+	"application/msword",
+	"application/vnd.ms-excel",
+	"application/vnd.ms-powerpoint",
+	"application/x-ole-storage", // 旧版Office复合文档
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+var archiveMIMEs = []string{
+	"application/zip",
+	"application/x-rar-compressed",
+	"application/x-7z-compressed",
+	"application/x-tar",
+	"application/gzip",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/zstd",
+}
+
+// category 由具体类型向上逐级匹配，如docx先于其父类型zip被识别为文档
+func category(m *mimetype.MIME) string {
+	for t := m; t != nil; t = t.Parent() {
+		base := BaseMIME(t.String())
+		switch {
+		case strings.HasPrefix(base, "image/"):
+			return CategoryImage
+		case strings.HasPrefix(base, "video/"):
+			return CategoryVideo
+		case strings.HasPrefix(base, "audio/"):
+			return CategoryAudio
+		case strings.HasPrefix(base, "application/vnd.oasis.opendocument."):
+			return CategoryDocument
+		case mimetype.EqualsAny(base, documentMIMEs...):
+			return CategoryDocument
+		case mimetype.EqualsAny(base, archiveMIMEs...):
+			return CategoryArchive
+		case base == "text/plain":
+			return CategoryText
+		}
+	}
+	return CategoryOther
+}
+
+// BaseMIME 去掉MIME类型中的参数，如 "text/plain; charset=utf-8" -> "text/plain"
+func BaseMIME(m string) string {
+	base, _, err := mime.ParseMediaType(m)
+	if err != nil {
+		return strings.TrimSpace(strings.Split(m, ";")[0])
+	}
+	return base
+}
+
+// IsActive 是否为浏览器会执行脚本的活动内容，这类内容不能不加沙箱地内联返回
+func IsActive(m string) bool {
+	switch BaseMIME(m) {
+	case "text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml":
+		return true
+	}
+	return false
+}
+
+// Consistent 识别出的类型是否与扩展名的类别一致
+// 只有扩展名声明为媒体、文档或压缩包时才要求内容相符；文本类与未知扩展名本就按文本/下载处理
+func Consistent(detected *Type, extCategory string) bool {
+	switch extCategory {
+	case CategoryImage, CategoryVideo, CategoryAudio, CategoryDocument, CategoryArchive:
+	default:
+		return true
+	}
+
+	switch detected.Category {
+	case extCategory:
+		return true
+	case CategoryOther:
+		// 无法识别的二进制内容无从判断，不视为伪装
+		return true
+	case CategoryVideo, CategoryAudio:
+		// 同一容器（mp4/ogg/webm）既可能只有音轨也可能带视频
+		return extCategory == CategoryVideo || extCategory == CategoryAudio
+	case CategoryArchive:
+		// Office Open XML与OpenDocument本身就是zip
+		return extCategory == CategoryDocument
+	}
+	return false
+}
+
+// CategoryOf 已保存的MIME类型对应的类别
+func CategoryOf(m string) string {
+	t := mimetype.Lookup(BaseMIME(m))
+	if t == nil {
+		return CategoryOther
+	}
+	return category(t)
+}
@@ -1,11 +1,22 @@
 package jwt_util
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type Util interface {
-	GenerateToken(userID int, username string, role string, extraExpiration int64) (string, error)
+	// GenerateToken 签发登录令牌，sessionID写入sid声明、tokenVersion写入ver声明，会话被撤销或用户令牌版本变化后令牌随之失效
+	GenerateToken(userID int, username string, role string, sessionID string, tokenVersion int, extraExpiration int64) (string, error)
 	ValidateToken(tokenString string) (*jwt.Token, error)
 	ExtractClaims(token *jwt.Token) (jwt.MapClaims, error)
+	// GenerateShareToken 验证分享密码后签发的分享访问令牌，只能用于访问对应的分享
+	GenerateShareToken(uniqueID string, fingerprint string, ttl time.Duration) (string, error)
+	// ValidateShareToken 校验分享访问令牌，返回分享ID与签发时的密码指纹
+	ValidateShareToken(tokenString string) (uniqueID string, fingerprint string, err error)
+	// GenerateChallengeToken 密码验证通过、等待两步验证时签发的登录挑战令牌，不能用于访问其他接口
+	GenerateChallengeToken(userID int, ttl time.Duration) (string, error)
+	// ValidateChallengeToken 校验登录挑战令牌，返回用户ID与挑战ID
+	ValidateChallengeToken(tokenString string) (userID int, challengeID string, err error)
 }
@@ -3,6 +3,8 @@ package jwt_util
 import (
 	"ClaranCloudDisk/config"
 	"ClaranCloudDisk/model"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -23,11 +25,13 @@ func NewJWTUtil(config *config.Config) Util {
 	}
 }
 
-func (util *defaultJWTUtil) GenerateToken(userID int, username string, role string, extraExpiration int64) (string, error) {
+func (util *defaultJWTUtil) GenerateToken(userID int, username string, role string, sessionID string, tokenVersion int, extraExpiration int64) (string, error) {
 	claims := jwt.MapClaims{
 		"role":     role,
 		"username": username,
 		"user_id":  userID,
+		"sid":      sessionID,
+		"ver":      tokenVersion,
 		"iss":      util.config.Issuer,
 		"sub":      userID,
 		"iat":      time.Now().Unix(),
@@ -69,3 +73,90 @@ func (util *defaultJWTUtil) ExtractClaims(token *jwt.Token) (jwt.MapClaims, erro
 		return nil, jwt.ErrTokenInvalidClaims
 	}
 }
+
+// shareTokenType 分享访问令牌的类型标记，与登录令牌区分，互相不能混用
+const shareTokenType = "share_access"
+
+func (util *defaultJWTUtil) GenerateShareToken(uniqueID string, fingerprint string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":   shareTokenType,
+		"share": uniqueID,
+		"pwd":   fingerprint,
+		"iss":   util.config.Issuer,
+		"iat":   time.Now().Unix(),
+		"nbf":   time.Now().Unix(),
+		"exp":   time.Now().Add(ttl).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(util.config.SecretKey))
+}
+
+func (util *defaultJWTUtil) ValidateShareToken(tokenString string) (string, string, error) {
+	token, err := util.ValidateToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", "", jwt.ErrTokenInvalidClaims
+	}
+	if typ, _ := claims["typ"].(string); typ != shareTokenType {
+		return "", "", jwt.ErrTokenInvalidClaims
+	}
+	uniqueID, _ := claims["share"].(string)
+	fingerprint, _ := claims["pwd"].(string)
+	if uniqueID == "" {
+		return "", "", jwt.ErrTokenInvalidClaims
+	}
+
+	return uniqueID, fingerprint, nil
+}
+
+// challengeTokenType 登录挑战令牌的类型标记，不含user_id声明，JWTAuthentication不会接受
+const challengeTokenType = "2fa_challenge"
+
+func (util *defaultJWTUtil) GenerateChallengeToken(userID int, ttl time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"typ": challengeTokenType,
+		"uid": userID,
+		"jti": hex.EncodeToString(jti),
+		"iss": util.config.Issuer,
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"exp": time.Now().Add(ttl).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(util.config.SecretKey))
+}
+
+func (util *defaultJWTUtil) ValidateChallengeToken(tokenString string) (int, string, error) {
+	token, err := util.ValidateToken(tokenString)
+	if err != nil {
+		return 0, "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0, "", jwt.ErrTokenInvalidClaims
+	}
+	if typ, _ := claims["typ"].(string); typ != challengeTokenType {
+		return 0, "", jwt.ErrTokenInvalidClaims
+	}
+	userID, _ := claims["uid"].(float64)
+	jti, _ := claims["jti"].(string)
+	if userID <= 0 || jti == "" {
+		return 0, "", jwt.ErrTokenInvalidClaims
+	}
+
+	return int(userID), jti, nil
+}
@@ -0,0 +1,293 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// MPEG音频码率表（kbit/s），下标为帧头中的bitrate index
+var (
+	mp3BitratesV1L1 = []int{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448}
+	mp3BitratesV1L2 = []int{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384}
+	mp3BitratesV1L3 = []int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+	mp3BitratesV2L1 = []int{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256}
+	mp3BitratesV2L2 = []int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+)
+
+// MPEG音频采样率表，按版本 MPEG1 / MPEG2 / MPEG2.5
+var mp3SampleRates = map[int][]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+// skipID3v2 返回ID3v2标签之后的偏移
+func skipID3v2(r io.ReaderAt) int64 {
+	header, err := readAt(r, 0, 10)
+	if err != nil || !bytes.Equal(header[0:3], []byte("ID3")) {
+		return 0
+	}
+	// syncsafe整数，每个字节只用低7位
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	offset := 10 + size
+	if header[5]&0x10 != 0 { // footer
+		offset += 10
+	}
+	return offset
+}
+
+// parseMP3 解析第一个MPEG音频帧及Xing/Info头
+func parseMP3(r io.ReaderAt, size int64, meta *Metadata) error {
+	start := skipID3v2(r)
+
+	//在ID3之后的64KB内寻找帧同步
+	window := int64(64 * 1024)
+	if start+window > size {
+		window = size - start
+	}
+	if window < 4 {
+		return errors.New("未找到MPEG音频帧")
+	}
+	buf, err := readAt(r, start, int(window))
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		frame, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+
+		audioSize := size - start - int64(i)
+		meta.Codec = frame.codec
+		meta.Bitrate = int64(frame.bitrate) * 1000
+
+		// VBR文件使用Xing/Info头中的总帧数计算时长
+		if frames := xingFrames(buf[i:], frame); frames > 0 {
+			meta.Duration = float64(frames) * float64(frame.samples) / float64(frame.sampleRate)
+			if meta.Duration > 0 {
+				meta.Bitrate = int64(float64(audioSize*8) / meta.Duration)
+			}
+			return nil
+		}
+
+		// CBR文件按码率估算
+		if meta.Bitrate > 0 {
+			meta.Duration = float64(audioSize*8) / float64(meta.Bitrate)
+		}
+		return nil
+	}
+
+	return errors.New("未找到MPEG音频帧")
+}
+
+type mp3Frame struct {
+	version    int // 1 / 2 / 25
+	layer      int
+	bitrate    int // kbit/s
+	sampleRate int
+	samples    int // 每帧采样数
+	mono       bool
+	codec      string
+}
+
+func parseMP3Frame(b []byte) (*mp3Frame, bool) {
+	f := &mp3Frame{}
+
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		f.version = 25
+	case 2:
+		f.version = 2
+	case 3:
+		f.version = 1
+	default:
+		return nil, false
+	}
+	switch (b[1] >> 1) & 0x03 {
+	case 1:
+		f.layer = 3
+	case 2:
+		f.layer = 2
+	case 3:
+		f.layer = 1
+	default:
+		return nil, false
+	}
+
+	bitrateIndex := int(b[2] >> 4)
+	sampleIndex := int((b[2] >> 2) & 0x03)
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleIndex == 3 {
+		return nil, false
+	}
+
+	var table []int
+	switch {
+	case f.version == 1 && f.layer == 1:
+		table = mp3BitratesV1L1
+	case f.version == 1 && f.layer == 2:
+		table = mp3BitratesV1L2
+	case f.version == 1:
+		table = mp3BitratesV1L3
+	case f.layer == 1:
+		table = mp3BitratesV2L1
+	default:
+		table = mp3BitratesV2L2
+	}
+	f.bitrate = table[bitrateIndex]
+	f.sampleRate = mp3SampleRates[f.version][sampleIndex]
+	f.mono = b[3]>>6 == 3
+
+	switch f.layer {
+	case 1:
+		f.samples = 384
+		f.codec = "mp1"
+	case 2:
+		f.samples = 1152
+		f.codec = "mp2"
+	default:
+		f.samples = 1152
+		if f.version != 1 {
+			f.samples = 576
+		}
+		f.codec = "mp3"
+	}
+
+	return f, true
+}
+
+// xingFrames 读取Xing/Info头中的总帧数，不存在时返回0
+func xingFrames(b []byte, f *mp3Frame) int64 {
+	// side information长度
+	offset := 4
+	switch {
+	case f.version == 1 && f.mono:
+		offset += 17
+	case f.version == 1:
+		offset += 32
+	case f.mono:
+		offset += 9
+	default:
+		offset += 17
+	}
+	if offset+12 > len(b) {
+		return 0
+	}
+
+	tag := string(b[offset : offset+4])
+	if tag != "Xing" && tag != "Info" {
+		return 0
+	}
+	flags := u32be(b[offset+4 : offset+8])
+	if flags&0x01 == 0 {
+		return 0
+	}
+	return int64(u32be(b[offset+8 : offset+12]))
+}
+
+// parseWAV 解析RIFF/WAVE的fmt与data块
+func parseWAV(r io.ReaderAt, size int64, meta *Metadata) error {
+	header, err := readAt(r, 0, 12)
+	if err != nil {
+		return err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return errors.New("不是WAVE文件")
+	}
+
+	var byteRate uint32
+	var dataSize int64 = -1
+	for off := int64(12); off+8 <= size; {
+		chunk, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		id := string(chunk[0:4])
+		chunkSize := int64(u32le(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if chunkSize < 16 {
+				return errors.New("fmt块长度非法")
+			}
+			fmtChunk, err := readAt(r, off+8, 16)
+			if err != nil {
+				return err
+			}
+			meta.Codec = wavCodec(u16le(fmtChunk[0:2]))
+			byteRate = u32le(fmtChunk[8:12])
+		case "data":
+			dataSize = chunkSize
+			// 流式写入的文件data长度可能为0或者超出文件
+			if dataSize == 0 || off+8+dataSize > size {
+				dataSize = size - off - 8
+			}
+		}
+		if byteRate > 0 && dataSize >= 0 {
+			break
+		}
+
+		// 块按偶数字节对齐
+		off += 8 + chunkSize + chunkSize%2
+	}
+
+	if byteRate == 0 || dataSize < 0 {
+		return errors.New("WAVE文件缺少fmt或data块")
+	}
+	meta.Bitrate = int64(byteRate) * 8
+	meta.Duration = float64(dataSize) / float64(byteRate)
+
+	return nil
+}
+
+func wavCodec(format uint16) string {
+	switch format {
+	case 1, 0xfffe:
+		return "pcm"
+	case 3:
+		return "pcm_float"
+	case 6:
+		return "alaw"
+	case 7:
+		return "mulaw"
+	case 0x55:
+		return "mp3"
+	default:
+		return "wav"
+	}
+}
+
+// parseFLAC 解析STREAMINFO块
+func parseFLAC(r io.ReaderAt, size int64, meta *Metadata) error {
+	start := skipID3v2(r)
+
+	header, err := readAt(r, start, 4+4+34)
+	if err != nil {
+		return err
+	}
+	if string(header[0:4]) != "fLaC" {
+		return errors.New("不是FLAC文件")
+	}
+	// 第一个元数据块必须是STREAMINFO
+	if header[4]&0x7f != 0 {
+		return errors.New("缺少STREAMINFO")
+	}
+
+	info := header[8:]
+	// 采样率20位 | 声道3位 | 位深5位 | 总采样数36位
+	sampleRate := int64(info[10])<<12 | int64(info[11])<<4 | int64(info[12])>>4
+	totalSamples := int64(info[13]&0x0f)<<32 | int64(u32be(info[14:18]))
+
+	meta.Codec = "flac"
+	if sampleRate > 0 && totalSamples > 0 {
+		meta.Duration = float64(totalSamples) / float64(sampleRate)
+		meta.Bitrate = int64(float64((size-start)*8) / meta.Duration)
+	}
+
+	return nil
+}
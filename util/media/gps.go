@@ -0,0 +1,155 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+const gpsInfoTag = 0x8825
+
+// TIFF数据类型 -> 单个值的字节数
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// StripGPS 去除JPEG中的GPS信息
+// 从IFD0中删除GPSInfo指针并将GPS IFD的内容清零，其他EXIF字段保持不变；
+// 同时移除包含GPS字段的XMP段。返回新的文件内容以及是否确实删除了GPS信息
+func StripGPS(data []byte) ([]byte, bool, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, false, errors.New("不是JPEG文件")
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	stripped := false
+
+	off := 2
+	for off+4 <= len(data) {
+		if data[off] != 0xff {
+			return nil, false, errors.New("JPEG段结构非法")
+		}
+		marker := data[off+1]
+		// 填充字节
+		if marker == 0xff {
+			out.WriteByte(0xff)
+			off++
+			continue
+		}
+		// SOS之后是图像数据，原样写出
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[off+2 : off+4]))
+		end := off + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, false, errors.New("JPEG段长度非法")
+		}
+		segment := data[off:end]
+		payload := segment[4:]
+
+		if marker == 0xe1 {
+			switch {
+			case bytes.HasPrefix(payload, []byte("Exif\x00\x00")):
+				cleaned := append([]byte(nil), segment...)
+				ok, err := removeGPSIFD(cleaned[4+6:])
+				if err != nil {
+					return nil, false, err
+				}
+				stripped = stripped || ok
+				segment = cleaned
+			case bytes.HasPrefix(payload, []byte("http://ns.adobe.com/xap/1.0/")) && bytes.Contains(payload, []byte("GPS")):
+				// XMP中的exif:GPSLatitude等字段，整段丢弃
+				stripped = true
+				off = end
+				continue
+			}
+		}
+
+		out.Write(segment)
+		off = end
+	}
+	out.Write(data[off:])
+
+	return out.Bytes(), stripped, nil
+}
+
+// removeGPSIFD 在TIFF数据中删除GPSInfo指针并清零GPS IFD
+func removeGPSIFD(t []byte) (bool, error) {
+	if len(t) < 8 {
+		return false, errors.New("EXIF数据过短")
+	}
+
+	var order binary.ByteOrder
+	switch string(t[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false, errors.New("EXIF字节序非法")
+	}
+
+	ifd0 := int(order.Uint32(t[4:8]))
+	if ifd0+2 > len(t) {
+		return false, errors.New("IFD0偏移非法")
+	}
+	count := int(order.Uint16(t[ifd0 : ifd0+2]))
+	tableEnd := ifd0 + 2 + count*12 + 4 // 含下一个IFD偏移
+	if tableEnd > len(t) {
+		return false, errors.New("IFD0长度非法")
+	}
+
+	for i := 0; i < count; i++ {
+		entry := ifd0 + 2 + i*12
+		if order.Uint16(t[entry:entry+2]) != gpsInfoTag {
+			continue
+		}
+
+		// 清零GPS IFD及其引用的数据
+		gpsIFD := int(order.Uint32(t[entry+8 : entry+12]))
+		zeroIFD(t, gpsIFD, order)
+
+		// 后续条目与下一个IFD偏移前移12字节，并清空多出的末尾
+		copy(t[entry:], t[entry+12:tableEnd])
+		for j := tableEnd - 12; j < tableEnd; j++ {
+			t[j] = 0
+		}
+		order.PutUint16(t[ifd0:ifd0+2], uint16(count-1))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func zeroIFD(t []byte, ifd int, order binary.ByteOrder) {
+	if ifd <= 0 || ifd+2 > len(t) {
+		return
+	}
+	count := int(order.Uint16(t[ifd : ifd+2]))
+	tableEnd := ifd + 2 + count*12 + 4
+	if tableEnd > len(t) {
+		return
+	}
+
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		typ := order.Uint16(t[entry+2 : entry+4])
+		n := order.Uint32(t[entry+4 : entry+8])
+		size := uint64(tiffTypeSizes[typ]) * uint64(n)
+		// 超过4字节的值存放在偏移处
+		if size > 4 {
+			valueOff := uint64(order.Uint32(t[entry+8 : entry+12]))
+			if valueOff+size <= uint64(len(t)) {
+				for j := valueOff; j < valueOff+size; j++ {
+					t[j] = 0
+				}
+			}
+		}
+	}
+	for j := ifd; j < tableEnd; j++ {
+		t[j] = 0
+	}
+}
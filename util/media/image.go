@@ -0,0 +1,56 @@
+package media
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// parseImage 解析图片尺寸与EXIF信息
+func parseImage(r io.ReaderAt, size int64, meta *Metadata) error {
+	//尺寸：只解码文件头
+	config, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	meta.Width = config.Width
+	meta.Height = config.Height
+
+	//EXIF：没有EXIF的图片直接返回
+	x, err := exif.Decode(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil
+	}
+
+	if t, err := x.DateTime(); err == nil && !t.IsZero() {
+		meta.TakenAt = &t
+	}
+	meta.CameraMake = exifString(x, exif.Make)
+	meta.CameraModel = exifString(x, exif.Model)
+	if lat, lng, err := x.LatLong(); err == nil && (lat != 0 || lng != 0) {
+		meta.Latitude = &lat
+		meta.Longitude = &lng
+	}
+
+	return nil
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// Metadata 从文件头解析出的媒体元数据
+type Metadata struct {
+	Width       int        // 宽度（像素）
+	Height      int        // 高度（像素）
+	TakenAt     *time.Time // 拍摄时间（EXIF / 视频创建时间）
+	CameraMake  string     // 相机厂商
+	CameraModel string     // 相机型号
+	Latitude    *float64   // GPS纬度
+	Longitude   *float64   // GPS经度
+	Duration    float64    // 时长（秒）
+	Bitrate     int64      // 码率（bit/s）
+	Codec       string     // 编码格式
+}
+
+// Extract 根据扩展名解析媒体元数据
+// 不支持的类型返回空的Metadata；解析失败返回error，调用方可忽略错误继续上传
+func Extract(r io.ReaderAt, size int64, ext string) (*Metadata, error) {
+	meta := &Metadata{}
+
+	var err error
+	switch strings.ToLower(ext) {
+	case "jpg", "jpeg", "png", "gif", "bmp", "webp", "tif", "tiff":
+		err = parseImage(r, size, meta)
+	case "mp4", "mov", "m4v", "m4a", "3gp":
+		err = parseMP4(r, size, meta)
+	case "mp3":
+		err = parseMP3(r, size, meta)
+	case "wav":
+		err = parseWAV(r, size, meta)
+	case "flac":
+		err = parseFLAC(r, size, meta)
+	}
+
+	return meta, err
+}
+
+// readAt 读取[off, off+n)，越界时返回io.ErrUnexpectedEOF
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, off)
+	if read == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+func u16be(b []byte) uint16 { return binary.BigEndian.Uint16(b) }
+func u32be(b []byte) uint32 { return binary.BigEndian.Uint32(b) }
+func u64be(b []byte) uint64 { return binary.BigEndian.Uint64(b) }
+func u16le(b []byte) uint16 { return binary.LittleEndian.Uint16(b) }
+func u32le(b []byte) uint32 { return binary.LittleEndian.Uint32(b) }
@@ -0,0 +1,218 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// mp4/mov 中 mvhd 的时间从1904-01-01开始计算
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// 需要向下递归的容器box
+var mp4Containers = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+}
+
+// fourcc -> 编码名称
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"alac": "alac",
+	"Opus": "opus",
+	"fLaC": "flac",
+}
+
+type mp4Track struct {
+	handler string // vide / soun
+	codec   string
+	width   int
+	height  int
+}
+
+type mp4Parser struct {
+	r         io.ReaderAt
+	timescale uint32
+	duration  uint64
+	created   uint64
+	tracks    []*mp4Track
+	current   *mp4Track
+}
+
+// parseMP4 解析ISO BMFF（mp4/mov/m4a）的moov box
+func parseMP4(r io.ReaderAt, size int64, meta *Metadata) error {
+	p := &mp4Parser{r: r}
+	if err := p.walk(0, size, 0); err != nil {
+		return err
+	}
+	if p.timescale == 0 {
+		return errors.New("未找到mvhd")
+	}
+
+	meta.Duration = float64(p.duration) / float64(p.timescale)
+	if meta.Duration > 0 {
+		meta.Bitrate = int64(float64(size*8) / meta.Duration)
+	}
+	if p.created > 0 {
+		t := mp4Epoch.Add(time.Duration(p.created) * time.Second)
+		// 部分设备写入0或者未初始化的时间
+		if t.Year() >= 1971 {
+			meta.TakenAt = &t
+		}
+	}
+
+	// 视频轨优先
+	for _, track := range p.tracks {
+		if track.handler == "vide" {
+			meta.Width, meta.Height = track.width, track.height
+			meta.Codec = track.codec
+			return nil
+		}
+	}
+	for _, track := range p.tracks {
+		if track.handler == "soun" {
+			meta.Codec = track.codec
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (p *mp4Parser) walk(start, end int64, depth int) error {
+	if depth > 8 {
+		return nil
+	}
+
+	for off := start; off+8 <= end; {
+		header, err := readAt(p.r, off, 8)
+		if err != nil {
+			return err
+		}
+		boxSize := int64(u32be(header[0:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch boxSize {
+		case 0: // 延伸到文件末尾
+			boxSize = end - off
+		case 1: // 64位长度
+			large, err := readAt(p.r, off+8, 8)
+			if err != nil {
+				return err
+			}
+			boxSize = int64(u64be(large))
+			headerSize = 16
+		}
+		if boxSize < headerSize || off+boxSize > end {
+			return errors.New("box长度非法")
+		}
+
+		body := off + headerSize
+		bodySize := boxSize - headerSize
+
+		switch {
+		case boxType == "trak":
+			p.current = &mp4Track{}
+			p.tracks = append(p.tracks, p.current)
+			if err := p.walk(body, body+bodySize, depth+1); err != nil {
+				return err
+			}
+		case mp4Containers[boxType]:
+			if err := p.walk(body, body+bodySize, depth+1); err != nil {
+				return err
+			}
+		case boxType == "mvhd":
+			p.parseMvhd(body, bodySize)
+		case boxType == "tkhd":
+			p.parseTkhd(body, bodySize)
+		case boxType == "hdlr":
+			p.parseHdlr(body, bodySize)
+		case boxType == "stsd":
+			p.parseStsd(body, bodySize)
+		}
+
+		// moov解析完即可返回，不必扫描后面的mdat
+		if boxType == "moov" && depth == 0 {
+			return nil
+		}
+		off += boxSize
+	}
+
+	return nil
+}
+
+func (p *mp4Parser) parseMvhd(off, size int64) {
+	if size < 4 {
+		return
+	}
+	b, err := readAt(p.r, off, int(min(size, 32)))
+	if err != nil || len(b) < 20 {
+		return
+	}
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return
+		}
+		p.created = u64be(b[4:12])
+		p.timescale = u32be(b[20:24])
+		p.duration = u64be(b[24:32])
+		return
+	}
+	p.created = uint64(u32be(b[4:8]))
+	p.timescale = u32be(b[12:16])
+	p.duration = uint64(u32be(b[16:20]))
+}
+
+func (p *mp4Parser) parseTkhd(off, size int64) {
+	if p.current == nil || size < 8 {
+		return
+	}
+	// 宽高为box最后8个字节，16.16定点数
+	b, err := readAt(p.r, off+size-8, 8)
+	if err != nil {
+		return
+	}
+	p.current.width = int(u32be(b[0:4]) >> 16)
+	p.current.height = int(u32be(b[4:8]) >> 16)
+}
+
+func (p *mp4Parser) parseHdlr(off, size int64) {
+	if p.current == nil || size < 12 {
+		return
+	}
+	b, err := readAt(p.r, off+8, 4)
+	if err != nil {
+		return
+	}
+	p.current.handler = string(b)
+}
+
+func (p *mp4Parser) parseStsd(off, size int64) {
+	if p.current == nil || size < 16 {
+		return
+	}
+	// version/flags(4) entry_count(4) 第一个entry: size(4) format(4)
+	b, err := readAt(p.r, off+12, 4)
+	if err != nil {
+		return
+	}
+	format := string(b)
+	if codec, ok := mp4Codecs[format]; ok {
+		p.current.codec = codec
+		return
+	}
+	p.current.codec = format
+}
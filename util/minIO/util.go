@@ -86,6 +86,20 @@ func (m *MinIOClient) Save(ctx context.Context, objectName string, data []byte,
 	return nil
 }
 
+// SaveStream 以流的方式保存文件，避免大文件整体读入内存
+func (m *MinIOClient) SaveStream(ctx context.Context, objectName string, reader io.Reader, size int64, ext string) error {
+	mimeType := mime.TypeByExtension(ext)
+	opts := minio.PutObjectOptions{ContentType: mimeType}
+
+	_, err := m.Client.PutObject(ctx, m.BucketName, objectName, reader, size, opts)
+	if err != nil {
+		zap.S().Errorf("保存到minIO失败: %v", err)
+		return fmt.Errorf("保存到minIO失败: %v", err)
+	}
+
+	return nil
+}
+
 func (m *MinIOClient) Delete(ctx context.Context, objectName string) error {
 	//RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
 	err := m.Client.RemoveObject(ctx, m.BucketName, objectName, minio.RemoveObjectOptions{})
@@ -1,6 +1,9 @@
 package util
 
 import (
+	"crypto/rand"
+	"math/big"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,3 +21,19 @@ func CheckPassword(hashedPassword, plainPassword string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
 	return err == nil
 }
+
+// 去掉了容易混淆的0/o/1/l
+const randomPasswordCharset = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// GenerateRandomPassword 生成n位随机密码
+func GenerateRandomPassword(n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(randomPasswordCharset))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = randomPasswordCharset[idx.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,222 @@
+package preview
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Code 源码预览结果
+type Code struct {
+	Language  string `json:"language"`
+	Content   string `json:"content"`
+	Lines     int    `json:"lines"`
+	Encoding  string `json:"encoding"`  // 原始编码，utf-8或gb18030，内容统一转换为UTF-8返回
+	Truncated bool   `json:"truncated"` // 文件超出预览大小上限时仅返回前半部分
+}
+
+// 扩展名 -> 语言（取值与highlight.js/Prism的语言名保持一致，方便前端直接高亮）
+var extLanguages = map[string]string{
+	"go":     "go",
+	"py":     "python",
+	"js":     "javascript",
+	"mjs":    "javascript",
+	"cjs":    "javascript",
+	"jsx":    "javascript",
+	"ts":     "typescript",
+	"tsx":    "typescript",
+	"java":   "java",
+	"kt":     "kotlin",
+	"kts":    "kotlin",
+	"scala":  "scala",
+	"c":      "c",
+	"h":      "c",
+	"cc":     "cpp",
+	"cpp":    "cpp",
+	"cxx":    "cpp",
+	"hpp":    "cpp",
+	"cs":     "csharp",
+	"rs":     "rust",
+	"rb":     "ruby",
+	"php":    "php",
+	"swift":  "swift",
+	"m":      "objectivec",
+	"lua":    "lua",
+	"pl":     "perl",
+	"r":      "r",
+	"dart":   "dart",
+	"sh":     "bash",
+	"bash":   "bash",
+	"zsh":    "bash",
+	"ps1":    "powershell",
+	"bat":    "dos",
+	"sql":    "sql",
+	"html":   "html",
+	"htm":    "html",
+	"xml":    "xml",
+	"vue":    "html",
+	"css":    "css",
+	"scss":   "scss",
+	"less":   "less",
+	"json":   "json",
+	"yaml":   "yaml",
+	"yml":    "yaml",
+	"toml":   "toml",
+	"ini":    "ini",
+	"conf":   "ini",
+	"proto":  "protobuf",
+	"gradle": "gradle",
+	"mod":    "go",
+	"txt":    "plaintext",
+	"log":    "plaintext",
+}
+
+// 无扩展名的常见文件
+var nameLanguages = map[string]string{
+	"dockerfile":  "dockerfile",
+	"makefile":    "makefile",
+	"gemfile":     "ruby",
+	"rakefile":    "ruby",
+	"jenkinsfile": "groovy",
+	".gitignore":  "plaintext",
+	".env":        "bash",
+}
+
+// shebang解释器 -> 语言
+var shebangLanguages = map[string]string{
+	"sh":      "bash",
+	"bash":    "bash",
+	"zsh":     "bash",
+	"python":  "python",
+	"python3": "python",
+	"node":    "javascript",
+	"ruby":    "ruby",
+	"perl":    "perl",
+	"php":     "php",
+	"lua":     "lua",
+}
+
+// IsCodeExt 判断扩展名是否为已知的源码类型
+func IsCodeExt(ext string) bool {
+	_, ok := extLanguages[strings.ToLower(ext)]
+	return ok
+}
+
+// DetectLanguage 根据文件名、扩展名和shebang推断语言，无法推断时返回plaintext
+func DetectLanguage(name, ext string, data []byte) string {
+	if lang, ok := extLanguages[strings.ToLower(ext)]; ok && lang != "plaintext" {
+		return lang
+	}
+	if lang, ok := nameLanguages[strings.ToLower(filepath.Base(name))]; ok {
+		return lang
+	}
+	if lang := detectShebang(data); lang != "" {
+		return lang
+	}
+	return "plaintext"
+}
+
+// BuildCode 构造源码预览结果
+func BuildCode(name, ext string, data []byte, truncated bool) *Code {
+	content, encoding := decodeText(data, truncated)
+
+	return &Code{
+		Language:  DetectLanguage(name, ext, data),
+		Content:   content,
+		Lines:     strings.Count(content, "\n") + 1,
+		Encoding:  encoding,
+		Truncated: truncated,
+	}
+}
+
+// decodeText 将文本内容转换为UTF-8，返回转换后的内容和原始编码
+// IsBinary会放行GBK等非UTF-8文本，这类内容按GB18030（兼容GBK）解码
+func decodeText(data []byte, truncated bool) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), "utf-8"
+	}
+	// 截断可能落在多字节字符中间，最多去掉末尾一个不完整的字符
+	if truncated {
+		for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+			if utf8.Valid(data[:len(data)-i]) {
+				return string(data[:len(data)-i]), "utf-8"
+			}
+		}
+	}
+
+	// 非法的字节序列会被解码为替换字符，不会返回错误
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "\uFFFD"), "unknown"
+	}
+	return string(decoded), "gb18030"
+}
+
+func detectShebang(data []byte) string {
+	if !bytes.HasPrefix(data, []byte("#!")) {
+		return ""
+	}
+	line := string(data[2:])
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	// #!/usr/bin/env python3
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	return shebangLanguages[interpreter]
+}
+
+// IsBinary 通过前8KB内容判断是否为二进制文件
+// 出现NUL字节，或者不是合法UTF-8且控制字符占比过高时视为二进制
+func IsBinary(data []byte) bool {
+	if len(data) > 8192 {
+		data = data[:8192]
+	}
+	if len(data) == 0 {
+		return false
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+
+	// 采样末尾可能截断了多字节字符
+	sample := data
+	for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+		sample = sample[:len(sample)-1]
+	}
+	valid := utf8.Valid(sample)
+
+	control := 0
+	for _, b := range data {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\b' && b != 0x1b {
+			control++
+		}
+	}
+
+	if !valid {
+		// 非UTF-8文本（如GBK）控制字符依然很少
+		return control*100 > len(data) || !looksLikeLegacyText(data)
+	}
+	return control*10 > len(data)
+}
+
+// looksLikeLegacyText 粗略判断非UTF-8内容是否为GBK等双字节编码的文本
+func looksLikeLegacyText(data []byte) bool {
+	high := 0
+	for _, b := range data {
+		if b >= 0x80 {
+			high++
+		}
+	}
+	// 高位字节超过七成基本是压缩或加密数据
+	return high*10 < len(data)*7
+}
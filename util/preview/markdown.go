@@ -0,0 +1,28 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM), // 表格、删除线、任务列表、自动链接
+	)
+	policy = bluemonday.UGCPolicy()
+)
+
+// RenderMarkdown 将Markdown渲染为经过清洗的HTML片段
+func RenderMarkdown(data []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(data, &buf); err != nil {
+		return "", fmt.Errorf("渲染Markdown失败: %v", err)
+	}
+
+	// 清洗HTML，去除脚本、事件属性等危险内容
+	return policy.Sanitize(buf.String()), nil
+}
@@ -0,0 +1,200 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Table 表格预览结果
+type Table struct {
+	Delimiter string     `json:"delimiter"`
+	HasHeader bool       `json:"has_header"`
+	Header    []string   `json:"header"`
+	Rows      [][]string `json:"rows"`
+	Page      int        `json:"page"`
+	PageSize  int        `json:"page_size"`
+	TotalRows int        `json:"total_rows"`
+	Encoding  string     `json:"encoding"`  // 原始编码，utf-8或gb18030，内容统一转换为UTF-8返回
+	Truncated bool       `json:"truncated"` // 文件超出预览大小上限时仅解析了前半部分
+}
+
+// 候选分隔符
+var delimiters = []rune{',', '\t', ';', '|'}
+
+// SniffDelimiter 根据前几行内容推断分隔符
+// 选取在各行中出现次数一致且最多的字符
+func SniffDelimiter(data []byte, ext string) rune {
+	if ext == "tsv" {
+		return '\t'
+	}
+
+	lines := sampleLines(data, 10)
+	if len(lines) == 0 {
+		return ','
+	}
+
+	best, bestScore := ',', -1
+	for _, d := range delimiters {
+		first := strings.Count(lines[0], string(d))
+		if first == 0 {
+			continue
+		}
+		// 每一行出现次数都相同的分隔符得分更高
+		consistent := 0
+		for _, line := range lines {
+			if strings.Count(line, string(d)) == first {
+				consistent++
+			}
+		}
+		score := consistent*100 + first
+		if score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+
+	return best
+}
+
+// ParseTable 解析CSV/TSV并分页返回
+// page从1开始，pageSize<=0时使用默认值
+func ParseTable(data []byte, ext string, page, pageSize int, truncated bool) (*Table, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 500 {
+		pageSize = 50
+	}
+
+	// Excel导出的CSV常见GBK编码，先转换为UTF-8再推断分隔符
+	content, encoding := decodeText(data, truncated)
+	data = []byte(content)
+
+	delimiter := SniffDelimiter(data, ext)
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1 // 允许每行列数不同
+	reader.LazyQuotes = true
+
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 截断的文件最后一行可能不完整
+			if truncated {
+				break
+			}
+			return nil, fmt.Errorf("解析表格失败: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	table := &Table{
+		Delimiter: string(delimiter),
+		Page:      page,
+		PageSize:  pageSize,
+		Encoding:  encoding,
+		Truncated: truncated,
+		Rows:      [][]string{},
+	}
+
+	if DetectHeader(records) {
+		table.HasHeader = true
+		table.Header = records[0]
+		records = records[1:]
+	}
+	table.TotalRows = len(records)
+
+	start := (page - 1) * pageSize
+	if start < len(records) {
+		end := start + pageSize
+		if end > len(records) {
+			end = len(records)
+		}
+		table.Rows = records[start:end]
+	}
+
+	return table, nil
+}
+
+// DetectHeader 推断首行是否为表头
+// 首行各列非空、互不重复且不全为数字，并且存在某一列在首行为文本而在数据行中为数字
+func DetectHeader(records [][]string) bool {
+	if len(records) == 0 {
+		return false
+	}
+
+	first := records[0]
+	seen := make(map[string]bool, len(first))
+	for _, cell := range first {
+		cell = strings.TrimSpace(cell)
+		if cell == "" || seen[cell] || isNumeric(cell) {
+			return false
+		}
+		seen[cell] = true
+	}
+
+	// 只有一行时按表头处理
+	if len(records) == 1 {
+		return true
+	}
+
+	// 数据行中存在数字列 -> 首行是表头
+	sample := records[1:]
+	if len(sample) > 20 {
+		sample = sample[:20]
+	}
+	for col := range first {
+		numeric := 0
+		for _, row := range sample {
+			if col < len(row) && isNumeric(strings.TrimSpace(row[col])) {
+				numeric++
+			}
+		}
+		if numeric*2 > len(sample) {
+			return true
+		}
+	}
+
+	// 全文本表格：首行与数据行的列长度特征差异明显时视为表头
+	firstLen, restLen := 0, 0
+	for _, cell := range first {
+		firstLen += len(cell)
+	}
+	for _, row := range sample {
+		for _, cell := range row {
+			restLen += len(cell)
+		}
+	}
+	return firstLen*len(sample) < restLen
+}
+
+func isNumeric(s string) bool {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, ",", ""), "%")
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func sampleLines(data []byte, n int) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) >= n {
+			break
+		}
+	}
+	return lines
+}
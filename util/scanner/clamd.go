@@ -0,0 +1,157 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamd单个INSTREAM数据块大小，需小于clamd的StreamMaxLength
+const clamdChunkSize = 64 * 1024
+
+// ClamdScanner 通过clamd的INSTREAM命令扫描数据流
+// 协议: "zINSTREAM\0" + 若干[4字节大端长度 + 数据] + 4字节0，应答 "stream: OK" / "stream: <签名> FOUND" / "... ERROR"
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamdScanner(addr string, timeout time.Duration) *ClamdScanner {
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	network, address := "tcp", addr
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		network, address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		address = strings.TrimPrefix(addr, "tcp://")
+	}
+
+	return &ClamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (s *ClamdScanner) Name() string {
+	return "clamd(" + s.network + "://" + s.address + ")"
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("连接clamd失败: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("发送INSTREAM命令失败: %v", err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return nil, fmt.Errorf("发送数据失败: %v", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				// 超过StreamMaxLength时clamd会提前返回错误并关闭连接
+				return nil, s.readError(conn, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("读取待扫描数据失败: %v", readErr)
+		}
+	}
+
+	// 结束标记
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, fmt.Errorf("发送数据失败: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return nil, fmt.Errorf("读取clamd应答失败: %v", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// readError 写入失败时尝试读取clamd给出的原因
+func (s *ClamdScanner) readError(conn net.Conn, writeErr error) error {
+	reply, _ := bufio.NewReader(conn).ReadString(0)
+	reply = strings.TrimRight(reply, "\x00\n")
+	if reply != "" {
+		return fmt.Errorf("clamd扫描失败: %s", reply)
+	}
+	return fmt.Errorf("发送数据失败: %v", writeErr)
+}
+
+func parseClamdReply(reply string) (*Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	// 去掉 "stream: " 前缀
+	if i := strings.Index(reply, ": "); i >= 0 {
+		reply = reply[i+2:]
+	}
+
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{
+			Infected:  true,
+			Signature: strings.TrimSuffix(reply, " FOUND"),
+		}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return nil, fmt.Errorf("clamd扫描失败: %s", strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return nil, fmt.Errorf("无法识别的clamd应答: %q", reply)
+	}
+}
+
+// Ping 检查clamd是否可用
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("连接clamd失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("发送PING失败: %v", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("读取clamd应答失败: %v", err)
+	}
+	if !bytes.Equal(bytes.TrimRight([]byte(reply), "\x00\n"), []byte("PONG")) {
+		return fmt.Errorf("clamd应答异常: %q", reply)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// 扫描结果状态，保存在 model.File.ScanStatus
+const (
+	StatusClean    = "clean"    // 未发现威胁
+	StatusInfected = "infected" // 发现威胁，文件被隔离
+	StatusError    = "error"    // 扫描失败（扫描服务不可用等），文件仍可访问
+	StatusSkipped  = "skipped"  // 未配置扫描服务
+	StatusReleased = "released" // 管理员复核后解除隔离
+)
+
+// Result 扫描结果
+type Result struct {
+	Infected  bool
+	Signature string // 命中的病毒/策略名称
+}
+
+// Scanner 上传内容扫描
+// 上传或分片合并完成、写入存储之前调用，返回Infected的文件会被隔离
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+	// Name 扫描器名称，用于日志
+	Name() string
+}
+
+// NewScanner 根据配置创建扫描器，addr为空时返回不做任何检查的NoopScanner
+// addr 形如 "127.0.0.1:3310"、"tcp://127.0.0.1:3310" 或 "unix:///var/run/clamav/clamd.ctl"
+func NewScanner(addr string, timeout time.Duration) Scanner {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return NoopScanner{}
+	}
+	return NewClamdScanner(addr, timeout)
+}
+
+// NoopScanner 默认扫描器，不做任何检查
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	return &Result{}, nil
+}
+
+func (NoopScanner) Name() string {
+	return "noop"
+}
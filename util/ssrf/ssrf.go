@@ -0,0 +1,135 @@
+// Package ssrf 服务端代用户请求外部URL（离线下载等）时的SSRF防护
+// 只允许http/https，禁止访问回环、内网、链路本地等非公网地址；
+// 检查在建立连接时对解析后的IP进行，重定向与DNS重绑定同样受约束
+package ssrf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("只支持http/https链接")
+	ErrForbiddenAddress  = errors.New("不允许访问内网地址")
+)
+
+const maxRedirects = 5
+
+// 标准库未覆盖的保留地址段
+var reservedNets = mustParseCIDRs(
+	"0.0.0.0/8",       // 本网络
+	"100.64.0.0/10",   // 运营商级NAT
+	"192.0.0.0/24",    // IETF协议分配
+	"192.0.2.0/24",    // 文档用 TEST-NET-1
+	"198.18.0.0/15",   // 基准测试
+	"198.51.100.0/24", // 文档用 TEST-NET-2
+	"203.0.113.0/24",  // 文档用 TEST-NET-3
+	"240.0.0.0/4",     // 保留
+	"64:ff9b::/96",    // NAT64，可映射到内网IPv4
+	"2001:db8::/32",   // 文档用
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// IsPublicIP 是否为可以访问的公网地址
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL 校验协议并解析域名，任一解析结果为非公网地址时拒绝
+// 连接时会再次检查，这里只是为了提交时尽早报错
+func CheckURL(ctx context.Context, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("链接格式错误: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrUnsupportedScheme
+	}
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("链接缺少主机名")
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("解析域名失败: %v", err)
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return nil, fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+		}
+	}
+	return u, nil
+}
+
+// NewClient 只能访问公网地址的http客户端
+// 不使用环境变量中的代理，否则检查的是代理地址而不是目标地址
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// 域名解析完成后、建立连接前检查实际要连接的IP
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("重定向次数过多")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrUnsupportedScheme
+			}
+			return nil
+		},
+	}
+}
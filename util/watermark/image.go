@@ -0,0 +1,94 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"sync"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels 解码后每个像素占4字节，限制像素数避免占用过多内存
+const maxPixels = 40_000_000
+
+var boldFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(gobold.TTF)
+})
+
+// Image 在图片上平铺半透明的水印文字，返回新的图片与其MIME类型
+// jpeg仍编码为jpeg，其余格式统一编码为png（动图只保留第一帧）
+func Image(data []byte, text string) ([]byte, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+
+	if err := stampImage(dst, asciiText(text)); err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+// stampImage 按图片宽度选择字号，错行平铺，文字带阴影以便在浅色与深色背景上都能看清
+func stampImage(dst *image.RGBA, text string) error {
+	f, err := boldFont()
+	if err != nil {
+		return err
+	}
+	bounds := dst.Bounds()
+	size := float64(max(bounds.Dx(), bounds.Dy())) / 40
+	size = max(size, 12)
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	shadow := &font.Drawer{Dst: dst, Src: image.NewUniform(color.NRGBA{0, 0, 0, 110}), Face: face}
+	fill := &font.Drawer{Dst: dst, Src: image.NewUniform(color.NRGBA{255, 255, 255, 150}), Face: face}
+
+	textWidth := fill.MeasureString(text).Ceil()
+	stepX := textWidth + int(size*3)
+	stepY := int(size * 5)
+	offset := max(int(size/12), 1)
+
+	for row, y := 0, bounds.Min.Y+stepY/2; y < bounds.Max.Y+stepY; row, y = row+1, y+stepY {
+		start := bounds.Min.X - (row%2)*stepX/2
+		for x := start; x < bounds.Max.X; x += stepX {
+			shadow.Dot = fixed.P(x+offset, y+offset)
+			shadow.DrawString(text)
+			fill.Dot = fixed.P(x, y)
+			fill.DrawString(text)
+		}
+	}
+	return nil
+}
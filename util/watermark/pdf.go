@@ -0,0 +1,1018 @@
+package watermark
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PDF 为每一页追加一个平铺的半透明水印内容流
+// 完整重写整个文件：按最新的交叉引用写出每个对象（对象流中的对象展开为普通对象），生成新的交叉引用表，
+// 不保留原文件的交叉引用与/Prev链，无法通过截掉追加部分还原出没有水印的文件
+// 加密、结构无法解析或有对象无法读取的PDF返回ErrUnsupported
+func PDF(data []byte, text string) ([]byte, error) {
+	header, ok := pdfHeader(data)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	p, err := parsePDF(data)
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if p.trailer.get("/Encrypt") != nil {
+		return nil, ErrUnsupported
+	}
+	pages, err := p.pages()
+	if err != nil || len(pages) == 0 {
+		return nil, ErrUnsupported
+	}
+	objects, err := p.liveObjects()
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	// 编号按实际存在的对象计算，不使用原trailer中的/Size
+	next := 1
+	for num := range objects {
+		next = max(next, num+1)
+	}
+	alloc := func() int {
+		next++
+		return next - 1
+	}
+
+	fontRef := pdfRef{num: alloc()}
+	objects[fontRef.num] = liveObject{value: pdfRaw("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")}
+	gsRef := pdfRef{num: alloc()}
+	objects[gsRef.num] = liveObject{value: pdfRaw("<< /Type /ExtGState /ca 0.25 /CA 0.25 >>")}
+	saveRef := pdfRef{num: alloc()}
+	objects[saveRef.num] = liveObject{value: newStream([]byte("q\n"))}
+
+	text = escapePDFString(asciiText(text))
+	for _, page := range pages {
+		stampRef := pdfRef{num: alloc()}
+		objects[stampRef.num] = liveObject{value: newStream(stampContent(page.box, text))}
+
+		// 原内容前保存图形状态，水印前恢复，避免原内容的坐标变换影响水印
+		contents := pdfArray{saveRef}
+		switch c := page.dict.get("/Contents").(type) {
+		case pdfRef:
+			if arr, ok := p.resolve(c).(pdfArray); ok {
+				contents = append(contents, arr...)
+			} else {
+				contents = append(contents, c)
+			}
+		case pdfArray:
+			contents = append(contents, c...)
+		}
+		contents = append(contents, stampRef)
+
+		resources := page.resources.clone()
+		resources.set("/Font", p.withEntry(resources.get("/Font"), "/ClaranWMF", fontRef))
+		resources.set("/ExtGState", p.withEntry(resources.get("/ExtGState"), "/ClaranWMGS", gsRef))
+
+		dict := page.dict.clone()
+		dict.set("/Contents", contents)
+		dict.set("/Resources", resources)
+		objects[page.ref.num] = liveObject{gen: page.ref.gen, value: dict}
+	}
+
+	trailer := newDict()
+	trailer.set("/Size", pdfRaw(strconv.Itoa(next)))
+	for _, key := range []string{"/Root", "/Info", "/ID"} {
+		if v := p.trailer.get(key); v != nil {
+			trailer.set(key, v)
+		}
+	}
+
+	w := &pdfWriter{}
+	w.buf.Grow(len(data) + len(pages)*1024)
+	w.buf.Write(header)
+	// 二进制注释，提示传输工具按二进制处理
+	w.buf.WriteString("\n%\xe2\xe3\xcf\xd3\n")
+	nums := make([]int, 0, len(objects))
+	for num := range objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		obj := objects[num]
+		w.object(pdfRef{num: num, gen: obj.gen}, serializeObject(obj.value))
+	}
+	w.xrefTable(trailer)
+	return w.buf.Bytes(), nil
+}
+
+// pdfHeader 返回文件头的版本行，如%PDF-1.7
+func pdfHeader(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, false
+	}
+	end := bytes.IndexAny(data[:min(len(data), 32)], "\r\n")
+	if end < 0 {
+		return nil, false
+	}
+	return data[:end], true
+}
+
+// stampContent 旋转45度平铺水印文字，覆盖整个页面
+func stampContent(box [4]float64, text string) []byte {
+	x0, y0 := min(box[0], box[2]), min(box[1], box[3])
+	x1, y1 := max(box[0], box[2]), max(box[1], box[3])
+	size := max(min(x1-x0, y1-y0)/25, 10)
+	textWidth := float64(len(text)) * size * 0.6
+	stepX := textWidth + size*4
+	stepY := size * 6
+
+	var b bytes.Buffer
+	b.WriteString("Q\nq\n/ClaranWMGS gs\n0.5 0.5 0.5 rg\nBT\n")
+	fmt.Fprintf(&b, "/ClaranWMF %.2f Tf\n", size)
+	for row, y := 0, y0-textWidth*0.7071; y < y1; row, y = row+1, y+stepY {
+		start := x0 - stepX + float64(row%2)*stepX/2
+		for x := start; x < x1; x += stepX {
+			fmt.Fprintf(&b, "0.7071 0.7071 -0.7071 0.7071 %.2f %.2f Tm (%s) Tj\n", x, y, text)
+		}
+	}
+	b.WriteString("ET\nQ\n")
+	return b.Bytes()
+}
+
+func escapePDFString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
+
+//===================================== 对象模型 =====================================
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+// pdfRaw 数字、名称、字符串、布尔值与null，原样保存原文件中的写法
+type pdfRaw string
+
+type pdfArray []any
+
+// pdfDict 保持键的顺序，写回时与原文件一致
+type pdfDict struct {
+	keys []string
+	vals map[string]any
+}
+
+type pdfStream struct {
+	dict *pdfDict
+	data []byte // 未解码的原始数据
+}
+
+func newDict() *pdfDict {
+	return &pdfDict{vals: make(map[string]any)}
+}
+
+func (d *pdfDict) get(key string) any {
+	return d.vals[key]
+}
+
+func (d *pdfDict) set(key string, v any) {
+	if _, ok := d.vals[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.vals[key] = v
+}
+
+func (d *pdfDict) clone() *pdfDict {
+	c := &pdfDict{keys: append([]string(nil), d.keys...), vals: make(map[string]any, len(d.vals))}
+	for k, v := range d.vals {
+		c.vals[k] = v
+	}
+	return c
+}
+
+func serialize(v any) []byte {
+	var b bytes.Buffer
+	writeValue(&b, v)
+	return b.Bytes()
+}
+
+func writeValue(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case pdfRaw:
+		b.WriteString(string(v))
+	case pdfRef:
+		fmt.Fprintf(b, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writeValue(b, item)
+		}
+		b.WriteByte(']')
+	case *pdfDict:
+		b.WriteString("<<")
+		for _, key := range v.keys {
+			b.WriteString(key)
+			b.WriteByte(' ')
+			writeValue(b, v.vals[key])
+			b.WriteByte(' ')
+		}
+		b.WriteString(">>")
+	default:
+		b.WriteString("null")
+	}
+}
+
+//===================================== 词法解析 =====================================
+
+var errPDFSyntax = errors.New("pdf syntax error")
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *lexer) skip() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// token 读取到下一个空白或分隔符为止
+func (l *lexer) token() string {
+	l.skip()
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(s))
+}
+
+func (l *lexer) value(depth int) (any, error) {
+	if depth > 64 {
+		return nil, errPDFSyntax
+	}
+	l.skip()
+	if l.pos >= len(l.data) {
+		return nil, errPDFSyntax
+	}
+
+	start := l.pos
+	switch c := l.data[l.pos]; {
+	case l.hasPrefix("<<"):
+		l.pos += 2
+		dict := newDict()
+		for {
+			l.skip()
+			if l.pos >= len(l.data) {
+				return nil, errPDFSyntax
+			}
+			if l.hasPrefix(">>") {
+				l.pos += 2
+				return dict, nil
+			}
+			if l.data[l.pos] != '/' {
+				return nil, errPDFSyntax
+			}
+			key := l.name()
+			v, err := l.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict.set(key, v)
+		}
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFSyntax
+		}
+		l.pos += end + 1
+		return pdfRaw(l.data[start:l.pos]), nil
+	case c == '(':
+		nest := 0
+		for l.pos < len(l.data) {
+			switch l.data[l.pos] {
+			case '\\':
+				l.pos++
+			case '(':
+				nest++
+			case ')':
+				nest--
+				if nest == 0 {
+					l.pos++
+					return pdfRaw(l.data[start:l.pos]), nil
+				}
+			}
+			l.pos++
+		}
+		return nil, errPDFSyntax
+	case c == '[':
+		l.pos++
+		arr := pdfArray{}
+		for {
+			l.skip()
+			if l.pos >= len(l.data) {
+				return nil, errPDFSyntax
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			v, err := l.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == '/':
+		return pdfRaw(l.name()), nil
+	}
+
+	tok := l.token()
+	if tok == "" {
+		return nil, errPDFSyntax
+	}
+	// 整数后面跟着 "整数 R" 时为间接引用
+	if num, err := strconv.Atoi(tok); err == nil {
+		save := l.pos
+		if gen, err := strconv.Atoi(l.token()); err == nil {
+			l.skip()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' && (l.pos+1 == len(l.data) || isWhite(l.data[l.pos+1]) || isDelim(l.data[l.pos+1])) {
+				l.pos++
+				return pdfRef{num: num, gen: gen}, nil
+			}
+		}
+		l.pos = save
+	}
+	return pdfRaw(tok), nil
+}
+
+// name 读取名称，返回值包含开头的/
+func (l *lexer) name() string {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+//===================================== 文件结构 =====================================
+
+type xrefEntry struct {
+	typ int // 0 空闲，1 位于文件中的偏移，2 位于对象流中
+	a   int // 偏移或对象流的编号
+	b   int // 代数或在对象流中的序号
+}
+
+type pdfFile struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer *pdfDict
+
+	cache   map[int]any
+	loading map[int]bool
+	objStms map[int]map[int]any
+}
+
+func parsePDF(data []byte) (*pdfFile, error) {
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	if idx < 0 {
+		return nil, errPDFSyntax
+	}
+	l := &lexer{data: data, pos: idx + len("startxref")}
+	start, err := strconv.Atoi(l.token())
+	if err != nil || start < 0 || start >= len(data) {
+		return nil, errPDFSyntax
+	}
+
+	p := &pdfFile{
+		data:    data,
+		xref:    make(map[int]xrefEntry),
+		cache:   make(map[int]any),
+		loading: make(map[int]bool),
+		objStms: make(map[int]map[int]any),
+	}
+
+	// 从最新的交叉引用沿/Prev向前读取，较新的条目优先
+	seen := make(map[int]bool)
+	for offset, first := start, true; !seen[offset]; first = false {
+		seen[offset] = true
+		trailer, _, err := p.readXref(offset)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			p.trailer = trailer
+		}
+		if stm, ok := p.intValue(trailer.get("/XRefStm")); ok && !seen[stm] {
+			seen[stm] = true
+			if _, _, err := p.readXref(stm); err != nil {
+				return nil, err
+			}
+		}
+		prev, ok := p.intValue(trailer.get("/Prev"))
+		if !ok || prev < 0 || prev >= len(data) {
+			break
+		}
+		offset = prev
+	}
+	return p, nil
+}
+
+// readXref 读取一段交叉引用表或交叉引用流，返回其trailer
+func (p *pdfFile) readXref(offset int) (*pdfDict, bool, error) {
+	l := &lexer{data: p.data, pos: offset}
+	l.skip()
+	if !l.hasPrefix("xref") {
+		_, v, err := p.parseObjectAt(offset)
+		if err != nil {
+			return nil, false, err
+		}
+		stream, ok := v.(*pdfStream)
+		if !ok || stream.dict.get("/Type") != pdfRaw("/XRef") {
+			return nil, false, errPDFSyntax
+		}
+		return stream.dict, true, p.readXrefStream(stream)
+	}
+
+	l.pos += len("xref")
+	for {
+		l.skip()
+		if l.hasPrefix("trailer") {
+			l.pos += len("trailer")
+			v, err := l.value(0)
+			if err != nil {
+				return nil, false, err
+			}
+			trailer, ok := v.(*pdfDict)
+			if !ok {
+				return nil, false, errPDFSyntax
+			}
+			return trailer, false, nil
+		}
+		first, err1 := strconv.Atoi(l.token())
+		count, err2 := strconv.Atoi(l.token())
+		if err1 != nil || err2 != nil || count < 0 {
+			return nil, false, errPDFSyntax
+		}
+		for i := 0; i < count; i++ {
+			off, err1 := strconv.Atoi(l.token())
+			gen, err2 := strconv.Atoi(l.token())
+			kind := l.token()
+			if err1 != nil || err2 != nil || (kind != "n" && kind != "f") {
+				return nil, false, errPDFSyntax
+			}
+			if _, ok := p.xref[first+i]; ok {
+				continue
+			}
+			if kind == "n" {
+				p.xref[first+i] = xrefEntry{typ: 1, a: off, b: gen}
+			} else {
+				p.xref[first+i] = xrefEntry{typ: 0}
+			}
+		}
+	}
+}
+
+func (p *pdfFile) readXrefStream(stream *pdfStream) error {
+	data, err := p.decode(stream)
+	if err != nil {
+		return err
+	}
+	widths, ok := p.resolve(stream.dict.get("/W")).(pdfArray)
+	if !ok || len(widths) != 3 {
+		return errPDFSyntax
+	}
+	var w [3]int
+	for i := range w {
+		if w[i], ok = p.intValue(widths[i]); !ok || w[i] < 0 || w[i] > 8 {
+			return errPDFSyntax
+		}
+	}
+	size, _ := p.intValue(stream.dict.get("/Size"))
+	index := pdfArray{pdfRaw("0"), pdfRaw(strconv.Itoa(size))}
+	if arr, ok := p.resolve(stream.dict.get("/Index")).(pdfArray); ok {
+		index = arr
+	}
+
+	field := func(b []byte, typeField bool) int {
+		if len(b) == 0 && typeField {
+			return 1 // 类型字段宽度为0时默认为1
+		}
+		n := 0
+		for _, c := range b {
+			n = n<<8 | int(c)
+		}
+		return n
+	}
+
+	entryLen := w[0] + w[1] + w[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		first, ok1 := p.intValue(index[i])
+		count, ok2 := p.intValue(index[i+1])
+		if !ok1 || !ok2 {
+			return errPDFSyntax
+		}
+		for j := 0; j < count; j++ {
+			if pos+entryLen > len(data) {
+				return errPDFSyntax
+			}
+			row := data[pos : pos+entryLen]
+			pos += entryLen
+			if _, ok := p.xref[first+j]; ok {
+				continue
+			}
+			p.xref[first+j] = xrefEntry{
+				typ: field(row[:w[0]], true),
+				a:   field(row[w[0]:w[0]+w[1]], false),
+				b:   field(row[w[0]+w[1]:], false),
+			}
+		}
+	}
+	return nil
+}
+
+// parseObjectAt 解析 "编号 代数 obj" 开始的对象，流对象返回*pdfStream
+func (p *pdfFile) parseObjectAt(offset int) (int, any, error) {
+	l := &lexer{data: p.data, pos: offset}
+	num, err := strconv.Atoi(l.token())
+	if err != nil {
+		return 0, nil, errPDFSyntax
+	}
+	if _, err := strconv.Atoi(l.token()); err != nil {
+		return 0, nil, errPDFSyntax
+	}
+	if l.token() != "obj" {
+		return 0, nil, errPDFSyntax
+	}
+	v, err := l.value(0)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dict, ok := v.(*pdfDict)
+	if !ok {
+		return num, v, nil
+	}
+	l.skip()
+	if !l.hasPrefix("stream") {
+		return num, v, nil
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	length, ok := p.intValue(dict.get("/Length"))
+	if !ok || length < 0 || l.pos+length > len(l.data) {
+		// 长度缺失或错误时以endstream为准
+		end := bytes.Index(l.data[l.pos:], []byte("endstream"))
+		if end < 0 {
+			return 0, nil, errPDFSyntax
+		}
+		length = len(bytes.TrimRight(l.data[l.pos:l.pos+end], "\r\n"))
+	}
+	return num, &pdfStream{dict: dict, data: l.data[l.pos : l.pos+length]}, nil
+}
+
+// object 按编号读取对象，不存在的对象按规范视为null
+func (p *pdfFile) object(num int) any {
+	if v, ok := p.cache[num]; ok {
+		return v
+	}
+	if p.loading[num] {
+		return nil
+	}
+	p.loading[num] = true
+	defer delete(p.loading, num)
+
+	var v any
+	switch e := p.xref[num]; e.typ {
+	case 1:
+		if _, obj, err := p.parseObjectAt(e.a); err == nil {
+			v = obj
+		}
+	case 2:
+		v = p.objStmObject(e.a, num)
+	}
+	p.cache[num] = v
+	return v
+}
+
+// objStmObject 从对象流中读取对象
+func (p *pdfFile) objStmObject(stmNum, num int) any {
+	objects, ok := p.objStms[stmNum]
+	if !ok {
+		objects = make(map[int]any)
+		p.objStms[stmNum] = objects
+
+		stream, ok := p.object(stmNum).(*pdfStream)
+		if !ok {
+			return nil
+		}
+		data, err := p.decode(stream)
+		if err != nil {
+			return nil
+		}
+		n, ok1 := p.intValue(stream.dict.get("/N"))
+		first, ok2 := p.intValue(stream.dict.get("/First"))
+		if !ok1 || !ok2 || first > len(data) {
+			return nil
+		}
+		header := &lexer{data: data[:first]}
+		for i := 0; i < n; i++ {
+			objNum, err1 := strconv.Atoi(header.token())
+			off, err2 := strconv.Atoi(header.token())
+			if err1 != nil || err2 != nil || first+off > len(data) {
+				break
+			}
+			l := &lexer{data: data, pos: first + off}
+			if v, err := l.value(0); err == nil {
+				objects[objNum] = v
+			}
+		}
+	}
+	return objects[num]
+}
+
+func (p *pdfFile) resolve(v any) any {
+	if ref, ok := v.(pdfRef); ok {
+		return p.object(ref.num)
+	}
+	return v
+}
+
+func (p *pdfFile) intValue(v any) (int, bool) {
+	raw, ok := p.resolve(v).(pdfRaw)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(raw))
+	return n, err == nil
+}
+
+func (p *pdfFile) floatValue(v any) (float64, bool) {
+	raw, ok := p.resolve(v).(pdfRaw)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	return f, err == nil
+}
+
+// withEntry 在资源子字典（如/Font）的副本中加入一项
+func (p *pdfFile) withEntry(v any, key string, ref pdfRef) *pdfDict {
+	dict, ok := p.resolve(v).(*pdfDict)
+	if !ok {
+		dict = newDict()
+	}
+	dict = dict.clone()
+	dict.set(key, ref)
+	return dict
+}
+
+//===================================== 流解码 =====================================
+
+// decode 解码流数据，只支持不压缩与FlateDecode（含PNG预测器）
+func (p *pdfFile) decode(stream *pdfStream) ([]byte, error) {
+	filter := p.resolve(stream.dict.get("/Filter"))
+	parms := p.resolve(stream.dict.get("/DecodeParms"))
+	if arr, ok := filter.(pdfArray); ok {
+		if len(arr) > 1 {
+			return nil, ErrUnsupported
+		}
+		filter = nil
+		if len(arr) == 1 {
+			filter = p.resolve(arr[0])
+		}
+		if parmsArr, ok := parms.(pdfArray); ok && len(parmsArr) > 0 {
+			parms = p.resolve(parmsArr[0])
+		}
+	}
+
+	switch filter {
+	case nil:
+		return stream.data, nil
+	case pdfRaw("/FlateDecode"):
+	default:
+		return nil, ErrUnsupported
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(stream.data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize*4))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	dict, ok := parms.(*pdfDict)
+	if !ok {
+		return data, nil
+	}
+	predictor, _ := p.intValue(dict.get("/Predictor"))
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, ErrUnsupported
+		}
+		return data, nil
+	}
+	columns, ok := p.intValue(dict.get("/Columns"))
+	if !ok || columns <= 0 {
+		columns = 1
+	}
+	colors, ok := p.intValue(dict.get("/Colors"))
+	if !ok || colors <= 0 {
+		colors = 1
+	}
+	bits, ok := p.intValue(dict.get("/BitsPerComponent"))
+	if !ok || bits <= 0 {
+		bits = 8
+	}
+	return unpredictPNG(data, (columns*colors*bits+7)/8, max((colors*bits+7)/8, 1))
+}
+
+// unpredictPNG 还原PNG预测器，每行以一个字节的过滤类型开头
+func unpredictPNG(data []byte, rowLen, bpp int) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, errPDFSyntax
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	pa := abs(int(b) - int(c))
+	pb := abs(int(a) - int(c))
+	pc := abs(int(a) + int(b) - 2*int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+//===================================== 页面 =====================================
+
+type pdfPage struct {
+	ref       pdfRef
+	dict      *pdfDict
+	resources *pdfDict // 本页或继承自上级的资源
+	box       [4]float64
+}
+
+// pages 按页面树的顺序返回所有页面，资源与页面大小按规范从上级节点继承
+func (p *pdfFile) pages() ([]*pdfPage, error) {
+	root, ok := p.resolve(p.trailer.get("/Root")).(*pdfDict)
+	if !ok {
+		return nil, errPDFSyntax
+	}
+	treeRef, ok := root.get("/Pages").(pdfRef)
+	if !ok {
+		return nil, errPDFSyntax
+	}
+
+	var pages []*pdfPage
+	visited := make(map[int]bool)
+	var walk func(ref pdfRef, resources, box any, depth int) error
+	walk = func(ref pdfRef, resources, box any, depth int) error {
+		if visited[ref.num] || depth > 64 {
+			return errPDFSyntax
+		}
+		visited[ref.num] = true
+		node, ok := p.resolve(ref).(*pdfDict)
+		if !ok {
+			return errPDFSyntax
+		}
+		if v := node.get("/Resources"); v != nil {
+			resources = v
+		}
+		if v := node.get("/MediaBox"); v != nil {
+			box = v
+		}
+
+		kids := node.get("/Kids")
+		if node.get("/Type") == pdfRaw("/Pages") || (node.get("/Type") == nil && kids != nil) {
+			arr, _ := p.resolve(kids).(pdfArray)
+			for _, kid := range arr {
+				kidRef, ok := kid.(pdfRef)
+				if !ok {
+					return errPDFSyntax
+				}
+				if err := walk(kidRef, resources, box, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		page := &pdfPage{ref: ref, dict: node, box: [4]float64{0, 0, 612, 792}}
+		if dict, ok := p.resolve(resources).(*pdfDict); ok {
+			page.resources = dict
+		} else {
+			page.resources = newDict()
+		}
+		if arr, ok := p.resolve(box).(pdfArray); ok && len(arr) == 4 {
+			var b [4]float64
+			valid := true
+			for i := range b {
+				if b[i], ok = p.floatValue(arr[i]); !ok {
+					valid = false
+				}
+			}
+			if valid {
+				page.box = b
+			}
+		}
+		pages = append(pages, page)
+		return nil
+	}
+
+	if err := walk(treeRef, nil, nil, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+//===================================== 写入 =====================================
+
+// liveObject 重写时写出的对象
+type liveObject struct {
+	gen   int
+	value any
+}
+
+// liveObjects 读取最新交叉引用中的所有对象，交叉引用流、对象流与线性化参数不再写出
+// 有对象无法读取时返回错误，避免写出缺少对象的文件
+func (p *pdfFile) liveObjects() (map[int]liveObject, error) {
+	objects := make(map[int]liveObject, len(p.xref))
+	for num, e := range p.xref {
+		if num == 0 {
+			continue
+		}
+		var v any
+		gen := 0
+		switch e.typ {
+		case 1:
+			_, obj, err := p.parseObjectAt(e.a)
+			if err != nil {
+				return nil, err
+			}
+			v, gen = obj, e.b
+		case 2:
+			v = p.objStmObject(e.a, num)
+			if v == nil {
+				return nil, errPDFSyntax
+			}
+		default:
+			continue
+		}
+
+		switch obj := v.(type) {
+		case *pdfStream:
+			if t := obj.dict.get("/Type"); t == pdfRaw("/XRef") || t == pdfRaw("/ObjStm") {
+				continue
+			}
+		case *pdfDict:
+			// 重写后线性化参数中的偏移全部失效
+			if obj.get("/Linearized") != nil {
+				continue
+			}
+		}
+		objects[num] = liveObject{gen: gen, value: v}
+	}
+	return objects, nil
+}
+
+func newStream(data []byte) *pdfStream {
+	return &pdfStream{dict: newDict(), data: data}
+}
+
+// serializeObject 流对象按实际数据长度重写/Length，原数据不解码直接写出
+func serializeObject(v any) []byte {
+	stream, ok := v.(*pdfStream)
+	if !ok {
+		return serialize(v)
+	}
+	dict := stream.dict.clone()
+	dict.set("/Length", pdfRaw(strconv.Itoa(len(stream.data))))
+	body := serialize(dict)
+	body = append(body, "\nstream\n"...)
+	body = append(body, stream.data...)
+	return append(body, "\nendstream"...)
+}
+
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]writtenObject
+}
+
+type writtenObject struct {
+	gen    int
+	offset int
+}
+
+func (w *pdfWriter) object(ref pdfRef, body []byte) {
+	if w.offsets == nil {
+		w.offsets = make(map[int]writtenObject)
+	}
+	w.offsets[ref.num] = writtenObject{gen: ref.gen, offset: w.buf.Len()}
+	fmt.Fprintf(&w.buf, "%d %d obj\n", ref.num, ref.gen)
+	w.buf.Write(body)
+	w.buf.WriteString("\nendobj\n")
+}
+
+// xrefTable 写出新的交叉引用表，连续编号的对象为一段，没有写出的编号不出现在表中
+func (w *pdfWriter) xrefTable(trailer *pdfDict) {
+	nums := make([]int, 0, len(w.offsets))
+	for num := range w.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	offset := w.buf.Len()
+	w.buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for i := 0; i < len(nums); {
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(&w.buf, "%d %d\n", nums[i], j-i)
+		for _, num := range nums[i:j] {
+			e := w.offsets[num]
+			fmt.Fprintf(&w.buf, "%010d %05d n \n", e.offset, e.gen)
+		}
+		i = j
+	}
+	w.buf.WriteString("trailer\n")
+	w.buf.Write(serialize(trailer))
+	fmt.Fprintf(&w.buf, "\nstartxref\n%d\n%%%%EOF\n", offset)
+}
@@ -0,0 +1,69 @@
+package watermark
+
+import (
+	"ClaranCloudDisk/util/filetype"
+	"errors"
+	"strings"
+)
+
+// 可以添加水印的文件类别
+const (
+	KindImage = "image"
+	KindPDF   = "pdf"
+)
+
+// MaxSize 添加水印时需要把整个文件读入内存，超过该大小的文件不处理
+const MaxSize = 64 << 20
+
+var (
+	ErrTooLarge    = errors.New("文件过大，无法添加水印")
+	ErrUnsupported = errors.New("无法为该文件添加水印")
+)
+
+var imageMIMEs = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/bmp":  true,
+	"image/webp": true,
+	"image/tiff": true,
+}
+
+var imageExts = map[string]bool{
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "bmp": true, "webp": true, "tif": true, "tiff": true,
+}
+
+// KindOf 按识别出的类型（未识别过的历史文件按扩展名）判断能否添加水印，不能时返回空字符串
+func KindOf(detectedMime, ext string) string {
+	if detectedMime != "" {
+		base := filetype.BaseMIME(detectedMime)
+		switch {
+		case imageMIMEs[base]:
+			return KindImage
+		case base == "application/pdf":
+			return KindPDF
+		}
+		return ""
+	}
+
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	switch {
+	case imageExts[ext]:
+		return KindImage
+	case ext == "pdf":
+		return KindPDF
+	}
+	return ""
+}
+
+// asciiText 内置字体只包含拉丁字符，其余字符替换为?
+func asciiText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}